@@ -34,17 +34,13 @@ func main() {
 	}
 
 	// 加载配置
-	cfg, err := config.LoadAgentConfig(*configFile)
+	cfg, err := loadConfig()
 	if err != nil {
 		logrus.WithError(err).Fatal("加载配置失败")
 	}
 
-	// 调试模式覆盖配置
-	if *debug {
-		cfg.Log.Level = "debug"
-	}
-
 	// 创建eBPF Agent
+	agent.Version = AppVersion
 	ebpfAgent, err := agent.NewEBPFAgent(cfg)
 	if err != nil {
 		logrus.WithError(err).Fatal("创建eBPF Agent失败")
@@ -65,6 +61,11 @@ func main() {
 		logrus.WithError(err).Fatal("启动eBPF Agent失败")
 	}
 
+	// 启用配置热加载（文件变更或SIGHUP）
+	if err := ebpfAgent.EnableConfigReload(*configFile, loadConfig); err != nil {
+		logrus.WithError(err).Warn("启用配置热加载失败")
+	}
+
 	// 等待信号
 	sig := <-sigChan
 	logrus.WithField("signal", sig).Info("收到停止信号")
@@ -76,3 +77,18 @@ func main() {
 
 	logrus.Info("eBPF网络监控代理已退出")
 }
+
+// loadConfig 加载配置并应用命令行覆盖
+func loadConfig() (*config.AgentConfig, error) {
+	cfg, err := config.LoadAgentConfig(*configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// 调试模式覆盖配置
+	if *debug {
+		cfg.Log.Level = "debug"
+	}
+
+	return cfg, nil
+}
@@ -26,7 +26,7 @@ func main() {
 		RunE:  runServer,
 	}
 
-	rootCmd.Flags().StringVarP(&configPath, "config", "c", "configs/server.yaml", "配置文件路径")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "configs/server.yaml", "配置文件路径")
 	rootCmd.Flags().BoolVarP(&debugMode, "debug", "d", false, "启用debug模式")
 
 	// 添加--version标志支持
@@ -57,7 +57,7 @@ func main() {
 		},
 	}
 
-	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(versionCmd, newTokenCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
@@ -67,16 +67,12 @@ func main() {
 
 func runServer(cmd *cobra.Command, args []string) error {
 	// 加载配置
-	cfg, err := config.SimpleLoadServerConfig(configPath)
+	cfg, err := loadServerConfig()
 	if err != nil {
 		return fmt.Errorf("加载配置失败: %w", err)
 	}
 
-	// 如果命令行指定了debug模式，覆盖配置文件设置
 	if debugMode {
-		cfg.HTTP.Debug = true
-		cfg.Log.Level = "debug"
-		cfg.Log.Format = "text" // debug模式使用text格式更易读
 		fmt.Println("Server Debug模式已启用")
 	}
 
@@ -86,6 +82,28 @@ func runServer(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("创建Server失败: %w", err)
 	}
 
+	// 启用配置热加载（文件变更或SIGHUP）
+	if err := server.EnableConfigReload(configPath, loadServerConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "启用配置热加载失败: %v\n", err)
+	}
+
 	// 运行Server
 	return server.Run()
 }
+
+// loadServerConfig 加载配置并应用命令行覆盖
+func loadServerConfig() (*config.ServerAppConfig, error) {
+	cfg, err := config.SimpleLoadServerConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 如果命令行指定了debug模式，覆盖配置文件设置
+	if debugMode {
+		cfg.HTTP.Debug = true
+		cfg.Log.Level = "debug"
+		cfg.Log.Format = "text" // debug模式使用text格式更易读
+	}
+
+	return cfg, nil
+}
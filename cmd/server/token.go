@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-net-monitoring/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// newTokenCmd API令牌管理命令，直接读写配置中的存储（运行中的Server在未命中或30秒内同步）
+// 与运行中的Server共享时需要Redis存储，文件存储只能在Server停止时使用
+func newTokenCmd() *cobra.Command {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "管理带角色的API令牌（ingest、read、admin）",
+		// 参数正确时的执行错误不需要打印用法
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.SilenceUsage = true
+		},
+	}
+
+	var (
+		name   string
+		roles  []string
+		agents []string
+		ttl    time.Duration
+	)
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "创建API令牌，令牌只显示一次",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, err := openTokenStorage()
+			if err != nil {
+				return err
+			}
+			defer storage.Close()
+
+			secret, token, err := server.CreateAPIToken(storage, name, roles, agents, ttl)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("ID:    %s\n", token.ID)
+			fmt.Printf("名称:  %s\n", token.Name)
+			fmt.Printf("角色:  %s\n", strings.Join(token.Roles, ","))
+			fmt.Printf("Agent: %s\n", formatAgents(token.Agents))
+			fmt.Printf("过期:  %s\n", formatExpiry(token.ExpiresAt))
+			fmt.Printf("令牌:  %s\n", secret)
+			fmt.Fprintln(os.Stderr, "请妥善保存令牌，它不会再次显示")
+			return nil
+		},
+	}
+	createCmd.Flags().StringVar(&name, "name", "", "令牌名称（用途说明）")
+	createCmd.Flags().StringSliceVar(&roles, "role", nil, "角色，可重复或用逗号分隔: ingest, read, admin")
+	createCmd.Flags().StringSliceVar(&agents, "agent", nil, "ingest角色可以上报的Agent ID，支持通配符（如 web-*），可重复或用逗号分隔，不指定表示不限制")
+	createCmd.Flags().DurationVar(&ttl, "ttl", 0, "有效期，如 720h，0表示不过期")
+	createCmd.MarkFlagRequired("name")
+	createCmd.MarkFlagRequired("role")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "列出API令牌",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, err := openTokenStorage()
+			if err != nil {
+				return err
+			}
+			defer storage.Close()
+
+			tokens, err := server.ListAPITokens(storage)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tROLES\tAGENTS\tCREATED\tEXPIRES")
+			now := time.Now()
+			for _, token := range tokens {
+				expires := formatExpiry(token.ExpiresAt)
+				if token.Expired(now) {
+					expires += " (已过期)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, strings.Join(token.Roles, ","),
+					formatAgents(token.Agents), token.CreatedAt.Format(time.RFC3339), expires)
+			}
+			return w.Flush()
+		},
+	}
+
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "吊销API令牌",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, err := openTokenStorage()
+			if err != nil {
+				return err
+			}
+			defer storage.Close()
+
+			revoked, err := server.RevokeAPIToken(storage, args[0])
+			if err != nil {
+				return err
+			}
+			if !revoked {
+				return fmt.Errorf("令牌不存在: %s", args[0])
+			}
+			fmt.Printf("已吊销令牌 %s\n", args[0])
+			return nil
+		},
+	}
+
+	tokenCmd.AddCommand(createCmd, listCmd, revokeCmd)
+	return tokenCmd
+}
+
+// openTokenStorage 按配置打开存储
+// 内存存储无法与运行中的Server共享；文件存储在Server运行时被独占锁定，只能在Server停止时使用
+func openTokenStorage() (server.Storage, error) {
+	cfg, err := loadServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %w", err)
+	}
+	if strings.ToLower(cfg.Storage.Type) == "memory" {
+		return nil, fmt.Errorf("存储类型为memory，令牌无法与运行中的Server共享；请使用Redis存储，或通过 /api/v1/admin/tokens 接口管理令牌")
+	}
+
+	storage, err := server.NewStorage(&cfg.Storage)
+	if errors.Is(err, server.ErrStorageLocked) {
+		return nil, fmt.Errorf("存储文件 %s 被运行中的Server锁定；请通过 /api/v1/admin/tokens 接口管理令牌，或停止Server后再执行", cfg.Storage.File.Path)
+	}
+	return storage, err
+}
+
+// formatExpiry 格式化过期时间
+func formatExpiry(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return "永不"
+	}
+	return expiresAt.Format(time.RFC3339)
+}
+
+// formatAgents 格式化令牌限定的Agent模式
+func formatAgents(agents []string) string {
+	if len(agents) == 0 {
+		return "全部"
+	}
+	return strings.Join(agents, ",")
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minCommandInterval 通过命令设置的最小上报间隔
+const minCommandInterval = time.Second
+
+// handleCommand 处理Server通过gRPC流下发的命令
+// 命令修改的是运行时配置，配置文件重新加载后以配置文件为准
+func (a *EBPFAgent) handleCommand(cmdType string, args map[string]string) error {
+	switch cmdType {
+	case "set_report_interval":
+		interval, err := time.ParseDuration(args["interval"])
+		if err != nil {
+			return fmt.Errorf("无效的上报间隔: %q", args["interval"])
+		}
+		if interval < minCommandInterval {
+			return fmt.Errorf("上报间隔不能小于 %s", minCommandInterval)
+		}
+
+		a.mutex.Lock()
+		a.config.Monitor.ReportInterval = interval
+		hash := configHash(a.config)
+		a.mutex.Unlock()
+
+		a.reporter.UpdateReportInfo(interval, hash)
+		a.pushInterval(interval)
+		a.logger.WithField("interval", interval).Info("Server命令：上报间隔已更新")
+		return nil
+
+	case "set_log_level":
+		level, err := logrus.ParseLevel(args["level"])
+		if err != nil {
+			return fmt.Errorf("无效的日志级别: %q", args["level"])
+		}
+
+		a.mutex.Lock()
+		a.config.Log.Level = args["level"]
+		a.mutex.Unlock()
+
+		a.logger.SetLevel(level)
+		a.logger.WithField("level", level).Info("Server命令：日志级别已更新")
+		return nil
+
+	default:
+		return fmt.Errorf("不支持的命令: %s", cmdType)
+	}
+}
@@ -2,7 +2,11 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
@@ -11,26 +15,47 @@ import (
 	"go-net-monitoring/internal/common"
 	"go-net-monitoring/internal/config"
 	"go-net-monitoring/pkg/ebpf/loader"
+	ebpfmetrics "go-net-monitoring/pkg/ebpf/metrics"
+	"go-net-monitoring/pkg/network"
 	"go-net-monitoring/pkg/reporter"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Version Agent版本号，由main包在创建Agent前设置
+var Version = "dev"
+
 // EBPFAgent eBPF网络监控代理
 type EBPFAgent struct {
-	config     *config.AgentConfig
-	logger     *logrus.Logger
-	xdpLoader  *loader.XDPLoader
-	reporter   *reporter.Reporter
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-	startTime  time.Time
-	
+	config      *config.AgentConfig
+	logger      *logrus.Logger
+	xdpLoader   *loader.XDPLoader
+	reporter    *reporter.Reporter
+	persistence *PersistenceManager
+	exporter    *ebpfmetrics.EBPFMetricsExporter
+	httpServer  *http.Server
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	startTime   time.Time
+	// 累计计数起始时间（启用持久化时从状态文件恢复）
+	startupTime time.Time
+
+	// 采集模式（ebpf/simulation）和已加载的eBPF程序路径
+	collectorMode string
+	programPath   string
+
+	// 网卡和主机信息，随心跳上报
+	interfaces *network.InterfaceManager
+
+	// 配置热加载
+	configWatcher *config.Watcher
+	intervalChan  chan time.Duration
+
 	// 统计数据
-	lastStats  *loader.PacketStats
-	metrics    common.NetworkMetrics
-	mutex      sync.RWMutex
+	lastStats *loader.PacketStats
+	metrics   common.NetworkMetrics
+	mutex     sync.RWMutex
 }
 
 // NewEBPFAgent 创建新的eBPF Agent
@@ -53,15 +78,27 @@ func NewEBPFAgent(cfg *config.AgentConfig) (*EBPFAgent, error) {
 		return nil, fmt.Errorf("创建Reporter失败: %w", err)
 	}
 
+	// 创建持久化管理器（未启用时状态文件为空，管理器处于禁用状态）
+	stateFile := ""
+	if cfg.Persistence.Enabled {
+		stateFile = cfg.Persistence.StateFile
+	}
+	persistence := NewPersistenceManager(stateFile, cfg.Persistence.SaveInterval,
+		cfg.Persistence.BackupCount, rep.GetAgentID(), logger)
+
 	agent := &EBPFAgent{
-		config:    cfg,
-		logger:    logger,
-		xdpLoader: xdpLoader,
-		reporter:  rep,
-		ctx:       ctx,
-		cancel:    cancel,
-		startTime: time.Now(),
-		metrics:   common.NetworkMetrics{
+		config:       cfg,
+		logger:       logger,
+		xdpLoader:    xdpLoader,
+		reporter:     rep,
+		persistence:  persistence,
+		exporter:     ebpfmetrics.NewEBPFMetricsExporter(cfg.Monitor.Interface, logger),
+		interfaces:   network.NewInterfaceManager(logger),
+		ctx:          ctx,
+		cancel:       cancel,
+		startTime:    time.Now(),
+		intervalChan: make(chan time.Duration, 1),
+		metrics: common.NetworkMetrics{
 			DomainsAccessed: make(map[string]uint64),
 			IPsAccessed:     make(map[string]uint64),
 			ProtocolStats:   make(map[string]uint64),
@@ -70,10 +107,74 @@ func NewEBPFAgent(cfg *config.AgentConfig) (*EBPFAgent, error) {
 			Interface:       cfg.Monitor.Interface,
 		},
 	}
+	agent.startupTime = agent.startTime
+	agent.exporter.RegisterReporterStats(rep.GetStats)
+	rep.SetCommandHandler(agent.handleCommand)
+	rep.SetHeartbeatInfo(agent.heartbeatInfo)
+
+	// 恢复持久化状态
+	if persistence.IsEnabled() {
+		agent.restoreState()
+	}
+	// 恢复的计数作为增量基准，首个增量报告不再重复发送
+	if persistence.IsRestored() {
+		rep.SetBaseline(agent.startupTime, agent.snapshotMetrics(cfg.Monitor.Filters))
+	}
+
+	// 设置MetricsReport元数据
+	rep.SetReportInfo(reporter.ReportInfo{
+		Version:            Version,
+		StartupTime:        agent.startupTime,
+		ReportInterval:     cfg.Monitor.ReportInterval,
+		ConfigHash:         configHash(cfg),
+		PersistenceEnabled: persistence.IsEnabled(),
+		RestartDetected:    persistence.IsRestored(),
+	})
 
 	return agent, nil
 }
 
+// configHash 计算配置摘要，用于Server端识别配置变更
+func configHash(cfg *config.AgentConfig) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// restoreState 从持久化状态恢复Agent标识和累计计数器
+func (a *EBPFAgent) restoreState() {
+	state := a.persistence.GetState()
+
+	// Agent ID由Reporter稳定解析，状态文件中的旧ID（如hostname-时间戳）以解析结果为准
+	if agentID := a.reporter.GetAgentID(); state.AgentID != agentID {
+		a.logger.WithFields(logrus.Fields{
+			"state_agent_id": state.AgentID,
+			"agent_id":       agentID,
+		}).Warn("状态文件中的Agent ID与当前Agent ID不一致，使用当前Agent ID")
+		a.persistence.SetAgentID(agentID)
+		state.AgentID = agentID
+	}
+	a.startupTime = state.StartupTime
+
+	a.metrics.TotalConnections = state.Counters.TotalConnections
+	a.metrics.TotalBytesSent = state.Counters.TotalBytesSent
+	a.metrics.TotalBytesRecv = state.Counters.TotalBytesRecv
+	a.metrics.TotalPacketsSent = state.Counters.TotalPacketsSent
+	a.metrics.TotalPacketsRecv = state.Counters.TotalPacketsRecv
+	for protocol, count := range state.Counters.ProtocolStats {
+		a.metrics.ProtocolStats[protocol] = count
+	}
+
+	a.logger.WithFields(logrus.Fields{
+		"agent_id":      state.AgentID,
+		"startup_time":  state.StartupTime,
+		"total_packets": state.Counters.TotalPacketsSent + state.Counters.TotalPacketsRecv,
+	}).Info("已恢复持久化状态")
+}
+
 // Start 启动eBPF Agent
 func (a *EBPFAgent) Start() error {
 	a.logger.Info("启动eBPF网络监控代理")
@@ -83,14 +184,21 @@ func (a *EBPFAgent) Start() error {
 		return fmt.Errorf("启动Reporter失败: %w", err)
 	}
 
+	// 启动本地HTTP服务（Prometheus拉取模式）
+	if a.config.HTTP.Enabled {
+		if err := a.startHTTPServer(); err != nil {
+			return fmt.Errorf("启动Agent HTTP服务失败: %w", err)
+		}
+	}
+
 	// 获取eBPF程序路径
 	programPath := a.getEBPFProgramPath()
 	a.logger.WithField("program_path", programPath).Info("准备加载eBPF程序")
-	
+
 	// 尝试加载eBPF程序
 	if err := a.loadEBPFProgram(programPath); err != nil {
 		a.logger.WithError(err).Warn("eBPF程序加载失败")
-		
+
 		// 检查是否启用回退模式
 		if a.config.EBPF.EnableFallback {
 			a.logger.Info("启用模拟模式作为回退方案")
@@ -123,17 +231,22 @@ func (a *EBPFAgent) loadEBPFProgram(programPath string) error {
 		return fmt.Errorf("附加XDP程序到接口 [%s] 失败: %w", a.config.Monitor.Interface, err)
 	}
 
+	a.mutex.Lock()
+	a.programPath = programPath
+	a.mutex.Unlock()
+
 	a.logger.WithFields(logrus.Fields{
 		"program_path": programPath,
 		"interface":    a.config.Monitor.Interface,
 	}).Info("eBPF程序加载并附加成功")
-	
+
 	return nil
 }
 
 // startEBPFMode 启动eBPF模式
 func (a *EBPFAgent) startEBPFMode() error {
 	a.logger.Info("启动eBPF监控模式")
+	a.setCollectorMode("ebpf")
 
 	// 启动统计收集
 	interval := a.config.Monitor.ReportInterval
@@ -149,6 +262,7 @@ func (a *EBPFAgent) startEBPFMode() error {
 // startSimulationMode 启动模拟模式
 func (a *EBPFAgent) startSimulationMode() error {
 	a.logger.Info("启动模拟监控模式")
+	a.setCollectorMode("simulation")
 
 	// 启动模拟数据生成
 	a.wg.Add(1)
@@ -182,6 +296,7 @@ func (a *EBPFAgent) handleEBPFStats(stats *loader.PacketStats) {
 
 	// 更新指标
 	a.updateMetrics(&deltaStats)
+	a.exporter.UpdatePacketStats(&deltaStats)
 	a.lastStats = stats
 
 	a.logger.WithFields(logrus.Fields{
@@ -195,6 +310,20 @@ func (a *EBPFAgent) handleEBPFStats(stats *loader.PacketStats) {
 
 // updateMetrics 更新指标数据
 func (a *EBPFAgent) updateMetrics(stats *loader.PacketStats) {
+	// 同步到持久化管理器
+	a.persistence.UpdateCounters(CounterStats{
+		TotalConnections: stats.TotalPackets,
+		TotalBytesSent:   stats.TotalBytes / 2,
+		TotalBytesRecv:   stats.TotalBytes / 2,
+		TotalPacketsSent: stats.TotalPackets / 2,
+		TotalPacketsRecv: stats.TotalPackets / 2,
+		ProtocolStats: map[string]uint64{
+			"tcp":   stats.TCPPackets,
+			"udp":   stats.UDPPackets,
+			"other": stats.OtherPackets,
+		},
+	})
+
 	// 更新协议统计
 	a.metrics.ProtocolStats["tcp"] += stats.TCPPackets
 	a.metrics.ProtocolStats["udp"] += stats.UDPPackets
@@ -202,7 +331,7 @@ func (a *EBPFAgent) updateMetrics(stats *loader.PacketStats) {
 
 	// 更新总体统计
 	a.metrics.TotalConnections += stats.TotalPackets
-	a.metrics.TotalBytesSent += stats.TotalBytes / 2    // 简化：假设发送和接收各占一半
+	a.metrics.TotalBytesSent += stats.TotalBytes / 2 // 简化：假设发送和接收各占一半
 	a.metrics.TotalBytesRecv += stats.TotalBytes / 2
 	a.metrics.TotalPacketsSent += stats.TotalPackets / 2
 	a.metrics.TotalPacketsRecv += stats.TotalPackets / 2
@@ -249,9 +378,11 @@ func (a *EBPFAgent) simulationLoop() {
 func (a *EBPFAgent) reportLoop() {
 	defer a.wg.Done()
 
+	a.mutex.RLock()
 	interval := a.config.Monitor.ReportInterval
+	a.mutex.RUnlock()
 	a.logger.WithField("interval", interval).Debug("启动数据上报循环")
-	
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -259,17 +390,23 @@ func (a *EBPFAgent) reportLoop() {
 		select {
 		case <-ticker.C:
 			a.logger.Debug("触发数据上报")
-			
+
+			filters := a.getFilters()
 			a.mutex.RLock()
-			metrics := a.metrics
+			metrics := a.snapshotMetrics(filters)
 			a.mutex.RUnlock()
 
 			if err := a.reporter.Report(metrics); err != nil {
 				a.logger.WithError(err).Error("数据上报失败")
 			} else {
+				a.persistence.MarkReported(time.Now())
 				a.logger.Debug("数据上报成功")
 			}
 
+		case newInterval := <-a.intervalChan:
+			ticker.Reset(newInterval)
+			a.logger.WithField("interval", newInterval).Info("上报间隔已更新")
+
 		case <-a.ctx.Done():
 			a.logger.Debug("上报循环退出")
 			return
@@ -281,9 +418,17 @@ func (a *EBPFAgent) reportLoop() {
 func (a *EBPFAgent) Stop() error {
 	a.logger.Info("停止eBPF网络监控代理")
 
+	// 停止配置监听
+	if a.configWatcher != nil {
+		a.configWatcher.Stop()
+	}
+
 	// 取消上下文
 	a.cancel()
 
+	// 关闭本地HTTP服务
+	a.stopHTTPServer()
+
 	// 等待所有goroutine结束
 	a.wg.Wait()
 
@@ -301,6 +446,13 @@ func (a *EBPFAgent) Stop() error {
 		}
 	}
 
+	// 保存持久化状态
+	if a.persistence != nil {
+		if err := a.persistence.Close(); err != nil {
+			a.logger.WithError(err).Error("保存持久化状态失败")
+		}
+	}
+
 	a.logger.Info("eBPF网络监控代理已停止")
 	return nil
 }
@@ -312,6 +464,29 @@ func (a *EBPFAgent) GetMetrics() common.NetworkMetrics {
 	return a.metrics
 }
 
+// setCollectorMode 设置采集模式并更新程序信息指标
+func (a *EBPFAgent) setCollectorMode(mode string) {
+	a.mutex.Lock()
+	a.collectorMode = mode
+	programPath := a.programPath
+	a.mutex.Unlock()
+
+	a.exporter.SetProgramInfo(mode, programPath)
+
+	// 采集模式确定后立即发送心跳
+	a.reporter.TriggerHeartbeat()
+}
+
+// getCollectorMode 获取采集模式
+func (a *EBPFAgent) getCollectorMode() string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if a.collectorMode == "" {
+		return "starting"
+	}
+	return a.collectorMode
+}
+
 // getEBPFProgramPath 获取eBPF程序路径，支持智能路径解析
 func (a *EBPFAgent) getEBPFProgramPath() string {
 	// 1. 优先使用配置文件中指定的路径
@@ -377,7 +552,7 @@ func (a *EBPFAgent) resolveEBPFPath(programPath string) (string, error) {
 	if execPath, err := os.Executable(); err == nil {
 		binDir := filepath.Dir(execPath)
 		searchPaths[1] = filepath.Join(binDir, programPath)
-		
+
 		// 尝试项目根目录（假设二进制在 bin/ 或 cmd/ 子目录中）
 		parentDir := filepath.Dir(binDir)
 		searchPaths[2] = filepath.Join(parentDir, programPath)
@@ -388,7 +563,7 @@ func (a *EBPFAgent) resolveEBPFPath(programPath string) (string, error) {
 		if searchPath == "" {
 			continue
 		}
-		
+
 		if _, err := os.Stat(searchPath); err == nil {
 			location := []string{"当前工作目录", "二进制文件目录", "项目根目录"}[i]
 			a.logger.WithFields(logrus.Fields{
@@ -403,10 +578,9 @@ func (a *EBPFAgent) resolveEBPFPath(programPath string) (string, error) {
 	return "", fmt.Errorf("在所有搜索路径中都未找到文件: %s", programPath)
 }
 
-// getHostID 获取主机ID
+// getHostID 获取主机ID（与上报使用的Agent ID一致）
 func (a *EBPFAgent) getHostID() string {
-	hostname, _ := os.Hostname()
-	return hostname
+	return a.reporter.GetAgentID()
 }
 
 // getHostname 获取主机名
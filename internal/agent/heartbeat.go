@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/network"
+)
+
+// heartbeatInfo 心跳携带的Agent运行信息，每次心跳时刷新网卡列表
+func (a *EBPFAgent) heartbeatInfo() common.AgentInfo {
+	a.mutex.RLock()
+	iface := a.config.Monitor.Interface
+	interval := a.config.Monitor.ReportInterval
+	a.mutex.RUnlock()
+
+	info := common.AgentInfo{
+		Version:        Version,
+		StartTime:      a.startTime,
+		StartupTime:    a.startupTime,
+		Mode:           a.getCollectorMode(),
+		KernelVersion:  kernelVersion(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		Interface:      iface,
+		ReportInterval: interval.String(),
+		Host:           a.interfaces.GetHostInfo(),
+	}
+
+	if err := a.interfaces.RefreshInterfaces(); err != nil {
+		a.logger.WithError(err).Debug("刷新网络接口信息失败")
+	}
+	interfaces := a.interfaces.GetAllInterfaces()
+	names := make([]string, 0, len(interfaces))
+	for name := range interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	info.Interfaces = make([]network.InterfaceInfo, 0, len(names))
+	for _, name := range names {
+		info.Interfaces = append(info.Interfaces, *interfaces[name])
+	}
+
+	return info
+}
+
+// kernelVersion 读取内核版本，非Linux系统返回空字符串
+func kernelVersion() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
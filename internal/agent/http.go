@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AgentStatus Agent状态（/status响应）
+type AgentStatus struct {
+	AgentID            string      `json:"agent_id"`
+	Hostname           string      `json:"hostname"`
+	Version            string      `json:"version"`
+	Mode               string      `json:"mode"`
+	Interface          string      `json:"interface"`
+	ProgramPath        string      `json:"program_path,omitempty"`
+	StartTime          time.Time   `json:"start_time"`
+	StartupTime        time.Time   `json:"startup_time"`
+	Uptime             string      `json:"uptime"`
+	PersistenceEnabled bool        `json:"persistence_enabled"`
+	Counters           interface{} `json:"counters"`
+	Reporter           interface{} `json:"reporter"`
+}
+
+// startHTTPServer 启动本地HTTP服务，暴露/metrics、/healthz和/status
+func (a *EBPFAgent) startHTTPServer() error {
+	cfg := a.config.HTTP
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.MetricsPath, a.exporter.Handler())
+	mux.HandleFunc("/healthz", a.handleHealthz)
+	mux.HandleFunc("/status", a.handleStatus)
+
+	a.httpServer = &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	// 同步监听，端口冲突等错误直接返回
+	listener, err := net.Listen("tcp", a.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", a.httpServer.Addr, err)
+	}
+
+	// 刷新网卡信息指标
+	a.refreshInterfaceInfo()
+
+	go func() {
+		a.logger.WithFields(logrus.Fields{
+			"addr":         a.httpServer.Addr,
+			"metrics_path": cfg.MetricsPath,
+		}).Info("Agent HTTP服务启动")
+
+		if err := a.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			a.logger.WithError(err).Error("Agent HTTP服务异常退出")
+		}
+	}()
+
+	return nil
+}
+
+// stopHTTPServer 关闭本地HTTP服务
+func (a *EBPFAgent) stopHTTPServer() {
+	if a.httpServer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.logger.WithError(err).Error("Agent HTTP服务关闭失败")
+	}
+}
+
+// refreshInterfaceInfo 刷新网卡信息指标
+func (a *EBPFAgent) refreshInterfaceInfo() {
+	if err := a.interfaces.RefreshInterfaces(); err != nil {
+		a.logger.WithError(err).Debug("刷新网络接口信息失败")
+		return
+	}
+
+	a.exporter.ClearInterfaceInfo()
+	a.interfaces.UpdateMetrics(a.exporter.UpdateInterfaceInfo)
+}
+
+// handleHealthz 处理健康检查
+func (a *EBPFAgent) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	body := map[string]interface{}{
+		"status": "healthy",
+		"mode":   a.getCollectorMode(),
+		"time":   time.Now().Unix(),
+	}
+
+	if a.ctx.Err() != nil {
+		status = http.StatusServiceUnavailable
+		body["status"] = "stopping"
+	}
+
+	writeJSON(w, status, body)
+}
+
+// handleStatus 处理状态查询
+func (a *EBPFAgent) handleStatus(w http.ResponseWriter, r *http.Request) {
+	reporterStats := a.reporter.GetStats()
+
+	a.mutex.RLock()
+	programPath := a.programPath
+	protocolStats := make(map[string]uint64, len(a.metrics.ProtocolStats))
+	for protocol, count := range a.metrics.ProtocolStats {
+		protocolStats[protocol] = count
+	}
+	counters := map[string]interface{}{
+		"total_connections":      a.metrics.TotalConnections,
+		"total_bytes_sent":       a.metrics.TotalBytesSent,
+		"total_bytes_received":   a.metrics.TotalBytesRecv,
+		"total_packets_sent":     a.metrics.TotalPacketsSent,
+		"total_packets_received": a.metrics.TotalPacketsRecv,
+		"protocol_stats":         protocolStats,
+	}
+	a.mutex.RUnlock()
+
+	status := AgentStatus{
+		AgentID:            a.reporter.GetAgentID(),
+		Hostname:           a.getHostname(),
+		Version:            Version,
+		Mode:               a.getCollectorMode(),
+		Interface:          a.config.Monitor.Interface,
+		ProgramPath:        programPath,
+		StartTime:          a.startTime,
+		StartupTime:        a.startupTime,
+		Uptime:             time.Since(a.startTime).String(),
+		PersistenceEnabled: a.persistence.IsEnabled(),
+		Counters:           counters,
+		Reporter: map[string]interface{}{
+			"total_reports":        reporterStats.TotalReports,
+			"success_reports":      reporterStats.SuccessReports,
+			"failed_reports":       reporterStats.FailedReports,
+			"retry_count":          reporterStats.RetryCount,
+			"last_report_time":     reporterStats.LastReportTime,
+			"last_error":           reporterStats.LastError,
+			"queue_size":           reporterStats.QueueSize,
+			"batch_size":           reporterStats.BatchSize,
+			"spool_depth":          reporterStats.SpoolDepth,
+			"spool_bytes":          reporterStats.SpoolBytes,
+			"spooled_reports":      reporterStats.SpooledReports,
+			"replayed_reports":     reporterStats.ReplayedReports,
+			"spool_dropped":        reporterStats.SpoolDropped,
+			"pending_retries":      reporterStats.PendingRetries,
+			"breaker_state":        reporterStats.BreakerState,
+			"consecutive_failures": reporterStats.ConsecutiveFailures,
+			"breaker_opened_at":    reporterStats.BreakerOpenedAt,
+			"next_probe_time":      reporterStats.NextProbeTime,
+			"transport":            reporterStats.Transport,
+			"stream_connected":     reporterStats.StreamConnected,
+			"sinks":                reporterStats.Sinks,
+		},
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// writeJSON 输出JSON响应
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/ebpf/loader"
+	ebpfmetrics "go-net-monitoring/pkg/ebpf/metrics"
+	"go-net-monitoring/pkg/reporter"
+)
+
+// newTestAgent 创建不加载eBPF程序、不启动上报的Agent
+func newTestAgent(t *testing.T) *EBPFAgent {
+	t.Helper()
+
+	logger := newTestLogger()
+	rep, err := reporter.NewReporter(&config.ReporterConfig{
+		ServerURL:  "http://127.0.0.1:1/api/v1/metrics",
+		Timeout:    time.Second,
+		RetryDelay: time.Second,
+		BatchSize:  1,
+		AgentID:    "agent-test",
+		StateDir:   t.TempDir(),
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewReporter: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &EBPFAgent{
+		config: &config.AgentConfig{
+			Monitor:  config.MonitorConfig{Interface: "eth0", ReportInterval: 10 * time.Second},
+			Reporter: config.ReporterConfig{ServerURL: "http://127.0.0.1:1/api/v1/metrics", Timeout: time.Second, BatchSize: 1},
+			Log:      config.LogConfig{Level: "info"},
+		},
+		logger:       logger,
+		xdpLoader:    loader.NewXDPLoader("eth0", logger),
+		intervalChan: make(chan time.Duration, 1),
+		reporter:     rep,
+		persistence:  NewPersistenceManager("", time.Minute, 0, rep.GetAgentID(), logger),
+		exporter:     ebpfmetrics.NewEBPFMetricsExporter("eth0", logger),
+		ctx:          ctx,
+		cancel:       cancel,
+		startTime:    time.Now(),
+		startupTime:  time.Now().Add(-time.Hour),
+		metrics: common.NetworkMetrics{
+			ProtocolStats: map[string]uint64{"tcp": 7},
+		},
+	}
+}
+
+func TestHandleHealthz(t *testing.T) {
+	a := newTestAgent(t)
+
+	var body map[string]interface{}
+	w := httptest.NewRecorder()
+	a.handleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["status"] != "healthy" || body["mode"] != "starting" {
+		t.Fatalf("body = %v, want healthy/starting", body)
+	}
+
+	// 停止中返回503，负载均衡器据此摘除
+	a.setCollectorMode("simulation")
+	a.cancel()
+	w = httptest.NewRecorder()
+	a.handleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status after cancel = %d, want 503", w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["status"] != "stopping" || body["mode"] != "simulation" {
+		t.Fatalf("body = %v, want stopping/simulation", body)
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	a := newTestAgent(t)
+	a.updateMetrics(&loader.PacketStats{TotalPackets: 10, TotalBytes: 1000, TCPPackets: 6, UDPPackets: 4})
+
+	w := httptest.NewRecorder()
+	a.handleStatus(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var status struct {
+		AgentID     string    `json:"agent_id"`
+		Interface   string    `json:"interface"`
+		StartupTime time.Time `json:"startup_time"`
+		Counters    struct {
+			TotalConnections uint64            `json:"total_connections"`
+			TotalBytesSent   uint64            `json:"total_bytes_sent"`
+			ProtocolStats    map[string]uint64 `json:"protocol_stats"`
+		} `json:"counters"`
+		Reporter map[string]interface{} `json:"reporter"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.AgentID != "agent-test" || status.Interface != "eth0" {
+		t.Fatalf("identity = %s/%s, want agent-test/eth0", status.AgentID, status.Interface)
+	}
+	if !status.StartupTime.Equal(a.startupTime) {
+		t.Fatalf("startup_time = %v, want %v", status.StartupTime, a.startupTime)
+	}
+	if status.Counters.TotalConnections != 10 || status.Counters.TotalBytesSent != 500 {
+		t.Fatalf("counters = %+v, want 10 connections and 500 bytes sent", status.Counters)
+	}
+	if status.Counters.ProtocolStats["tcp"] != 13 {
+		t.Fatalf("protocol_stats = %v, want tcp=13", status.Counters.ProtocolStats)
+	}
+	if _, ok := status.Reporter["spool_depth"]; !ok {
+		t.Fatalf("reporter stats missing spool_depth: %v", status.Reporter)
+	}
+}
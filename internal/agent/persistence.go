@@ -14,22 +14,22 @@ import (
 
 // PersistentState Agent持久化状态
 type PersistentState struct {
-	AgentID         string                 `json:"agent_id"`
-	StartupTime     time.Time              `json:"startup_time"`
-	LastReportTime  time.Time              `json:"last_report_time"`
-	CumulativeStats map[string]DomainStats `json:"cumulative_stats"`
-	LastSaveTime    time.Time              `json:"last_save_time"`
-	Version         string                 `json:"version"`
+	AgentID        string       `json:"agent_id"`
+	StartupTime    time.Time    `json:"startup_time"`
+	LastReportTime time.Time    `json:"last_report_time"`
+	Counters       CounterStats `json:"counters"`
+	LastSaveTime   time.Time    `json:"last_save_time"`
+	Version        string       `json:"version"`
 }
 
-// DomainStats 域名统计信息
-type DomainStats struct {
-	Domain          string    `json:"domain"`
-	AccessCount     int64     `json:"access_count"`
-	BytesSent       int64     `json:"bytes_sent"`
-	BytesReceived   int64     `json:"bytes_received"`
-	ConnectionCount int64     `json:"connection_count"`
-	LastAccessTime  time.Time `json:"last_access_time"`
+// CounterStats 全局累计计数器
+type CounterStats struct {
+	TotalConnections uint64            `json:"total_connections"`
+	TotalBytesSent   uint64            `json:"total_bytes_sent"`
+	TotalBytesRecv   uint64            `json:"total_bytes_received"`
+	TotalPacketsSent uint64            `json:"total_packets_sent"`
+	TotalPacketsRecv uint64            `json:"total_packets_received"`
+	ProtocolStats    map[string]uint64 `json:"protocol_stats,omitempty"`
 }
 
 // PersistenceManager 持久化管理器
@@ -39,9 +39,12 @@ type PersistenceManager struct {
 	backupCount  int
 	state        *PersistentState
 	mutex        sync.RWMutex
+	saveMutex    sync.Mutex // 串行化定期保存和关闭时的保存，快照和写文件都在锁内
 	logger       *logrus.Logger
 	stopChan     chan struct{}
+	stopOnce     sync.Once
 	enabled      bool
+	restored     bool
 }
 
 // NewPersistenceManager 创建持久化管理器
@@ -54,10 +57,9 @@ func NewPersistenceManager(stateFile string, saveInterval time.Duration, backupC
 		stopChan:     make(chan struct{}),
 		enabled:      stateFile != "",
 		state: &PersistentState{
-			AgentID:         agentID,
-			StartupTime:     time.Now(),
-			CumulativeStats: make(map[string]DomainStats),
-			Version:         "1.0",
+			AgentID:     agentID,
+			StartupTime: time.Now(),
+			Version:     "1.0",
 		},
 	}
 
@@ -103,13 +105,16 @@ func (pm *PersistenceManager) loadState() error {
 		pm.logger.Warnf("State version mismatch, expected %s, got %s", pm.state.Version, loadedState.Version)
 	}
 
-	// 更新启动时间，保留累计统计
-	loadedState.StartupTime = time.Now()
+	// 保留首次启动时间：累计统计从该时间开始连续计数，Server据此判断计数器未重置
+	if loadedState.StartupTime.IsZero() {
+		loadedState.StartupTime = time.Now()
+	}
 	pm.state = &loadedState
+	pm.restored = true
 
 	pm.logger.WithFields(logrus.Fields{
 		"agent_id":         pm.state.AgentID,
-		"cumulative_stats": len(pm.state.CumulativeStats),
+		"startup_time":     pm.state.StartupTime,
 		"last_report_time": pm.state.LastReportTime,
 	}).Info("Loaded persistent state")
 
@@ -122,10 +127,14 @@ func (pm *PersistenceManager) saveState() error {
 		return nil
 	}
 
-	pm.mutex.RLock()
+	// 快照和替换文件在同一把锁内完成，较早的快照不会覆盖关闭时写入的较新快照
+	pm.saveMutex.Lock()
+	defer pm.saveMutex.Unlock()
+
+	pm.mutex.Lock()
 	pm.state.LastSaveTime = time.Now()
 	data, err := json.MarshalIndent(pm.state, "", "  ")
-	pm.mutex.RUnlock()
+	pm.mutex.Unlock()
 
 	if err != nil {
 		pm.logger.WithError(err).Error("Failed to marshal state")
@@ -139,22 +148,58 @@ func (pm *PersistenceManager) saveState() error {
 		return err
 	}
 
+	// 先完整写入临时文件并同步到磁盘，再替换状态文件：
+	// 写入中途崩溃或磁盘写满时，状态文件仍是上一次完整保存的内容
+	tmpFile := pm.stateFile + ".tmp"
+	if err := writeFileSync(tmpFile, data, 0644); err != nil {
+		os.Remove(tmpFile)
+		pm.logger.WithError(err).Error("Failed to write state file")
+		return err
+	}
+
 	// 备份现有文件
 	if pm.backupCount > 0 {
 		pm.rotateBackups()
 	}
 
-	// 写入新状态
-	if err := ioutil.WriteFile(pm.stateFile, data, 0644); err != nil {
-		pm.logger.WithError(err).Error("Failed to write state file")
+	if err := os.Rename(tmpFile, pm.stateFile); err != nil {
+		os.Remove(tmpFile)
+		pm.logger.WithError(err).Error("Failed to replace state file")
 		return err
 	}
+	syncDir(dir)
 
 	pm.logger.Debug("State saved successfully")
 	return nil
 }
 
+// writeFileSync 写入文件并在关闭前同步到磁盘
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir 同步目录，使重命名在断电后仍然有效（失败时忽略）
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
 // rotateBackups 轮转备份文件
+// 当前状态文件以硬链接（不支持时复制）备份，轮转过程中状态文件始终存在
 func (pm *PersistenceManager) rotateBackups() {
 	for i := pm.backupCount - 1; i >= 1; i-- {
 		oldFile := fmt.Sprintf("%s.%d", pm.stateFile, i)
@@ -165,7 +210,12 @@ func (pm *PersistenceManager) rotateBackups() {
 	// 备份当前文件
 	if _, err := os.Stat(pm.stateFile); err == nil {
 		backupFile := fmt.Sprintf("%s.1", pm.stateFile)
-		os.Rename(pm.stateFile, backupFile)
+		os.Remove(backupFile)
+		if err := os.Link(pm.stateFile, backupFile); err != nil {
+			if data, err := ioutil.ReadFile(pm.stateFile); err == nil {
+				writeFileSync(backupFile, data, 0644)
+			}
+		}
 	}
 }
 
@@ -186,57 +236,58 @@ func (pm *PersistenceManager) periodicSave() {
 	}
 }
 
-// UpdateStats 更新统计信息
-func (pm *PersistenceManager) UpdateStats(domain string, stats DomainStats) {
+// SetAgentID 更新状态中的Agent ID
+func (pm *PersistenceManager) SetAgentID(agentID string) {
 	if !pm.enabled {
 		return
 	}
 
 	pm.mutex.Lock()
-	defer pm.mutex.Unlock()
-
-	existing, exists := pm.state.CumulativeStats[domain]
-	if exists {
-		// 累加统计信息
-		existing.AccessCount += stats.AccessCount
-		existing.BytesSent += stats.BytesSent
-		existing.BytesReceived += stats.BytesReceived
-		existing.ConnectionCount += stats.ConnectionCount
-		existing.LastAccessTime = stats.LastAccessTime
-	} else {
-		// 新域名
-		existing = stats
-	}
-
-	pm.state.CumulativeStats[domain] = existing
-	pm.state.LastReportTime = time.Now()
+	pm.state.AgentID = agentID
+	pm.mutex.Unlock()
 }
 
-// GetCumulativeStats 获取累计统计信息
-func (pm *PersistenceManager) GetCumulativeStats() map[string]DomainStats {
+// UpdateCounters 累加全局计数器
+func (pm *PersistenceManager) UpdateCounters(delta CounterStats) {
 	if !pm.enabled {
-		return make(map[string]DomainStats)
+		return
 	}
 
-	pm.mutex.RLock()
-	defer pm.mutex.RUnlock()
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	counters := &pm.state.Counters
+	counters.TotalConnections += delta.TotalConnections
+	counters.TotalBytesSent += delta.TotalBytesSent
+	counters.TotalBytesRecv += delta.TotalBytesRecv
+	counters.TotalPacketsSent += delta.TotalPacketsSent
+	counters.TotalPacketsRecv += delta.TotalPacketsRecv
 
-	// 深拷贝
-	result := make(map[string]DomainStats)
-	for k, v := range pm.state.CumulativeStats {
-		result[k] = v
+	if counters.ProtocolStats == nil {
+		counters.ProtocolStats = make(map[string]uint64)
+	}
+	for protocol, count := range delta.ProtocolStats {
+		counters.ProtocolStats[protocol] += count
+	}
+}
+
+// MarkReported 记录最后一次上报时间
+func (pm *PersistenceManager) MarkReported(t time.Time) {
+	if !pm.enabled {
+		return
 	}
 
-	return result
+	pm.mutex.Lock()
+	pm.state.LastReportTime = t
+	pm.mutex.Unlock()
 }
 
 // GetState 获取持久化状态
 func (pm *PersistenceManager) GetState() PersistentState {
 	if !pm.enabled {
 		return PersistentState{
-			AgentID:         "unknown",
-			StartupTime:     time.Now(),
-			CumulativeStats: make(map[string]DomainStats),
+			AgentID:     "unknown",
+			StartupTime: time.Now(),
 		}
 	}
 
@@ -245,9 +296,9 @@ func (pm *PersistenceManager) GetState() PersistentState {
 
 	// 深拷贝状态
 	state := *pm.state
-	state.CumulativeStats = make(map[string]DomainStats)
-	for k, v := range pm.state.CumulativeStats {
-		state.CumulativeStats[k] = v
+	state.Counters.ProtocolStats = make(map[string]uint64)
+	for k, v := range pm.state.Counters.ProtocolStats {
+		state.Counters.ProtocolStats[k] = v
 	}
 
 	return state
@@ -259,7 +310,7 @@ func (pm *PersistenceManager) Close() error {
 		return nil
 	}
 
-	close(pm.stopChan)
+	pm.stopOnce.Do(func() { close(pm.stopChan) })
 
 	// 最后保存一次状态
 	if err := pm.saveState(); err != nil {
@@ -271,6 +322,13 @@ func (pm *PersistenceManager) Close() error {
 	return nil
 }
 
+// IsRestored 检查是否从状态文件恢复了历史状态
+func (pm *PersistenceManager) IsRestored() bool {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return pm.restored
+}
+
 // IsEnabled 检查是否启用持久化
 func (pm *PersistenceManager) IsEnabled() bool {
 	return pm.enabled
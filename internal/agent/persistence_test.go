@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestPersistenceRestoreCounters(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "agent-state.json")
+
+	pm := NewPersistenceManager(stateFile, time.Hour, 2, "agent-a", newTestLogger())
+	if pm.IsRestored() {
+		t.Fatal("没有状态文件时不应标记为已恢复")
+	}
+	startup := pm.GetState().StartupTime
+	pm.UpdateCounters(CounterStats{TotalBytesSent: 100, TotalPacketsRecv: 3, ProtocolStats: map[string]uint64{"tcp": 2}})
+	pm.UpdateCounters(CounterStats{TotalBytesSent: 50, ProtocolStats: map[string]uint64{"tcp": 1, "udp": 4}})
+	if err := pm.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if err := pm.Close(); err != nil {
+		t.Fatalf("重复关闭失败: %v", err)
+	}
+
+	restored := NewPersistenceManager(stateFile, time.Hour, 2, "agent-a", newTestLogger())
+	defer restored.Close()
+	if !restored.IsRestored() {
+		t.Fatal("应从状态文件恢复")
+	}
+	state := restored.GetState()
+	if !state.StartupTime.Equal(startup) {
+		t.Fatalf("启动时间应保留: got %v, want %v", state.StartupTime, startup)
+	}
+	if state.Counters.TotalBytesSent != 150 || state.Counters.TotalPacketsRecv != 3 {
+		t.Fatalf("计数器恢复错误: %+v", state.Counters)
+	}
+	if state.Counters.ProtocolStats["tcp"] != 3 || state.Counters.ProtocolStats["udp"] != 4 {
+		t.Fatalf("协议统计恢复错误: %v", state.Counters.ProtocolStats)
+	}
+}
+
+func TestPersistenceCloseKeepsLatestSnapshot(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "agent-state.json")
+	pm := NewPersistenceManager(stateFile, time.Hour, 0, "agent-a", newTestLogger())
+
+	// 并发保存与计数更新交错，关闭时写入的最终快照必须留在磁盘上
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				pm.UpdateCounters(CounterStats{TotalConnections: 1})
+				pm.saveState()
+			}
+		}()
+	}
+	wg.Wait()
+	pm.UpdateCounters(CounterStats{TotalConnections: 1})
+	if err := pm.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	restored := NewPersistenceManager(stateFile, time.Hour, 0, "agent-a", newTestLogger())
+	defer restored.Close()
+	if got := restored.GetState().Counters.TotalConnections; got != 81 {
+		t.Fatalf("关闭时的计数未保存: got %d, want 81", got)
+	}
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EnableConfigReload 启用配置热加载，配置文件变更或收到SIGHUP时调用load重新加载
+func (a *EBPFAgent) EnableConfigReload(path string, load func() (*config.AgentConfig, error)) error {
+	watcher, err := config.NewWatcher(path, a.logger, func() {
+		newCfg, err := load()
+		if err != nil {
+			a.logger.WithError(err).Error("重新加载配置失败，继续使用当前配置")
+			return
+		}
+		a.Reload(newCfg)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Start(); err != nil {
+		return err
+	}
+
+	a.configWatcher = watcher
+	return nil
+}
+
+// Reload 应用新配置：可热加载的配置立即生效，其余变更仅记录日志，需要重启
+func (a *EBPFAgent) Reload(newCfg *config.AgentConfig) {
+	a.mutex.Lock()
+	changes := config.DiffAgentConfig(a.config, newCfg)
+	oldInterval := a.config.Monitor.ReportInterval
+
+	// 只更新可热加载的字段，其余字段保持启动时的值
+	a.config.Monitor.ReportInterval = newCfg.Monitor.ReportInterval
+	a.config.Monitor.Filters = newCfg.Monitor.Filters
+	a.config.Log.Level = newCfg.Log.Level
+	a.config.Reporter.ServerURL = newCfg.Reporter.ServerURL
+	a.config.Reporter.Timeout = newCfg.Reporter.Timeout
+	a.config.Reporter.RetryCount = newCfg.Reporter.RetryCount
+	a.config.Reporter.RetryDelay = newCfg.Reporter.RetryDelay
+	a.config.Reporter.MaxRetryDelay = newCfg.Reporter.MaxRetryDelay
+	a.config.Reporter.BreakerThreshold = newCfg.Reporter.BreakerThreshold
+	a.config.Reporter.Encoding = newCfg.Reporter.Encoding
+	a.config.Reporter.Compression = newCfg.Reporter.Compression
+	a.config.Reporter.Mode = newCfg.Reporter.Mode
+	a.config.Reporter.IncludeTotals = newCfg.Reporter.IncludeTotals
+	a.config.Reporter.Tags = newCfg.Reporter.Tags
+	reporterCfg := a.config.Reporter
+	interval := a.config.Monitor.ReportInterval
+	hash := configHash(a.config)
+	a.mutex.Unlock()
+
+	// 日志级别
+	if level, err := logrus.ParseLevel(newCfg.Log.Level); err == nil {
+		a.logger.SetLevel(level)
+	} else {
+		a.logger.WithField("level", newCfg.Log.Level).Warn("无效的日志级别，保持原有级别")
+	}
+
+	// 上报配置
+	a.reporter.UpdateConfig(&reporterCfg)
+	a.reporter.UpdateReportInfo(interval, hash)
+
+	// 上报和统计收集间隔
+	if interval != oldInterval && interval > 0 {
+		a.pushInterval(interval)
+	}
+
+	config.LogConfigChanges(a.logger, changes)
+}
+
+// pushInterval 通知上报循环和XDP统计收集使用新的间隔
+func (a *EBPFAgent) pushInterval(interval time.Duration) {
+	select {
+	case a.intervalChan <- interval:
+	default:
+		// 上一次变更尚未被处理，替换为最新值
+		select {
+		case <-a.intervalChan:
+		default:
+		}
+		a.intervalChan <- interval
+	}
+	a.xdpLoader.SetStatsInterval(interval)
+
+	// 让Server尽快看到新的上报间隔
+	a.reporter.TriggerHeartbeat()
+}
+
+// getFilters 获取当前过滤规则
+func (a *EBPFAgent) getFilters() config.FilterConfig {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.config.Monitor.Filters
+}
+
+// snapshotMetrics 复制当前指标并应用过滤规则，调用方需持有读锁
+func (a *EBPFAgent) snapshotMetrics(filters config.FilterConfig) common.NetworkMetrics {
+	metrics := a.metrics
+
+	metrics.DomainsAccessed = make(map[string]uint64, len(a.metrics.DomainsAccessed))
+	for domain, count := range a.metrics.DomainsAccessed {
+		if domainAllowed(domain, filters) {
+			metrics.DomainsAccessed[domain] = count
+		}
+	}
+
+	metrics.DomainTraffic = make(map[string]*common.DomainTrafficStats, len(a.metrics.DomainTraffic))
+	for domain, stats := range a.metrics.DomainTraffic {
+		if domainAllowed(domain, filters) {
+			copied := *stats
+			metrics.DomainTraffic[domain] = &copied
+		}
+	}
+
+	metrics.IPsAccessed = make(map[string]uint64, len(a.metrics.IPsAccessed))
+	for ip, count := range a.metrics.IPsAccessed {
+		if ipAllowed(ip, filters) {
+			metrics.IPsAccessed[ip] = count
+		}
+	}
+
+	metrics.PortStats = make(map[int]uint64, len(a.metrics.PortStats))
+	for port, count := range a.metrics.PortStats {
+		if portAllowed(port, filters) {
+			metrics.PortStats[port] = count
+		}
+	}
+
+	metrics.ProtocolStats = make(map[string]uint64, len(a.metrics.ProtocolStats))
+	for protocol, count := range a.metrics.ProtocolStats {
+		metrics.ProtocolStats[protocol] = count
+	}
+
+	return metrics
+}
+
+// domainAllowed 检查域名是否通过过滤规则
+func domainAllowed(domain string, filters config.FilterConfig) bool {
+	if filters.IgnoreLocalhost && (domain == "localhost" || isLoopback(domain)) {
+		return false
+	}
+	if len(filters.OnlyDomains) == 0 {
+		return true
+	}
+	for _, allowed := range filters.OnlyDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed 检查IP是否通过过滤规则
+func ipAllowed(ip string, filters config.FilterConfig) bool {
+	if filters.IgnoreLocalhost && isLoopback(ip) {
+		return false
+	}
+	for _, ignored := range filters.IgnoreIPs {
+		if ip == ignored {
+			return false
+		}
+	}
+	return true
+}
+
+// portAllowed 检查端口是否通过过滤规则
+func portAllowed(port int, filters config.FilterConfig) bool {
+	for _, ignored := range filters.IgnorePorts {
+		if port == ignored {
+			return false
+		}
+	}
+	return true
+}
+
+// isLoopback 判断地址是否为本地回环地址
+func isLoopback(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+func TestReloadAppliesHotFieldsOnly(t *testing.T) {
+	a := newTestAgent(t)
+
+	newCfg := *a.config
+	newCfg.Monitor.Interface = "eth1"
+	newCfg.Monitor.ReportInterval = 30 * time.Second
+	newCfg.Monitor.Filters = config.FilterConfig{OnlyDomains: []string{"example.com"}}
+	newCfg.Reporter.Mode = common.ReportModeCumulative
+	newCfg.Log.Level = "debug"
+	a.Reload(&newCfg)
+
+	if a.config.Monitor.Interface != "eth0" {
+		t.Errorf("interface = %s, want eth0 until restart", a.config.Monitor.Interface)
+	}
+	if a.config.Monitor.ReportInterval != 30*time.Second || a.config.Reporter.Mode != common.ReportModeCumulative {
+		t.Errorf("hot fields not applied: interval=%v mode=%s", a.config.Monitor.ReportInterval, a.config.Reporter.Mode)
+	}
+	if a.logger.GetLevel().String() != "debug" {
+		t.Errorf("log level = %s, want debug", a.logger.GetLevel())
+	}
+	select {
+	case interval := <-a.intervalChan:
+		if interval != 30*time.Second {
+			t.Errorf("pushed interval = %v, want 30s", interval)
+		}
+	default:
+		t.Fatal("report interval change was not pushed to the report loop")
+	}
+}
+
+func TestPushIntervalKeepsLatest(t *testing.T) {
+	a := newTestAgent(t)
+
+	// 上报循环尚未处理前一次变更时，只保留最新的间隔
+	a.pushInterval(20 * time.Second)
+	a.pushInterval(40 * time.Second)
+	if got := <-a.intervalChan; got != 40*time.Second {
+		t.Fatalf("interval = %v, want 40s", got)
+	}
+	select {
+	case got := <-a.intervalChan:
+		t.Fatalf("stale interval %v left in channel", got)
+	default:
+	}
+}
+
+func TestSnapshotMetricsAppliesReloadedFilters(t *testing.T) {
+	a := newTestAgent(t)
+	a.metrics.DomainsAccessed = map[string]uint64{"api.example.com": 3, "other.org": 2, "localhost": 1}
+	a.metrics.IPsAccessed = map[string]uint64{"10.0.0.1": 4, "127.0.0.1": 5}
+	a.metrics.PortStats = map[int]uint64{443: 6, 22: 7}
+
+	snapshot := a.snapshotMetrics(config.FilterConfig{
+		IgnoreLocalhost: true,
+		IgnorePorts:     []int{22},
+		OnlyDomains:     []string{"example.com"},
+	})
+	if len(snapshot.DomainsAccessed) != 1 || snapshot.DomainsAccessed["api.example.com"] != 3 {
+		t.Errorf("domains = %v, want only api.example.com", snapshot.DomainsAccessed)
+	}
+	if len(snapshot.IPsAccessed) != 1 || snapshot.IPsAccessed["10.0.0.1"] != 4 {
+		t.Errorf("ips = %v, want only 10.0.0.1", snapshot.IPsAccessed)
+	}
+	if len(snapshot.PortStats) != 1 || snapshot.PortStats[443] != 6 {
+		t.Errorf("ports = %v, want only 443", snapshot.PortStats)
+	}
+	// 过滤不修改Agent自身的计数
+	if len(a.metrics.DomainsAccessed) != 3 {
+		t.Errorf("snapshot modified agent metrics: %v", a.metrics.DomainsAccessed)
+	}
+}
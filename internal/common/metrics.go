@@ -1,9 +1,19 @@
 package common
 
 import (
+	"fmt"
 	"time"
 )
 
+// 上报模式
+const (
+	ReportModeIncremental = "incremental" // 增量模式：上报DeltaStats，可选附带TotalStats
+	ReportModeCumulative  = "cumulative"  // 累计模式：只上报TotalStats
+)
+
+// MetricsReportSchemaVersion /api/v2/reports 接受的报告结构版本
+const MetricsReportSchemaVersion = 2
+
 // MetricsReport 增强的指标报告结构
 type MetricsReport struct {
 	// Agent信息
@@ -25,6 +35,64 @@ type MetricsReport struct {
 	Metadata ReportMetadata `json:"metadata"`
 }
 
+// Validate 校验报告的必填字段和计数
+func (r *MetricsReport) Validate() error {
+	if r.AgentID == "" {
+		return fmt.Errorf("agent_id is required")
+	}
+	switch r.ReportMode {
+	case ReportModeIncremental, ReportModeCumulative:
+	default:
+		return fmt.Errorf("unsupported report_mode %q", r.ReportMode)
+	}
+	if r.StartupTime.IsZero() || r.ReportTime.IsZero() {
+		return fmt.Errorf("startup_time and report_time are required")
+	}
+	if r.ReportTime.Before(r.StartupTime) {
+		return fmt.Errorf("report_time is before startup_time")
+	}
+	if r.ReportMode == ReportModeCumulative && len(r.DeltaStats) > 0 {
+		return fmt.Errorf("cumulative report must not contain delta_stats")
+	}
+
+	for _, stats := range []map[string]DomainMetrics{r.DeltaStats, r.TotalStats} {
+		for domain, m := range stats {
+			if domain == "" {
+				return fmt.Errorf("empty domain")
+			}
+			if m.AccessCount < 0 || m.BytesSent < 0 || m.BytesReceived < 0 || m.ConnectionCount < 0 {
+				return fmt.Errorf("negative counter for domain %s", domain)
+			}
+		}
+	}
+	return nil
+}
+
+// ReportBatch /api/v2/reports 请求，包含一个或多个报告
+type ReportBatch struct {
+	SchemaVersion int             `json:"schema_version"`
+	Reports       []MetricsReport `json:"reports"`
+}
+
+// ReportItemResult 批量上报中单个报告的处理结果，Index为报告在请求中的位置
+type ReportItemResult struct {
+	Index     int    `json:"index"`
+	AgentID   string `json:"agent_id,omitempty"`
+	Accepted  bool   `json:"accepted"`
+	Error     string `json:"error,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"` // 被拒绝的报告可以原样重试
+	Warning   string `json:"warning,omitempty"`   // 已接受但部分处理失败（不应重试）
+}
+
+// ReportBatchResponse /api/v2/reports 响应
+type ReportBatchResponse struct {
+	SchemaVersion int                `json:"schema_version"`
+	Accepted      int                `json:"accepted"`
+	Rejected      int                `json:"rejected"`
+	Results       []ReportItemResult `json:"results"`
+	Timestamp     time.Time          `json:"timestamp"`
+}
+
 // DomainMetrics 域名指标
 type DomainMetrics struct {
 	Domain          string    `json:"domain"`
@@ -146,7 +214,7 @@ func CalculateDelta(current, previous DomainMetrics, timePeriod time.Duration) M
 	}
 }
 
-// MergeMetrics 合并两个域名指标
+// MergeMetrics 合并两个域名指标，不修改base中的协议和端口统计
 func MergeMetrics(base, additional DomainMetrics) DomainMetrics {
 	merged := base
 	merged.AccessCount += additional.AccessCount
@@ -160,16 +228,18 @@ func MergeMetrics(base, additional DomainMetrics) DomainMetrics {
 	}
 
 	// 合并协议统计
-	if merged.ProtocolStats == nil {
-		merged.ProtocolStats = make(map[string]int64)
+	merged.ProtocolStats = make(map[string]int64, len(base.ProtocolStats))
+	for protocol, count := range base.ProtocolStats {
+		merged.ProtocolStats[protocol] = count
 	}
 	for protocol, count := range additional.ProtocolStats {
 		merged.ProtocolStats[protocol] += count
 	}
 
 	// 合并端口统计
-	if merged.PortStats == nil {
-		merged.PortStats = make(map[int]int64)
+	merged.PortStats = make(map[int]int64, len(base.PortStats))
+	for port, count := range base.PortStats {
+		merged.PortStats[port] = count
 	}
 	for port, count := range additional.PortStats {
 		merged.PortStats[port] += count
@@ -177,3 +247,56 @@ func MergeMetrics(base, additional DomainMetrics) DomainMetrics {
 
 	return merged
 }
+
+// SubtractMetrics 从累计值中减去基线（MergeMetrics的逆运算），协议和端口统计按键相减，减为零的键被移除
+func SubtractMetrics(total, baseline DomainMetrics) DomainMetrics {
+	result := total
+	result.AccessCount -= baseline.AccessCount
+	result.BytesSent -= baseline.BytesSent
+	result.BytesReceived -= baseline.BytesReceived
+	result.ConnectionCount -= baseline.ConnectionCount
+
+	result.ProtocolStats = make(map[string]int64, len(total.ProtocolStats))
+	for protocol, count := range total.ProtocolStats {
+		if count -= baseline.ProtocolStats[protocol]; count > 0 {
+			result.ProtocolStats[protocol] = count
+		}
+	}
+
+	result.PortStats = make(map[int]int64, len(total.PortStats))
+	for port, count := range total.PortStats {
+		if count -= baseline.PortStats[port]; count > 0 {
+			result.PortStats[port] = count
+		}
+	}
+
+	return result
+}
+
+// DomainMetricsFromNetworkMetrics 将NetworkMetrics中的域名统计转换为DomainMetrics
+func DomainMetricsFromNetworkMetrics(metrics NetworkMetrics) map[string]DomainMetrics {
+	result := make(map[string]DomainMetrics)
+
+	for domain, count := range metrics.DomainsAccessed {
+		result[domain] = DomainMetrics{
+			Domain:      domain,
+			AccessCount: int64(count),
+		}
+	}
+
+	for domain, stats := range metrics.DomainTraffic {
+		if stats == nil {
+			continue
+		}
+
+		dm := result[domain]
+		dm.Domain = domain
+		dm.BytesSent = int64(stats.BytesSent)
+		dm.BytesReceived = int64(stats.BytesReceived)
+		dm.ConnectionCount = int64(stats.Connections)
+		dm.LastAccessTime = stats.LastAccess
+		result[domain] = dm
+	}
+
+	return result
+}
@@ -3,6 +3,8 @@ package common
 import (
 	"net"
 	"time"
+
+	"go-net-monitoring/pkg/network"
 )
 
 // NetworkEvent 网络事件结构
@@ -109,6 +111,7 @@ type ReportRequest struct {
 	Hostname  string         `json:"hostname"`
 	Timestamp time.Time      `json:"timestamp"`
 	Metrics   NetworkMetrics `json:"metrics"`
+	Report    *MetricsReport `json:"report,omitempty"` // 增强报告（增量/累计模式）
 }
 
 // ReportResponse 上报响应结构
@@ -118,15 +121,45 @@ type ReportResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// AgentInfo Agent信息
+// AgentInfo Agent信息，由心跳上报
 type AgentInfo struct {
 	ID        string    `json:"id"`
 	Hostname  string    `json:"hostname"`
 	IP        string    `json:"ip"`
 	Version   string    `json:"version"`
-	StartTime time.Time `json:"start_time"`
+	StartTime time.Time `json:"start_time"` // Agent进程启动时间
 	LastSeen  time.Time `json:"last_seen"`
 	Status    string    `json:"status"` // online, offline
+
+	Mode           string                  `json:"mode,omitempty"` // 采集模式：ebpf、simulation、procfs
+	KernelVersion  string                  `json:"kernel_version,omitempty"`
+	OS             string                  `json:"os,omitempty"`
+	Arch           string                  `json:"arch,omitempty"`
+	Interface      string                  `json:"interface,omitempty"`       // 监控的网卡
+	ReportInterval string                  `json:"report_interval,omitempty"` // 当前上报间隔，如 30s
+	StartupTime    time.Time               `json:"startup_time,omitempty"`    // 累计计数起始时间，启用持久化时早于StartTime
+	Host           *network.HostInfo       `json:"host,omitempty"`
+	Interfaces     []network.InterfaceInfo `json:"interfaces,omitempty"`
+}
+
+// 心跳指令类型，与gRPC流命令的类型相同
+const (
+	DirectiveSetReportInterval = "set_report_interval" // 调整上报间隔，参数interval（如 30s）
+	DirectiveReplaySpool       = "replay_spool"        // 重发待重试数据和磁盘缓存
+)
+
+// Directive Server在心跳响应中下发给Agent的指令
+type Directive struct {
+	ID   string            `json:"id"`
+	Type string            `json:"type"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// HeartbeatResponse 心跳响应
+type HeartbeatResponse struct {
+	Success    bool        `json:"success"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Directives []Directive `json:"directives,omitempty"`
 }
 
 // AlertRule 告警规则
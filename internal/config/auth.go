@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuthConfig Server端认证配置
+// 启用后Agent上报和心跳必须携带API Key（Authorization: Bearer <api_key>），API Key通过注册接口或管理接口签发
+// 查询接口和管理接口需要带角色的API令牌（ingest、read、admin），令牌通过 server token 命令或管理接口创建
+type AuthConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	AdminToken       string        `yaml:"admin_token"`       // 静态管理员令牌，等同于admin角色的API令牌；为空时只能使用API令牌
+	EnrollmentToken  string        `yaml:"enrollment_token"`  // Agent注册令牌，为空时关闭自助注册
+	RequireSignature bool          `yaml:"require_signature"` // REST上报、心跳和gRPC流建立连接必须携带HMAC-SHA256签名
+	SignatureWindow  time.Duration `yaml:"signature_window"`  // 签名时间戳允许的偏差，同时是nonce的保留时间，默认5m
+}
+
+// AgentAuthConfig Agent认证配置
+type AgentAuthConfig struct {
+	APIKey          string `yaml:"api_key"`          // 管理员签发的API Key，设置后不再注册
+	EnrollmentToken string `yaml:"enrollment_token"` // 注册令牌，没有API Key时向Server注册，签发的Key保存在 state_dir/api_key
+	Sign            bool   `yaml:"sign"`             // 对REST上报、心跳和gRPC流建立连接进行HMAC-SHA256签名
+}
+
+// validateAuth 验证Server端认证配置并补全默认值
+func validateAuth(c *AuthConfig) error {
+	if c.SignatureWindow < 0 {
+		return fmt.Errorf("auth: signature_window 不能为负数")
+	}
+	if c.SignatureWindow == 0 {
+		c.SignatureWindow = 5 * time.Minute
+	}
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.AdminToken != "" && c.AdminToken == c.EnrollmentToken {
+		return fmt.Errorf("auth: admin_token 与 enrollment_token 不能相同")
+	}
+	return nil
+}
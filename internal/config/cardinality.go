@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 受基数限制的指标（标签值来自流量数据，数量不可控）
+var limitedMetrics = []string{
+	"network_domains_accessed_total",
+	"network_domain_bytes_sent_total",
+	"network_domain_bytes_received_total",
+	"network_domain_connections_total",
+	"network_ips_accessed_total",
+	"network_protocol_stats_total",
+	"network_port_connections_total",
+}
+
+// CardinalityConfig 标签基数限制：每个指标只保留流量最大的前K个标签值，其余汇总到 other
+type CardinalityConfig struct {
+	Enabled      bool           `yaml:"enabled"`
+	DefaultLimit int            `yaml:"default_limit"` // 未单独配置的指标的标签值上限，默认1000
+	Limits       map[string]int `yaml:"limits"`        // 按指标名称配置的上限，0表示不限制
+}
+
+// Limit 指标的标签值上限，0表示不限制
+func (c *CardinalityConfig) Limit(metric string) int {
+	if !c.Enabled {
+		return 0
+	}
+	if limit, ok := c.Limits[metric]; ok {
+		return limit
+	}
+	return c.DefaultLimit
+}
+
+// validateCardinality 验证标签基数限制配置并补全默认值
+func validateCardinality(prefix string, c *CardinalityConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.DefaultLimit < 0 {
+		return fmt.Errorf("%s.default_limit 不能为负数", prefix)
+	}
+	if c.DefaultLimit == 0 {
+		c.DefaultLimit = 1000
+	}
+
+	for metric, limit := range c.Limits {
+		if !isLimitedMetric(metric) {
+			return fmt.Errorf("%s.limits 不支持指标 %s (支持 %s)", prefix, metric, strings.Join(limitedMetrics, ", "))
+		}
+		if limit < 0 {
+			return fmt.Errorf("%s.limits.%s 不能为负数", prefix, metric)
+		}
+	}
+	return nil
+}
+
+// isLimitedMetric 判断指标是否支持基数限制
+func isLimitedMetric(metric string) bool {
+	for _, name := range limitedMetrics {
+		if name == metric {
+			return true
+		}
+	}
+	return false
+}
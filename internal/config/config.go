@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -14,6 +17,7 @@ type AgentConfig struct {
 	Reporter    ReporterConfig    `yaml:"reporter"`
 	Persistence PersistenceConfig `yaml:"persistence"`
 	EBPF        EBPFConfig        `yaml:"ebpf"`
+	HTTP        AgentHTTPConfig   `yaml:"http"`
 	Log         LogConfig         `yaml:"log"`
 }
 
@@ -42,17 +46,46 @@ type FilterConfig struct {
 
 // ReporterConfig 上报配置
 type ReporterConfig struct {
-	ServerURL     string        `yaml:"server_url"`
-	Timeout       time.Duration `yaml:"timeout"`
-	RetryCount    int           `yaml:"retry_count"`
-	RetryDelay    time.Duration `yaml:"retry_delay"`
-	BatchSize     int           `yaml:"batch_size"`
-	EnableTLS     bool          `yaml:"enable_tls"`
-	TLSCertPath   string        `yaml:"tls_cert_path"`
-	TLSKeyPath    string        `yaml:"tls_key_path"`
-	Mode          string        `yaml:"mode"`           // "incremental" 或 "cumulative"
-	IncludeTotals bool          `yaml:"include_totals"` // 是否包含总计数据
-	AgentID       string        `yaml:"agent_id"`       // Agent唯一标识
+	ServerURL     string            `yaml:"server_url"`
+	Timeout       time.Duration     `yaml:"timeout"`
+	RetryCount    int               `yaml:"retry_count"`
+	RetryDelay    time.Duration     `yaml:"retry_delay"`
+	BatchSize     int               `yaml:"batch_size"`
+	EnableTLS     bool              `yaml:"enable_tls"`
+	TLSCertPath   string            `yaml:"tls_cert_path"`
+	TLSKeyPath    string            `yaml:"tls_key_path"`
+	TLSCAPath     string            `yaml:"tls_ca_path"`     // 校验Server证书的CA文件，为空时使用系统CA
+	TLSServerName string            `yaml:"tls_server_name"` // 校验Server证书使用的名称，为空时使用连接地址中的主机名
+	Mode          string            `yaml:"mode"`            // "incremental" 或 "cumulative"
+	IncludeTotals bool              `yaml:"include_totals"`  // 是否包含总计数据
+	AgentID       string            `yaml:"agent_id"`        // Agent唯一标识
+	StateDir      string            `yaml:"state_dir"`       // 状态目录（保存生成的Agent ID）
+	Tags          map[string]string `yaml:"tags"`            // 附加到报告元数据的标签
+	Spool         SpoolConfig       `yaml:"spool"`           // 本地磁盘缓存
+
+	MaxRetryDelay    time.Duration `yaml:"max_retry_delay"`   // 指数退避的最大重试间隔
+	BreakerThreshold int           `yaml:"breaker_threshold"` // 连续失败多少次后熔断，0表示不熔断
+
+	Encoding    string `yaml:"encoding"`    // 上报数据序列化格式："json" 或 "protobuf"
+	Compression string `yaml:"compression"` // 上报数据压缩算法："none"、"gzip" 或 "zstd"
+
+	Transport   string `yaml:"transport"`    // 传输方式："http"（REST接口）或 "grpc"（双向流）
+	GRPCAddress string `yaml:"grpc_address"` // gRPC地址（host:port），transport为grpc时使用
+
+	Sinks []SinkConfig `yaml:"sinks"` // 输出目标列表，为空时只上报到中心Server
+
+	Auth AgentAuthConfig `yaml:"auth"` // 向Server认证（Server启用auth时需要）
+
+	Cardinality CardinalityConfig `yaml:"cardinality"` // 域名、IP等标签的基数限制，对Server和所有输出目标生效
+}
+
+// SpoolConfig 上报失败数据的磁盘缓存配置
+type SpoolConfig struct {
+	Enabled      bool          `yaml:"enabled"`       // 是否启用
+	Dir          string        `yaml:"dir"`           // 缓存目录，默认为 state_dir/spool
+	MaxBytes     int64         `yaml:"max_bytes"`     // 缓存总大小上限，超出时丢弃最旧的数据
+	MaxAge       time.Duration `yaml:"max_age"`       // 缓存数据最长保留时间
+	SegmentBytes int64         `yaml:"segment_bytes"` // 单个段文件大小
 }
 
 // PersistenceConfig 持久化配置
@@ -70,6 +103,14 @@ type EBPFConfig struct {
 	EnableFallback bool     `yaml:"enable_fallback"` // 是否启用模拟模式回退
 }
 
+// AgentHTTPConfig Agent本地HTTP服务配置（Prometheus拉取模式）
+type AgentHTTPConfig struct {
+	Enabled     bool   `yaml:"enabled"`      // 是否启用本地HTTP服务
+	Host        string `yaml:"host"`         // 监听地址
+	Port        int    `yaml:"port"`         // 监听端口
+	MetricsPath string `yaml:"metrics_path"` // Prometheus指标路径
+}
+
 // LogConfig 日志配置
 type LogConfig struct {
 	Level  string `yaml:"level"`
@@ -79,10 +120,20 @@ type LogConfig struct {
 
 // ServerAppConfig Server应用配置
 type ServerAppConfig struct {
-	HTTP    HTTPConfig    `yaml:"http"`
-	Metrics MetricsConfig `yaml:"metrics"`
-	Storage StorageConfig `yaml:"storage"`
-	Log     LogConfig     `yaml:"log"`
+	HTTP     HTTPConfig     `yaml:"http"`
+	GRPC     GRPCConfig     `yaml:"grpc"`
+	OTLP     OTLPConfig     `yaml:"otlp"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Log      LogConfig      `yaml:"log"`
+	Advanced AdvancedConfig `yaml:"advanced"`
+}
+
+// AdvancedConfig Server高级配置
+type AdvancedConfig struct {
+	AgentTimeout    time.Duration `yaml:"agent_timeout"`     // Agent超过该时间未上报或心跳时被清理，其指标序列一并删除
+	QueryMaxReports int           `yaml:"query_max_reports"` // 历史查询一次最多读取的上报数，超过时返回413，默认10000
 }
 
 // HTTPConfig HTTP服务配置
@@ -94,19 +145,29 @@ type HTTPConfig struct {
 	EnableTLS    bool          `yaml:"enable_tls"`
 	TLSCertPath  string        `yaml:"tls_cert_path"`
 	TLSKeyPath   string        `yaml:"tls_key_path"`
-	Debug        bool          `yaml:"debug"` // Debug模式
+	TLSCAPath    string        `yaml:"tls_ca_path"` // 校验客户端证书的CA文件（PEM，可包含多个证书）
+	ClientAuth   string        `yaml:"client_auth"` // 客户端证书校验：none、optional 或 require
+	Debug        bool          `yaml:"debug"`       // Debug模式
+}
+
+// GRPCConfig gRPC流式上报服务配置（TLS证书与HTTP服务共用）
+type GRPCConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"`
 }
 
 // MetricsConfig Prometheus指标配置
 type MetricsConfig struct {
-	Path     string        `yaml:"path"`
-	Enabled  bool          `yaml:"enabled"`
-	Interval time.Duration `yaml:"interval"`
+	Path        string            `yaml:"path"`
+	Enabled     bool              `yaml:"enabled"`
+	Interval    time.Duration     `yaml:"interval"`
+	Cardinality CardinalityConfig `yaml:"cardinality"` // network_*指标的标签基数限制
 }
 
 // StorageConfig 存储配置
 type StorageConfig struct {
-	Type                  string        `yaml:"type"`                    // memory, redis
+	Type                  string        `yaml:"type"`                    // memory, redis, file
 	TTL                   time.Duration `yaml:"ttl"`                     // 数据保留时间
 	MaxEntries            int           `yaml:"max_entries"`             // 最大条目数 (仅memory)
 	CumulativeMode        bool          `yaml:"cumulative_mode"`         // 累计模式
@@ -115,6 +176,33 @@ type StorageConfig struct {
 
 	// Redis配置
 	Redis RedisConfig `yaml:"redis"`
+
+	// 本地文件存储配置
+	File FileStorageConfig `yaml:"file"`
+}
+
+// FileStorageConfig 本地文件存储配置（type为file时生效）
+type FileStorageConfig struct {
+	Path     string `yaml:"path"`      // 存储文件路径
+	MaxBytes int64  `yaml:"max_bytes"` // 数据大小上限（键和值的字节数，不含文件的页结构），超出时删除最旧的数据，默认1GB
+}
+
+// validateFileStorage 验证文件存储配置并补全默认值
+func validateFileStorage(c *StorageConfig) error {
+	if !strings.EqualFold(c.Type, "file") {
+		return nil
+	}
+
+	if c.File.Path == "" {
+		c.File.Path = "/var/lib/netmon/server.db"
+	}
+	if c.File.MaxBytes < 0 {
+		return fmt.Errorf("storage.file.max_bytes 不能为负数")
+	}
+	if c.File.MaxBytes == 0 {
+		c.File.MaxBytes = 1 << 30
+	}
+	return nil
 }
 
 // RedisConfig Redis存储配置
@@ -142,7 +230,7 @@ func LoadAgentConfig(configPath string) (*AgentConfig, error) {
 	}
 
 	var config AgentConfig
-	if err := v.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config, decodeWithYAMLTags); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
@@ -166,6 +254,11 @@ func LoadAgentConfig(configPath string) (*AgentConfig, error) {
 	return &config, nil
 }
 
+// decodeWithYAMLTags 按yaml标签映射配置键（默认的mapstructure标签无法匹配report_interval等下划线键名）
+func decodeWithYAMLTags(dc *mapstructure.DecoderConfig) {
+	dc.TagName = "yaml"
+}
+
 // validateAgentConfig 验证Agent配置
 func validateAgentConfig(config *AgentConfig) error {
 	// 验证时间间隔
@@ -181,15 +274,99 @@ func validateAgentConfig(config *AgentConfig) error {
 		config.Reporter.RetryDelay = 5 * time.Second
 	}
 
-	// 验证其他必要字段
-	if config.Reporter.ServerURL == "" {
-		return fmt.Errorf("reporter.server_url 不能为空")
+	if config.Reporter.MaxRetryDelay <= 0 {
+		config.Reporter.MaxRetryDelay = 2 * time.Minute
+	}
+	if config.Reporter.MaxRetryDelay < config.Reporter.RetryDelay {
+		config.Reporter.MaxRetryDelay = config.Reporter.RetryDelay
+	}
+
+	if config.Reporter.BreakerThreshold < 0 {
+		return fmt.Errorf("reporter.breaker_threshold 不能为负数")
+	}
+
+	switch config.Reporter.Encoding {
+	case "":
+		config.Reporter.Encoding = "json"
+	case "json", "protobuf":
+	default:
+		return fmt.Errorf("reporter.encoding 必须是 json 或 protobuf")
+	}
+
+	switch config.Reporter.Compression {
+	case "":
+		config.Reporter.Compression = "none"
+	case "none", "gzip", "zstd":
+	default:
+		return fmt.Errorf("reporter.compression 必须是 none、gzip 或 zstd")
+	}
+
+	switch config.Reporter.Transport {
+	case "":
+		config.Reporter.Transport = "http"
+	case "http":
+	case "grpc":
+		if config.Reporter.GRPCAddress == "" {
+			return fmt.Errorf("reporter.transport 为 grpc 时 reporter.grpc_address 不能为空")
+		}
+	default:
+		return fmt.Errorf("reporter.transport 必须是 http 或 grpc")
+	}
+
+	// 验证输出目标（包含server_url检查）
+	if err := validateSinks(&config.Reporter); err != nil {
+		return err
+	}
+
+	if err := validateCardinality("reporter.cardinality", &config.Reporter.Cardinality); err != nil {
+		return err
+	}
+
+	switch config.Reporter.Mode {
+	case "":
+		config.Reporter.Mode = "incremental"
+	case "incremental", "cumulative":
+	default:
+		return fmt.Errorf("无效的上报模式: %s (支持 incremental, cumulative)", config.Reporter.Mode)
 	}
 
 	if config.Monitor.BufferSize <= 0 {
 		config.Monitor.BufferSize = 1000
 	}
 
+	if config.Persistence.SaveInterval <= 0 {
+		config.Persistence.SaveInterval = 30 * time.Second
+	}
+
+	if config.Persistence.Enabled && config.Persistence.StateFile == "" {
+		return fmt.Errorf("persistence.state_file 不能为空")
+	}
+
+	if config.Reporter.Spool.Enabled {
+		if config.Reporter.Spool.Dir == "" {
+			if config.Reporter.StateDir == "" {
+				return fmt.Errorf("启用reporter.spool时 reporter.spool.dir 和 reporter.state_dir 不能同时为空")
+			}
+			config.Reporter.Spool.Dir = filepath.Join(config.Reporter.StateDir, "spool")
+		}
+		if config.Reporter.Spool.MaxBytes <= 0 {
+			config.Reporter.Spool.MaxBytes = 64 << 20
+		}
+		if config.Reporter.Spool.SegmentBytes <= 0 {
+			config.Reporter.Spool.SegmentBytes = 1 << 20
+		}
+		if config.Reporter.Spool.MaxAge <= 0 {
+			config.Reporter.Spool.MaxAge = 24 * time.Hour
+		}
+	}
+
+	if config.HTTP.Enabled && (config.HTTP.Port <= 0 || config.HTTP.Port > 65535) {
+		return fmt.Errorf("无效的HTTP端口: %d", config.HTTP.Port)
+	}
+	if config.HTTP.MetricsPath == "" {
+		config.HTTP.MetricsPath = "/metrics"
+	}
+
 	return nil
 }
 
@@ -206,7 +383,7 @@ func LoadServerConfig(configPath string) (*ServerAppConfig, error) {
 	}
 
 	var config ServerAppConfig
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := viper.Unmarshal(&config, decodeWithYAMLTags); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
@@ -237,12 +414,42 @@ func validateServerConfig(config *ServerAppConfig) error {
 		config.Storage.TTL = 1 * time.Hour
 	}
 
+	if err := validateFileStorage(&config.Storage); err != nil {
+		return err
+	}
+
+	if config.Advanced.AgentTimeout <= 0 {
+		config.Advanced.AgentTimeout = 5 * time.Minute
+	}
+	if config.Advanced.QueryMaxReports <= 0 {
+		config.Advanced.QueryMaxReports = 10000
+	}
+
 	// 验证端口
 	if config.HTTP.Port <= 0 || config.HTTP.Port > 65535 {
 		return fmt.Errorf("无效的HTTP端口: %d", config.HTTP.Port)
 	}
 
-	return nil
+	if config.GRPC.Enabled {
+		if config.GRPC.Port <= 0 || config.GRPC.Port > 65535 {
+			return fmt.Errorf("无效的gRPC端口: %d", config.GRPC.Port)
+		}
+		if config.GRPC.Port == config.HTTP.Port && config.GRPC.Host == config.HTTP.Host {
+			return fmt.Errorf("gRPC端口不能与HTTP端口相同: %d", config.GRPC.Port)
+		}
+	}
+
+	if err := validateServerTLS(&config.HTTP); err != nil {
+		return err
+	}
+	if err := validateAuth(&config.Auth); err != nil {
+		return err
+	}
+	if err := validateCardinality("metrics.cardinality", &config.Metrics.Cardinality); err != nil {
+		return err
+	}
+
+	return validateOTLP(&config.OTLP)
 }
 
 // setAgentDefaultsForViper 为指定的 viper 实例设置Agent默认配置
@@ -263,6 +470,24 @@ func setAgentDefaultsForViper(v *viper.Viper) {
 	v.SetDefault("reporter.retry_delay", 5*time.Second)
 	v.SetDefault("reporter.batch_size", 100)
 	v.SetDefault("reporter.enable_tls", false)
+	v.SetDefault("reporter.mode", "incremental")
+	v.SetDefault("reporter.include_totals", true)
+	v.SetDefault("reporter.state_dir", "/var/lib/netmon")
+	v.SetDefault("reporter.max_retry_delay", 2*time.Minute)
+	v.SetDefault("reporter.breaker_threshold", 5)
+	v.SetDefault("reporter.encoding", "json")
+	v.SetDefault("reporter.compression", "none")
+	v.SetDefault("reporter.transport", "http")
+	v.SetDefault("reporter.spool.enabled", true)
+	v.SetDefault("reporter.spool.max_bytes", 64<<20)
+	v.SetDefault("reporter.spool.max_age", 24*time.Hour)
+	v.SetDefault("reporter.spool.segment_bytes", 1<<20)
+
+	// 持久化配置默认值
+	v.SetDefault("persistence.enabled", false)
+	v.SetDefault("persistence.state_file", "/var/lib/netmon/agent-state.json")
+	v.SetDefault("persistence.save_interval", 30*time.Second)
+	v.SetDefault("persistence.backup_count", 3)
 
 	// eBPF配置默认值
 	v.SetDefault("ebpf.program_path", "/opt/go-net-monitoring/bpf/xdp_monitor.o")
@@ -274,6 +499,12 @@ func setAgentDefaultsForViper(v *viper.Viper) {
 	})
 	v.SetDefault("ebpf.enable_fallback", true)
 
+	// 本地HTTP服务默认值
+	v.SetDefault("http.enabled", false)
+	v.SetDefault("http.host", "0.0.0.0")
+	v.SetDefault("http.port", 9091)
+	v.SetDefault("http.metrics_path", "/metrics")
+
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.format", "json")
 	v.SetDefault("log.output", "stdout")
@@ -293,6 +524,12 @@ func setServerDefaults() {
 	viper.SetDefault("http.enable_tls", false)
 	viper.SetDefault("http.debug", false)
 
+	viper.SetDefault("grpc.enabled", false)
+	viper.SetDefault("grpc.host", "0.0.0.0")
+	viper.SetDefault("grpc.port", 8081)
+	viper.SetDefault("otlp.enabled", false)
+	viper.SetDefault("otlp.protocol", "http")
+
 	viper.SetDefault("metrics.path", "/metrics")
 	viper.SetDefault("metrics.enabled", true)
 	viper.SetDefault("metrics.interval", 15*time.Second)
@@ -312,4 +549,6 @@ func setServerDefaults() {
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.format", "json")
 	viper.SetDefault("log.output", "stdout")
+
+	viper.SetDefault("advanced.agent_timeout", 5*time.Minute)
 }
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConfigChange 配置变更项
+type ConfigChange struct {
+	Field        string      // 配置键，如 monitor.report_interval
+	Old          interface{} // 旧值
+	New          interface{} // 新值
+	NeedsRestart bool        // 是否需要重启才能生效
+}
+
+// agentHotReloadKeys Agent可热加载的配置键（前缀匹配）
+var agentHotReloadKeys = []string{
+	"monitor.report_interval",
+	"monitor.filters",
+	"reporter.server_url",
+	"reporter.timeout",
+	"reporter.retry_count",
+	"reporter.retry_delay",
+	"reporter.max_retry_delay",
+	"reporter.breaker_threshold",
+	"reporter.encoding",
+	"reporter.compression",
+	"reporter.mode",
+	"reporter.include_totals",
+	"reporter.tags",
+	"log.level",
+}
+
+// serverHotReloadKeys Server可热加载的配置键（前缀匹配）
+var serverHotReloadKeys = []string{
+	"metrics.interval",
+	"storage.ttl",
+	"storage.max_entries",
+	"storage.file.max_bytes",
+	"log.level",
+	"advanced.agent_timeout",
+	"advanced.query_max_reports",
+}
+
+// DiffAgentConfig 比较两份Agent配置
+func DiffAgentConfig(oldCfg, newCfg *AgentConfig) []ConfigChange {
+	return diffConfig(oldCfg, newCfg, agentHotReloadKeys)
+}
+
+// DiffServerConfig 比较两份Server配置
+func DiffServerConfig(oldCfg, newCfg *ServerAppConfig) []ConfigChange {
+	return diffConfig(oldCfg, newCfg, serverHotReloadKeys)
+}
+
+// LogConfigChanges 输出配置变更日志，区分已生效和需要重启的变更
+func LogConfigChanges(logger *logrus.Logger, changes []ConfigChange) {
+	if len(changes) == 0 {
+		logger.Info("配置未发生变化")
+		return
+	}
+
+	var applied, pending []string
+	for _, change := range changes {
+		fields := logrus.Fields{
+			"field": change.Field,
+			"old":   fmt.Sprintf("%v", change.Old),
+			"new":   fmt.Sprintf("%v", change.New),
+		}
+		if change.NeedsRestart {
+			pending = append(pending, change.Field)
+			logger.WithFields(fields).Warn("配置已变更，需要重启才能生效")
+		} else {
+			applied = append(applied, change.Field)
+			logger.WithFields(fields).Info("配置已热加载")
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"applied":       strings.Join(applied, ","),
+		"needs_restart": strings.Join(pending, ","),
+	}).Info("配置重新加载完成")
+}
+
+// diffConfig 递归比较配置结构体，以yaml标签作为配置键
+func diffConfig(oldCfg, newCfg interface{}, hotKeys []string) []ConfigChange {
+	var changes []ConfigChange
+	walkDiff("", reflect.ValueOf(oldCfg).Elem(), reflect.ValueOf(newCfg).Elem(), func(key string, oldVal, newVal reflect.Value) {
+		oldValue, newValue := oldVal.Interface(), newVal.Interface()
+		if isSecretKey(key) {
+			oldValue, newValue = maskedValue, maskedValue
+		}
+		changes = append(changes, ConfigChange{
+			Field:        key,
+			Old:          oldValue,
+			New:          newValue,
+			NeedsRestart: !isHotKey(key, hotKeys),
+		})
+	})
+	return changes
+}
+
+// walkDiff 遍历结构体字段，对叶子字段的差异调用onDiff
+func walkDiff(prefix string, oldVal, newVal reflect.Value, onDiff func(key string, oldVal, newVal reflect.Value)) {
+	t := oldVal.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			name = strings.ToLower(field.Name)
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		o, n := oldVal.Field(i), newVal.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type.PkgPath() == t.PkgPath() {
+			walkDiff(key, o, n, onDiff)
+			continue
+		}
+
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			onDiff(key, o, n)
+		}
+	}
+}
+
+// maskedValue 变更日志中代替敏感配置值
+const maskedValue = "******"
+
+// secretKeyNames 敏感配置键的最后一段，变更日志中不输出其值
+var secretKeyNames = []string{"password", "admin_token", "enrollment_token", "api_key"}
+
+// isSecretKey 判断配置键是否为敏感配置
+func isSecretKey(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, secret := range secretKeyNames {
+		if name == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// isHotKey 判断配置键是否支持热加载
+func isHotKey(key string, hotKeys []string) bool {
+	for _, hot := range hotKeys {
+		if key == hot || strings.HasPrefix(key, hot+".") {
+			return true
+		}
+	}
+	return false
+}
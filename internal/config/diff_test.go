@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffAgentConfig(t *testing.T) {
+	oldCfg := &AgentConfig{
+		Monitor:  MonitorConfig{Interface: "eth0", ReportInterval: 10 * time.Second},
+		Reporter: ReporterConfig{ServerURL: "http://a", Tags: map[string]string{"env": "prod"}, Auth: AgentAuthConfig{APIKey: "old-secret"}},
+		Log:      LogConfig{Level: "info"},
+	}
+	newCfg := &AgentConfig{
+		Monitor:  MonitorConfig{Interface: "eth1", ReportInterval: 30 * time.Second},
+		Reporter: ReporterConfig{ServerURL: "http://a", Tags: map[string]string{"env": "dev"}, Auth: AgentAuthConfig{APIKey: "new-secret"}},
+		Log:      LogConfig{Level: "info"},
+	}
+
+	changes := make(map[string]ConfigChange)
+	for _, change := range DiffAgentConfig(oldCfg, newCfg) {
+		changes[change.Field] = change
+	}
+
+	want := map[string]bool{
+		"monitor.interface":       true,  // 需要重启
+		"monitor.report_interval": false, // 热加载
+		"reporter.tags":           false,
+		"reporter.auth.api_key":   true,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want fields %v", changes, want)
+	}
+	for field, needsRestart := range want {
+		change, ok := changes[field]
+		if !ok {
+			t.Fatalf("missing change for %s in %v", field, changes)
+		}
+		if change.NeedsRestart != needsRestart {
+			t.Errorf("%s NeedsRestart = %v, want %v", field, change.NeedsRestart, needsRestart)
+		}
+	}
+
+	if got := changes["monitor.report_interval"]; got.Old != 10*time.Second || got.New != 30*time.Second {
+		t.Errorf("report_interval change = %v -> %v", got.Old, got.New)
+	}
+	// 敏感配置不输出原值
+	if got := changes["reporter.auth.api_key"]; got.Old != maskedValue || got.New != maskedValue {
+		t.Errorf("api_key change = %v -> %v, want masked", got.Old, got.New)
+	}
+}
+
+func TestDiffServerConfigUnchanged(t *testing.T) {
+	cfg := &ServerAppConfig{}
+	if changes := DiffServerConfig(cfg, &ServerAppConfig{}); len(changes) != 0 {
+		t.Fatalf("changes = %v, want none", changes)
+	}
+}
+
+func TestIsHotKeyMatchesPrefix(t *testing.T) {
+	for key, want := range map[string]bool{
+		"monitor.filters":                 true,
+		"monitor.filters.ignore_ports":    true,
+		"monitor.filters_extra":           false,
+		"storage.file.max_bytes":          true,
+		"storage.file.path":               false,
+		"reporter.retry_delay":            true,
+		"reporter.retry_delay_multiplier": false,
+	} {
+		if got := isHotKey(key, append(agentHotReloadKeys, serverHotReloadKeys...)); got != want {
+			t.Errorf("isHotKey(%s) = %v, want %v", key, got, want)
+		}
+	}
+}
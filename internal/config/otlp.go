@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// OTLP协议
+const (
+	OTLPProtocolHTTP = "http" // OTLP/HTTP，protobuf编码，默认端口4318
+	OTLPProtocolGRPC = "grpc" // OTLP/gRPC，默认端口4317
+)
+
+// OTLPConfig Server端OTLP导出配置，将收到的上报数据转发到OpenTelemetry Collector
+type OTLPConfig struct {
+	Enabled            bool              `yaml:"enabled"`
+	Protocol           string            `yaml:"protocol"`            // http 或 grpc
+	Endpoint           string            `yaml:"endpoint"`            // http为基础URL（如 http://localhost:4318），grpc为 host:port
+	Insecure           bool              `yaml:"insecure"`            // grpc不使用TLS
+	Compression        string            `yaml:"compression"`         // none 或 gzip
+	Headers            map[string]string `yaml:"headers"`             // 附加的请求头（gRPC为metadata）
+	Timeout            time.Duration     `yaml:"timeout"`             // 单次导出超时
+	ResourceAttributes map[string]string `yaml:"resource_attributes"` // 附加的资源属性
+
+	BatchSize     int           `yaml:"batch_size"`     // 每批上报条数
+	FlushInterval time.Duration `yaml:"flush_interval"` // 未满一批时的最长等待时间
+	QueueSize     int           `yaml:"queue_size"`     // 队列长度，满时丢弃新数据
+	RetryCount    int           `yaml:"retry_count"`    // 可重试错误的重试次数，默认3
+}
+
+// validateOTLP 验证Server端OTLP配置并补全默认值
+func validateOTLP(c *OTLPConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if err := validateOTLPEndpoint(&c.Protocol, c.Endpoint, &c.Compression); err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 5 * time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1000
+	}
+	if c.RetryCount < 0 {
+		return fmt.Errorf("otlp: retry_count 不能为负数")
+	}
+	if c.RetryCount == 0 {
+		c.RetryCount = 3
+	}
+	return nil
+}
+
+// validateOTLPEndpoint 验证OTLP协议、地址和压缩算法（Agent输出目标和Server共用）
+func validateOTLPEndpoint(protocol *string, endpoint string, compression *string) error {
+	switch *protocol {
+	case "":
+		*protocol = OTLPProtocolHTTP
+	case OTLPProtocolHTTP, OTLPProtocolGRPC:
+	default:
+		return fmt.Errorf("protocol必须是 http 或 grpc")
+	}
+
+	switch *compression {
+	case "":
+		*compression = "none"
+	case "none", "gzip":
+	default:
+		return fmt.Errorf("compression必须是 none 或 gzip")
+	}
+
+	if endpoint == "" {
+		return fmt.Errorf("endpoint不能为空")
+	}
+	if *protocol == OTLPProtocolHTTP {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint必须是http(s)地址，如 http://localhost:4318: %s", endpoint)
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return fmt.Errorf("endpoint必须是 host:port，如 localhost:4317: %s", endpoint)
+	}
+	return nil
+}
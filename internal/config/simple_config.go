@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -47,9 +48,63 @@ func SimpleLoadAgentConfig(configPath string) (*AgentConfig, error) {
 	if config.Reporter.RetryDelay == 0 {
 		config.Reporter.RetryDelay = 5 * time.Second
 	}
+	if config.Reporter.MaxRetryDelay == 0 {
+		config.Reporter.MaxRetryDelay = 2 * time.Minute
+	}
+	if config.Reporter.BreakerThreshold == 0 {
+		config.Reporter.BreakerThreshold = 5
+	}
+	if config.Reporter.Encoding == "" {
+		config.Reporter.Encoding = "json"
+	}
+	if config.Reporter.Compression == "" {
+		config.Reporter.Compression = "none"
+	}
+	if config.Reporter.Transport == "" {
+		config.Reporter.Transport = "http"
+	}
+	if err := validateSinks(&config.Reporter); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+	if err := validateCardinality("reporter.cardinality", &config.Reporter.Cardinality); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
 	if config.Reporter.BatchSize == 0 {
 		config.Reporter.BatchSize = 100
 	}
+	if config.Reporter.Mode == "" {
+		config.Reporter.Mode = "incremental"
+	}
+	if config.Reporter.StateDir == "" {
+		config.Reporter.StateDir = "/var/lib/netmon"
+	}
+	if config.Reporter.Spool.Dir == "" {
+		config.Reporter.Spool.Dir = filepath.Join(config.Reporter.StateDir, "spool")
+	}
+	if config.Reporter.Spool.MaxBytes == 0 {
+		config.Reporter.Spool.MaxBytes = 64 << 20
+	}
+	if config.Reporter.Spool.MaxAge == 0 {
+		config.Reporter.Spool.MaxAge = 24 * time.Hour
+	}
+	if config.Reporter.Spool.SegmentBytes == 0 {
+		config.Reporter.Spool.SegmentBytes = 1 << 20
+	}
+	if config.HTTP.Host == "" {
+		config.HTTP.Host = "0.0.0.0"
+	}
+	if config.HTTP.Port == 0 {
+		config.HTTP.Port = 9091
+	}
+	if config.HTTP.MetricsPath == "" {
+		config.HTTP.MetricsPath = "/metrics"
+	}
+	if config.Persistence.StateFile == "" {
+		config.Persistence.StateFile = "/var/lib/netmon/agent-state.json"
+	}
+	if config.Persistence.SaveInterval == 0 {
+		config.Persistence.SaveInterval = 30 * time.Second
+	}
 	if config.Log.Level == "" {
 		config.Log.Level = "info"
 	}
@@ -108,6 +163,12 @@ func SimpleLoadServerConfig(configPath string) (*ServerAppConfig, error) {
 	if logLevel := os.Getenv("LOG_LEVEL"); logLevel != "" {
 		config.Log.Level = logLevel
 	}
+	if adminToken := os.Getenv("AUTH_ADMIN_TOKEN"); adminToken != "" {
+		config.Auth.AdminToken = adminToken
+	}
+	if enrollmentToken := os.Getenv("AUTH_ENROLLMENT_TOKEN"); enrollmentToken != "" {
+		config.Auth.EnrollmentToken = enrollmentToken
+	}
 
 	// 设置默认值
 	if config.HTTP.Host == "" {
@@ -122,6 +183,12 @@ func SimpleLoadServerConfig(configPath string) (*ServerAppConfig, error) {
 	if config.HTTP.WriteTimeout == 0 {
 		config.HTTP.WriteTimeout = 30 * time.Second
 	}
+	if config.GRPC.Host == "" {
+		config.GRPC.Host = config.HTTP.Host
+	}
+	if config.GRPC.Port == 0 {
+		config.GRPC.Port = 8081
+	}
 	if config.Metrics.Path == "" {
 		config.Metrics.Path = "/metrics"
 	}
@@ -162,6 +229,29 @@ func SimpleLoadServerConfig(configPath string) (*ServerAppConfig, error) {
 		config.Log.Output = "stdout"
 	}
 
+	if config.Advanced.AgentTimeout <= 0 {
+		config.Advanced.AgentTimeout = 5 * time.Minute
+	}
+	if config.Advanced.QueryMaxReports <= 0 {
+		config.Advanced.QueryMaxReports = 10000
+	}
+
+	if err := validateServerTLS(&config.HTTP); err != nil {
+		return nil, err
+	}
+	if err := validateAuth(&config.Auth); err != nil {
+		return nil, err
+	}
+	if err := validateOTLP(&config.OTLP); err != nil {
+		return nil, err
+	}
+	if err := validateCardinality("metrics.cardinality", &config.Metrics.Cardinality); err != nil {
+		return nil, err
+	}
+	if err := validateFileStorage(&config.Storage); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 上报输出目标类型
+const (
+	SinkHTTP   = "http"   // 中心Server（使用reporter的server_url/transport、重试、熔断和磁盘缓存配置）
+	SinkFile   = "file"   // 本地NDJSON文件，按大小轮转
+	SinkStdout = "stdout" // 标准输出，每行一个JSON
+	SinkUnix   = "unix"   // Unix域套接字，每行一个JSON
+
+	SinkRemoteWrite = "remote_write" // Prometheus remote_write，snappy压缩的protobuf
+	SinkOTLP        = "otlp"         // OpenTelemetry OTLP（HTTP或gRPC），计数为Sum指标，事件为日志
+	SinkInflux      = "influx"       // InfluxDB行协议（HTTP写入接口或UDP）
+	SinkStatsD      = "statsd"       // StatsD/DogStatsD（UDP），计数转换为增量
+)
+
+// labelNamePattern Prometheus标签名规则
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SinkConfig 上报输出目标配置
+// 除http外，每个输出目标有独立的队列、批处理和重试，互不阻塞
+type SinkConfig struct {
+	Type string `yaml:"type"` // http, file, stdout, unix, remote_write, otlp, influx, statsd
+	Name string `yaml:"name"` // 名称，用于日志和统计，默认与类型相同
+
+	BatchSize     int           `yaml:"batch_size"`      // 每批条数
+	FlushInterval time.Duration `yaml:"flush_interval"`  // 未满一批时的最长等待时间
+	QueueSize     int           `yaml:"queue_size"`      // 队列长度，满时丢弃新数据
+	Timeout       time.Duration `yaml:"timeout"`         // 单次写出超时，默认与reporter.timeout相同
+	RetryCount    int           `yaml:"retry_count"`     // 重试次数，默认与reporter.retry_count相同
+	RetryDelay    time.Duration `yaml:"retry_delay"`     // 首次重试间隔，默认与reporter.retry_delay相同
+	MaxRetryDelay time.Duration `yaml:"max_retry_delay"` // 最大重试间隔，默认与reporter.max_retry_delay相同
+
+	Path       string `yaml:"path"`        // 文件路径或套接字路径（file、unix）
+	MaxBytes   int64  `yaml:"max_bytes"`   // 单个文件大小上限，超出时轮转（file）
+	MaxBackups int    `yaml:"max_backups"` // 保留的轮转文件数（file）
+	Network    string `yaml:"network"`     // unix 或 unixgram（unix）
+
+	URL            string            `yaml:"url"`             // 写入地址（remote_write、influx的http协议）
+	ExternalLabels map[string]string `yaml:"external_labels"` // 附加到每条序列的标签，不覆盖同名标签（remote_write）
+	Headers        map[string]string `yaml:"headers"`         // 附加的请求头，如 Authorization、X-Scope-OrgID（remote_write、otlp、influx）
+
+	Protocol           string            `yaml:"protocol"`            // http 或 grpc（otlp），http 或 udp（influx）
+	Endpoint           string            `yaml:"endpoint"`            // otlp: http为基础URL，grpc为 host:port；influx的udp协议和statsd: host:port
+	Insecure           bool              `yaml:"insecure"`            // grpc不使用TLS（otlp）
+	Compression        string            `yaml:"compression"`         // none 或 gzip（otlp）
+	ResourceAttributes map[string]string `yaml:"resource_attributes"` // 附加的资源属性（otlp）
+
+	Prefix       string            `yaml:"prefix"`         // measurement或指标名前缀，默认netmon（influx、statsd）
+	Tags         map[string]string `yaml:"tags"`           // 附加的标签（influx、statsd）
+	TagFormat    string            `yaml:"tag_format"`     // dogstatsd、telegraf 或 none（statsd）
+	MaxTagValues int               `yaml:"max_tag_values"` // 每个维度（域名、IP、协议、端口）最多的标签值，超出的合并为other（influx、statsd）
+}
+
+// HasSink 是否配置了指定类型的输出目标
+func (r *ReporterConfig) HasSink(sinkType string) bool {
+	for _, sink := range r.Sinks {
+		if sink.Type == sinkType {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSinks 验证输出目标配置并补全默认值，未配置时只上报到中心Server
+func validateSinks(r *ReporterConfig) error {
+	if len(r.Sinks) == 0 {
+		r.Sinks = []SinkConfig{{Type: SinkHTTP}}
+	}
+
+	names := make(map[string]bool, len(r.Sinks))
+	httpSinks := 0
+
+	for i := range r.Sinks {
+		sink := &r.Sinks[i]
+
+		if sink.Name == "" {
+			sink.Name = sink.Type
+		}
+		if names[sink.Name] {
+			return fmt.Errorf("reporter.sinks[%d]: 名称 %q 重复", i, sink.Name)
+		}
+		names[sink.Name] = true
+
+		if sink.BatchSize <= 0 {
+			sink.BatchSize = 1
+		}
+		if sink.FlushInterval <= 0 {
+			sink.FlushInterval = 5 * time.Second
+		}
+		if sink.QueueSize <= 0 {
+			sink.QueueSize = 100
+		}
+		if sink.Timeout <= 0 {
+			sink.Timeout = r.Timeout
+		}
+		if sink.RetryCount < 0 {
+			return fmt.Errorf("reporter.sinks[%d]: retry_count 不能为负数", i)
+		}
+		if sink.RetryCount == 0 {
+			sink.RetryCount = r.RetryCount
+		}
+		if sink.RetryDelay <= 0 {
+			sink.RetryDelay = r.RetryDelay
+		}
+		if sink.MaxRetryDelay <= 0 {
+			sink.MaxRetryDelay = r.MaxRetryDelay
+		}
+		if sink.MaxRetryDelay < sink.RetryDelay {
+			sink.MaxRetryDelay = sink.RetryDelay
+		}
+
+		switch sink.Type {
+		case SinkHTTP:
+			httpSinks++
+			if httpSinks > 1 {
+				return fmt.Errorf("reporter.sinks[%d]: 只能配置一个http输出目标", i)
+			}
+			if r.ServerURL == "" && r.Transport != "grpc" {
+				return fmt.Errorf("reporter.server_url 不能为空")
+			}
+		case SinkFile:
+			if sink.Path == "" {
+				return fmt.Errorf("reporter.sinks[%d]: file输出目标的path不能为空", i)
+			}
+			if sink.MaxBytes <= 0 {
+				sink.MaxBytes = 100 << 20
+			}
+			if sink.MaxBackups <= 0 {
+				sink.MaxBackups = 5
+			}
+		case SinkStdout:
+		case SinkUnix:
+			if sink.Path == "" {
+				return fmt.Errorf("reporter.sinks[%d]: unix输出目标的path不能为空", i)
+			}
+			switch sink.Network {
+			case "":
+				sink.Network = "unix"
+			case "unix", "unixgram":
+			default:
+				return fmt.Errorf("reporter.sinks[%d]: network必须是 unix 或 unixgram", i)
+			}
+		case SinkRemoteWrite:
+			if err := validateRemoteWrite(sink); err != nil {
+				return fmt.Errorf("reporter.sinks[%d]: %w", i, err)
+			}
+		case SinkOTLP:
+			if err := validateOTLPEndpoint(&sink.Protocol, sink.Endpoint, &sink.Compression); err != nil {
+				return fmt.Errorf("reporter.sinks[%d]: %w", i, err)
+			}
+		case SinkInflux, SinkStatsD:
+			if err := validateLineSink(sink); err != nil {
+				return fmt.Errorf("reporter.sinks[%d]: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("reporter.sinks[%d]: 不支持的类型 %q", i, sink.Type)
+		}
+	}
+
+	return nil
+}
+
+// validateRemoteWrite 验证remote_write输出目标的地址和外部标签
+func validateRemoteWrite(sink *SinkConfig) error {
+	if sink.URL == "" {
+		return fmt.Errorf("remote_write输出目标的url不能为空")
+	}
+	u, err := url.Parse(sink.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("remote_write输出目标的url无效: %s", sink.URL)
+	}
+
+	for name := range sink.ExternalLabels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("external_labels: 无效的标签名 %q", name)
+		}
+	}
+	return nil
+}
+
+// validateLineSink 验证influx和statsd输出目标并补全默认值
+func validateLineSink(sink *SinkConfig) error {
+	if sink.Prefix == "" {
+		sink.Prefix = "netmon"
+	}
+	if sink.MaxTagValues < 0 {
+		return fmt.Errorf("max_tag_values 不能为负数")
+	}
+	if sink.MaxTagValues == 0 {
+		sink.MaxTagValues = 100
+	}
+
+	if sink.Type == SinkStatsD {
+		if sink.Endpoint == "" {
+			sink.Endpoint = "127.0.0.1:8125"
+		}
+		switch sink.TagFormat {
+		case "":
+			sink.TagFormat = "dogstatsd"
+		case "dogstatsd", "telegraf", "none":
+		default:
+			return fmt.Errorf("tag_format必须是 dogstatsd、telegraf 或 none")
+		}
+		if _, _, err := net.SplitHostPort(sink.Endpoint); err != nil {
+			return fmt.Errorf("endpoint必须是 host:port: %s", sink.Endpoint)
+		}
+		return nil
+	}
+
+	switch sink.Protocol {
+	case "", "http":
+		sink.Protocol = "http"
+		u, err := url.Parse(sink.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("influx输出目标的url无效，如 http://localhost:8086/api/v2/write?org=o&bucket=b: %s", sink.URL)
+		}
+	case "udp":
+		if _, _, err := net.SplitHostPort(sink.Endpoint); err != nil {
+			return fmt.Errorf("endpoint必须是 host:port: %s", sink.Endpoint)
+		}
+	default:
+		return fmt.Errorf("influx输出目标的protocol必须是 http 或 udp")
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 客户端证书校验方式（http.client_auth）
+const (
+	ClientAuthNone     = "none"     // 不要求客户端证书
+	ClientAuthOptional = "optional" // 客户端提供证书时校验
+	ClientAuthRequire  = "require"  // 必须提供有效的客户端证书
+)
+
+// validateServerTLS 验证Server端TLS配置（HTTP和gRPC共用）
+func validateServerTLS(c *HTTPConfig) error {
+	c.ClientAuth = strings.ToLower(c.ClientAuth)
+	switch c.ClientAuth {
+	case "":
+		c.ClientAuth = ClientAuthNone
+	case ClientAuthNone, ClientAuthOptional, ClientAuthRequire:
+	default:
+		return fmt.Errorf("http.client_auth 必须是 none、optional 或 require")
+	}
+
+	if !c.EnableTLS {
+		return nil
+	}
+	if c.TLSCertPath == "" || c.TLSKeyPath == "" {
+		return fmt.Errorf("启用TLS时 http.tls_cert_path 和 http.tls_key_path 不能为空")
+	}
+	if c.ClientAuth != ClientAuthNone && c.TLSCAPath == "" {
+		return fmt.Errorf("http.client_auth 为 %s 时 http.tls_ca_path 不能为空", c.ClientAuth)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadDebounce 文件变更去抖时间，编辑器保存时通常会产生多个事件
+const reloadDebounce = 500 * time.Millisecond
+
+// Watcher 配置文件监听器，文件变更（fsnotify）或收到SIGHUP时触发重新加载
+type Watcher struct {
+	path     string
+	logger   *logrus.Logger
+	onReload func()
+	watcher  *fsnotify.Watcher
+	sigChan  chan os.Signal
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewWatcher 创建配置文件监听器
+func NewWatcher(path string, logger *logrus.Logger, onReload func()) (*Watcher, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件路径失败: %w", err)
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("创建文件监听器失败: %w", err)
+	}
+
+	return &Watcher{
+		path:     absPath,
+		logger:   logger,
+		onReload: onReload,
+		watcher:  fsWatcher,
+		sigChan:  make(chan os.Signal, 1),
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start 开始监听配置文件和SIGHUP信号
+func (w *Watcher) Start() error {
+	// 监听所在目录而不是文件本身，以便处理编辑器原子替换和Kubernetes ConfigMap的符号链接切换
+	if err := w.watcher.Add(filepath.Dir(w.path)); err != nil {
+		w.watcher.Close()
+		return fmt.Errorf("监听配置目录失败: %w", err)
+	}
+
+	signal.Notify(w.sigChan, syscall.SIGHUP)
+
+	w.wg.Add(1)
+	go w.run()
+
+	w.logger.WithField("path", w.path).Info("配置热加载已启用 (文件变更或SIGHUP)")
+	return nil
+}
+
+// Stop 停止监听
+func (w *Watcher) Stop() {
+	signal.Stop(w.sigChan)
+	close(w.stopChan)
+	w.watcher.Close()
+	w.wg.Wait()
+}
+
+// run 事件循环
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.isConfigEvent(event) {
+				continue
+			}
+			w.logger.WithFields(logrus.Fields{
+				"file": event.Name,
+				"op":   event.Op.String(),
+			}).Debug("检测到配置文件变更")
+			debounce = time.After(reloadDebounce)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.WithError(err).Warn("配置文件监听错误")
+
+		case <-debounce:
+			debounce = nil
+			w.logger.WithField("trigger", "file").Info("重新加载配置")
+			w.onReload()
+
+		case <-w.sigChan:
+			w.logger.WithField("trigger", "SIGHUP").Info("重新加载配置")
+			w.onReload()
+
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// isConfigEvent 判断事件是否与配置文件有关
+func (w *Watcher) isConfigEvent(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		return false
+	}
+
+	name := filepath.Clean(event.Name)
+	// Kubernetes ConfigMap更新时替换 ..data 符号链接
+	return name == w.path || filepath.Base(name) == "..data"
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWatcherReloadsOnFileChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.yaml")
+	if err := os.WriteFile(path, []byte("log:\n  level: info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	reloads := make(chan struct{}, 10)
+	w, err := NewWatcher(path, logger, func() { reloads <- struct{}{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// 同目录其他文件的变更不触发重新加载
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+		t.Fatal("reload triggered by an unrelated file")
+	case <-time.After(2 * reloadDebounce):
+	}
+
+	// 编辑器式的原子替换：连续多个事件只触发一次重新加载
+	tmp := path + ".swp"
+	if err := os.WriteFile(tmp, []byte("log:\n  level: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("log:\n  level: warn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after the config file changed")
+	}
+	select {
+	case <-reloads:
+		t.Fatal("burst of events reloaded more than once")
+	case <-time.After(2 * reloadDebounce):
+	}
+}
@@ -0,0 +1,630 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/auth"
+	"go-net-monitoring/pkg/metrics"
+	"go-net-monitoring/pkg/tlsutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// stateKindAPIKeys API Key记录的状态类型，ID为Agent ID
+const stateKindAPIKeys = "api_keys"
+
+// authRefreshInterval 从存储重新加载API Key的间隔（多个Server共用Redis时同步签发和吊销）
+const authRefreshInterval = 30 * time.Second
+
+// authMissReloadInterval 令牌未命中时重新加载的最小间隔（命令行创建的令牌无需等待定期刷新）
+const authMissReloadInterval = 5 * time.Second
+
+// ctxAuthAgentID gin上下文中已认证的Agent ID
+const ctxAuthAgentID = "auth_agent_id"
+
+// 认证失败原因（server_auth_failures_total的reason标签）
+const (
+	authFailMissingToken = "missing_token"
+	authFailInvalidToken = auth.ReasonInvalidToken
+	authFailBadSignature = "bad_signature"
+	authFailExpired      = "expired"
+	authFailReplay       = "replay"
+	authFailMismatch     = "agent_mismatch"
+	authFailCertMismatch = "cert_mismatch"
+	authFailEnrollment   = "enrollment_token"
+)
+
+// 签发来源
+const (
+	keySourceEnroll = "enroll"
+	keySourceAdmin  = "admin"
+)
+
+// ErrKeyExists Agent已有API Key
+var ErrKeyExists = errors.New("api key already exists")
+
+// APIKeyRecord Agent的API Key记录，不保存Key本身
+// KeyHash只用于查找，SigningKey只用于校验签名；两者都不能还原Key，缺少Key无法通过认证
+type APIKeyRecord struct {
+	AgentID    string    `json:"agent_id"`
+	KeyID      string    `json:"key_id"`      // Key的前缀，用于识别
+	KeyHash    string    `json:"key_hash"`    // SHA-256(api_key)
+	SigningKey string    `json:"signing_key"` // HMAC-SHA256(api_key, "sign")
+	Hostname   string    `json:"hostname,omitempty"`
+	Source     string    `json:"source"` // enroll 或 admin
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// APIKeyInfo 管理接口返回的API Key信息（不含哈希）
+type APIKeyInfo struct {
+	AgentID    string     `json:"agent_id"`
+	KeyID      string     `json:"key_id"`
+	Hostname   string     `json:"hostname,omitempty"`
+	Source     string     `json:"source"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// authService Agent认证：API Key签发、校验和请求签名验证
+type authService struct {
+	config  config.AuthConfig
+	storage Storage
+	logger  *logrus.Logger
+	metrics *metrics.Metrics
+
+	mu          sync.RWMutex
+	byHash      map[string]*APIKeyRecord // key_hash -> 记录
+	byAgent     map[string]*APIKeyRecord // agent_id -> 记录
+	lastUsed    map[string]time.Time     // agent_id -> 最近一次认证成功时间
+	tokens      map[string]*APIToken     // token_hash -> 令牌
+	tokenUsed   map[string]time.Time     // 令牌ID -> 最近一次认证成功时间
+	tokenAgents map[string]bool          // 令牌ID/agent_id -> 已记录过该令牌上报该Agent
+	lastReload  time.Time
+	lastMiss    time.Time // 最近一次因未命中而重新加载的时间
+
+	nonces *nonceCache
+}
+
+// newAuthService 创建认证服务并从存储加载已签发的API Key
+func newAuthService(cfg config.AuthConfig, storage Storage, logger *logrus.Logger, m *metrics.Metrics) (*authService, error) {
+	a := &authService{
+		config:      cfg,
+		storage:     storage,
+		logger:      logger,
+		metrics:     m,
+		byHash:      make(map[string]*APIKeyRecord),
+		byAgent:     make(map[string]*APIKeyRecord),
+		lastUsed:    make(map[string]time.Time),
+		tokens:      make(map[string]*APIToken),
+		tokenUsed:   make(map[string]time.Time),
+		tokenAgents: make(map[string]bool),
+		nonces:      newNonceCache(cfg.SignatureWindow),
+	}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload 从存储重新加载全部API Key和API令牌
+func (a *authService) reload() error {
+	values, err := a.storage.ListState(stateKindAPIKeys)
+	if err != nil {
+		return fmt.Errorf("加载API Key失败: %w", err)
+	}
+
+	byHash := make(map[string]*APIKeyRecord, len(values))
+	byAgent := make(map[string]*APIKeyRecord, len(values))
+	for _, value := range values {
+		record, err := decodeKeyRecord(value)
+		if err != nil {
+			a.logger.WithError(err).Warn("忽略无效的API Key记录")
+			continue
+		}
+		byHash[record.KeyHash] = record
+		byAgent[record.AgentID] = record
+	}
+
+	tokenList, err := ListAPITokens(a.storage)
+	if err != nil {
+		return err
+	}
+	tokens := make(map[string]*APIToken, len(tokenList))
+	for _, token := range tokenList {
+		tokens[token.TokenHash] = token
+	}
+
+	a.mu.Lock()
+	a.byHash = byHash
+	a.byAgent = byAgent
+	a.tokens = tokens
+	a.lastReload = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+// decodeKeyRecord 解码存储中的API Key记录
+func decodeKeyRecord(data []byte) (*APIKeyRecord, error) {
+	var record APIKeyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.AgentID == "" || record.KeyHash == "" || record.SigningKey == "" {
+		return nil, fmt.Errorf("缺少agent_id、key_hash或signing_key")
+	}
+	return &record, nil
+}
+
+// refreshIfStale 距上次加载超过authRefreshInterval时重新加载
+func (a *authService) refreshIfStale() {
+	a.mu.RLock()
+	stale := time.Since(a.lastReload) > authRefreshInterval
+	a.mu.RUnlock()
+
+	if stale {
+		if err := a.reload(); err != nil {
+			a.logger.WithError(err).Warn("刷新API Key失败，继续使用缓存")
+		}
+	}
+}
+
+// reloadNow 立即重新加载（本节点修改令牌后调用）
+func (a *authService) reloadNow() {
+	if err := a.reload(); err != nil {
+		a.logger.WithError(err).Warn("刷新API Key失败，继续使用缓存")
+	}
+}
+
+// reloadOnMiss 查找未命中时重新加载，至多每authMissReloadInterval一次；返回是否执行了加载
+func (a *authService) reloadOnMiss() bool {
+	a.mu.Lock()
+	if time.Since(a.lastMiss) < authMissReloadInterval {
+		a.mu.Unlock()
+		return false
+	}
+	a.lastMiss = time.Now()
+	a.mu.Unlock()
+
+	a.reloadNow()
+	return true
+}
+
+// lookup 按API Key查找记录
+func (a *authService) lookup(apiKey string) *APIKeyRecord {
+	a.refreshIfStale()
+
+	hash := auth.HashKey(apiKey)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	record := a.byHash[hash]
+	if record != nil {
+		a.lastUsed[record.AgentID] = time.Now()
+	}
+	return record
+}
+
+// issue 为Agent签发API Key，已存在时除非replace否则返回ErrKeyExists
+func (a *authService) issue(agentID, hostname, source string, replace bool) (string, *APIKeyRecord, error) {
+	a.refreshIfStale()
+
+	apiKey, err := auth.GenerateKey()
+	if err != nil {
+		return "", nil, err
+	}
+	record := &APIKeyRecord{
+		AgentID:    agentID,
+		KeyID:      auth.KeyID(apiKey),
+		KeyHash:    auth.HashKey(apiKey),
+		SigningKey: auth.SigningKey(apiKey),
+		Hostname:   hostname,
+		Source:     source,
+		CreatedAt:  time.Now(),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	old, exists := a.byAgent[agentID]
+	if exists && !replace {
+		return "", nil, ErrKeyExists
+	}
+
+	if err := a.storage.PutState(stateKindAPIKeys, agentID, *record); err != nil {
+		return "", nil, fmt.Errorf("保存API Key失败: %w", err)
+	}
+	if exists {
+		delete(a.byHash, old.KeyHash)
+	}
+	a.byHash[record.KeyHash] = record
+	a.byAgent[agentID] = record
+	delete(a.lastUsed, agentID)
+
+	return apiKey, record, nil
+}
+
+// revoke 吊销Agent的API Key，不存在时返回false
+func (a *authService) revoke(agentID string) (bool, error) {
+	a.refreshIfStale()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	record, exists := a.byAgent[agentID]
+	if !exists {
+		return false, nil
+	}
+	if err := a.storage.DeleteState(stateKindAPIKeys, agentID); err != nil && !errors.Is(err, ErrNotFound) {
+		return false, fmt.Errorf("删除API Key失败: %w", err)
+	}
+	delete(a.byHash, record.KeyHash)
+	delete(a.byAgent, agentID)
+	delete(a.lastUsed, agentID)
+	return true, nil
+}
+
+// list 列出全部API Key（按Agent ID排序）
+func (a *authService) list() []APIKeyInfo {
+	a.refreshIfStale()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	keys := make([]APIKeyInfo, 0, len(a.byAgent))
+	for _, record := range a.byAgent {
+		info := APIKeyInfo{
+			AgentID:   record.AgentID,
+			KeyID:     record.KeyID,
+			Hostname:  record.Hostname,
+			Source:    record.Source,
+			CreatedAt: record.CreatedAt,
+		}
+		if used, ok := a.lastUsed[record.AgentID]; ok {
+			info.LastUsedAt = &used
+		}
+		keys = append(keys, info)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].AgentID < keys[j].AgentID })
+	return keys
+}
+
+// reject 记录认证失败并返回错误响应
+func (a *authService) reject(c *gin.Context, status int, reason, message string) {
+	a.metrics.RecordAuthFailure(reason)
+	a.logger.WithFields(logrus.Fields{
+		"reason": reason,
+		"path":   c.Request.URL.Path,
+		"client": c.ClientIP(),
+	}).Warn("请求认证失败")
+
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Bearer realm="netmon"`)
+	}
+	c.Header(auth.HeaderAuthError, reason)
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": message,
+	})
+}
+
+// requireAgent Agent接口（上报、心跳）的认证中间件：校验API Key（有已验证的客户端证书时可省略），按配置校验签名
+// 也接受具有ingest角色的API令牌，令牌不绑定Agent，签名要求与API Key相同
+func (a *authService) requireAgent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		certNames := tlsutil.PeerIdentities(c.Request.TLS)
+		apiKey := auth.BearerToken(c.GetHeader("Authorization"))
+		if apiKey == "" {
+			// 已验证的客户端证书可以代替API Key，Agent ID由authorizeAgent按证书校验
+			if len(certNames) > 0 {
+				c.Next()
+				return
+			}
+			a.reject(c, http.StatusUnauthorized, authFailMissingToken, "missing api key")
+			return
+		}
+		if auth.IsToken(apiKey) {
+			if !a.authorizeToken(c, apiKey, RoleIngest) {
+				return
+			}
+			if a.config.RequireSignature || c.GetHeader(auth.HeaderSignature) != "" {
+				if !a.verifyRequest(c, auth.SigningKey(apiKey), tokenNonceScope(c.GetString(ctxAuthTokenID))) {
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		record := a.lookup(apiKey)
+		if record == nil {
+			a.reject(c, http.StatusUnauthorized, authFailInvalidToken, "invalid api key")
+			return
+		}
+		if len(certNames) > 0 && !containsString(certNames, record.AgentID) {
+			a.reject(c, http.StatusForbidden, authFailCertMismatch, "client certificate does not match api key")
+			return
+		}
+
+		if a.config.RequireSignature || c.GetHeader(auth.HeaderSignature) != "" {
+			if !a.verifyRequest(c, record.SigningKey, record.AgentID) {
+				return
+			}
+		}
+
+		c.Set(ctxAuthAgentID, record.AgentID)
+		c.Next()
+	}
+}
+
+// verifyRequest 校验请求签名、时间戳和nonce，失败时已写入错误响应
+// signingKey由凭据派生，nonceScope区分不同凭据的nonce
+func (a *authService) verifyRequest(c *gin.Context, signingKey, nonceScope string) bool {
+	timestamp := c.GetHeader(auth.HeaderTimestamp)
+	nonce := c.GetHeader(auth.HeaderNonce)
+	signature := c.GetHeader(auth.HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		a.reject(c, http.StatusUnauthorized, authFailBadSignature, "missing request signature")
+		return false
+	}
+
+	// 签名覆盖原始请求体，读取后放回供后续解码
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxReportBodyBytes+1))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return false
+	}
+	if len(body) > maxReportBodyBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": "request body too large",
+		})
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if reason, message := a.checkSignature(signingKey, nonceScope, c.Request.Method, c.Request.URL.Path, timestamp, nonce, body, signature); reason != "" {
+		a.reject(c, http.StatusUnauthorized, reason, message)
+		return false
+	}
+	return true
+}
+
+// checkSignature 校验时间戳窗口、签名和nonce，通过时返回空的失败原因
+func (a *authService) checkSignature(signingKey, nonceScope, method, path, timestamp, nonce string, body []byte, signature string) (string, string) {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return authFailBadSignature, "invalid signature timestamp"
+	}
+	skew := time.Since(time.Unix(unix, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > a.config.SignatureWindow {
+		return authFailExpired, "signature timestamp out of window"
+	}
+
+	if !auth.VerifySignature(signingKey, method, path, timestamp, nonce, body, signature) {
+		return authFailBadSignature, "invalid request signature"
+	}
+
+	// 签名通过后再登记nonce，避免伪造请求占用合法nonce
+	if !a.nonces.add(nonceScope + ":" + nonce) {
+		return authFailReplay, "nonce already used"
+	}
+	return "", ""
+}
+
+// authorizeAgent 校验请求中的Agent ID与客户端证书、API Key所属的Agent一致，失败时已写入错误响应
+func (s *Server) authorizeAgent(c *gin.Context, agentID string) bool {
+	reason, message := s.checkAgent(c, agentID)
+	if reason == "" {
+		return true
+	}
+	s.auth.reject(c, http.StatusForbidden, reason, message)
+	return false
+}
+
+// checkAgent 检查请求的认证身份（客户端证书、API Key或ingest令牌）是否允许使用该Agent ID，允许时返回空的失败原因
+func (s *Server) checkAgent(c *gin.Context, agentID string) (string, string) {
+	if names := tlsutil.PeerIdentities(c.Request.TLS); len(names) > 0 && !containsString(names, agentID) {
+		return authFailCertMismatch, "client certificate does not match agent id"
+	}
+
+	bound := c.GetString(ctxAuthAgentID)
+	if bound != "" && bound != agentID {
+		return authFailMismatch, "api key does not belong to this agent"
+	}
+	if value, ok := c.Get(ctxAuthToken); ok {
+		if token, ok := value.(*APIToken); ok && !s.auth.checkTokenAgent(token, agentID) {
+			return authFailMismatch, "token is not allowed to report for this agent"
+		}
+	}
+	return "", ""
+}
+
+// tokenNonceScope API令牌签名的nonce作用域，与API Key的Agent ID区分开
+func tokenNonceScope(tokenID string) string {
+	return "token/" + tokenID
+}
+
+// containsString 判断列表中是否包含指定字符串
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// enrollRequest Agent注册请求
+type enrollRequest struct {
+	AgentID  string `json:"agent_id" binding:"required"`
+	Hostname string `json:"hostname"`
+}
+
+// enrollResponse 注册响应，api_key只在签发时返回一次
+type enrollResponse struct {
+	AgentID   string    `json:"agent_id"`
+	APIKey    string    `json:"api_key"`
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleEnroll Agent使用注册令牌换取API Key，已注册的Agent需管理员吊销后才能重新注册
+func (s *Server) handleEnroll(c *gin.Context) {
+	if s.auth.config.EnrollmentToken == "" {
+		s.auth.reject(c, http.StatusForbidden, authFailEnrollment, "enrollment disabled")
+		return
+	}
+	token := auth.BearerToken(c.GetHeader("Authorization"))
+	if token == "" || !auth.TokenEqual(token, s.auth.config.EnrollmentToken) {
+		s.auth.reject(c, http.StatusUnauthorized, authFailEnrollment, "invalid enrollment token")
+		return
+	}
+
+	var req enrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	s.issueKey(c, req.AgentID, req.Hostname, keySourceEnroll, false)
+}
+
+// createKeyRequest 管理员签发API Key请求
+type createKeyRequest struct {
+	AgentID  string `json:"agent_id" binding:"required"`
+	Hostname string `json:"hostname"`
+	Rotate   bool   `json:"rotate"` // 已存在时替换（旧Key立即失效）
+}
+
+// handleCreateKey 管理员为Agent签发或轮换API Key
+func (s *Server) handleCreateKey(c *gin.Context) {
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	s.issueKey(c, req.AgentID, req.Hostname, keySourceAdmin, req.Rotate)
+}
+
+// issueKey 签发API Key并返回给调用方
+func (s *Server) issueKey(c *gin.Context, agentID, hostname, source string, replace bool) {
+	apiKey, record, err := s.auth.issue(agentID, hostname, source, replace)
+	if errors.Is(err, ErrKeyExists) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "agent already has an api key",
+		})
+		return
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("签发API Key失败")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to issue api key",
+		})
+		return
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"agent_id": record.AgentID,
+		"key_id":   record.KeyID,
+		"source":   source,
+		"replaced": replace,
+	}).Info("已签发API Key")
+
+	c.JSON(http.StatusCreated, enrollResponse{
+		AgentID:   record.AgentID,
+		APIKey:    apiKey,
+		KeyID:     record.KeyID,
+		CreatedAt: record.CreatedAt,
+	})
+}
+
+// handleListKeys 列出已签发的API Key（不含Key本身）
+func (s *Server) handleListKeys(c *gin.Context) {
+	keys := s.auth.list()
+	c.JSON(http.StatusOK, gin.H{
+		"keys":  keys,
+		"count": len(keys),
+	})
+}
+
+// handleRevokeKey 吊销Agent的API Key
+func (s *Server) handleRevokeKey(c *gin.Context) {
+	agentID := c.Param("agent_id")
+	revoked, err := s.auth.revoke(agentID)
+	if err != nil {
+		s.logger.WithError(err).Error("吊销API Key失败")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to revoke api key",
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "api key not found",
+		})
+		return
+	}
+
+	s.logger.WithField("agent_id", agentID).Info("已吊销API Key")
+	c.JSON(http.StatusOK, gin.H{
+		"status": "revoked",
+	})
+}
+
+// nonceCache 签名窗口内已使用的nonce
+type nonceCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time
+	nextSweep time.Time
+}
+
+// newNonceCache 创建nonce缓存，nonce在ttl内不可重复
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// add 登记nonce，已存在时返回false
+func (nc *nonceCache) add(nonce string) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	now := time.Now()
+	if now.After(nc.nextSweep) {
+		for key, expiry := range nc.seen {
+			if now.After(expiry) {
+				delete(nc.seen, key)
+			}
+		}
+		nc.nextSweep = now.Add(nc.ttl)
+	}
+
+	if expiry, ok := nc.seen[nonce]; ok && now.Before(expiry) {
+		return false
+	}
+	// 时间戳允许前后各偏差一个窗口，nonce需保留两个窗口
+	nc.seen[nonce] = now.Add(2 * nc.ttl)
+	return true
+}
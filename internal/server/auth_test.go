@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAgentSignatureForEveryCredential(t *testing.T) {
+	s := newTestAuthServer(t, config.AuthConfig{RequireSignature: true})
+	apiKey, _, err := s.auth.issue("agent-a", "host-a", keySourceAdmin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := CreateAPIToken(s.storage, "fleet", []string{RoleIngest}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.auth.reloadNow()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/heartbeat", s.auth.requireAgent(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	body := []byte(`{"id":"agent-a"}`)
+	send := func(credential, signingKey, nonce string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/heartbeat", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+credential)
+		if signingKey != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(auth.HeaderTimestamp, timestamp)
+			req.Header.Set(auth.HeaderNonce, nonce)
+			req.Header.Set(auth.HeaderSignature, auth.Sign(signingKey, req.Method, req.URL.Path, timestamp, nonce, body))
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// ingest令牌与API Key一样必须签名，nonce不能重放
+	tests := []struct {
+		name       string
+		credential string
+		signingKey string
+		nonce      string
+		code       int
+	}{
+		{"unsigned api key", apiKey, "", "", http.StatusUnauthorized},
+		{"signed api key", apiKey, auth.SigningKey(apiKey), "n1", http.StatusOK},
+		{"replayed api key nonce", apiKey, auth.SigningKey(apiKey), "n1", http.StatusUnauthorized},
+		{"unsigned token", token, "", "", http.StatusUnauthorized},
+		{"token signed with wrong key", token, auth.SigningKey(apiKey), "n2", http.StatusUnauthorized},
+		{"signed token", token, auth.SigningKey(token), "n3", http.StatusOK},
+		{"replayed token nonce", token, auth.SigningKey(token), "n3", http.StatusUnauthorized},
+		{"token nonce independent of api key", token, auth.SigningKey(token), "n1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := send(tt.credential, tt.signingKey, tt.nonce); code != tt.code {
+				t.Fatalf("status = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// cumulativeAggregator Server端全局累计统计（storage.cumulative_mode启用），
+// 由CumulativeManager或SimpleCumulativeManager实现
+type cumulativeAggregator interface {
+	common.MetricsAggregator
+
+	// GetAgentState 获取Agent的重启次数和基线，Agent不存在时返回false
+	GetAgentState(agentID string) (*AgentCumulativeState, bool)
+
+	// ProcessDelta 处理可能只有增量数据的报告：没有TotalStats时在同一次加锁内用该Agent本次启动以来的累计值
+	// 加上增量得到TotalStats，再按ProcessMetrics处理
+	ProcessDelta(report common.MetricsReport) error
+
+	Close() error
+}
+
+// AgentCumulativeState Agent在累计统计中的状态
+type AgentCumulativeState struct {
+	AgentID        string                          `json:"agent_id"`
+	StartupTime    time.Time                       `json:"startup_time"`
+	LastReportTime time.Time                       `json:"last_report_time"`
+	IsActive       bool                            `json:"is_active"`
+	RestartCount   int                             `json:"restart_count"`
+	Baselines      map[string]common.DomainMetrics `json:"baselines,omitempty"` // 历次重启前的累计值
+	Current        map[string]common.DomainMetrics `json:"current,omitempty"`   // 本次启动以来的累计值
+	Totals         map[string]common.DomainMetrics `json:"totals,omitempty"`    // 计入全局累计的值（基线 + 本次启动以来）
+}
+
+// newCumulativeAggregator 按存储配置创建累计管理器
+// 启用重启检测时使用CumulativeManager（启动时间和计数回退两种检测，可选基线跟踪），
+// 否则使用只按启动时间检测重启的SimpleCumulativeManager
+func newCumulativeAggregator(cfg *config.StorageConfig, logger *logrus.Logger) cumulativeAggregator {
+	if cfg.AgentRestartDetection {
+		return NewCumulativeManager(logger, true, cfg.BaselineTracking)
+	}
+	return NewSimpleCumulativeManager(logger, cfg.BaselineTracking)
+}
+
+// cumulativeReport 从上报请求构建累计管理器使用的报告
+// Agent没有附带TotalStats时（增量模式）使用请求中的Agent累计数据
+func cumulativeReport(request *common.ReportRequest) common.MetricsReport {
+	var report common.MetricsReport
+	if request.Report != nil {
+		report = *request.Report
+	}
+	if report.AgentID == "" {
+		report.AgentID = request.AgentID
+	}
+	if report.ReportTime.IsZero() {
+		report.ReportTime = request.Timestamp
+	}
+	if len(report.TotalStats) == 0 {
+		report.TotalStats = common.DomainMetricsFromNetworkMetrics(request.Metrics)
+	}
+	return report
+}
+
+// fillTotalsFromDelta 没有TotalStats的报告，用state中本次启动以来的累计值加上增量得到TotalStats
+// state为nil或Agent已重启时只使用增量
+func fillTotalsFromDelta(state *AgentCumulativeState, report *common.MetricsReport) {
+	if len(report.TotalStats) > 0 || len(report.DeltaStats) == 0 {
+		return
+	}
+
+	totals := make(map[string]common.DomainMetrics)
+	if state != nil && state.StartupTime.Equal(report.StartupTime) {
+		totals = copyDomainMetrics(state.Current)
+	}
+	for domain, delta := range report.DeltaStats {
+		delta.Domain = domain
+		if current, exists := totals[domain]; exists {
+			delta = common.MergeMetrics(current, delta)
+		}
+		totals[domain] = delta
+	}
+	report.TotalStats = totals
+}
+
+// copyDomainMetrics 复制域名指标映射
+func copyDomainMetrics(src map[string]common.DomainMetrics) map[string]common.DomainMetrics {
+	dst := make(map[string]common.DomainMetrics, len(src))
+	for domain, stats := range src {
+		dst[domain] = stats
+	}
+	return dst
+}
+
+// handleGetCumulative 获取全局累计指标
+func (s *Server) handleGetCumulative(c *gin.Context) {
+	if !s.requireCumulative(c) {
+		return
+	}
+
+	metrics, err := s.cumulative.GetCumulativeMetrics()
+	if err != nil {
+		s.logger.WithError(err).Error("获取累计指标失败")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to get cumulative metrics",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
+
+// handleGetCumulativeDomain 获取指定域名的累计指标
+func (s *Server) handleGetCumulativeDomain(c *gin.Context) {
+	if !s.requireCumulative(c) {
+		return
+	}
+
+	domain := c.Param("domain")
+	metrics, err := s.cumulative.GetDomainMetrics(domain)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "domain not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
+
+// handleGetAgentState 获取Agent的累计状态（重启次数、基线）
+func (s *Server) handleGetAgentState(c *gin.Context) {
+	if !s.requireCumulative(c) {
+		return
+	}
+
+	state, exists := s.cumulative.GetAgentState(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "agent not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
+
+// requireCumulative 未启用累计模式时返回404
+func (s *Server) requireCumulative(c *gin.Context) bool {
+	if s.cumulative == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "cumulative mode is disabled (storage.cumulative_mode)",
+		})
+		return false
+	}
+	return true
+}
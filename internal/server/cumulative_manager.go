@@ -54,10 +54,29 @@ func (cm *CumulativeManager) ProcessMetrics(report common.MetricsReport) error {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
+	return cm.processMetrics(report)
+}
+
+// ProcessDelta 处理只有增量数据的报告，读取累计值和更新在同一次加锁内完成
+func (cm *CumulativeManager) ProcessDelta(report common.MetricsReport) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	state, _ := cm.agentState(report.AgentID)
+	fillTotalsFromDelta(state, &report)
+	return cm.processMetrics(report)
+}
+
+// processMetrics 处理Agent上报的指标，调用方需持有写锁
+func (cm *CumulativeManager) processMetrics(report common.MetricsReport) error {
 	agentID := report.AgentID
 
 	// 检测Agent重启
 	restartResult := cm.detectAgentRestart(agentID, report)
+
+	// 记录更新前该Agent对全局累计的贡献
+	previous := cm.agentContribution(agentID)
+
 	if restartResult.IsRestart && cm.enableBaselineTracking {
 		cm.handleAgentRestart(agentID, report)
 	}
@@ -69,7 +88,7 @@ func (cm *CumulativeManager) ProcessMetrics(report common.MetricsReport) error {
 	cm.storage.RawMetrics[agentID] = report
 
 	// 计算并更新累计指标
-	cm.updateCumulativeMetrics(agentID, report, restartResult.IsRestart)
+	cm.updateCumulativeMetrics(agentID, previous)
 
 	cm.storage.LastUpdated = time.Now()
 
@@ -191,56 +210,47 @@ func (cm *CumulativeManager) updateAgentState(agentID string, report common.Metr
 	cm.storage.AgentStates[agentID] = state
 }
 
-// updateCumulativeMetrics 更新累计指标
-func (cm *CumulativeManager) updateCumulativeMetrics(agentID string, report common.MetricsReport, isRestart bool) {
-	// 处理每个域名的指标
-	for domain, currentStats := range report.TotalStats {
-		// 计算真实的累计值
-		realCumulative := currentStats
+// agentContribution Agent对全局累计的贡献：启用基线跟踪时为重启基线加本次启动以来的累计
+func (cm *CumulativeManager) agentContribution(agentID string) map[string]common.DomainMetrics {
+	contribution := make(map[string]common.DomainMetrics)
+	if cm.enableBaselineTracking {
+		for domain, baseline := range cm.storage.RestartBaselines[agentID] {
+			contribution[domain] = baseline
+		}
+	}
 
-		// 如果启用基线跟踪，加上重启前的基线值
-		if cm.enableBaselineTracking {
-			if baselines, hasAgent := cm.storage.RestartBaselines[agentID]; hasAgent {
-				if baseline, hasBaseline := baselines[domain]; hasBaseline {
-					realCumulative = common.MergeMetrics(baseline, currentStats)
-				}
+	if lastReport, exists := cm.storage.RawMetrics[agentID]; exists {
+		for domain, stats := range lastReport.TotalStats {
+			if baseline, hasBaseline := contribution[domain]; hasBaseline {
+				stats = common.MergeMetrics(baseline, stats)
 			}
+			stats.Domain = domain
+			contribution[domain] = stats
 		}
+	}
+	return contribution
+}
 
-		// 更新全局累计指标
-		if _, exists := cm.storage.GlobalCumulative[domain]; exists {
-			// 需要减去该Agent之前的贡献，加上新的贡献
-			cm.updateGlobalCumulativeForDomain(domain, agentID, realCumulative)
-		} else {
-			// 新域名，直接设置
-			realCumulative.Domain = domain // 确保域名字段正确设置
-			cm.storage.GlobalCumulative[domain] = realCumulative
+// updateCumulativeMetrics 更新累计指标：全局值减去该Agent之前的贡献，加上新的贡献
+func (cm *CumulativeManager) updateCumulativeMetrics(agentID string, previous map[string]common.DomainMetrics) {
+	current := cm.agentContribution(agentID)
+
+	for domain, stats := range current {
+		cm.updateGlobalCumulativeForDomain(domain, previous[domain], stats)
+	}
+	// 重启后未再出现且没有基线的域名，移除该Agent之前的贡献
+	for domain, stats := range previous {
+		if _, exists := current[domain]; !exists {
+			cm.updateGlobalCumulativeForDomain(domain, stats, common.DomainMetrics{})
 		}
 	}
 }
 
 // updateGlobalCumulativeForDomain 更新特定域名的全局累计指标
-func (cm *CumulativeManager) updateGlobalCumulativeForDomain(domain, agentID string, newStats common.DomainMetrics) {
+func (cm *CumulativeManager) updateGlobalCumulativeForDomain(domain string, previousContribution, newStats common.DomainMetrics) {
 	// 获取当前全局统计
 	globalStats := cm.storage.GlobalCumulative[domain]
 
-	// 获取该Agent之前的贡献
-	var previousContribution common.DomainMetrics
-	if lastReport, exists := cm.storage.RawMetrics[agentID]; exists {
-		if lastStats, hasDomain := lastReport.TotalStats[domain]; hasDomain {
-			previousContribution = lastStats
-
-			// 如果启用基线跟踪，加上基线值
-			if cm.enableBaselineTracking {
-				if baselines, hasAgent := cm.storage.RestartBaselines[agentID]; hasAgent {
-					if baseline, hasBaseline := baselines[domain]; hasBaseline {
-						previousContribution = common.MergeMetrics(baseline, lastStats)
-					}
-				}
-			}
-		}
-	}
-
 	// 计算新的全局累计值：当前全局值 - 该Agent之前的贡献 + 该Agent新的贡献
 	newGlobalStats := globalStats
 	newGlobalStats.Domain = domain // 确保域名字段正确设置
@@ -257,6 +267,11 @@ func (cm *CumulativeManager) updateGlobalCumulativeForDomain(domain, agentID str
 	// 更新协议和端口统计
 	cm.updateProtocolAndPortStats(&newGlobalStats, previousContribution, newStats)
 
+	if newGlobalStats.AccessCount <= 0 && newGlobalStats.BytesSent <= 0 &&
+		newGlobalStats.BytesReceived <= 0 && newGlobalStats.ConnectionCount <= 0 {
+		delete(cm.storage.GlobalCumulative, domain)
+		return
+	}
 	cm.storage.GlobalCumulative[domain] = newGlobalStats
 }
 
@@ -474,3 +489,43 @@ func (cm *CumulativeManager) Close() error {
 	cm.logger.Info("Cumulative manager closed")
 	return nil
 }
+
+// DetectAgentRestart 判断报告是否来自重启后的Agent（不修改状态）
+func (cm *CumulativeManager) DetectAgentRestart(agentID string, report common.MetricsReport) bool {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	return cm.detectAgentRestart(agentID, report).IsRestart
+}
+
+// GetAgentState 获取Agent的重启次数、基线和累计贡献
+func (cm *CumulativeManager) GetAgentState(agentID string) (*AgentCumulativeState, bool) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	return cm.agentState(agentID)
+}
+
+// agentState 构建Agent的累计状态，调用方需持有锁
+func (cm *CumulativeManager) agentState(agentID string) (*AgentCumulativeState, bool) {
+	state, exists := cm.storage.AgentStates[agentID]
+	if !exists {
+		return nil, false
+	}
+
+	result := &AgentCumulativeState{
+		AgentID:        agentID,
+		StartupTime:    state.LastStartupTime,
+		LastReportTime: state.LastReportTime,
+		IsActive:       state.IsActive && time.Since(state.LastHeartbeat) < cm.agentTimeoutDuration,
+		RestartCount:   state.RestartCount,
+		Totals:         cm.agentContribution(agentID),
+	}
+	if report, ok := cm.storage.RawMetrics[agentID]; ok {
+		result.Current = copyDomainMetrics(report.TotalStats)
+	}
+	if cm.enableBaselineTracking {
+		result.Baselines = copyDomainMetrics(cm.storage.RestartBaselines[agentID])
+	}
+	return result, true
+}
@@ -11,9 +11,12 @@ import (
 
 // SimpleCumulativeManager 简化的累计指标管理器
 type SimpleCumulativeManager struct {
-	// 存储Agent的累计数据
+	// 存储Agent的累计数据（含重启基线）
 	agentMetrics map[string]map[string]common.DomainMetrics // agentID -> domain -> metrics
 
+	// 重启前的累计值，启用持久化时叠加到重启后的上报上
+	agentBaselines map[string]map[string]common.DomainMetrics
+
 	// 存储Agent状态
 	agentStates map[string]AgentState
 
@@ -42,6 +45,7 @@ type AgentState struct {
 func NewSimpleCumulativeManager(logger *logrus.Logger, enablePersistence bool) *SimpleCumulativeManager {
 	return &SimpleCumulativeManager{
 		agentMetrics:      make(map[string]map[string]common.DomainMetrics),
+		agentBaselines:    make(map[string]map[string]common.DomainMetrics),
 		agentStates:       make(map[string]AgentState),
 		globalCache:       make(map[string]common.DomainMetrics),
 		logger:            logger,
@@ -55,6 +59,21 @@ func (scm *SimpleCumulativeManager) ProcessMetrics(report common.MetricsReport)
 	scm.mutex.Lock()
 	defer scm.mutex.Unlock()
 
+	return scm.processMetrics(report)
+}
+
+// ProcessDelta 处理只有增量数据的报告，读取累计值和更新在同一次加锁内完成
+func (scm *SimpleCumulativeManager) ProcessDelta(report common.MetricsReport) error {
+	scm.mutex.Lock()
+	defer scm.mutex.Unlock()
+
+	state, _ := scm.agentState(report.AgentID)
+	fillTotalsFromDelta(state, &report)
+	return scm.processMetrics(report)
+}
+
+// processMetrics 处理Agent上报的指标，调用方需持有写锁
+func (scm *SimpleCumulativeManager) processMetrics(report common.MetricsReport) error {
 	agentID := report.AgentID
 
 	// 检测Agent重启
@@ -63,21 +82,25 @@ func (scm *SimpleCumulativeManager) ProcessMetrics(report common.MetricsReport)
 	// 更新Agent状态
 	scm.updateAgentState(agentID, report, isRestart)
 
-	// 存储Agent的累计指标
-	if scm.agentMetrics[agentID] == nil {
-		scm.agentMetrics[agentID] = make(map[string]common.DomainMetrics)
+	// 重启时把之前的累计值保存为基线，未启用持久化时丢弃
+	if isRestart {
+		if scm.enablePersistence {
+			scm.agentBaselines[agentID] = scm.agentMetrics[agentID]
+		} else {
+			delete(scm.agentBaselines, agentID)
+		}
 	}
 
-	// 如果是重启，需要将之前的累计值加到新的值上
-	if isRestart && scm.enablePersistence {
-		scm.handleRestart(agentID, report)
-	} else {
-		// 直接更新累计值
-		for domain, metrics := range report.TotalStats {
-			metrics.Domain = domain
-			scm.agentMetrics[agentID][domain] = metrics
+	// Agent的累计值 = 基线 + 本次启动以来的累计
+	metrics := copyDomainMetrics(scm.agentBaselines[agentID])
+	for domain, stats := range report.TotalStats {
+		stats.Domain = domain
+		if baseline, exists := metrics[domain]; exists {
+			stats = common.MergeMetrics(baseline, stats)
 		}
+		metrics[domain] = stats
 	}
+	scm.agentMetrics[agentID] = metrics
 
 	// 清除全局缓存，强制重新计算
 	scm.globalCache = make(map[string]common.DomainMetrics)
@@ -121,59 +144,11 @@ func (scm *SimpleCumulativeManager) updateAgentState(agentID string, report comm
 	scm.agentStates[agentID] = state
 }
 
-// handleRestart 处理Agent重启
-func (scm *SimpleCumulativeManager) handleRestart(agentID string, report common.MetricsReport) {
-	// 获取重启前的累计值
-	previousMetrics := scm.agentMetrics[agentID]
-
-	// 将新的累计值与重启前的值合并
-	for domain, newMetrics := range report.TotalStats {
-		if prevMetrics, exists := previousMetrics[domain]; exists {
-			// 合并指标
-			mergedMetrics := common.DomainMetrics{
-				Domain:          domain,
-				AccessCount:     prevMetrics.AccessCount + newMetrics.AccessCount,
-				BytesSent:       prevMetrics.BytesSent + newMetrics.BytesSent,
-				BytesReceived:   prevMetrics.BytesReceived + newMetrics.BytesReceived,
-				ConnectionCount: prevMetrics.ConnectionCount + newMetrics.ConnectionCount,
-				LastAccessTime:  newMetrics.LastAccessTime,
-			}
-
-			// 合并协议统计
-			if mergedMetrics.ProtocolStats == nil {
-				mergedMetrics.ProtocolStats = make(map[string]int64)
-			}
-			for protocol, count := range prevMetrics.ProtocolStats {
-				mergedMetrics.ProtocolStats[protocol] += count
-			}
-			for protocol, count := range newMetrics.ProtocolStats {
-				mergedMetrics.ProtocolStats[protocol] += count
-			}
-
-			// 合并端口统计
-			if mergedMetrics.PortStats == nil {
-				mergedMetrics.PortStats = make(map[int]int64)
-			}
-			for port, count := range prevMetrics.PortStats {
-				mergedMetrics.PortStats[port] += count
-			}
-			for port, count := range newMetrics.PortStats {
-				mergedMetrics.PortStats[port] += count
-			}
-
-			scm.agentMetrics[agentID][domain] = mergedMetrics
-		} else {
-			// 新域名，直接设置
-			newMetrics.Domain = domain
-			scm.agentMetrics[agentID][domain] = newMetrics
-		}
-	}
-}
-
 // GetCumulativeMetrics 获取累计指标
 func (scm *SimpleCumulativeManager) GetCumulativeMetrics() (*common.CumulativeMetrics, error) {
-	scm.mutex.RLock()
-	defer scm.mutex.RUnlock()
+	// 需要更新缓存，使用写锁
+	scm.mutex.Lock()
+	defer scm.mutex.Unlock()
 
 	// 检查缓存是否有效
 	if time.Since(scm.cacheTime) < scm.cacheExpiry && len(scm.globalCache) > 0 {
@@ -189,34 +164,8 @@ func (scm *SimpleCumulativeManager) GetCumulativeMetrics() (*common.CumulativeMe
 		if state, exists := scm.agentStates[agentID]; exists && state.IsActive {
 			for domain, metrics := range agentMetrics {
 				if existing, exists := globalMetrics[domain]; exists {
-					// 合并指标
-					existing.AccessCount += metrics.AccessCount
-					existing.BytesSent += metrics.BytesSent
-					existing.BytesReceived += metrics.BytesReceived
-					existing.ConnectionCount += metrics.ConnectionCount
-
-					// 使用最新的访问时间
-					if metrics.LastAccessTime.After(existing.LastAccessTime) {
-						existing.LastAccessTime = metrics.LastAccessTime
-					}
-
-					// 合并协议统计
-					if existing.ProtocolStats == nil {
-						existing.ProtocolStats = make(map[string]int64)
-					}
-					for protocol, count := range metrics.ProtocolStats {
-						existing.ProtocolStats[protocol] += count
-					}
-
-					// 合并端口统计
-					if existing.PortStats == nil {
-						existing.PortStats = make(map[int]int64)
-					}
-					for port, count := range metrics.PortStats {
-						existing.PortStats[port] += count
-					}
-
-					globalMetrics[domain] = existing
+					// 合并指标（MergeMetrics不修改Agent数据中的协议和端口统计）
+					globalMetrics[domain] = common.MergeMetrics(existing, metrics)
 				} else {
 					// 新域名
 					globalMetrics[domain] = metrics
@@ -252,7 +201,7 @@ func (scm *SimpleCumulativeManager) buildCumulativeMetricsFromCache() *common.Cu
 	}
 
 	return &common.CumulativeMetrics{
-		DomainStats: scm.globalCache,
+		DomainStats: copyDomainMetrics(scm.globalCache),
 		SystemStats: common.SystemMetrics{
 			TotalConnections:   totalConnections,
 			TotalBytesSent:     totalBytesSent,
@@ -327,6 +276,7 @@ func (scm *SimpleCumulativeManager) CleanupExpiredAgents(maxAge time.Duration) e
 	// 清理过期Agent
 	for _, agentID := range expiredAgents {
 		delete(scm.agentMetrics, agentID)
+		delete(scm.agentBaselines, agentID)
 		delete(scm.agentStates, agentID)
 
 		scm.logger.WithField("agent_id", agentID).Info("Cleaned up expired agent")
@@ -341,6 +291,55 @@ func (scm *SimpleCumulativeManager) CleanupExpiredAgents(maxAge time.Duration) e
 	return nil
 }
 
+// CleanupExpiredData 清理过期数据（实现common.MetricsAggregator）
+func (scm *SimpleCumulativeManager) CleanupExpiredData(maxAge time.Duration) error {
+	return scm.CleanupExpiredAgents(maxAge)
+}
+
+// DetectAgentRestart 判断报告是否来自重启后的Agent（不修改状态）
+func (scm *SimpleCumulativeManager) DetectAgentRestart(agentID string, report common.MetricsReport) bool {
+	scm.mutex.RLock()
+	defer scm.mutex.RUnlock()
+
+	return scm.detectRestart(agentID, report)
+}
+
+// GetAgentState 获取Agent的重启次数、基线和累计值
+func (scm *SimpleCumulativeManager) GetAgentState(agentID string) (*AgentCumulativeState, bool) {
+	scm.mutex.RLock()
+	defer scm.mutex.RUnlock()
+
+	return scm.agentState(agentID)
+}
+
+// agentState 构建Agent的累计状态，调用方需持有锁
+func (scm *SimpleCumulativeManager) agentState(agentID string) (*AgentCumulativeState, bool) {
+	state, exists := scm.agentStates[agentID]
+	if !exists {
+		return nil, false
+	}
+
+	baselines := scm.agentBaselines[agentID]
+	current := make(map[string]common.DomainMetrics)
+	for domain, stats := range scm.agentMetrics[agentID] {
+		if baseline, ok := baselines[domain]; ok {
+			stats = common.SubtractMetrics(stats, baseline)
+		}
+		current[domain] = stats
+	}
+
+	return &AgentCumulativeState{
+		AgentID:        agentID,
+		StartupTime:    state.StartupTime,
+		LastReportTime: state.LastReportTime,
+		IsActive:       state.IsActive,
+		RestartCount:   state.RestartCount,
+		Baselines:      copyDomainMetrics(baselines),
+		Current:        current,
+		Totals:         copyDomainMetrics(scm.agentMetrics[agentID]),
+	}, true
+}
+
 // GetAgentStates 获取所有Agent状态
 func (scm *SimpleCumulativeManager) GetAgentStates() map[string]AgentState {
 	scm.mutex.RLock()
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+)
+
+func TestProcessDeltaConcurrent(t *testing.T) {
+	managers := map[string]cumulativeAggregator{
+		"restart detection": NewCumulativeManager(newTestLogger(), true, true),
+		"simple":            NewSimpleCumulativeManager(newTestLogger(), true),
+	}
+	for name, manager := range managers {
+		t.Run(name, func(t *testing.T) {
+			defer manager.Close()
+
+			startup := time.Now().Add(-time.Hour)
+			const reports = 50
+			var wg sync.WaitGroup
+			for i := 0; i < reports; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					report := common.MetricsReport{
+						AgentID:     "agent-a",
+						StartupTime: startup,
+						ReportTime:  time.Now(),
+						DeltaStats: map[string]common.DomainMetrics{
+							"example.com": {AccessCount: 1, BytesSent: 10},
+						},
+					}
+					if err := manager.ProcessDelta(report); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			state, ok := manager.GetAgentState("agent-a")
+			if !ok {
+				t.Fatal("agent state missing")
+			}
+			got := state.Current["example.com"]
+			if got.AccessCount != reports || got.BytesSent != 10*reports {
+				t.Fatalf("lost deltas: access=%d bytes=%d, want %d/%d", got.AccessCount, got.BytesSent, reports, 10*reports)
+			}
+		})
+	}
+}
+
+func TestAgentStateCurrentAfterRestartWithBaseline(t *testing.T) {
+	managers := map[string]cumulativeAggregator{
+		"restart detection": NewCumulativeManager(newTestLogger(), true, true),
+		"simple":            NewSimpleCumulativeManager(newTestLogger(), true),
+	}
+	for name, manager := range managers {
+		t.Run(name, func(t *testing.T) {
+			defer manager.Close()
+
+			firstRun := time.Now().Add(-time.Hour)
+			secondRun := firstRun.Add(30 * time.Minute)
+			reports := []common.MetricsReport{
+				{
+					AgentID: "agent-a", StartupTime: firstRun, ReportTime: firstRun.Add(time.Minute),
+					TotalStats: map[string]common.DomainMetrics{"example.com": {
+						AccessCount: 5, BytesSent: 50,
+						ProtocolStats: map[string]int64{"tcp": 5}, PortStats: map[int]int64{443: 5},
+					}},
+				},
+				// 重启后第一次上报，之前的累计值成为基线
+				{
+					AgentID: "agent-a", StartupTime: secondRun, ReportTime: secondRun.Add(time.Minute),
+					TotalStats: map[string]common.DomainMetrics{"example.com": {
+						AccessCount: 2, BytesSent: 20,
+						ProtocolStats: map[string]int64{"tcp": 1, "udp": 1}, PortStats: map[int]int64{443: 1, 53: 1},
+					}},
+				},
+			}
+			for _, report := range reports {
+				if err := manager.ProcessMetrics(report); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 增量上报在本次启动的累计值上叠加，协议和端口统计不能丢失
+			delta := common.MetricsReport{
+				AgentID: "agent-a", StartupTime: secondRun, ReportTime: secondRun.Add(2 * time.Minute),
+				DeltaStats: map[string]common.DomainMetrics{"example.com": {
+					AccessCount: 1, BytesSent: 10,
+					ProtocolStats: map[string]int64{"tcp": 1}, PortStats: map[int]int64{443: 1},
+				}},
+			}
+			if err := manager.ProcessDelta(delta); err != nil {
+				t.Fatal(err)
+			}
+
+			state, ok := manager.GetAgentState("agent-a")
+			if !ok {
+				t.Fatal("agent state missing")
+			}
+			if state.RestartCount != 1 {
+				t.Fatalf("restart count = %d, want 1", state.RestartCount)
+			}
+			current := state.Current["example.com"]
+			if current.AccessCount != 3 || current.BytesSent != 30 {
+				t.Fatalf("current = %d/%d, want 3/30", current.AccessCount, current.BytesSent)
+			}
+			if !reflect.DeepEqual(current.ProtocolStats, map[string]int64{"tcp": 2, "udp": 1}) {
+				t.Fatalf("current protocol stats = %v, want tcp=2 udp=1", current.ProtocolStats)
+			}
+			if !reflect.DeepEqual(current.PortStats, map[int]int64{443: 2, 53: 1}) {
+				t.Fatalf("current port stats = %v, want 443=2 53=1", current.PortStats)
+			}
+
+			total := state.Totals["example.com"]
+			if total.AccessCount != 8 || total.ProtocolStats["tcp"] != 7 || total.PortStats[443] != 7 {
+				t.Fatalf("totals = %+v, want access 8, tcp 7, port 443 7", total)
+			}
+		})
+	}
+}
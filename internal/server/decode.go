@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReportBodyBytes 上报请求体（压缩前后）的大小上限
+const maxReportBodyBytes = 32 << 20
+
+// decodeReportRequest 按Content-Encoding解压、按Content-Type解析上报请求
+// 失败时已写入错误响应，返回ok=false
+func (s *Server) decodeReportRequest(c *gin.Context) (common.ReportRequest, string, bool) {
+	decoded, contentType, ok := s.readReportBody(c)
+	if !ok {
+		return common.ReportRequest{}, "", false
+	}
+
+	request, err := codec.UnmarshalReportRequest(decoded, contentType)
+	if err != nil {
+		s.logger.WithError(err).Error("解析指标数据失败")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return request, "", false
+	}
+
+	return request, contentType, true
+}
+
+// readReportBody 读取并解压上报请求体，返回解压后的数据和规范化的Content-Type
+// 失败时已写入错误响应，返回ok=false
+func (s *Server) readReportBody(c *gin.Context) ([]byte, string, bool) {
+	contentType, err := codec.NormalizeContentType(c.GetHeader("Content-Type"))
+	if err != nil {
+		s.logger.WithError(err).Warn("不支持的上报数据格式")
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+
+	encoding, err := codec.NormalizeEncoding(c.GetHeader("Content-Encoding"))
+	if err != nil {
+		s.logger.WithError(err).Warn("不支持的上报数据压缩算法")
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxReportBodyBytes+1))
+	if err != nil {
+		s.logger.WithError(err).Error("读取指标数据失败")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return nil, "", false
+	}
+	if len(body) > maxReportBodyBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": "request body too large",
+		})
+		return nil, "", false
+	}
+
+	decoded, err := codec.Decompress(body, encoding, maxReportBodyBytes)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, codec.ErrPayloadTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		s.logger.WithError(err).Error("解压指标数据失败")
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+
+	s.metrics.RecordReportPayload(contentType, encoding, len(body), len(decoded))
+	return decoded, contentType, true
+}
+
+// writeReportResponse 按请求的Content-Type写入上报响应
+func (s *Server) writeReportResponse(c *gin.Context, response *common.ReportResponse, contentType string) {
+	if contentType != codec.ContentTypeProtobuf {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	data, err := codec.MarshalReportResponse(response, contentType)
+	if err != nil {
+		s.logger.WithError(err).Error("序列化响应失败")
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, data)
+}
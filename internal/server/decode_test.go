@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDecodeReportRequest(t *testing.T) {
+	s := &Server{logger: newTestLogger(), metrics: newTestMetrics()}
+
+	protobuf, err := codec.MarshalReportRequest(&common.ReportRequest{AgentID: "agent-a", Metrics: common.NetworkMetrics{TotalConnections: 9}}, codec.ContentTypeProtobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstdBody, err := codec.Compress(protobuf, codec.EncodingZstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 压缩后很小、解压后超过上限的请求体
+	bomb, err := codec.Compress(bytes.Repeat([]byte(" "), maxReportBodyBytes+1), codec.EncodingGzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        []byte
+		wantStatus  int
+	}{
+		{"zstd protobuf", codec.ContentTypeProtobuf, codec.EncodingZstd, zstdBody, http.StatusOK},
+		{"unknown encoding", codec.ContentTypeJSON, "br", []byte("{}"), http.StatusUnsupportedMediaType},
+		{"unknown content type", "text/plain", "", []byte("{}"), http.StatusUnsupportedMediaType},
+		{"decompression bomb", codec.ContentTypeJSON, codec.EncodingGzip, bomb, http.StatusRequestEntityTooLarge},
+		{"corrupt gzip", codec.ContentTypeJSON, codec.EncodingGzip, []byte("not gzip"), http.StatusBadRequest},
+		{"invalid json", codec.ContentTypeJSON, "", []byte("{"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/metrics", bytes.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			if tt.encoding != "" {
+				c.Request.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			request, contentType, ok := s.decodeReportRequest(c)
+			if tt.wantStatus == http.StatusOK {
+				if !ok || contentType != codec.ContentTypeProtobuf || request.AgentID != "agent-a" || request.Metrics.TotalConnections != 9 {
+					t.Fatalf("decode = %+v, %s, %v", request, contentType, ok)
+				}
+				return
+			}
+			if ok || w.Code != tt.wantStatus {
+				t.Fatalf("ok=%v status=%d, want status %d", ok, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
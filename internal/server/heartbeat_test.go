@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestHeartbeatServer 创建未启用认证、只处理心跳的Server
+func newTestHeartbeatServer() *Server {
+	s := &Server{
+		config:  &config.ServerAppConfig{},
+		logger:  newTestLogger(),
+		metrics: newTestMetrics(),
+		agents:  make(map[string]*common.AgentInfo),
+	}
+	s.stream = newStreamService(s)
+	return s
+}
+
+// postHeartbeat 调用心跳接口并返回响应
+func postHeartbeat(s *Server, body string, agentHeader string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/heartbeat", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if agentHeader != "" {
+		c.Request.Header.Set("X-Agent-ID", agentHeader)
+	}
+	s.handleHeartbeat(c)
+	return w
+}
+
+func TestHandleHeartbeatRecordsAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		header string
+		code   int
+		wantID string
+	}{
+		{"id in body", `{"id":"agent-a","hostname":"host-a","version":"1.2.0"}`, "", http.StatusOK, "agent-a"},
+		{"id from header", `{"hostname":"host-b"}`, "agent-b", http.StatusOK, "agent-b"},
+		{"missing id", `{"hostname":"host-c"}`, "", http.StatusBadRequest, ""},
+		{"invalid body", `{`, "agent-d", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestHeartbeatServer()
+			w := postHeartbeat(s, tt.body, tt.header)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.wantID == "" {
+				if len(s.agents) != 0 {
+					t.Fatalf("rejected heartbeat recorded agents: %v", s.agents)
+				}
+				return
+			}
+
+			agent := s.agents[tt.wantID]
+			if agent == nil {
+				t.Fatalf("agent %s not recorded", tt.wantID)
+			}
+			if agent.Status != "online" || agent.LastSeen.IsZero() || agent.IP == "" {
+				t.Fatalf("agent info not filled in: %+v", agent)
+			}
+
+			var response common.HeartbeatResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !response.Success || len(response.Directives) != 0 {
+				t.Fatalf("response = %+v, want success without directives", response)
+			}
+		})
+	}
+}
+
+func TestHandleHeartbeatDeliversDirectivesOnce(t *testing.T) {
+	s := newTestHeartbeatServer()
+	queued := s.stream.QueueDirective("agent-a", common.DirectiveSetReportInterval, map[string]string{"interval": "30s"})
+	s.stream.QueueDirective("agent-b", common.DirectiveReplaySpool, nil)
+
+	var response common.HeartbeatResponse
+	w := postHeartbeat(s, `{"id":"agent-a"}`, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Directives) != 1 {
+		t.Fatalf("directives = %+v, want only agent-a's command", response.Directives)
+	}
+	directive := response.Directives[0]
+	if directive.ID != queued.ID || directive.Type != common.DirectiveSetReportInterval || directive.Args["interval"] != "30s" {
+		t.Fatalf("directive = %+v, want %s set_report_interval 30s", directive, queued.ID)
+	}
+	if cmd := s.stream.byID[queued.ID]; cmd.Status != CommandDelivered {
+		t.Fatalf("command status = %s, want %s", cmd.Status, CommandDelivered)
+	}
+
+	// 已下发的指令不会随下一次心跳重复下发
+	response = common.HeartbeatResponse{}
+	w = postHeartbeat(s, `{"id":"agent-a"}`, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Directives) != 0 {
+		t.Fatalf("directives delivered twice: %+v", response.Directives)
+	}
+	if len(s.stream.queued["agent-b"]) != 1 {
+		t.Fatal("another agent's queued directive was consumed")
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/metrics"
+	"go-net-monitoring/pkg/otlp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// otlpForwarder 将收到的上报数据批量转发到OpenTelemetry Collector
+// 队列满时丢弃新数据，导出不会阻塞上报接口
+type otlpForwarder struct {
+	cfg       config.OTLPConfig
+	exporter  *otlp.Exporter
+	converter *otlp.Converter
+	queue     chan otlp.Record
+	logger    *logrus.Logger
+	metrics   *metrics.Metrics
+
+	mu        sync.Mutex
+	sent      uint64
+	failed    uint64
+	dropped   uint64
+	lastError string
+}
+
+// newOTLPForwarder 创建OTLP转发器
+func newOTLPForwarder(cfg config.OTLPConfig, logger *logrus.Logger, m *metrics.Metrics) (*otlpForwarder, error) {
+	exporter, err := otlp.NewExporter(otlp.Options{
+		Protocol:    cfg.Protocol,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		Compression: cfg.Compression,
+		Headers:     cfg.Headers,
+		UserAgent:   "network-monitor-server/1.0.0",
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpForwarder{
+		cfg:      cfg,
+		exporter: exporter,
+		converter: &otlp.Converter{
+			ServiceName: "netmon-server",
+			Version:     "1.0.0",
+			Attributes:  cfg.ResourceAttributes,
+		},
+		queue:   make(chan otlp.Record, cfg.QueueSize),
+		logger:  logger,
+		metrics: m,
+	}, nil
+}
+
+// Enqueue 加入转发队列，不阻塞
+func (f *otlpForwarder) Enqueue(request *common.ReportRequest) {
+	metricsCopy := request.Metrics
+	record := otlp.Record{
+		AgentID:  request.AgentID,
+		Hostname: request.Hostname,
+		Metrics:  &metricsCopy,
+	}
+	if request.Report != nil {
+		record.StartTime = request.Report.StartupTime
+	}
+
+	select {
+	case f.queue <- record:
+	default:
+		f.record("dropped", 1, "")
+		f.logger.Warn("OTLP转发队列已满，丢弃数据")
+	}
+}
+
+// run 批处理协程，ctx取消后尽力导出剩余数据
+func (f *otlpForwarder) run(ctx context.Context) {
+	ticker := time.NewTicker(f.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]otlp.Record, 0, f.cfg.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for len(f.queue) > 0 {
+				batch = append(batch, <-f.queue)
+			}
+			if len(batch) > 0 {
+				f.export(context.Background(), batch, 0)
+			}
+			if err := f.exporter.Close(); err != nil {
+				f.logger.WithError(err).Debug("关闭OTLP导出器失败")
+			}
+			return
+
+		case record := <-f.queue:
+			batch = append(batch, record)
+			if len(batch) >= f.cfg.BatchSize {
+				f.export(ctx, batch, f.cfg.RetryCount)
+				batch = make([]otlp.Record, 0, f.cfg.BatchSize)
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				f.export(ctx, batch, f.cfg.RetryCount)
+				batch = make([]otlp.Record, 0, f.cfg.BatchSize)
+			}
+		}
+	}
+}
+
+// export 导出一批数据，可重试的错误按指数退避重试
+func (f *otlpForwarder) export(ctx context.Context, batch []otlp.Record, retries int) {
+	data := f.converter.Convert(batch)
+
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		exportCtx, cancel := otlp.WithTimeout(ctx, f.cfg.Timeout)
+		err := f.exporter.Export(exportCtx, data)
+		cancel()
+
+		if err == nil {
+			f.record("sent", len(batch), "")
+			return
+		}
+
+		if attempt >= retries || otlp.IsPermanent(err) || ctx.Err() != nil {
+			f.record("failed", len(batch), err.Error())
+			f.logger.WithError(err).WithField("records", len(batch)).Error("OTLP导出失败，放弃该批数据")
+			return
+		}
+
+		f.logger.WithError(err).WithField("attempt", attempt+1).Warn("OTLP导出失败，稍后重试")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		delay *= 2
+	}
+}
+
+// record 更新统计
+func (f *otlpForwarder) record(status string, records int, lastError string) {
+	f.metrics.RecordOTLPExport(status, records)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch status {
+	case "sent":
+		f.sent += uint64(records)
+		f.lastError = ""
+	case "failed":
+		f.failed += uint64(records)
+		f.lastError = lastError
+	case "dropped":
+		f.dropped += uint64(records)
+	}
+}
+
+// Status 转发状态（/status接口使用）
+func (f *otlpForwarder) Status() map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return map[string]interface{}{
+		"enabled":    true,
+		"protocol":   f.cfg.Protocol,
+		"endpoint":   f.cfg.Endpoint,
+		"queue_size": len(f.queue),
+		"sent":       f.sent,
+		"failed":     f.failed,
+		"dropped":    f.dropped,
+		"last_error": f.lastError,
+	}
+}
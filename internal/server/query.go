@@ -0,0 +1,648 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/cardinality"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 历史查询的维度
+const (
+	queryDimAgent     = "agent"
+	queryDimInterface = "interface"
+	queryDimDomain    = "domain"
+	queryDimIP        = "ip"
+	queryDimPort      = "port"
+)
+
+// queryDimensions 支持过滤和分组的维度，按该顺序输出标签
+var queryDimensions = []string{queryDimAgent, queryDimInterface, queryDimDomain, queryDimIP, queryDimPort}
+
+// 历史查询的指标
+const (
+	queryMetricBytes       = "bytes"
+	queryMetricPackets     = "packets"
+	queryMetricConnections = "connections"
+)
+
+// 聚合函数
+const (
+	queryAggSum  = "sum"  // 时间步内的增量之和
+	queryAggRate = "rate" // 时间步内的增量之和除以时间步长（每秒）
+	queryAggMax  = "max"  // 组内单个序列在时间步内增量的最大值
+)
+
+const (
+	// queryLookback 查询起点之前额外读取的时间，用于取得累计计数的基准值
+	queryLookback = 5 * time.Minute
+	// queryDefaultRange 未指定from时查询最近一小时
+	queryDefaultRange = time.Hour
+	// queryDefaultPoints 未指定step时每个序列的点数
+	queryDefaultPoints = 60
+	// queryMaxPoints 每个序列最多的点数
+	queryMaxPoints = 11000
+	// queryDefaultMaxReports 未配置advanced.query_max_reports时一次查询最多读取的上报数
+	queryDefaultMaxReports = 10000
+)
+
+// historyQuery 解析后的查询参数
+type historyQuery struct {
+	metric  string
+	agg     string
+	from    time.Time
+	to      time.Time
+	step    time.Duration
+	groupBy []string
+	filters map[string]map[string]bool // 维度 -> 允许的值
+	detail  string                     // 使用的明细维度（domain、ip、port之一），为空时使用Agent总计
+}
+
+// QueryPoint 时间序列中的一个点，时间为时间步的起点
+type QueryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// QuerySeries 一个分组的时间序列，没有数据的时间步不输出
+type QuerySeries struct {
+	Labels map[string]string `json:"labels"`
+	Points []QueryPoint      `json:"points"`
+}
+
+// QueryResponse 历史查询响应
+type QueryResponse struct {
+	Metric      string        `json:"metric"`
+	Agg         string        `json:"agg"`
+	From        time.Time     `json:"from"`
+	To          time.Time     `json:"to"`
+	Step        string        `json:"step"`
+	StepSeconds float64       `json:"step_seconds"`
+	GroupBy     []string      `json:"group_by"`
+	Series      []QuerySeries `json:"series"`
+}
+
+// querySample 从一次上报中取出的一个计数
+type querySample struct {
+	labels [5]string // 与queryDimensions一一对应
+	value  float64
+	delta  bool // true为增量，false为Agent启动以来的累计值
+}
+
+// handleQuery 按时间步长查询字节数、包数或连接数的时间序列
+func (s *Server) handleQuery(c *gin.Context) {
+	q, err := parseHistoryQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	reports, err := s.queryStoredReports(q, q.from.Add(-queryLookback))
+	if err != nil {
+		s.respondQueryError(c, err)
+		return
+	}
+
+	groupBy := q.groupBy
+	if groupBy == nil {
+		groupBy = []string{}
+	}
+	c.JSON(http.StatusOK, QueryResponse{
+		Metric:      q.metric,
+		Agg:         q.agg,
+		From:        q.from,
+		To:          q.to,
+		Step:        q.step.String(),
+		StepSeconds: q.step.Seconds(),
+		GroupBy:     groupBy,
+		Series:      evaluateHistoryQuery(q, reports),
+	})
+}
+
+// handleQueryValues 列出时间范围内一个维度出现过的值（按其他维度过滤）
+func (s *Server) handleQueryValues(c *gin.Context) {
+	dimension := c.Param("dimension")
+	if dimensionIndex(dimension) < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("unknown dimension %q (supported: %s)", dimension, strings.Join(queryDimensions, ", ")),
+		})
+		return
+	}
+
+	// 值的查询与时间序列共用参数解析，按维度选择有数据的指标
+	metric := queryMetricBytes
+	if dimension == queryDimIP || dimension == queryDimPort {
+		metric = queryMetricConnections
+	}
+	q, err := parseHistoryQueryWith(c, metric, []string{dimension})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	reports, err := s.queryStoredReports(q, q.from)
+	if err != nil {
+		s.respondQueryError(c, err)
+		return
+	}
+
+	index := dimensionIndex(dimension)
+	seen := make(map[string]bool)
+	for _, report := range reports {
+		for _, sample := range extractQuerySamples(q, report) {
+			if q.matches(sample) && sample.labels[index] != "" {
+				seen[sample.labels[index]] = true
+			}
+		}
+	}
+
+	values := make([]string, 0, len(seen))
+	for value := range seen {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	c.JSON(http.StatusOK, gin.H{
+		"dimension": dimension,
+		"values":    values,
+		"count":     len(values),
+	})
+}
+
+// queryStoredReports 读取[from, q.to]内的上报，只过滤一个Agent时直接按Agent查询
+func (s *Server) queryStoredReports(q *historyQuery, from time.Time) ([]common.ReportRequest, error) {
+	agentID := ""
+	if agents := q.filters[queryDimAgent]; len(agents) == 1 {
+		for agent := range agents {
+			agentID = agent
+		}
+	}
+	return s.storage.QueryReports(agentID, from, q.to, s.queryMaxReports())
+}
+
+// queryMaxReports 一次查询最多读取的上报数（advanced.query_max_reports），超过时返回413而不解码
+func (s *Server) queryMaxReports() int {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	if s.config.Advanced.QueryMaxReports <= 0 {
+		return queryDefaultMaxReports
+	}
+	return s.config.Advanced.QueryMaxReports
+}
+
+// respondQueryError 返回读取历史上报失败的响应，上报过多时提示缩小查询范围
+func (s *Server) respondQueryError(c *gin.Context, err error) {
+	if errors.Is(err, ErrTooManyReports) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("query would read more than %d reports, shorten the time range or filter by a single agent", s.queryMaxReports()),
+		})
+		return
+	}
+	s.logger.WithError(err).Error("查询历史上报失败")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "failed to query storage",
+	})
+}
+
+// parseHistoryQuery 解析查询参数
+func parseHistoryQuery(c *gin.Context) (*historyQuery, error) {
+	metric := c.Query("metric")
+	switch metric {
+	case queryMetricBytes, queryMetricPackets, queryMetricConnections:
+	case "":
+		return nil, fmt.Errorf("metric is required (bytes, packets or connections)")
+	default:
+		return nil, fmt.Errorf("unsupported metric %q (supported: bytes, packets, connections)", metric)
+	}
+
+	var groupBy []string
+	for _, value := range c.QueryArray("group_by") {
+		for _, dimension := range strings.Split(value, ",") {
+			if dimension = strings.TrimSpace(dimension); dimension != "" {
+				groupBy = append(groupBy, dimension)
+			}
+		}
+	}
+
+	return parseHistoryQueryWith(c, metric, groupBy)
+}
+
+// parseHistoryQueryWith 解析时间范围、时间步长、聚合函数和过滤条件
+func parseHistoryQueryWith(c *gin.Context, metric string, groupBy []string) (*historyQuery, error) {
+	q := &historyQuery{
+		metric:  metric,
+		agg:     c.DefaultQuery("agg", queryAggSum),
+		filters: make(map[string]map[string]bool),
+	}
+
+	switch q.agg {
+	case queryAggSum, queryAggRate, queryAggMax:
+	default:
+		return nil, fmt.Errorf("unsupported agg %q (supported: sum, rate, max)", q.agg)
+	}
+
+	var err error
+	q.to = time.Now()
+	if value := c.Query("to"); value != "" {
+		if q.to, err = parseQueryTime(value); err != nil {
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	q.from = q.to.Add(-queryDefaultRange)
+	if value := c.Query("from"); value != "" {
+		if q.from, err = parseQueryTime(value); err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if !q.from.Before(q.to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	if value := c.Query("step"); value != "" {
+		if q.step, err = parseQueryStep(value); err != nil {
+			return nil, fmt.Errorf("invalid step: %w", err)
+		}
+	} else {
+		q.step = (q.to.Sub(q.from) / queryDefaultPoints).Round(time.Second)
+		if q.step < time.Second {
+			q.step = time.Second
+		}
+	}
+	if points := math.Ceil(float64(q.to.Sub(q.from)) / float64(q.step)); points > queryMaxPoints {
+		return nil, fmt.Errorf("too many points per series (%.0f > %d), increase step or shorten the range", points, queryMaxPoints)
+	}
+
+	seen := make(map[string]bool)
+	for _, dimension := range groupBy {
+		if dimensionIndex(dimension) < 0 {
+			return nil, fmt.Errorf("unknown group_by dimension %q (supported: %s)", dimension, strings.Join(queryDimensions, ", "))
+		}
+		if !seen[dimension] {
+			seen[dimension] = true
+			q.groupBy = append(q.groupBy, dimension)
+		}
+	}
+
+	for _, dimension := range queryDimensions {
+		values := c.QueryArray(dimension)
+		if len(values) == 0 {
+			continue
+		}
+		q.filters[dimension] = make(map[string]bool, len(values))
+		for _, value := range values {
+			q.filters[dimension][value] = true
+		}
+		seen[dimension] = true
+	}
+
+	// 上报中域名、IP和端口是分别统计的，一次查询只能使用其中一个
+	for _, dimension := range []string{queryDimDomain, queryDimIP, queryDimPort} {
+		if !seen[dimension] {
+			continue
+		}
+		if q.detail != "" {
+			return nil, fmt.Errorf("domain, ip and port cannot be combined (got %s and %s)", q.detail, dimension)
+		}
+		q.detail = dimension
+	}
+	if (q.detail == queryDimIP || q.detail == queryDimPort) && q.metric != queryMetricConnections {
+		return nil, fmt.Errorf("metric %s is not available by %s, only connections", q.metric, q.detail)
+	}
+
+	return q, nil
+}
+
+// parseQueryTime 解析RFC3339时间或Unix时间戳（秒，可带小数）
+func parseQueryTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// parseQueryStep 解析时间步长，支持Go时长（如30s、5m）或秒数
+func parseQueryStep(value string) (time.Duration, error) {
+	step, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, numErr := strconv.ParseFloat(value, 64)
+		if numErr != nil {
+			return 0, err
+		}
+		step = time.Duration(seconds * float64(time.Second))
+	}
+	if step < time.Second {
+		return 0, fmt.Errorf("step must be at least 1s")
+	}
+	return step, nil
+}
+
+// dimensionIndex 维度在queryDimensions中的位置，未知维度返回-1
+func dimensionIndex(dimension string) int {
+	for i, name := range queryDimensions {
+		if name == dimension {
+			return i
+		}
+	}
+	return -1
+}
+
+// matches 判断样本是否满足过滤条件
+func (q *historyQuery) matches(sample querySample) bool {
+	for i, dimension := range queryDimensions {
+		if allowed := q.filters[dimension]; allowed != nil && !allowed[sample.labels[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// queryAgentState 计算累计计数增量时Agent的状态
+type queryAgentState struct {
+	startupTime time.Time
+	reports     int                // 已处理的上报数
+	fresh       bool               // 读取范围内包含Agent本次启动后的全部上报
+	last        map[string]float64 // 序列 -> 最近一次的累计值
+}
+
+// evaluateHistoryQuery 把上报转换为增量并按时间步和分组聚合
+//
+// 累计值取与同一序列上一次上报的差值，变小时视为Agent重启、取当前值；
+// 序列在读取范围内第一次出现时，如果该Agent之前已有上报或本次启动发生在读取范围内，说明计数从零开始，取当前值，
+// 否则只作为基准值。查询起点之前的上报只用于取得基准值
+func evaluateHistoryQuery(q *historyQuery, reports []common.ReportRequest) []QuerySeries {
+	buckets := int(math.Ceil(float64(q.to.Sub(q.from)) / float64(q.step)))
+	scanFrom := q.from.Add(-queryLookback)
+
+	type groupSeries struct {
+		labels map[string]string
+		series map[string][]float64 // 序列 -> 各时间步的增量之和
+		seen   []bool
+	}
+	groups := make(map[string]*groupSeries)
+	states := make(map[string]*queryAgentState)
+
+	for _, report := range reports {
+		state := states[report.AgentID]
+		startupTime := reportStartup(report)
+		if state == nil {
+			state = &queryAgentState{
+				fresh: !startupTime.IsZero() && !startupTime.Before(scanFrom),
+				last:  make(map[string]float64),
+			}
+			states[report.AgentID] = state
+		} else if !startupTime.IsZero() && !state.startupTime.IsZero() && !startupTime.Equal(state.startupTime) {
+			// Agent重启，计数从零开始
+			state.fresh = true
+			state.last = make(map[string]float64)
+		}
+		state.startupTime = startupTime
+
+		bucket := -1
+		if !report.Timestamp.Before(q.from) {
+			bucket = int(report.Timestamp.Sub(q.from) / q.step)
+			if bucket >= buckets {
+				bucket = buckets - 1
+			}
+		}
+
+		for _, sample := range extractQuerySamples(q, report) {
+			if !q.matches(sample) {
+				continue
+			}
+
+			increase := sample.value
+			if !sample.delta {
+				// 累计计数按Agent和明细标签识别，接口只是上报的属性
+				series := sample.labels[0] + "\x00" + sample.labels[2] + "\x00" + sample.labels[3] + "\x00" + sample.labels[4]
+				prev, ok := state.last[series]
+				state.last[series] = sample.value
+				switch {
+				case ok && sample.value >= prev:
+					increase = sample.value - prev
+				case !ok && !state.fresh && state.reports == 0:
+					continue
+				}
+			}
+			if bucket < 0 {
+				continue
+			}
+
+			labels := make(map[string]string, len(q.groupBy))
+			var groupKey strings.Builder
+			for _, dimension := range q.groupBy {
+				value := sample.labels[dimensionIndex(dimension)]
+				labels[dimension] = value
+				groupKey.WriteString(value)
+				groupKey.WriteByte(0)
+			}
+			group := groups[groupKey.String()]
+			if group == nil {
+				group = &groupSeries{labels: labels, series: make(map[string][]float64), seen: make([]bool, buckets)}
+				groups[groupKey.String()] = group
+			}
+
+			seriesKey := strings.Join(sample.labels[:], "\x00")
+			values := group.series[seriesKey]
+			if values == nil {
+				values = make([]float64, buckets)
+				group.series[seriesKey] = values
+			}
+			values[bucket] += increase
+			group.seen[bucket] = true
+		}
+		state.reports++
+	}
+
+	results := make([]QuerySeries, 0, len(groups))
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		group := groups[key]
+		result := QuerySeries{Labels: group.labels, Points: []QueryPoint{}}
+		for i := 0; i < buckets; i++ {
+			if !group.seen[i] {
+				continue
+			}
+
+			var value float64
+			for _, values := range group.series {
+				if q.agg == queryAggMax {
+					value = math.Max(value, values[i])
+				} else {
+					value += values[i]
+				}
+			}
+
+			start := q.from.Add(time.Duration(i) * q.step)
+			if q.agg == queryAggRate {
+				// 最后一个时间步可能不足一个步长
+				end := start.Add(q.step)
+				if end.After(q.to) {
+					end = q.to
+				}
+				value /= end.Sub(start).Seconds()
+			}
+			result.Points = append(result.Points, QueryPoint{Timestamp: start, Value: value})
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// reportStartup 上报中的Agent启动时间，没有时返回零值
+func reportStartup(report common.ReportRequest) time.Time {
+	if report.Report != nil {
+		return report.Report.StartupTime
+	}
+	return time.Time{}
+}
+
+// extractQuerySamples 按查询的指标和明细维度从上报中取出计数
+// v1上报使用累计的网络指标；v2上报（只有report字段）的系统总计为累计值，域名统计在增量模式下为增量
+func extractQuerySamples(q *historyQuery, report common.ReportRequest) []querySample {
+	m := &report.Metrics
+	useReport := report.Report != nil && isEmptyNetworkMetrics(m)
+
+	iface := m.Interface
+	if useReport {
+		iface = report.Report.SystemInfo.Interface
+	}
+	sample := func(detail string, value float64, delta bool) querySample {
+		s := querySample{value: value, delta: delta}
+		s.labels[0] = report.AgentID
+		s.labels[1] = iface
+		if detail != "" {
+			s.labels[dimensionIndex(q.detail)] = detail
+		}
+		return s
+	}
+
+	if useReport {
+		return extractReportSamples(q, report.Report, sample)
+	}
+
+	var samples []querySample
+	switch q.detail {
+	case "":
+		var value uint64
+		switch q.metric {
+		case queryMetricBytes:
+			value = m.TotalBytesSent + m.TotalBytesRecv
+		case queryMetricPackets:
+			value = m.TotalPacketsSent + m.TotalPacketsRecv
+		case queryMetricConnections:
+			value = m.TotalConnections
+		}
+		samples = append(samples, sample("", float64(value), false))
+	case queryDimDomain:
+		for domain, stats := range m.DomainTraffic {
+			if stats == nil {
+				continue
+			}
+			var value uint64
+			switch q.metric {
+			case queryMetricBytes:
+				value = stats.BytesSent + stats.BytesReceived
+			case queryMetricPackets:
+				value = stats.PacketsSent + stats.PacketsRecv
+			case queryMetricConnections:
+				value = stats.Connections
+			}
+			samples = append(samples, sample(domain, float64(value), false))
+		}
+		// 没有流量统计的域名只有访问次数
+		if q.metric == queryMetricConnections {
+			for domain, count := range m.DomainsAccessed {
+				if m.DomainTraffic[domain] == nil {
+					samples = append(samples, sample(domain, float64(count), false))
+				}
+			}
+		}
+	case queryDimIP:
+		for ip, count := range m.IPsAccessed {
+			samples = append(samples, sample(ip, float64(count), false))
+		}
+	case queryDimPort:
+		for port, count := range m.PortStats {
+			samples = append(samples, sample(portLabel(port), float64(count), false))
+		}
+	}
+	return samples
+}
+
+// extractReportSamples 从v2报告中取出计数，报告中没有包数和IP统计
+func extractReportSamples(q *historyQuery, report *common.MetricsReport, sample func(string, float64, bool) querySample) []querySample {
+	if q.metric == queryMetricPackets || q.detail == queryDimIP {
+		return nil
+	}
+
+	if q.detail == "" {
+		value := report.SystemInfo.TotalConnections
+		if q.metric == queryMetricBytes {
+			value = report.SystemInfo.TotalBytesSent + report.SystemInfo.TotalBytesReceived
+		}
+		return []querySample{sample("", float64(value), false)}
+	}
+
+	stats, delta := report.TotalStats, false
+	if report.ReportMode == common.ReportModeIncremental {
+		stats, delta = report.DeltaStats, true
+	}
+
+	var samples []querySample
+	if q.detail == queryDimPort {
+		ports := make(map[int]int64)
+		for _, m := range stats {
+			for port, count := range m.PortStats {
+				ports[port] += count
+			}
+		}
+		for port, count := range ports {
+			samples = append(samples, sample(portLabel(port), float64(count), delta))
+		}
+		return samples
+	}
+
+	for domain, m := range stats {
+		value := m.ConnectionCount
+		if q.metric == queryMetricBytes {
+			value = m.BytesSent + m.BytesReceived
+		}
+		samples = append(samples, sample(domain, float64(value), delta))
+	}
+	return samples
+}
+
+// isEmptyNetworkMetrics 判断上报中没有v1网络指标（v2报告保存时只有report字段）
+func isEmptyNetworkMetrics(m *common.NetworkMetrics) bool {
+	return m.Hostname == "" && m.Interface == "" && m.TotalConnections == 0 &&
+		m.TotalBytesSent == 0 && m.TotalBytesRecv == 0 && m.TotalPacketsSent == 0 && m.TotalPacketsRecv == 0 &&
+		len(m.DomainsAccessed) == 0 && len(m.IPsAccessed) == 0 && len(m.PortStats) == 0 && len(m.DomainTraffic) == 0
+}
+
+// portLabel 端口的标签值，端口0为基数限制汇总的other
+func portLabel(port int) string {
+	if port == 0 {
+		return cardinality.Other
+	}
+	return strconv.Itoa(port)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEvaluateHistoryQuery(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	startup := from.Add(-time.Hour)
+
+	// report 构造v1上报，bytes为累计发送字节数，domains为各域名的累计字节数
+	report := func(offset time.Duration, startup time.Time, bytes uint64, domains map[string]uint64) common.ReportRequest {
+		r := common.ReportRequest{
+			AgentID:   "agent-a",
+			Timestamp: from.Add(offset),
+			Metrics:   common.NetworkMetrics{TotalBytesSent: bytes},
+			Report:    &common.MetricsReport{AgentID: "agent-a", StartupTime: startup},
+		}
+		if domains != nil {
+			r.Metrics.DomainTraffic = make(map[string]*common.DomainTrafficStats, len(domains))
+			for domain, value := range domains {
+				r.Metrics.DomainTraffic[domain] = &common.DomainTrafficStats{BytesSent: value}
+			}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		agg     string
+		detail  string
+		groupBy []string
+		to      time.Duration
+		reports []common.ReportRequest
+		want    map[string][]string // 分组标签 -> "时间步起点偏移=值"
+	}{
+		{
+			name: "restart counts the value after restart",
+			agg:  queryAggSum,
+			to:   40 * time.Second,
+			reports: []common.ReportRequest{
+				report(-10*time.Second, startup, 100, nil), // 查询起点之前，只作为基准
+				report(0, startup, 150, nil),
+				report(10*time.Second, startup, 200, nil),
+				report(20*time.Second, from.Add(15*time.Second), 30, nil), // 启动时间变化
+				report(30*time.Second, from.Add(15*time.Second), 50, nil),
+			},
+			want: map[string][]string{"": {"0s=100", "20s=50"}},
+		},
+		{
+			name: "counter drop without startup time counts as restart",
+			agg:  queryAggSum,
+			to:   40 * time.Second,
+			reports: []common.ReportRequest{
+				report(-10*time.Second, time.Time{}, 100, nil),
+				report(0, time.Time{}, 150, nil),
+				report(20*time.Second, time.Time{}, 20, nil),
+				report(30*time.Second, time.Time{}, 45, nil),
+			},
+			want: map[string][]string{"": {"0s=50", "20s=45"}},
+		},
+		{
+			name:    "series first seen mid-range counts from zero",
+			agg:     queryAggSum,
+			detail:  queryDimDomain,
+			groupBy: []string{queryDimDomain},
+			to:      40 * time.Second,
+			reports: []common.ReportRequest{
+				report(-10*time.Second, startup, 0, map[string]uint64{"a.com": 100}),
+				report(0, startup, 0, map[string]uint64{"a.com": 110}),
+				report(20*time.Second, startup, 0, map[string]uint64{"a.com": 120, "b.com": 5}),
+				report(30*time.Second, startup, 0, map[string]uint64{"a.com": 120, "b.com": 8}),
+			},
+			want: map[string][]string{
+				"a.com": {"0s=10", "20s=10"},
+				"b.com": {"20s=8"},
+			},
+		},
+		{
+			name: "rate divides the last partial step by its length",
+			agg:  queryAggRate,
+			to:   50 * time.Second,
+			reports: []common.ReportRequest{
+				report(-10*time.Second, startup, 0, nil),
+				report(0, startup, 20, nil),
+				report(10*time.Second, startup, 40, nil),
+				report(40*time.Second, startup, 60, nil),
+				report(50*time.Second, startup, 160, nil),
+			},
+			want: map[string][]string{"": {"0s=2", "40s=12"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &historyQuery{
+				metric:  queryMetricBytes,
+				agg:     tt.agg,
+				from:    from,
+				to:      from.Add(tt.to),
+				step:    20 * time.Second,
+				groupBy: tt.groupBy,
+				filters: make(map[string]map[string]bool),
+				detail:  tt.detail,
+			}
+
+			got := make(map[string][]string)
+			for _, series := range evaluateHistoryQuery(q, tt.reports) {
+				key := series.Labels[queryDimDomain]
+				for _, point := range series.Points {
+					got[key] = append(got[key], fmt.Sprintf("%s=%g", point.Timestamp.Sub(from), point.Value))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("结果不符: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleQueryMaxReports(t *testing.T) {
+	storage, err := NewMemoryStorage(&config.StorageConfig{TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		report := common.ReportRequest{AgentID: "agent-a", Timestamp: now.Add(-time.Duration(i+1) * time.Minute)}
+		if err := storage.PutReport(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Server{
+		config:  &config.ServerAppConfig{},
+		logger:  newTestLogger(),
+		storage: storage,
+	}
+
+	query := func() *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/query?metric=bytes", nil)
+		s.handleQuery(c)
+		return w
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		code  int
+	}{
+		{"default limit", 0, http.StatusOK},
+		{"configured limit exceeded", 2, http.StatusRequestEntityTooLarge},
+		{"configured limit fits", 3, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.config.Advanced.QueryMaxReports = tt.limit
+			w := query()
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.code == http.StatusRequestEntityTooLarge && !strings.Contains(w.Body.String(), "more than 2 reports") {
+				t.Fatalf("error does not name the configured limit: %s", w.Body.String())
+			}
+		})
+	}
+}
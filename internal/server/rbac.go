@@ -0,0 +1,446 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go-net-monitoring/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// 角色，admin包含全部权限
+const (
+	RoleIngest = "ingest" // 上报和心跳
+	RoleRead   = "read"   // 查询接口
+	RoleAdmin  = "admin"  // 管理接口（删除Agent、下发命令、API Key和令牌管理）
+)
+
+// stateKindAPITokens API令牌的状态类型，ID为令牌ID
+const stateKindAPITokens = "api_tokens"
+
+// gin上下文中已认证的令牌
+const (
+	ctxAuthTokenID = "auth_token_id"
+	ctxAuthToken   = "auth_token"
+)
+
+// 令牌认证失败原因
+const (
+	authFailTokenExpired = "token_expired"
+	authFailForbidden    = "forbidden"
+)
+
+// APIToken 带角色的API令牌，只保存令牌的SHA-256
+// Agents限定ingest角色可以上报的Agent ID（path.Match模式），为空时可以上报任意Agent
+type APIToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Roles     []string   `json:"roles"`
+	Agents    []string   `json:"agents,omitempty"`
+	TokenHash string     `json:"token_hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APITokenInfo 管理接口和命令行返回的令牌信息（不含哈希）
+type APITokenInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Roles      []string   `json:"roles"`
+	Agents     []string   `json:"agents,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Expired    bool       `json:"expired"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// HasRole 令牌是否具有指定角色（admin具有全部角色）
+func (t *APIToken) HasRole(role string) bool {
+	for _, r := range t.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAgent 令牌是否可以使用该Agent ID上报
+func (t *APIToken) AllowsAgent(agentID string) bool {
+	if len(t.Agents) == 0 {
+		return true
+	}
+	for _, pattern := range t.Agents {
+		if matched, _ := path.Match(pattern, agentID); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired 令牌是否已过期
+func (t *APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// Info 转换为不含哈希的令牌信息
+func (t *APIToken) Info() APITokenInfo {
+	return APITokenInfo{
+		ID:        t.ID,
+		Name:      t.Name,
+		Roles:     t.Roles,
+		Agents:    t.Agents,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		Expired:   t.Expired(time.Now()),
+	}
+}
+
+// NormalizeRoles 校验并去重角色列表
+func NormalizeRoles(roles []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, role := range roles {
+		for _, r := range strings.Split(role, ",") {
+			r = strings.ToLower(strings.TrimSpace(r))
+			if r == "" || seen[r] {
+				continue
+			}
+			switch r {
+			case RoleIngest, RoleRead, RoleAdmin:
+			default:
+				return nil, fmt.Errorf("未知的角色: %s（可选 ingest、read、admin）", r)
+			}
+			seen[r] = true
+			result = append(result, r)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("至少需要一个角色")
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// NormalizeAgentPatterns 校验并去重令牌限定的Agent ID模式
+func NormalizeAgentPatterns(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, pattern := range patterns {
+		for _, p := range strings.Split(pattern, ",") {
+			p = strings.TrimSpace(p)
+			if p == "" || seen[p] {
+				continue
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("无效的Agent模式: %s", p)
+			}
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// CreateAPIToken 在存储中创建令牌，返回只出现这一次的令牌明文
+// agents为空时ingest角色可以上报任意Agent；ttl为0表示不过期
+func CreateAPIToken(storage Storage, name string, roles, agents []string, ttl time.Duration) (string, *APIToken, error) {
+	roles, err := NormalizeRoles(roles)
+	if err != nil {
+		return "", nil, err
+	}
+	if agents, err = NormalizeAgentPatterns(agents); err != nil {
+		return "", nil, err
+	}
+	if ttl < 0 {
+		return "", nil, fmt.Errorf("有效期不能为负数")
+	}
+
+	secret, err := auth.GenerateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("生成令牌ID失败: %w", err)
+	}
+
+	token := &APIToken{
+		ID:        hex.EncodeToString(idBytes),
+		Name:      name,
+		Roles:     roles,
+		Agents:    agents,
+		TokenHash: auth.HashKey(secret),
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		expiresAt := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := storage.PutState(stateKindAPITokens, token.ID, *token); err != nil {
+		return "", nil, fmt.Errorf("保存令牌失败: %w", err)
+	}
+	return secret, token, nil
+}
+
+// ListAPITokens 列出存储中的全部令牌（按创建时间排序）
+func ListAPITokens(storage Storage) ([]*APIToken, error) {
+	values, err := storage.ListState(stateKindAPITokens)
+	if err != nil {
+		return nil, fmt.Errorf("加载令牌失败: %w", err)
+	}
+
+	tokens := make([]*APIToken, 0, len(values))
+	for _, value := range values {
+		token, err := decodeToken(value)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+// RevokeAPIToken 删除令牌，不存在时返回false
+func RevokeAPIToken(storage Storage, id string) (bool, error) {
+	if err := storage.DeleteState(stateKindAPITokens, id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("删除令牌失败: %w", err)
+	}
+	return true, nil
+}
+
+// decodeToken 解码存储中的令牌记录
+func decodeToken(data []byte) (*APIToken, error) {
+	var token APIToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	if token.ID == "" || token.TokenHash == "" {
+		return nil, fmt.Errorf("缺少id或token_hash")
+	}
+	return &token, nil
+}
+
+// lookupToken 按令牌明文查找令牌，未找到时从存储重新加载一次（命令行创建的令牌立即可用）
+func (a *authService) lookupToken(secret string) *APIToken {
+	a.refreshIfStale()
+
+	hash := auth.HashKey(secret)
+	token := a.findToken(hash)
+	if token == nil && a.reloadOnMiss() {
+		token = a.findToken(hash)
+	}
+	return token
+}
+
+// findToken 在缓存中查找令牌并记录使用时间
+func (a *authService) findToken(hash string) *APIToken {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	token := a.tokens[hash]
+	if token != nil {
+		a.tokenUsed[token.ID] = time.Now()
+	}
+	return token
+}
+
+// listTokens 列出令牌及最近使用时间
+func (a *authService) listTokens() []APITokenInfo {
+	a.refreshIfStale()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tokens := make([]APITokenInfo, 0, len(a.tokens))
+	for _, token := range a.tokens {
+		info := token.Info()
+		if used, ok := a.tokenUsed[token.ID]; ok {
+			info.LastUsedAt = &used
+		}
+		tokens = append(tokens, info)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// authorizeToken 校验令牌的有效期和角色，失败时已写入错误响应
+func (a *authService) authorizeToken(c *gin.Context, secret, role string) bool {
+	token := a.lookupToken(secret)
+	if token == nil {
+		a.reject(c, http.StatusUnauthorized, authFailInvalidToken, "invalid token")
+		return false
+	}
+	if token.Expired(time.Now()) {
+		a.reject(c, http.StatusUnauthorized, authFailTokenExpired, "token expired")
+		return false
+	}
+	if !token.HasRole(role) {
+		a.reject(c, http.StatusForbidden, authFailForbidden, fmt.Sprintf("token lacks role %q", role))
+		return false
+	}
+
+	c.Set(ctxAuthTokenID, token.ID)
+	c.Set(ctxAuthToken, token)
+	return true
+}
+
+// checkTokenAgent 校验令牌是否可以使用该Agent ID上报，令牌首次上报某个Agent时记录日志
+func (a *authService) checkTokenAgent(token *APIToken, agentID string) bool {
+	if !token.AllowsAgent(agentID) {
+		return false
+	}
+
+	key := token.ID + "/" + agentID
+	a.mu.Lock()
+	seen := a.tokenAgents[key]
+	a.tokenAgents[key] = true
+	a.mu.Unlock()
+	if !seen {
+		a.logger.WithFields(logrus.Fields{
+			"token_id": token.ID,
+			"name":     token.Name,
+			"agent_id": agentID,
+		}).Info("API令牌首次上报该Agent")
+	}
+	return true
+}
+
+// requireRole 按角色保护路由组
+// 启用认证时需要具有该角色的API令牌（admin_token视为admin）；未启用认证时只有配置了admin_token的管理接口需要认证
+func (a *authService) requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.config.Enabled && (role != RoleAdmin || a.config.AdminToken == "") {
+			c.Next()
+			return
+		}
+
+		secret := auth.BearerToken(c.GetHeader("Authorization"))
+		if secret == "" {
+			a.reject(c, http.StatusUnauthorized, authFailMissingToken, "missing token")
+			return
+		}
+		if a.config.AdminToken != "" && auth.TokenEqual(secret, a.config.AdminToken) {
+			c.Next()
+			return
+		}
+		if !auth.IsToken(secret) {
+			a.reject(c, http.StatusUnauthorized, authFailInvalidToken, "invalid token")
+			return
+		}
+		if !a.authorizeToken(c, secret, role) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// createTokenRequest 创建令牌请求
+type createTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Roles  []string `json:"roles" binding:"required"`
+	Agents []string `json:"agents"` // ingest角色可以上报的Agent ID模式，为空表示不限制
+	TTL    string   `json:"ttl"`    // 有效期，如 "720h"，为空表示不过期
+}
+
+// createTokenResponse 创建令牌响应，token只在创建时返回一次
+type createTokenResponse struct {
+	APITokenInfo
+	Token string `json:"token"`
+}
+
+// handleCreateToken 创建API令牌
+func (s *Server) handleCreateToken(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid ttl",
+			})
+			return
+		}
+	}
+
+	secret, token, err := CreateAPIToken(s.storage, req.Name, req.Roles, req.Agents, ttl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	s.auth.reloadNow()
+
+	s.logger.WithFields(logrus.Fields{
+		"token_id": token.ID,
+		"name":     token.Name,
+		"roles":    strings.Join(token.Roles, ","),
+		"agents":   strings.Join(token.Agents, ","),
+		"by":       c.GetString(ctxAuthTokenID),
+	}).Info("已创建API令牌")
+
+	c.JSON(http.StatusCreated, createTokenResponse{
+		APITokenInfo: token.Info(),
+		Token:        secret,
+	})
+}
+
+// handleListTokens 列出API令牌（不含令牌本身）
+func (s *Server) handleListTokens(c *gin.Context) {
+	tokens := s.auth.listTokens()
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"count":  len(tokens),
+	})
+}
+
+// handleRevokeToken 吊销API令牌
+func (s *Server) handleRevokeToken(c *gin.Context) {
+	id := c.Param("id")
+	revoked, err := RevokeAPIToken(s.storage, id)
+	if err != nil {
+		s.logger.WithError(err).Error("吊销API令牌失败")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to revoke token",
+		})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "token not found",
+		})
+		return
+	}
+	s.auth.reloadNow()
+
+	s.logger.WithFields(logrus.Fields{
+		"token_id": id,
+		"by":       c.GetString(ctxAuthTokenID),
+	}).Info("已吊销API令牌")
+	c.JSON(http.StatusOK, gin.H{
+		"status": "revoked",
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"go-net-monitoring/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reloadableStorage 支持热加载配置的存储
+type reloadableStorage interface {
+	UpdateConfig(cfg *config.StorageConfig)
+}
+
+// EnableConfigReload 启用配置热加载，配置文件变更或收到SIGHUP时调用load重新加载
+func (s *Server) EnableConfigReload(path string, load func() (*config.ServerAppConfig, error)) error {
+	watcher, err := config.NewWatcher(path, s.logger, func() {
+		newCfg, err := load()
+		if err != nil {
+			s.logger.WithError(err).Error("重新加载配置失败，继续使用当前配置")
+			return
+		}
+		s.Reload(newCfg)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Start(); err != nil {
+		return err
+	}
+
+	s.configWatcher = watcher
+	return nil
+}
+
+// Reload 应用新配置：可热加载的配置立即生效，其余变更仅记录日志，需要重启
+func (s *Server) Reload(newCfg *config.ServerAppConfig) {
+	s.configMu.Lock()
+	changes := config.DiffServerConfig(s.config, newCfg)
+	oldInterval := s.config.Metrics.Interval
+
+	// 只更新可热加载的字段，其余字段保持启动时的值
+	s.config.Metrics.Interval = newCfg.Metrics.Interval
+	s.config.Storage.TTL = newCfg.Storage.TTL
+	s.config.Storage.MaxEntries = newCfg.Storage.MaxEntries
+	s.config.Storage.File.MaxBytes = newCfg.Storage.File.MaxBytes
+	s.config.Log.Level = newCfg.Log.Level
+	s.config.Advanced.AgentTimeout = newCfg.Advanced.AgentTimeout
+	s.config.Advanced.QueryMaxReports = newCfg.Advanced.QueryMaxReports
+	storageCfg := s.config.Storage
+	interval := s.config.Metrics.Interval
+	s.configMu.Unlock()
+
+	// 日志级别
+	if level, err := logrus.ParseLevel(newCfg.Log.Level); err == nil {
+		s.logger.SetLevel(level)
+	} else {
+		s.logger.WithField("level", newCfg.Log.Level).Warn("无效的日志级别，保持原有级别")
+	}
+
+	// 存储TTL和容量
+	if storage, ok := s.storage.(reloadableStorage); ok {
+		storage.UpdateConfig(&storageCfg)
+	}
+
+	// 后台任务间隔
+	if interval != oldInterval && interval > 0 {
+		select {
+		case s.intervalChan <- interval:
+		default:
+			// 上一次变更尚未被处理，替换为最新值
+			select {
+			case <-s.intervalChan:
+			default:
+			}
+			s.intervalChan <- interval
+		}
+	}
+
+	config.LogConfigChanges(s.logger, changes)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxReportBatchSize 单次批量上报的报告数上限
+const maxReportBatchSize = 1000
+
+// handleReportsV2 处理批量上报的MetricsReport，逐个校验并返回每个报告的处理结果
+// 请求结构错误时整体拒绝；单个报告被拒绝不影响其他报告，Agent只需重试被拒绝的报告
+func (s *Server) handleReportsV2(c *gin.Context) {
+	decoded, contentType, ok := s.readReportBody(c)
+	if !ok {
+		return
+	}
+	if contentType != codec.ContentTypeJSON {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "only application/json is supported",
+		})
+		return
+	}
+
+	var batch common.ReportBatch
+	if err := json.Unmarshal(decoded, &batch); err != nil {
+		s.logger.WithError(err).Warn("解析批量上报失败")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+	if batch.SchemaVersion != common.MetricsReportSchemaVersion {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          fmt.Sprintf("unsupported schema_version %d", batch.SchemaVersion),
+			"schema_version": common.MetricsReportSchemaVersion,
+		})
+		return
+	}
+	if len(batch.Reports) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "reports is empty",
+		})
+		return
+	}
+	if len(batch.Reports) > maxReportBatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("too many reports in one batch (max %d)", maxReportBatchSize),
+		})
+		return
+	}
+
+	response := common.ReportBatchResponse{
+		SchemaVersion: common.MetricsReportSchemaVersion,
+		Results:       make([]common.ReportItemResult, len(batch.Reports)),
+		Timestamp:     time.Now(),
+	}
+	for i := range batch.Reports {
+		result := s.ingestMetricsReport(c, &batch.Reports[i])
+		result.Index = i
+		response.Results[i] = result
+
+		if result.Accepted {
+			response.Accepted++
+			s.metrics.RecordReportItem("accepted")
+		} else {
+			response.Rejected++
+			s.metrics.RecordReportItem("rejected")
+		}
+	}
+
+	if response.Rejected > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"accepted": response.Accepted,
+			"rejected": response.Rejected,
+		}).Warn("批量上报中有报告被拒绝")
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ingestMetricsReport 校验并处理一个报告
+func (s *Server) ingestMetricsReport(c *gin.Context, report *common.MetricsReport) common.ReportItemResult {
+	result := common.ReportItemResult{AgentID: report.AgentID}
+
+	if err := report.Validate(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if reason, message := s.checkAgent(c, report.AgentID); reason != "" {
+		s.metrics.RecordAuthFailure(reason)
+		result.Error = message
+		return result
+	}
+
+	// 先更新累计统计：失败时还没有任何副作用，可以原样重试；
+	// 之后的存储失败不能再重试，否则增量会被重复累计
+	if s.cumulative != nil {
+		if err := s.cumulative.ProcessDelta(*report); err != nil {
+			s.logger.WithError(err).WithField("agent_id", report.AgentID).Error("更新累计指标失败")
+			result.Error = "failed to update cumulative metrics"
+			result.Retryable = true
+			return result
+		}
+	}
+
+	stored := common.ReportRequest{
+		AgentID:   report.AgentID,
+		Hostname:  report.SystemInfo.Hostname,
+		Timestamp: report.ReportTime,
+		Report:    report,
+	}
+	if err := s.storage.PutReport(stored); err != nil {
+		s.logger.WithError(err).WithField("agent_id", report.AgentID).Error("存储报告失败")
+		if s.cumulative == nil {
+			result.Error = "failed to store report"
+			result.Retryable = true
+			return result
+		}
+		result.Warning = "report counted but not stored"
+	}
+
+	s.updateAgentInfo(report.AgentID, report.SystemInfo.Hostname)
+	s.metrics.UpdateReportMetrics(*report)
+
+	result.Accepted = true
+	return result
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingStorage PutReport总是失败的存储
+type failingStorage struct {
+	*MemoryStorage
+}
+
+func (f failingStorage) PutReport(common.ReportRequest) error {
+	return errors.New("disk full")
+}
+
+func TestIngestMetricsReportStorageFailure(t *testing.T) {
+	memory, err := NewMemoryStorage(&config.StorageConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memory.Close()
+
+	newReport := func() *common.MetricsReport {
+		now := time.Now()
+		return &common.MetricsReport{
+			AgentID:     "agent-a",
+			StartupTime: now.Add(-time.Minute),
+			ReportTime:  now,
+			ReportMode:  common.ReportModeIncremental,
+			DeltaStats: map[string]common.DomainMetrics{
+				"example.com": {AccessCount: 1},
+			},
+		}
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v2/reports", nil)
+
+	t.Run("without cumulative state", func(t *testing.T) {
+		s := &Server{logger: newTestLogger(), metrics: newTestMetrics(), storage: failingStorage{memory}, agents: make(map[string]*common.AgentInfo)}
+		result := s.ingestMetricsReport(c, newReport())
+		if result.Accepted || !result.Retryable {
+			t.Fatalf("store failure without side effects should be retryable: %+v", result)
+		}
+	})
+
+	t.Run("with cumulative state", func(t *testing.T) {
+		cumulative := NewSimpleCumulativeManager(newTestLogger(), false)
+		defer cumulative.Close()
+		s := &Server{logger: newTestLogger(), metrics: newTestMetrics(), storage: failingStorage{memory}, agents: make(map[string]*common.AgentInfo), cumulative: cumulative}
+
+		report := newReport()
+		result := s.ingestMetricsReport(c, report)
+		if !result.Accepted || result.Retryable || result.Warning == "" {
+			t.Fatalf("store failure after counting must not be retried: %+v", result)
+		}
+		if len(report.TotalStats) != 0 {
+			t.Fatal("cumulative processing modified the stored report")
+		}
+		state, _ := cumulative.GetAgentState("agent-a")
+		if got := state.Current["example.com"].AccessCount; got != 1 {
+			t.Fatalf("access count = %d, want 1", got)
+		}
+	})
+}
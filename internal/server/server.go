@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
@@ -14,10 +15,12 @@ import (
 	"go-net-monitoring/internal/config"
 	"go-net-monitoring/pkg/metrics"
 	"go-net-monitoring/pkg/network"
+	"go-net-monitoring/pkg/tlsutil"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 // Server 网络监控服务器
@@ -34,15 +37,27 @@ type Server struct {
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
 	startTime  time.Time
-}
 
-// Storage 存储接口
-type Storage interface {
-	Store(key string, value interface{}) error
-	Get(key string) (interface{}, error)
-	Delete(key string) error
-	List(prefix string) ([]interface{}, error)
-	Close() error
+	// gRPC流式上报
+	grpcServer *grpc.Server
+	stream     *streamService
+
+	// OTLP转发（otlp.enabled时使用）
+	otlp *otlpForwarder
+
+	// Agent认证和管理接口认证
+	auth *authService
+
+	// 全局累计统计（storage.cumulative_mode时使用）
+	cumulative cumulativeAggregator
+
+	// TLS配置（HTTP和gRPC共用，证书轮换后自动重新加载）
+	tlsConfig *tls.Config
+
+	// 配置热加载
+	configMu      sync.RWMutex
+	configWatcher *config.Watcher
+	intervalChan  chan time.Duration
 }
 
 // NewServer 创建新的服务器
@@ -74,6 +89,7 @@ func NewServer(cfg *config.ServerAppConfig) (*Server, error) {
 
 	// 初始化Prometheus指标
 	metricsInstance := metrics.NewMetrics()
+	metricsInstance.Network.SetCardinality(cfg.Metrics.Cardinality)
 
 	// 初始化存储
 	storage, err := NewStorage(&cfg.Storage)
@@ -93,6 +109,57 @@ func NewServer(cfg *config.ServerAppConfig) (*Server, error) {
 		ctx:       ctx,
 		cancel:    cancel,
 		startTime: time.Now(),
+
+		intervalChan: make(chan time.Duration, 1),
+	}
+	s.stream = newStreamService(s)
+
+	s.auth, err = newAuthService(cfg.Auth, storage, logger, metricsInstance)
+	if err != nil {
+		cancel()
+		storage.Close()
+		return nil, fmt.Errorf("初始化认证失败: %w", err)
+	}
+	if cfg.Auth.Enabled {
+		logger.WithFields(logrus.Fields{
+			"require_signature": cfg.Auth.RequireSignature,
+			"enrollment":        cfg.Auth.EnrollmentToken != "",
+		}).Info("已启用Agent认证")
+	}
+
+	if cfg.Storage.CumulativeMode {
+		s.cumulative = newCumulativeAggregator(&cfg.Storage, logger)
+		logger.WithFields(logrus.Fields{
+			"restart_detection": cfg.Storage.AgentRestartDetection,
+			"baseline_tracking": cfg.Storage.BaselineTracking,
+		}).Info("已启用累计模式")
+	}
+
+	if cfg.OTLP.Enabled {
+		forwarder, err := newOTLPForwarder(cfg.OTLP, logger, metricsInstance)
+		if err != nil {
+			cancel()
+			storage.Close()
+			return nil, fmt.Errorf("初始化OTLP导出失败: %w", err)
+		}
+		s.otlp = forwarder
+		logger.WithFields(logrus.Fields{
+			"protocol": cfg.OTLP.Protocol,
+			"endpoint": cfg.OTLP.Endpoint,
+		}).Info("已启用OTLP导出")
+	}
+
+	if cfg.HTTP.EnableTLS {
+		reloader, err := tlsutil.NewReloader(cfg.HTTP.TLSCertPath, cfg.HTTP.TLSKeyPath, cfg.HTTP.TLSCAPath, logger)
+		if err == nil {
+			s.tlsConfig, err = reloader.ServerConfig(cfg.HTTP.ClientAuth)
+		}
+		if err != nil {
+			cancel()
+			storage.Close()
+			return nil, fmt.Errorf("初始化TLS失败: %w", err)
+		}
+		logger.WithField("client_auth", cfg.HTTP.ClientAuth).Info("已启用TLS")
 	}
 
 	// 设置路由
@@ -104,6 +171,7 @@ func NewServer(cfg *config.ServerAppConfig) (*Server, error) {
 		Handler:      s.ginEngine,
 		ReadTimeout:  s.config.HTTP.ReadTimeout,
 		WriteTimeout: s.config.HTTP.WriteTimeout,
+		TLSConfig:    s.tlsConfig,
 	}
 
 	logger.WithFields(logrus.Fields{
@@ -117,16 +185,56 @@ func NewServer(cfg *config.ServerAppConfig) (*Server, error) {
 
 // setupRoutes 设置路由
 func (s *Server) setupRoutes() {
-	// API路由组
+	// API路由组，按角色（ingest、read、admin）分组认证
 	api := s.ginEngine.Group("/api/v1")
+
+	// 查询接口，启用认证时需要read角色
+	read := api.Group("", s.auth.requireRole(RoleRead))
+	{
+		read.GET("/agents", s.handleGetAgents)
+		read.GET("/agents/:id", s.handleGetAgent)
+		read.GET("/agents/:id/commands", s.handleGetCommands)
+		read.GET("/agents/:id/state", s.handleGetAgentState)
+		read.GET("/streams", s.handleGetStreams)
+		read.GET("/stats", s.handleGetStats)
+		read.GET("/status", s.handleStatus)
+		read.GET("/cumulative", s.handleGetCumulative)
+		read.GET("/cumulative/domains/:domain", s.handleGetCumulativeDomain)
+		read.GET("/query", s.handleQuery)
+		read.GET("/query/values/:dimension", s.handleQueryValues)
+	}
+
+	// Agent接口，启用认证时需要API Key、客户端证书或ingest角色的令牌
+	ingest := api.Group("")
+	if s.config.Auth.Enabled {
+		ingest.Use(s.auth.requireAgent())
+		api.POST("/enroll", s.handleEnroll)
+	}
+	{
+		ingest.POST("/metrics", s.handleMetrics)
+		ingest.POST("/heartbeat", s.handleHeartbeat)
+	}
+
+	// v2批量上报，认证方式与v1上报相同
+	v2 := s.ginEngine.Group("/api/v2")
+	if s.config.Auth.Enabled {
+		v2.Use(s.auth.requireAgent())
+	}
 	{
-		api.POST("/metrics", s.handleMetrics)
-		api.POST("/heartbeat", s.handleHeartbeat)
-		api.GET("/agents", s.handleGetAgents)
-		api.GET("/agents/:id", s.handleGetAgent)
-		api.DELETE("/agents/:id", s.handleDeleteAgent)
-		api.GET("/stats", s.handleGetStats)
-		api.GET("/status", s.handleStatus)
+		v2.POST("/reports", s.handleReportsV2)
+	}
+
+	// 管理接口，需要admin角色或admin_token（未启用认证且未配置admin_token时开放）
+	admin := api.Group("", s.auth.requireRole(RoleAdmin))
+	{
+		admin.DELETE("/agents/:id", s.handleDeleteAgent)
+		admin.POST("/agents/:id/commands", s.handleSendCommand)
+		admin.GET("/admin/keys", s.handleListKeys)
+		admin.POST("/admin/keys", s.handleCreateKey)
+		admin.DELETE("/admin/keys/:agent_id", s.handleRevokeKey)
+		admin.GET("/admin/tokens", s.handleListTokens)
+		admin.POST("/admin/tokens", s.handleCreateToken)
+		admin.DELETE("/admin/tokens/:id", s.handleRevokeToken)
 	}
 
 	// Prometheus指标端点
@@ -166,6 +274,24 @@ func (s *Server) Run() error {
 	s.wg.Add(1)
 	go s.backgroundTasks()
 
+	// 启动OTLP转发
+	if s.otlp != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.otlp.run(s.ctx)
+		}()
+	}
+
+	// 启动gRPC流服务
+	if s.config.GRPC.Enabled {
+		if err := s.startGRPC(); err != nil {
+			s.cancel()
+			s.wg.Wait()
+			return err
+		}
+	}
+
 	// 启动HTTP服务器
 	go func() {
 		s.logger.WithFields(logrus.Fields{
@@ -175,7 +301,8 @@ func (s *Server) Run() error {
 
 		var err error
 		if s.config.HTTP.EnableTLS {
-			err = s.httpServer.ListenAndServeTLS(s.config.HTTP.TLSCertPath, s.config.HTTP.TLSKeyPath)
+			// 证书由TLSConfig提供
+			err = s.httpServer.ListenAndServeTLS("", "")
 		} else {
 			err = s.httpServer.ListenAndServe()
 		}
@@ -203,9 +330,17 @@ func (s *Server) Run() error {
 func (s *Server) shutdown() error {
 	s.logger.Info("开始关闭Server...")
 
+	// 停止配置监听
+	if s.configWatcher != nil {
+		s.configWatcher.Stop()
+	}
+
 	// 取消上下文
 	s.cancel()
 
+	// 关闭gRPC服务
+	s.stopGRPC(5 * time.Second)
+
 	// 关闭HTTP服务器
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -217,6 +352,10 @@ func (s *Server) shutdown() error {
 	// 等待后台任务完成
 	s.wg.Wait()
 
+	if s.cumulative != nil {
+		s.cumulative.Close()
+	}
+
 	// 关闭存储
 	if err := s.storage.Close(); err != nil {
 		s.logger.WithError(err).Error("存储关闭失败")
@@ -230,13 +369,20 @@ func (s *Server) shutdown() error {
 func (s *Server) backgroundTasks() {
 	defer s.wg.Done()
 
-	ticker := time.NewTicker(s.config.Metrics.Interval)
+	s.configMu.RLock()
+	interval := s.config.Metrics.Interval
+	s.configMu.RUnlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			s.updateMetrics()
+		case newInterval := <-s.intervalChan:
+			ticker.Reset(newInterval)
+			s.logger.WithField("interval", newInterval).Info("指标更新间隔已更新")
 		case <-s.ctx.Done():
 			return
 		}
@@ -255,26 +401,51 @@ func (s *Server) updateMetrics() {
 
 	// 清理过期的Agent
 	s.cleanupExpiredAgents()
+	if s.cumulative != nil {
+		if err := s.cumulative.CleanupExpiredData(cumulativeAgentMaxAge); err != nil {
+			s.logger.WithError(err).Warn("清理累计数据失败")
+		}
+	}
 
 	if s.config.HTTP.Debug {
 		s.logger.WithField("agent_count", agentCount).Debug("更新指标")
 	}
 }
 
-// cleanupExpiredAgents 清理过期的Agent
+// cumulativeAgentMaxAge 累计统计中Agent停止上报后保留的时间，超过后其贡献从全局累计中移除
+const cumulativeAgentMaxAge = 10 * time.Minute
+
+// cleanupExpiredAgents 清理超过advanced.agent_timeout未上报的Agent及其指标序列
 func (s *Server) cleanupExpiredAgents() {
+	s.configMu.RLock()
+	timeout := s.config.Advanced.AgentTimeout
+	s.configMu.RUnlock()
+
 	s.agentsMu.Lock()
 	defer s.agentsMu.Unlock()
 
 	now := time.Now()
 	for id, agent := range s.agents {
-		if now.Sub(agent.LastSeen) > 5*time.Minute {
+		if now.Sub(agent.LastSeen) > timeout {
 			delete(s.agents, id)
+			s.removeAgentMetricsLocked(id, agent.Hostname)
 			s.logger.WithField("agent_id", id).Info("清理过期Agent")
 		}
 	}
 }
 
+// removeAgentMetricsLocked 删除已移除Agent的指标序列，主机名仍被其他Agent使用时保留按主机名的序列
+// 调用方需持有agentsMu
+func (s *Server) removeAgentMetricsLocked(agentID, hostname string) {
+	for _, agent := range s.agents {
+		if agent.Hostname == hostname {
+			hostname = ""
+			break
+		}
+	}
+	s.metrics.RemoveAgentMetrics(agentID, hostname)
+}
+
 // handleRoot 处理根路径请求
 func (s *Server) handleRoot(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -297,7 +468,7 @@ func (s *Server) handleHealth(c *gin.Context) {
 // handleReady 处理就绪检查
 func (s *Server) handleReady(c *gin.Context) {
 	// 检查存储是否可用
-	if err := s.storage.Store("health_check", time.Now()); err != nil {
+	if err := s.storage.Ping(); err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status": "not ready",
 			"error":  "storage not available",
@@ -313,25 +484,52 @@ func (s *Server) handleReady(c *gin.Context) {
 
 // handleMetrics 处理指标上报
 func (s *Server) handleMetrics(c *gin.Context) {
-	var request common.ReportRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		s.logger.WithError(err).Error("解析指标数据失败")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid request body",
-		})
+	request, contentType, ok := s.decodeReportRequest(c)
+	if !ok {
 		return
 	}
+	if !s.authorizeAgent(c, request.AgentID) {
+		return
+	}
+
+	s.ingestReport(&request)
 
+	// 返回响应，格式与请求一致
+	response := common.ReportResponse{
+		Success:   true,
+		Message:   "Metrics received successfully",
+		Timestamp: time.Now(),
+	}
+
+	s.writeReportResponse(c, &response, contentType)
+}
+
+// ingestReport 处理一次上报（REST和gRPC共用）
+func (s *Server) ingestReport(request *common.ReportRequest) {
 	// 更新Agent信息
 	s.updateAgentInfo(request.AgentID, request.Hostname)
 
 	// 处理指标数据
-	s.processMetricsData(&request.Metrics)
+	s.processMetricsData(request.AgentID, s.reportStartupTime(request), &request.Metrics)
+
+	// 更新全局累计统计
+	if s.cumulative != nil {
+		if err := s.cumulative.ProcessMetrics(cumulativeReport(request)); err != nil {
+			s.logger.WithError(err).WithField("agent_id", request.AgentID).Error("更新累计指标失败")
+		}
+	}
+
+	// 转发到OpenTelemetry Collector
+	if s.otlp != nil {
+		s.otlp.Enqueue(request)
+	}
 
 	// 存储数据
-	key := fmt.Sprintf("metrics:%s:%d", request.AgentID, request.Timestamp.Unix())
-	if err := s.storage.Store(key, request.Metrics); err != nil {
-		s.logger.WithError(err).Error("存储指标数据失败")
+	if request.Timestamp.IsZero() {
+		request.Timestamp = time.Now()
+	}
+	if err := s.storage.PutReport(*request); err != nil {
+		s.logger.WithError(err).WithField("agent_id", request.AgentID).Error("存储指标数据失败")
 	}
 
 	if s.config.HTTP.Debug {
@@ -340,18 +538,9 @@ func (s *Server) handleMetrics(c *gin.Context) {
 			"hostname": request.Hostname,
 		}).Debug("收到指标数据")
 	}
-
-	// 返回响应
-	response := common.ReportResponse{
-		Success:   true,
-		Message:   "Metrics received successfully",
-		Timestamp: time.Now(),
-	}
-
-	c.JSON(http.StatusOK, response)
 }
 
-// handleHeartbeat 处理心跳
+// handleHeartbeat 处理心跳，响应中携带排队等待下发的指令
 func (s *Server) handleHeartbeat(c *gin.Context) {
 	var agentInfo common.AgentInfo
 	if err := c.ShouldBindJSON(&agentInfo); err != nil {
@@ -361,24 +550,65 @@ func (s *Server) handleHeartbeat(c *gin.Context) {
 		})
 		return
 	}
+	if agentInfo.ID == "" {
+		agentInfo.ID = c.GetHeader("X-Agent-ID")
+	}
+	if agentInfo.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "agent id is required",
+		})
+		return
+	}
+	if !s.authorizeAgent(c, agentInfo.ID) {
+		return
+	}
+	if agentInfo.IP == "" {
+		agentInfo.IP = c.ClientIP()
+	}
+
+	s.recordHeartbeat(&agentInfo)
+
+	response := common.HeartbeatResponse{
+		Success:   true,
+		Timestamp: time.Now(),
+	}
+	for _, cmd := range s.stream.TakeDirectives(agentInfo.ID, CommandDelivered) {
+		response.Directives = append(response.Directives, cmd.directive())
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// recordHeartbeat 记录Agent心跳（REST和gRPC共用）
+func (s *Server) recordHeartbeat(agentInfo *common.AgentInfo) {
+	if agentInfo.Status == "" {
+		agentInfo.Status = "online"
+	}
 
 	// 更新Agent信息
 	s.agentsMu.Lock()
+	previous := s.agents[agentInfo.ID]
 	agentInfo.LastSeen = time.Now()
-	s.agents[agentInfo.ID] = &agentInfo
+	s.agents[agentInfo.ID] = agentInfo
 	s.agentsMu.Unlock()
 
+	// 首次心跳或Agent重启后记录运行信息
+	if previous == nil || !previous.StartTime.Equal(agentInfo.StartTime) {
+		s.logger.WithFields(logrus.Fields{
+			"agent_id":       agentInfo.ID,
+			"hostname":       agentInfo.Hostname,
+			"version":        agentInfo.Version,
+			"mode":           agentInfo.Mode,
+			"kernel_version": agentInfo.KernelVersion,
+			"start_time":     agentInfo.StartTime,
+		}).Info("收到Agent运行信息")
+	}
+
 	if s.config.HTTP.Debug {
 		s.logger.WithFields(logrus.Fields{
 			"agent_id": agentInfo.ID,
 			"hostname": agentInfo.Hostname,
 		}).Debug("收到Agent心跳")
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success":   true,
-		"timestamp": time.Now(),
-	})
 }
 
 // handleGetAgents 获取所有Agent信息
@@ -419,9 +649,10 @@ func (s *Server) handleDeleteAgent(c *gin.Context) {
 	agentID := c.Param("id")
 
 	s.agentsMu.Lock()
-	_, exists := s.agents[agentID]
+	agent, exists := s.agents[agentID]
 	if exists {
 		delete(s.agents, agentID)
+		s.removeAgentMetricsLocked(agentID, agent.Hostname)
 	}
 	s.agentsMu.Unlock()
 
@@ -466,6 +697,14 @@ func (s *Server) handleStatus(c *gin.Context) {
 		"version":     "1.0.0",
 		"debug":       s.config.HTTP.Debug,
 		"uptime":      time.Since(s.startTime).String(),
+		"grpc": gin.H{
+			"enabled":     s.config.GRPC.Enabled,
+			"connections": len(s.stream.Sessions()),
+		},
+		"otlp": gin.H{"enabled": false},
+	}
+	if s.otlp != nil {
+		status["otlp"] = s.otlp.Status()
 	}
 
 	c.JSON(http.StatusOK, status)
@@ -480,27 +719,46 @@ func (s *Server) updateAgentInfo(agentID, hostname string) {
 		agent.LastSeen = time.Now()
 		agent.Status = "online"
 	} else {
+		// 版本、启动时间等信息在收到心跳后补全
 		s.agents[agentID] = &common.AgentInfo{
-			ID:        agentID,
-			Hostname:  hostname,
-			Version:   "1.0.0",
-			StartTime: time.Now(),
-			LastSeen:  time.Now(),
-			Status:    "online",
+			ID:       agentID,
+			Hostname: hostname,
+			LastSeen: time.Now(),
+			Status:   "online",
 		}
 		s.logger.WithField("agent_id", agentID).Info("新Agent注册")
 	}
 }
 
-// processMetricsData 处理指标数据
-func (s *Server) processMetricsData(metrics *common.NetworkMetrics) {
+// processMetricsData 处理指标数据，metrics为Agent自startupTime启动以来的累计值
+func (s *Server) processMetricsData(agentID string, startupTime time.Time, metrics *common.NetworkMetrics) {
 	// 更新Prometheus指标
-	s.metrics.UpdateNetworkMetrics(*metrics)
+	s.metrics.UpdateNetworkMetrics(agentID, startupTime, *metrics)
 
 	// 更新网卡信息指标
 	s.updateInterfaceMetrics(metrics)
 }
 
+// reportStartupTime Agent计数的起始时间，用于识别Agent重启
+// 优先使用增强报告中的启动时间，否则使用心跳上报的启动时间
+func (s *Server) reportStartupTime(request *common.ReportRequest) time.Time {
+	if request.Report != nil && !request.Report.StartupTime.IsZero() {
+		return request.Report.StartupTime
+	}
+
+	s.agentsMu.RLock()
+	defer s.agentsMu.RUnlock()
+
+	agent, exists := s.agents[request.AgentID]
+	if !exists {
+		return time.Time{}
+	}
+	if !agent.StartupTime.IsZero() {
+		return agent.StartupTime
+	}
+	return agent.StartTime
+}
+
 // updateInterfaceMetrics 更新网卡信息指标
 func (s *Server) updateInterfaceMetrics(metrics *common.NetworkMetrics) {
 	// 清除旧的网卡信息指标
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+)
+
+func TestCleanupExpiredAgentsRemovesMetrics(t *testing.T) {
+	s := newTestHeartbeatServer()
+	s.config.Advanced.AgentTimeout = time.Minute
+
+	now := time.Now()
+	agents := []struct {
+		id, host string
+		lastSeen time.Time
+	}{
+		{"expiry-a", "expiry-host-a", now.Add(-time.Hour)},      // 过期，主机名只有它使用
+		{"expiry-b", "expiry-host-shared", now.Add(-time.Hour)}, // 过期，主机名仍被expiry-c使用
+		{"expiry-c", "expiry-host-shared", now},
+	}
+	for _, agent := range agents {
+		s.agents[agent.id] = &common.AgentInfo{ID: agent.id, Hostname: agent.host, LastSeen: agent.lastSeen}
+		s.metrics.UpdateNetworkMetrics(agent.id, now.Add(-time.Hour), common.NetworkMetrics{Hostname: agent.host, TotalBytesSent: 10})
+		s.metrics.UpdateReportStats(agent.host, "success")
+	}
+
+	s.cleanupExpiredAgents()
+
+	if _, ok := s.agents["expiry-a"]; ok {
+		t.Fatal("expired agent still registered")
+	}
+	if _, ok := s.agents["expiry-c"]; !ok {
+		t.Fatal("active agent removed")
+	}
+
+	// RemoveAgent只对仍保存计数的Agent返回true
+	for id, wantKept := range map[string]bool{"expiry-a": false, "expiry-b": false, "expiry-c": true} {
+		if kept := s.metrics.Network.RemoveAgent(id); kept != wantKept {
+			t.Fatalf("network counters of %s kept = %v, want %v", id, kept, wantKept)
+		}
+	}
+	// 按主机名的序列只在没有其他Agent使用该主机名时删除
+	if s.metrics.AgentReportTotal.DeleteLabelValues("success", "expiry-host-a") {
+		t.Fatal("host series of the expired agent not removed")
+	}
+	if !s.metrics.AgentReportTotal.DeleteLabelValues("success", "expiry-host-shared") {
+		t.Fatal("host series still used by an active agent removed")
+	}
+}
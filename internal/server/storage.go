@@ -1,36 +1,150 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"go-net-monitoring/internal/common"
 	"go-net-monitoring/internal/config"
 )
 
-// MemoryStorage 内存存储实现
-type MemoryStorage struct {
-	data   map[string]*StorageItem
-	mu     sync.RWMutex
-	config *config.StorageConfig
+// Storage 存储接口
+//
+// 上报按Agent和上报时间索引，按存储配置的保留时间（storage.ttl，按上报时间计算）和大小淘汰；
+// 状态记录（API Key、令牌等）按类型和ID保存，不过期也不参与淘汰。
+// 所有实现都以JSON保存数据，读取时解码为调用方给出的类型，各存储的返回结果一致
+type Storage interface {
+	// PutReport 保存一次上报，同一Agent相同上报时间的上报会被覆盖；超过保留时间的上报不保存
+	PutReport(report common.ReportRequest) error
+	// QueryReports 返回上报时间在[from, to]内的上报，按上报时间升序（相同时按Agent ID）
+	// agentID为空时返回所有Agent的上报；from、to为零值时不限制；
+	// limit>0时超过limit个上报即停止读取并返回ErrTooManyReports
+	QueryReports(agentID string, from, to time.Time, limit int) ([]common.ReportRequest, error)
+	// ListAgents 列出有未过期上报的Agent（按ID排序）
+	ListAgents() ([]string, error)
+
+	// PutState 保存状态记录
+	PutState(kind, id string, value interface{}) error
+	// GetState 读取状态记录并解码到value，不存在时返回ErrNotFound
+	GetState(kind, id string, value interface{}) error
+	// ListState 列出一种状态记录的JSON（按ID排序）
+	ListState(kind string) ([]json.RawMessage, error)
+	// DeleteState 删除状态记录，不存在时返回ErrNotFound
+	DeleteState(kind, id string) error
+
+	// Ping 检查存储是否可用
+	Ping() error
+	Close() error
 }
 
-// StorageItem 存储项
-type StorageItem struct {
-	Value     interface{}
-	Timestamp time.Time
-	TTL       time.Duration
+// ErrNotFound 状态记录不存在
+var ErrNotFound = errors.New("not found")
+
+// ErrStorageLocked 存储文件被其他进程（如运行中的Server）打开
+var ErrStorageLocked = errors.New("storage file is locked by another process")
+
+// ErrTooManyReports 查询范围内的上报超过调用方给出的上限
+var ErrTooManyReports = errors.New("too many reports")
+
+// checkReport 检查上报能否按Agent和上报时间索引
+func checkReport(report *common.ReportRequest) error {
+	if report.AgentID == "" {
+		return fmt.Errorf("agent_id不能为空")
+	}
+	if report.Timestamp.IsZero() {
+		return fmt.Errorf("上报时间不能为空")
+	}
+	return nil
+}
+
+// checkStateKey 检查状态记录的类型和ID
+func checkStateKey(kind, id string) error {
+	if kind == "" || id == "" {
+		return fmt.Errorf("状态记录的类型和ID不能为空")
+	}
+	return nil
+}
+
+// inTimeRange 判断t是否在[from, to]内，零值表示不限制
+func inTimeRange(t, from, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && t.After(to) {
+		return false
+	}
+	return true
+}
+
+// retentionCutoff 早于该时间的上报已过期，ttl<=0时不过期
+func retentionCutoff(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-ttl)
+}
+
+// laterTime 返回两个时间中较晚的一个，零值表示不限制
+func laterTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// storedReport 编码后的上报
+type storedReport struct {
+	agentID string
+	time    time.Time
+	data    []byte
+}
+
+// decodeReports 按上报时间（相同时按Agent ID）排序并解码
+func decodeReports(reports []storedReport) ([]common.ReportRequest, error) {
+	sort.Slice(reports, func(i, j int) bool {
+		if !reports[i].time.Equal(reports[j].time) {
+			return reports[i].time.Before(reports[j].time)
+		}
+		return reports[i].agentID < reports[j].agentID
+	})
+
+	results := make([]common.ReportRequest, 0, len(reports))
+	for _, stored := range reports {
+		var report common.ReportRequest
+		if err := json.Unmarshal(stored.data, &report); err != nil {
+			return nil, fmt.Errorf("反序列化上报失败: %w", err)
+		}
+		results = append(results, report)
+	}
+	return results, nil
+}
+
+// MemoryStorage 内存存储实现
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	config  *config.StorageConfig
+	reports map[string][]storedReport // Agent ID -> 按上报时间升序的上报
+	count   int
+	state   map[string]map[string][]byte
+
+	stopChan  chan struct{}
+	closeOnce sync.Once
 }
 
 // NewMemoryStorage 创建内存存储
 func NewMemoryStorage(cfg *config.StorageConfig) (*MemoryStorage, error) {
+	// 复制配置，热加载时通过UpdateConfig更新
+	cfgCopy := *cfg
 	storage := &MemoryStorage{
-		data:   make(map[string]*StorageItem),
-		config: cfg,
+		config:   &cfgCopy,
+		reports:  make(map[string][]storedReport),
+		state:    make(map[string]map[string][]byte),
+		stopChan: make(chan struct{}),
 	}
 
 	// 启动清理协程
@@ -39,249 +153,239 @@ func NewMemoryStorage(cfg *config.StorageConfig) (*MemoryStorage, error) {
 	return storage, nil
 }
 
-// Store 存储数据
-func (ms *MemoryStorage) Store(key string, value interface{}) error {
+// PutReport 保存上报，超过最大条目数时删除上报时间最早的上报
+func (ms *MemoryStorage) PutReport(report common.ReportRequest) error {
+	if err := checkReport(&report); err != nil {
+		return err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("序列化上报失败: %w", err)
+	}
+
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	// 检查是否超过最大条目数
-	if len(ms.data) >= ms.config.MaxEntries {
-		// 删除最旧的条目
-		ms.evictOldest()
+	t := report.Timestamp
+	if cutoff := retentionCutoff(ms.config.TTL); !cutoff.IsZero() && t.Before(cutoff) {
+		return nil
 	}
 
-	ms.data[key] = &StorageItem{
-		Value:     value,
-		Timestamp: time.Now(),
-		TTL:       ms.config.TTL,
+	list := ms.reports[report.AgentID]
+	i := sort.Search(len(list), func(i int) bool { return !list[i].time.Before(t) })
+	if i < len(list) && list[i].time.Equal(t) {
+		list[i].data = data
+		return nil
 	}
 
+	list = append(list, storedReport{})
+	copy(list[i+1:], list[i:])
+	list[i] = storedReport{agentID: report.AgentID, time: t, data: data}
+	ms.reports[report.AgentID] = list
+	ms.count++
+
+	ms.evictLocked()
 	return nil
 }
 
-// Get 获取数据
-func (ms *MemoryStorage) Get(key string) (interface{}, error) {
+// QueryReports 查询时间范围内的上报
+func (ms *MemoryStorage) QueryReports(agentID string, from, to time.Time, limit int) ([]common.ReportRequest, error) {
 	ms.mu.RLock()
-	defer ms.mu.RUnlock()
+	from = laterTime(from, retentionCutoff(ms.config.TTL))
 
-	item, exists := ms.data[key]
-	if !exists {
-		return nil, fmt.Errorf("key not found: %s", key)
+	var matched []storedReport
+	collect := func(list []storedReport) {
+		i := sort.Search(len(list), func(i int) bool { return !list[i].time.Before(from) })
+		for ; i < len(list) && inTimeRange(list[i].time, from, to); i++ {
+			matched = append(matched, list[i])
+		}
 	}
-
-	// 检查是否过期
-	if ms.isExpired(item) {
-		delete(ms.data, key)
-		return nil, fmt.Errorf("key expired: %s", key)
+	if agentID != "" {
+		collect(ms.reports[agentID])
+	} else {
+		for _, list := range ms.reports {
+			collect(list)
+			if limit > 0 && len(matched) > limit {
+				break
+			}
+		}
 	}
+	ms.mu.RUnlock()
 
-	return item.Value, nil
-}
-
-// Delete 删除数据
-func (ms *MemoryStorage) Delete(key string) error {
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
-
-	delete(ms.data, key)
-	return nil
+	if limit > 0 && len(matched) > limit {
+		return nil, ErrTooManyReports
+	}
+	return decodeReports(matched)
 }
 
-// List 列出数据
-func (ms *MemoryStorage) List(prefix string) ([]interface{}, error) {
+// ListAgents 列出有未过期上报的Agent
+func (ms *MemoryStorage) ListAgents() ([]string, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	var results []interface{}
-	for key, item := range ms.data {
-		if strings.HasPrefix(key, prefix) {
-			// 检查是否过期
-			if !ms.isExpired(item) {
-				results = append(results, item.Value)
-			}
+	cutoff := retentionCutoff(ms.config.TTL)
+	agents := make([]string, 0, len(ms.reports))
+	for agentID, list := range ms.reports {
+		if len(list) > 0 && !list[len(list)-1].time.Before(cutoff) {
+			agents = append(agents, agentID)
 		}
 	}
-
-	return results, nil
+	sort.Strings(agents)
+	return agents, nil
 }
 
-// Close 关闭存储
-func (ms *MemoryStorage) Close() error {
+// PutState 保存状态记录
+func (ms *MemoryStorage) PutState(kind, id string, value interface{}) error {
+	if err := checkStateKey(kind, id); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %w", err)
+	}
+
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	ms.data = nil
+	records := ms.state[kind]
+	if records == nil {
+		records = make(map[string][]byte)
+		ms.state[kind] = records
+	}
+	records[id] = data
 	return nil
 }
 
-// isExpired 检查是否过期
-func (ms *MemoryStorage) isExpired(item *StorageItem) bool {
-	if item.TTL <= 0 {
-		return false // 永不过期
+// GetState 读取状态记录
+func (ms *MemoryStorage) GetState(kind, id string, value interface{}) error {
+	ms.mu.RLock()
+	data, exists := ms.state[kind][id]
+	ms.mu.RUnlock()
+
+	if !exists {
+		return ErrNotFound
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("反序列化数据失败: %w", err)
 	}
-	return time.Since(item.Timestamp) > item.TTL
+	return nil
 }
 
-// evictOldest 删除最旧的条目
-func (ms *MemoryStorage) evictOldest() {
-	var oldestKey string
-	var oldestTime time.Time
+// ListState 列出状态记录
+func (ms *MemoryStorage) ListState(kind string) ([]json.RawMessage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 
-	for key, item := range ms.data {
-		if oldestKey == "" || item.Timestamp.Before(oldestTime) {
-			oldestKey = key
-			oldestTime = item.Timestamp
-		}
+	records := ms.state[kind]
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
 	}
+	sort.Strings(ids)
 
-	if oldestKey != "" {
-		delete(ms.data, oldestKey)
+	results := make([]json.RawMessage, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, append(json.RawMessage(nil), records[id]...))
 	}
+	return results, nil
 }
 
-// cleanupWorker 清理工作协程
-func (ms *MemoryStorage) cleanupWorker() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
+// DeleteState 删除状态记录
+func (ms *MemoryStorage) DeleteState(kind, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 
-	for range ticker.C {
-		ms.cleanup()
+	if _, exists := ms.state[kind][id]; !exists {
+		return ErrNotFound
 	}
+	delete(ms.state[kind], id)
+	return nil
 }
 
-// cleanup 清理过期数据
-func (ms *MemoryStorage) cleanup() {
+// UpdateConfig 热加载保留时间和最大条目数，对已存储的上报同样生效
+func (ms *MemoryStorage) UpdateConfig(cfg *config.StorageConfig) {
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
-
-	var expiredKeys []string
-	for key, item := range ms.data {
-		if ms.isExpired(item) {
-			expiredKeys = append(expiredKeys, key)
-		}
-	}
+	ms.config.TTL = cfg.TTL
+	ms.config.MaxEntries = cfg.MaxEntries
+	ms.evictLocked()
+	ms.mu.Unlock()
 
-	for _, key := range expiredKeys {
-		delete(ms.data, key)
-	}
+	ms.cleanup()
 }
 
-// RedisStorage Redis存储实现
-type RedisStorage struct {
-	client *redis.Client
-	config *config.StorageConfig
-	ctx    context.Context
+// Ping 内存存储总是可用
+func (ms *MemoryStorage) Ping() error {
+	return nil
 }
 
-// NewRedisStorage 创建Redis存储
-func NewRedisStorage(cfg *config.StorageConfig) (*RedisStorage, error) {
-	// 创建Redis客户端
-	rdb := redis.NewClient(&redis.Options{
-		Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
-		Password:     cfg.Redis.Password,
-		DB:           cfg.Redis.DB,
-		PoolSize:     cfg.Redis.PoolSize,
-		DialTimeout:  cfg.Redis.Timeout,
-		ReadTimeout:  cfg.Redis.Timeout,
-		WriteTimeout: cfg.Redis.Timeout,
-	})
-
-	ctx := context.Background()
-
-	// 测试连接
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("连接Redis失败: %w", err)
-	}
-
-	storage := &RedisStorage{
-		client: rdb,
-		config: cfg,
-		ctx:    ctx,
-	}
-
-	return storage, nil
+// Close 停止清理协程
+func (ms *MemoryStorage) Close() error {
+	ms.closeOnce.Do(func() { close(ms.stopChan) })
+	return nil
 }
 
-// Store 存储数据到Redis
-func (rs *RedisStorage) Store(key string, value interface{}) error {
-	// 序列化数据
-	data, err := json.Marshal(value)
-	if err != nil {
-		return fmt.Errorf("序列化数据失败: %w", err)
-	}
+// evictLocked 超过最大条目数时删除上报时间最早的上报，调用方持有写锁
+func (ms *MemoryStorage) evictLocked() {
+	for ms.config.MaxEntries > 0 && ms.count > ms.config.MaxEntries {
+		var oldestAgent string
+		var oldestTime time.Time
+		for agentID, list := range ms.reports {
+			if oldestAgent == "" || list[0].time.Before(oldestTime) {
+				oldestAgent = agentID
+				oldestTime = list[0].time
+			}
+		}
+		if oldestAgent == "" {
+			return
+		}
 
-	// 存储到Redis
-	if rs.config.TTL > 0 {
-		// 设置过期时间
-		return rs.client.Set(rs.ctx, key, data, rs.config.TTL).Err()
-	} else {
-		// 永不过期
-		return rs.client.Set(rs.ctx, key, data, 0).Err()
+		ms.removeOldestLocked(oldestAgent, 1)
 	}
 }
 
-// Get 从Redis获取数据
-func (rs *RedisStorage) Get(key string) (interface{}, error) {
-	data, err := rs.client.Get(rs.ctx, key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("key not found: %s", key)
-		}
-		return nil, fmt.Errorf("获取数据失败: %w", err)
-	}
-
-	// 反序列化数据
-	var value interface{}
-	if err := json.Unmarshal([]byte(data), &value); err != nil {
-		return nil, fmt.Errorf("反序列化数据失败: %w", err)
+// removeOldestLocked 删除Agent最早的n个上报，调用方持有写锁
+func (ms *MemoryStorage) removeOldestLocked(agentID string, n int) {
+	list := ms.reports[agentID]
+	if n >= len(list) {
+		ms.count -= len(list)
+		delete(ms.reports, agentID)
+		return
 	}
 
-	return value, nil
+	// 复制剩余部分，释放被删除上报的内存
+	ms.reports[agentID] = append([]storedReport(nil), list[n:]...)
+	ms.count -= n
 }
 
-// Delete 从Redis删除数据
-func (rs *RedisStorage) Delete(key string) error {
-	return rs.client.Del(rs.ctx, key).Err()
-}
+// cleanupWorker 清理工作协程
+func (ms *MemoryStorage) cleanupWorker() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 
-// List 从Redis列出数据
-func (rs *RedisStorage) List(prefix string) ([]interface{}, error) {
-	// 使用SCAN命令查找匹配的键
-	pattern := prefix + "*"
-	keys, err := rs.client.Keys(rs.ctx, pattern).Result()
-	if err != nil {
-		return nil, fmt.Errorf("查找键失败: %w", err)
+	for {
+		select {
+		case <-ticker.C:
+			ms.cleanup()
+		case <-ms.stopChan:
+			return
+		}
 	}
+}
 
-	if len(keys) == 0 {
-		return []interface{}{}, nil
-	}
+// cleanup 删除超过保留时间的上报
+func (ms *MemoryStorage) cleanup() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 
-	// 批量获取数据
-	values, err := rs.client.MGet(rs.ctx, keys...).Result()
-	if err != nil {
-		return nil, fmt.Errorf("批量获取数据失败: %w", err)
+	cutoff := retentionCutoff(ms.config.TTL)
+	if cutoff.IsZero() {
+		return
 	}
-
-	var results []interface{}
-	for _, val := range values {
-		if val != nil {
-			// 反序列化数据
-			var value interface{}
-			if data, ok := val.(string); ok {
-				if err := json.Unmarshal([]byte(data), &value); err == nil {
-					results = append(results, value)
-				}
-			}
+	for agentID, list := range ms.reports {
+		if n := sort.Search(len(list), func(i int) bool { return !list[i].time.Before(cutoff) }); n > 0 {
+			ms.removeOldestLocked(agentID, n)
 		}
 	}
-
-	return results, nil
-}
-
-// Close 关闭Redis连接
-func (rs *RedisStorage) Close() error {
-	return rs.client.Close()
 }
 
 // NewStorage 根据配置创建存储实例
@@ -291,6 +395,8 @@ func NewStorage(cfg *config.StorageConfig) (Storage, error) {
 		return NewMemoryStorage(cfg)
 	case "redis":
 		return NewRedisStorage(cfg)
+	case "file":
+		return NewFileStorage(cfg)
 	default:
 		return nil, fmt.Errorf("不支持的存储类型: %s", cfg.Type)
 	}
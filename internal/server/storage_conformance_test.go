@@ -0,0 +1,392 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// conformanceTTL 一致性检查使用的保留时间
+const conformanceTTL = time.Hour
+
+// conformanceOptions 存储一致性检查的选项
+type conformanceOptions struct {
+	// ttl 存储配置的保留时间，大于0时检查超过保留时间的上报不会被保存或返回
+	ttl time.Duration
+	// persistent 为true时检查关闭后重新打开存储，上报和状态记录仍然存在
+	persistent bool
+}
+
+// conformanceState 一致性检查使用的状态记录
+type conformanceState struct {
+	Name      string    `json:"name"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// conformanceCheck 一项检查
+type conformanceCheck struct {
+	name string
+	run  func(storage Storage) error
+}
+
+// conformanceBackend 参与检查的存储实现
+type conformanceBackend struct {
+	name string
+	open func() (Storage, error)
+	opts conformanceOptions
+}
+
+// TestStorageConformance 对所有存储实现运行同一组行为检查
+// Redis使用进程内的miniredis；设置NETMON_TEST_REDIS=host:port时额外检查真实的Redis
+func TestStorageConformance(t *testing.T) {
+	mr := miniredis.RunT(t)
+	dir := t.TempDir()
+
+	backends := []conformanceBackend{
+		{
+			name: "memory",
+			open: func() (Storage, error) { return NewStorage(conformanceConfig("memory")) },
+			opts: conformanceOptions{ttl: conformanceTTL},
+		},
+		{
+			name: "file",
+			open: func() (Storage, error) {
+				cfg := conformanceConfig("file")
+				cfg.File.Path = filepath.Join(dir, "server.db")
+				cfg.File.MaxBytes = 1 << 30
+				return NewStorage(cfg)
+			},
+			opts: conformanceOptions{ttl: conformanceTTL, persistent: true},
+		},
+		{
+			name: "redis",
+			open: func() (Storage, error) { return NewStorage(conformanceRedisConfig(mr.Addr())) },
+			opts: conformanceOptions{ttl: conformanceTTL, persistent: true},
+		},
+	}
+	if addr := os.Getenv("NETMON_TEST_REDIS"); addr != "" {
+		backends = append(backends, conformanceBackend{
+			name: "redis " + addr,
+			open: func() (Storage, error) { return NewStorage(conformanceRedisConfig(addr)) },
+			opts: conformanceOptions{ttl: conformanceTTL, persistent: true},
+		})
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			runStorageConformance(t, b.open, b.opts)
+		})
+	}
+}
+
+// runStorageConformance 按顺序执行各项检查，后面的检查依赖前面写入的数据
+// open每次调用都应打开同一份数据（persistent时用于重新打开）；检查使用带时间戳的Agent ID和状态类型，
+// 可以在已有数据的存储上运行，结束时删除写入的状态记录，上报随保留时间过期
+func runStorageConformance(t *testing.T, open func() (Storage, error), opts conformanceOptions) {
+	storage, err := open()
+	if err != nil {
+		t.Fatalf("打开存储失败: %v", err)
+	}
+
+	run := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+	agentA, agentB, agentC := run+"-a", run+"-b", run+"-c"
+	kind := run + "-state"
+	// 时间带纳秒部分，检查存储不会丢失精度；放在保留时间内
+	base := time.Now().Add(-10 * time.Minute).Truncate(time.Second).Add(123456789)
+	if opts.ttl > 0 && opts.ttl <= 10*time.Minute {
+		base = time.Now().Add(-opts.ttl / 2).Truncate(time.Second).Add(123456789)
+	}
+
+	report := func(agentID string, offset time.Duration, connections uint64) common.ReportRequest {
+		return common.ReportRequest{
+			AgentID:   agentID,
+			Hostname:  agentID + ".host",
+			Timestamp: base.Add(offset),
+			Metrics: common.NetworkMetrics{
+				TotalConnections: connections,
+				DomainsAccessed:  map[string]uint64{"example.com": connections},
+			},
+			Report: &common.MetricsReport{AgentID: agentID, ReportMode: common.ReportModeIncremental},
+		}
+	}
+
+	checks := []conformanceCheck{
+		{"ping", func(storage Storage) error { return storage.Ping() }},
+		{"report/put", func(storage Storage) error {
+			for _, r := range []common.ReportRequest{
+				report(agentA, 0, 1),
+				report(agentA, 2*time.Second, 3),
+				report(agentA, time.Second, 2),
+				report(agentB, 1500*time.Millisecond, 10),
+			} {
+				if err := storage.PutReport(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"report/roundtrip", func(storage Storage) error {
+			return expectReports(storage, agentA, time.Time{}, time.Time{}, []common.ReportRequest{
+				report(agentA, 0, 1), report(agentA, time.Second, 2), report(agentA, 2*time.Second, 3),
+			})
+		}},
+		{"report/range_inclusive", func(storage Storage) error {
+			return expectReports(storage, agentA, base.Add(time.Second), base.Add(2*time.Second), []common.ReportRequest{
+				report(agentA, time.Second, 2), report(agentA, 2*time.Second, 3),
+			})
+		}},
+		{"report/range_nanosecond", func(storage Storage) error {
+			return expectReports(storage, agentA, base.Add(time.Second+1), base.Add(2*time.Second-1), nil)
+		}},
+		{"report/all_agents", func(storage Storage) error {
+			reports, err := storage.QueryReports("", base, base.Add(2*time.Second), 0)
+			if err != nil {
+				return err
+			}
+			// 存储中可能有其他数据，只比较本次写入的Agent
+			var own []common.ReportRequest
+			for _, r := range reports {
+				if r.AgentID == agentA || r.AgentID == agentB {
+					own = append(own, r)
+				}
+			}
+			return compareReports(own, []common.ReportRequest{
+				report(agentA, 0, 1), report(agentA, time.Second, 2),
+				report(agentB, 1500*time.Millisecond, 10), report(agentA, 2*time.Second, 3),
+			})
+		}},
+		{"report/limit", func(storage Storage) error {
+			if _, err := storage.QueryReports(agentA, time.Time{}, time.Time{}, 2); !errors.Is(err, ErrTooManyReports) {
+				return fmt.Errorf("超过上限应返回ErrTooManyReports，实际为%v", err)
+			}
+			reports, err := storage.QueryReports(agentA, time.Time{}, time.Time{}, 3)
+			if err != nil {
+				return err
+			}
+			if len(reports) != 3 {
+				return fmt.Errorf("上限等于上报数时应返回全部3个上报，实际为%d个", len(reports))
+			}
+			return nil
+		}},
+		{"report/overwrite", func(storage Storage) error {
+			if err := storage.PutReport(report(agentA, time.Second, 20)); err != nil {
+				return err
+			}
+			return expectReports(storage, agentA, time.Time{}, time.Time{}, []common.ReportRequest{
+				report(agentA, 0, 1), report(agentA, time.Second, 20), report(agentA, 2*time.Second, 3),
+			})
+		}},
+		{"report/unknown_agent", func(storage Storage) error {
+			return expectReports(storage, run+"-unknown", time.Time{}, time.Time{}, nil)
+		}},
+		{"report/invalid", func(storage Storage) error {
+			if err := storage.PutReport(common.ReportRequest{Timestamp: base}); err == nil {
+				return fmt.Errorf("缺少agent_id的上报应返回错误")
+			}
+			if err := storage.PutReport(common.ReportRequest{AgentID: agentA}); err == nil {
+				return fmt.Errorf("缺少上报时间的上报应返回错误")
+			}
+			return nil
+		}},
+		{"report/expired", func(storage Storage) error {
+			if opts.ttl <= 0 {
+				return nil
+			}
+			expired := report(agentC, 0, 1)
+			expired.Timestamp = time.Now().Add(-2 * opts.ttl)
+			if err := storage.PutReport(expired); err != nil {
+				return err
+			}
+			return expectReports(storage, agentC, time.Time{}, time.Time{}, nil)
+		}},
+		{"agents", func(storage Storage) error {
+			agents, err := storage.ListAgents()
+			if err != nil {
+				return err
+			}
+			var own []string
+			for i, agentID := range agents {
+				if i > 0 && agents[i-1] >= agentID {
+					return fmt.Errorf("Agent列表未按ID排序: %v", agents)
+				}
+				if agentID == agentA || agentID == agentB || agentID == agentC {
+					own = append(own, agentID)
+				}
+			}
+			if !reflect.DeepEqual(own, []string{agentA, agentB}) {
+				return fmt.Errorf("Agent列表为 %v，期望 %v", own, []string{agentA, agentB})
+			}
+			return nil
+		}},
+		{"state/roundtrip", func(storage Storage) error {
+			want := conformanceState{Name: "first", Count: 1, CreatedAt: base}
+			if err := storage.PutState(kind, "k1", want); err != nil {
+				return err
+			}
+			var got conformanceState
+			if err := storage.GetState(kind, "k1", &got); err != nil {
+				return err
+			}
+			if got.Name != want.Name || got.Count != want.Count || !got.CreatedAt.Equal(want.CreatedAt) {
+				return fmt.Errorf("读取到 %+v，期望 %+v", got, want)
+			}
+			return nil
+		}},
+		{"state/not_found", func(storage Storage) error {
+			var got conformanceState
+			if err := storage.GetState(kind, "missing", &got); !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("读取不存在的记录返回 %v，期望ErrNotFound", err)
+			}
+			if err := storage.DeleteState(kind, "missing"); !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("删除不存在的记录返回 %v，期望ErrNotFound", err)
+			}
+			return nil
+		}},
+		{"state/list", func(storage Storage) error {
+			if err := storage.PutState(kind, "k2", conformanceState{Name: "second", Count: 2}); err != nil {
+				return err
+			}
+			if err := storage.PutState(kind, "k1", conformanceState{Name: "first", Count: 10}); err != nil {
+				return err
+			}
+			return expectState(storage, kind, []string{"first", "second"}, []int{10, 2})
+		}},
+		{"state/kind_isolation", func(storage Storage) error {
+			return expectState(storage, kind+"-other", nil, nil)
+		}},
+		{"state/delete", func(storage Storage) error {
+			if err := storage.DeleteState(kind, "k1"); err != nil {
+				return err
+			}
+			var got conformanceState
+			if err := storage.GetState(kind, "k1", &got); !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("删除后读取返回 %v，期望ErrNotFound", err)
+			}
+			return expectState(storage, kind, []string{"second"}, []int{2})
+		}},
+	}
+
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			if err := check.run(storage); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if opts.persistent {
+		if err := storage.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+		if storage, err = open(); err != nil {
+			t.Fatalf("重新打开存储失败: %v", err)
+		}
+		if err := expectReports(storage, agentA, time.Time{}, time.Time{}, []common.ReportRequest{
+			report(agentA, 0, 1), report(agentA, time.Second, 20), report(agentA, 2*time.Second, 3),
+		}); err != nil {
+			t.Errorf("reopen/reports: %v", err)
+		}
+		if err := expectState(storage, kind, []string{"second"}, []int{2}); err != nil {
+			t.Errorf("reopen/state: %v", err)
+		}
+	}
+
+	if err := storage.DeleteState(kind, "k2"); err != nil && !errors.Is(err, ErrNotFound) {
+		t.Errorf("cleanup: %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
+
+// conformanceConfig 检查使用的存储配置
+func conformanceConfig(storageType string) *config.StorageConfig {
+	return &config.StorageConfig{
+		Type:       storageType,
+		TTL:        conformanceTTL,
+		MaxEntries: 10000,
+	}
+}
+
+// conformanceRedisConfig 连接addr的Redis存储配置
+func conformanceRedisConfig(addr string) *config.StorageConfig {
+	cfg := conformanceConfig("redis")
+
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, portText = addr, "6379"
+	}
+	port, _ := strconv.Atoi(portText)
+
+	cfg.Redis = config.RedisConfig{
+		Host:     host,
+		Port:     port,
+		PoolSize: 10,
+		Timeout:  5 * time.Second,
+	}
+	return cfg
+}
+
+// expectReports 查询并与期望的上报比较
+func expectReports(storage Storage, agentID string, from, to time.Time, want []common.ReportRequest) error {
+	got, err := storage.QueryReports(agentID, from, to, 0)
+	if err != nil {
+		return err
+	}
+	return compareReports(got, want)
+}
+
+// compareReports 按顺序比较上报的Agent、时间和内容
+func compareReports(got, want []common.ReportRequest) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("返回 %d 个上报，期望 %d 个", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		switch {
+		case g.AgentID != w.AgentID || !g.Timestamp.Equal(w.Timestamp):
+			return fmt.Errorf("第 %d 个上报为 %s@%s，期望 %s@%s", i, g.AgentID, g.Timestamp.Format(time.RFC3339Nano), w.AgentID, w.Timestamp.Format(time.RFC3339Nano))
+		case g.Hostname != w.Hostname || g.Metrics.TotalConnections != w.Metrics.TotalConnections:
+			return fmt.Errorf("第 %d 个上报内容不一致", i)
+		case !reflect.DeepEqual(g.Metrics.DomainsAccessed, w.Metrics.DomainsAccessed):
+			return fmt.Errorf("第 %d 个上报的域名统计不一致", i)
+		case g.Report == nil || g.Report.ReportMode != w.Report.ReportMode:
+			return fmt.Errorf("第 %d 个上报的增强报告不一致", i)
+		}
+	}
+	return nil
+}
+
+// expectState 列出状态记录并按顺序比较名称和计数
+func expectState(storage Storage, kind string, names []string, counts []int) error {
+	values, err := storage.ListState(kind)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(names) {
+		return fmt.Errorf("返回 %d 条记录，期望 %d 条", len(values), len(names))
+	}
+	for i, value := range values {
+		var state conformanceState
+		if err := json.Unmarshal(value, &state); err != nil {
+			return fmt.Errorf("第 %d 条记录解码失败: %w", i, err)
+		}
+		if state.Name != names[i] || state.Count != counts[i] {
+			return fmt.Errorf("第 %d 条记录为 %s/%d，期望 %s/%d", i, state.Name, state.Count, names[i], counts[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,577 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileStorage 基于bbolt的本地文件存储，Server重启后数据保留
+//
+// reports桶下每个Agent一个子桶，键为8字节上报时间（UnixNano，大端），按时间有序，按时间范围查询时直接定位；
+// timeline桶的键为上报时间加Agent ID，按保留时间和大小淘汰时从最旧的一端删除。
+// 状态记录保存在state桶下按类型划分的子桶中，不过期也不参与淘汰。
+// 每次写入都是一个bbolt事务，提交时同步到磁盘，进程崩溃或断电后不会出现写了一半的数据。
+// max_bytes限制的是数据大小（键和值的字节数）；删除数据后bbolt只复用空闲页而不缩小文件，
+// 空闲页较多时把数据压缩到新文件后替换原文件
+type FileStorage struct {
+	dbMu sync.RWMutex // 事务持有读锁，压缩替换文件时持有写锁
+	db   *bolt.DB
+	path string
+	open func(path string) (*bolt.DB, error)
+	// 压缩后重新打开存储文件失败的原因，非nil时db已关闭，读写返回错误，Ping据此报告存储不可用
+	openErr error
+	retryAt time.Time // 下一次尝试重新打开的时间
+
+	mu       sync.Mutex
+	config   *config.StorageConfig
+	dataSize int64 // 各Agent子桶中键和值的总字节数
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+var (
+	reportsBucket  = []byte("reports")
+	timelineBucket = []byte("timeline")
+	stateBucket    = []byte("state")
+)
+
+// fileStorageCleanupInterval 按保留时间清理的间隔
+const fileStorageCleanupInterval = time.Minute
+
+// fileReopenRetryInterval 存储文件重新打开失败后，读写时再次尝试的最小间隔
+const fileReopenRetryInterval = 10 * time.Second
+
+// 空闲页超过fileCompactMinFree且超过文件大小的一半时压缩存储文件
+const (
+	fileCompactMinFree   = 64 << 20
+	fileCompactTxMaxSize = 64 << 20 // 压缩时每个事务复制的数据量
+)
+
+// NewFileStorage 打开或创建存储文件
+func NewFileStorage(cfg *config.StorageConfig) (*FileStorage, error) {
+	path := cfg.File.Path
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+
+	// 文件被其他进程（如另一个Server实例）打开时bbolt会阻塞等待文件锁，超时后返回错误
+	db, err := openBoltFile(path)
+	if err != nil {
+		if err == bolt.ErrTimeout {
+			return nil, fmt.Errorf("打开存储文件 %s 失败: 文件被其他进程占用: %w", path, ErrStorageLocked)
+		}
+		return nil, fmt.Errorf("打开存储文件 %s 失败: %w", path, err)
+	}
+
+	cfgCopy := *cfg
+	storage := &FileStorage{
+		db:       db,
+		path:     path,
+		open:     openBoltFile,
+		config:   &cfgCopy,
+		stopChan: make(chan struct{}),
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{reportsBucket, timelineBucket, stateBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		// 统计已有数据的大小
+		return forEachAgentBucket(tx, func(agentID []byte, bucket *bolt.Bucket) error {
+			return bucket.ForEach(func(k, v []byte) error {
+				storage.dataSize += int64(len(k) + len(v))
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化存储文件失败: %w", err)
+	}
+
+	storage.wg.Add(1)
+	go storage.cleanupWorker()
+
+	return storage, nil
+}
+
+// openBoltFile 打开bbolt文件，文件锁被占用时等待2秒后返回bolt.ErrTimeout
+func openBoltFile(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+}
+
+// PutReport 保存上报，超过保留大小时删除最旧的上报
+func (fs *FileStorage) PutReport(report common.ReportRequest) error {
+	if err := checkReport(&report); err != nil {
+		return err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("序列化上报失败: %w", err)
+	}
+
+	cutoff := fs.cutoff()
+	if !cutoff.IsZero() && report.Timestamp.Before(cutoff) {
+		return nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(reportsBucket).CreateBucketIfNotExists([]byte(report.AgentID))
+		if err != nil {
+			return err
+		}
+
+		key := encodeReportTime(report.Timestamp)
+		delta := int64(len(key) + len(data))
+		if old := bucket.Get(key); old != nil {
+			delta -= int64(len(key) + len(old))
+		}
+		if err := bucket.Put(key, data); err != nil {
+			return err
+		}
+		if err := tx.Bucket(timelineBucket).Put(encodeTimelineKey(report.Timestamp, report.AgentID), []byte{}); err != nil {
+			return err
+		}
+
+		size := fs.dataSize + delta
+		if maxBytes := fs.config.File.MaxBytes; maxBytes > 0 && size > maxBytes {
+			freed, err := evictReports(tx, func(t time.Time, size int64) bool { return size > maxBytes }, size)
+			if err != nil {
+				return err
+			}
+			size -= freed
+		}
+
+		// 提交失败时不更新大小
+		tx.OnCommit(func() { fs.dataSize = size })
+		return nil
+	})
+}
+
+// QueryReports 在Agent子桶中按上报时间定位查询
+func (fs *FileStorage) QueryReports(agentID string, from, to time.Time, limit int) ([]common.ReportRequest, error) {
+	from = laterTime(from, fs.cutoff())
+
+	var matched []storedReport
+	err := fs.view(func(tx *bolt.Tx) error {
+		collect := func(agentID []byte, bucket *bolt.Bucket) error {
+			c := bucket.Cursor()
+			k, v := c.First()
+			if !from.IsZero() {
+				k, v = c.Seek(encodeReportTime(from))
+			}
+			for ; k != nil; k, v = c.Next() {
+				t := decodeReportTime(k)
+				if !inTimeRange(t, from, to) {
+					break
+				}
+				if limit > 0 && len(matched) >= limit {
+					return ErrTooManyReports
+				}
+				matched = append(matched, storedReport{
+					agentID: string(agentID),
+					time:    t,
+					data:    append([]byte(nil), v...),
+				})
+			}
+			return nil
+		}
+
+		if agentID != "" {
+			if bucket := tx.Bucket(reportsBucket).Bucket([]byte(agentID)); bucket != nil {
+				return collect([]byte(agentID), bucket)
+			}
+			return nil
+		}
+		return forEachAgentBucket(tx, collect)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeReports(matched)
+}
+
+// ListAgents 列出有未过期上报的Agent（桶按名称有序）
+func (fs *FileStorage) ListAgents() ([]string, error) {
+	cutoff := fs.cutoff()
+
+	agents := []string{}
+	err := fs.view(func(tx *bolt.Tx) error {
+		return forEachAgentBucket(tx, func(agentID []byte, bucket *bolt.Bucket) error {
+			if last, _ := bucket.Cursor().Last(); last != nil && !decodeReportTime(last).Before(cutoff) {
+				agents = append(agents, string(agentID))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// PutState 保存状态记录
+func (fs *FileStorage) PutState(kind, id string, value interface{}) error {
+	if err := checkStateKey(kind, id); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %w", err)
+	}
+
+	return fs.update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(stateBucket).CreateBucketIfNotExists([]byte(kind))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// GetState 读取状态记录
+func (fs *FileStorage) GetState(kind, id string, value interface{}) error {
+	var data []byte
+	err := fs.view(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(stateBucket).Bucket([]byte(kind)); bucket != nil {
+			if v := bucket.Get([]byte(id)); v != nil {
+				data = append([]byte(nil), v...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return ErrNotFound
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("反序列化数据失败: %w", err)
+	}
+	return nil
+}
+
+// ListState 列出状态记录（桶中的键有序）
+func (fs *FileStorage) ListState(kind string) ([]json.RawMessage, error) {
+	results := []json.RawMessage{}
+	err := fs.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stateBucket).Bucket([]byte(kind))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			results = append(results, append(json.RawMessage(nil), v...))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteState 删除状态记录
+func (fs *FileStorage) DeleteState(kind, id string) error {
+	return fs.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(stateBucket).Bucket([]byte(kind))
+		if bucket == nil || bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// UpdateConfig 热加载保留时间和大小上限，对已存储的数据同样生效
+func (fs *FileStorage) UpdateConfig(cfg *config.StorageConfig) {
+	fs.mu.Lock()
+	fs.config.TTL = cfg.TTL
+	fs.config.File.MaxBytes = cfg.File.MaxBytes
+	fs.mu.Unlock()
+
+	fs.cleanup()
+	fs.maybeCompact()
+}
+
+// Ping 检查存储文件是否可读
+func (fs *FileStorage) Ping() error {
+	return fs.view(func(tx *bolt.Tx) error { return nil })
+}
+
+// Close 停止清理协程并关闭存储文件
+func (fs *FileStorage) Close() error {
+	close(fs.stopChan)
+	fs.wg.Wait()
+
+	fs.dbMu.Lock()
+	defer fs.dbMu.Unlock()
+	if fs.openErr != nil {
+		return nil
+	}
+	return fs.db.Close()
+}
+
+// view 执行只读事务
+func (fs *FileStorage) view(fn func(tx *bolt.Tx) error) error {
+	fs.retryOpen()
+
+	fs.dbMu.RLock()
+	defer fs.dbMu.RUnlock()
+	if fs.openErr != nil {
+		return fmt.Errorf("存储文件不可用: %w", fs.openErr)
+	}
+	return fs.db.View(fn)
+}
+
+// update 执行读写事务
+func (fs *FileStorage) update(fn func(tx *bolt.Tx) error) error {
+	fs.retryOpen()
+
+	fs.dbMu.RLock()
+	defer fs.dbMu.RUnlock()
+	if fs.openErr != nil {
+		return fmt.Errorf("存储文件不可用: %w", fs.openErr)
+	}
+	return fs.db.Update(fn)
+}
+
+// retryOpen 存储文件在压缩后没能重新打开时，按间隔重试打开
+func (fs *FileStorage) retryOpen() {
+	fs.dbMu.RLock()
+	failed := fs.openErr != nil && !time.Now().Before(fs.retryAt)
+	fs.dbMu.RUnlock()
+	if !failed {
+		return
+	}
+
+	fs.dbMu.Lock()
+	defer fs.dbMu.Unlock()
+	if fs.openErr != nil && !time.Now().Before(fs.retryAt) {
+		fs.reopenLocked()
+	}
+}
+
+// reopenLocked 重新打开存储文件，失败时记录原因，调用方需持有dbMu写锁
+func (fs *FileStorage) reopenLocked() error {
+	db, err := fs.open(fs.path)
+	if err != nil {
+		fs.openErr = fmt.Errorf("重新打开存储文件 %s 失败: %w", fs.path, err)
+		fs.retryAt = time.Now().Add(fileReopenRetryInterval)
+		return fs.openErr
+	}
+	fs.db = db
+	fs.openErr = nil
+	return nil
+}
+
+// cutoff 早于该时间的上报已过期，TTL<=0时不过期
+func (fs *FileStorage) cutoff() time.Time {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return retentionCutoff(fs.config.TTL)
+}
+
+// cleanupWorker 定期删除过期数据
+func (fs *FileStorage) cleanupWorker() {
+	defer fs.wg.Done()
+
+	ticker := time.NewTicker(fileStorageCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fs.cleanup()
+			fs.maybeCompact()
+		case <-fs.stopChan:
+			return
+		}
+	}
+}
+
+// cleanup 删除超过保留时间的上报，并把总大小降到上限以内
+func (fs *FileStorage) cleanup() {
+	cutoff := fs.cutoff()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	maxBytes := fs.config.File.MaxBytes
+	fs.update(func(tx *bolt.Tx) error {
+		freed, err := evictReports(tx, func(t time.Time, size int64) bool {
+			return (!cutoff.IsZero() && t.Before(cutoff)) || (maxBytes > 0 && size > maxBytes)
+		}, fs.dataSize)
+		if err != nil {
+			return err
+		}
+
+		size := fs.dataSize - freed
+		tx.OnCommit(func() { fs.dataSize = size })
+		return nil
+	})
+}
+
+// maybeCompact 空闲页超过阈值时压缩存储文件，失败时继续使用原文件
+func (fs *FileStorage) maybeCompact() {
+	fs.dbMu.RLock()
+	if fs.openErr != nil {
+		fs.dbMu.RUnlock()
+		return
+	}
+	stats := fs.db.Stats()
+	free := int64(stats.FreePageN+stats.PendingPageN) * int64(fs.db.Info().PageSize)
+	info, err := os.Stat(fs.db.Path())
+	fs.dbMu.RUnlock()
+
+	if err != nil || free < fileCompactMinFree || free*2 < info.Size() {
+		return
+	}
+	fs.compact()
+}
+
+// compact 把数据复制到临时文件，同步后替换存储文件并重新打开
+// 替换期间持有写锁，其他读写等待压缩完成
+func (fs *FileStorage) compact() error {
+	fs.dbMu.Lock()
+	defer fs.dbMu.Unlock()
+
+	if fs.openErr != nil {
+		return fs.openErr
+	}
+
+	path := fs.path
+	tmpPath := path + ".compact"
+	os.Remove(tmpPath)
+
+	dst, err := openBoltFile(tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建压缩文件失败: %w", err)
+	}
+	if err := bolt.Compact(dst, fs.db, fileCompactTxMaxSize); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("压缩存储文件失败: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("关闭压缩文件失败: %w", err)
+	}
+
+	// 关闭后才能替换（文件锁），替换失败时重新打开原文件；
+	// 重新打开失败时存储标记为不可用（Ping返回错误），之后的读写按间隔重试打开
+	fs.db.Close()
+	renameErr := os.Rename(tmpPath, path)
+	if renameErr == nil {
+		if dir, err := os.Open(filepath.Dir(path)); err == nil {
+			dir.Sync()
+			dir.Close()
+		}
+	} else {
+		os.Remove(tmpPath)
+	}
+
+	if err := fs.reopenLocked(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("替换存储文件失败: %w", renameErr)
+	}
+	return nil
+}
+
+// evictReports 按timeline从最旧的上报开始删除，直到evict返回false，返回释放的字节数
+// evict的size参数为删除当前上报之前的总大小；Agent的上报全部删除后同时删除其子桶
+func evictReports(tx *bolt.Tx, evict func(t time.Time, size int64) bool, size int64) (int64, error) {
+	reports := tx.Bucket(reportsBucket)
+
+	var freed int64
+	c := tx.Bucket(timelineBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.First() {
+		t, agentID := decodeTimelineKey(k)
+		if !evict(t, size-freed) {
+			break
+		}
+		agentID = append([]byte(nil), agentID...)
+
+		if bucket := reports.Bucket(agentID); bucket != nil {
+			key := encodeReportTime(t)
+			if v := bucket.Get(key); v != nil {
+				freed += int64(len(key) + len(v))
+				if err := bucket.Delete(key); err != nil {
+					return freed, err
+				}
+			}
+			if first, _ := bucket.Cursor().First(); first == nil {
+				if err := reports.DeleteBucket(agentID); err != nil {
+					return freed, err
+				}
+			}
+		}
+		if err := c.Delete(); err != nil {
+			return freed, err
+		}
+	}
+	return freed, nil
+}
+
+// forEachAgentBucket 按Agent ID顺序遍历reports下的子桶
+func forEachAgentBucket(tx *bolt.Tx, fn func(agentID []byte, bucket *bolt.Bucket) error) error {
+	reports := tx.Bucket(reportsBucket)
+	return reports.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		return fn(k, reports.Bucket(k))
+	})
+}
+
+// encodeReportTime 上报时间键：8字节UnixNano（大端）
+func encodeReportTime(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// decodeReportTime 解析上报时间键
+func decodeReportTime(key []byte) time.Time {
+	if len(key) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+// encodeTimelineKey timeline键：8字节上报时间 + Agent ID
+func encodeTimelineKey(t time.Time, agentID string) []byte {
+	key := make([]byte, 8+len(agentID))
+	copy(key, encodeReportTime(t))
+	copy(key[8:], agentID)
+	return key
+}
+
+// decodeTimelineKey 解析timeline键
+func decodeTimelineKey(key []byte) (time.Time, []byte) {
+	if len(key) < 8 {
+		return time.Time{}, nil
+	}
+	return decodeReportTime(key), key[8:]
+}
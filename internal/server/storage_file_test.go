@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestFileStorageCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.db")
+	storage, err := NewFileStorage(&config.StorageConfig{File: config.FileStorageConfig{Path: path, MaxBytes: 64 << 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	base := time.Now().Add(-time.Hour)
+	hostname := strings.Repeat("h", 4096)
+	for i := 0; i < 2000; i++ {
+		report := common.ReportRequest{AgentID: "agent-a", Hostname: hostname, Timestamp: base.Add(time.Duration(i) * time.Millisecond)}
+		if err := storage.PutReport(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storage.PutState("api_keys", "agent-a", map[string]string{"agent_id": "agent-a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 调小上限后只保留最新的少量上报，文件大小不变，压缩后缩小
+	storage.UpdateConfig(&config.StorageConfig{File: config.FileStorageConfig{MaxBytes: 64 << 10}})
+	before, _ := os.Stat(path)
+	if err := storage.compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size()/2 {
+		t.Fatalf("file not compacted: %d -> %d bytes", before.Size(), after.Size())
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+
+	reports, err := storage.QueryReports("agent-a", base, base.Add(time.Hour), 0)
+	if err != nil || len(reports) == 0 {
+		t.Fatalf("reports lost after compaction: %d, %v", len(reports), err)
+	}
+	var record map[string]string
+	if err := storage.GetState("api_keys", "agent-a", &record); err != nil {
+		t.Fatalf("state lost after compaction: %v", err)
+	}
+	if err := storage.PutReport(common.ReportRequest{AgentID: "agent-b", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("write after compaction: %v", err)
+	}
+}
+
+func TestFileStorageLockedByAnotherOpen(t *testing.T) {
+	cfg := &config.StorageConfig{Type: "file", File: config.FileStorageConfig{Path: filepath.Join(t.TempDir(), "server.db")}}
+	storage, err := NewStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	// Server运行时 token 命令打开同一文件，按文件被锁定报错
+	if _, err := NewStorage(cfg); !errors.Is(err, ErrStorageLocked) {
+		t.Fatalf("second open error = %v, want ErrStorageLocked", err)
+	}
+}
+
+func TestFileStorageCompactReopenFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.db")
+	storage, err := NewFileStorage(&config.StorageConfig{File: config.FileStorageConfig{Path: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	report := common.ReportRequest{AgentID: "agent-a", Timestamp: time.Now()}
+	if err := storage.PutReport(report); err != nil {
+		t.Fatal(err)
+	}
+
+	// 压缩后重新打开失败：存储标记为不可用，Ping和读写返回错误而不是使用已关闭的句柄
+	storage.open = func(string) (*bolt.DB, error) { return nil, errors.New("disk gone") }
+	if err := storage.compact(); err == nil {
+		t.Fatal("compact should report the reopen failure")
+	}
+	if err := storage.Ping(); err == nil || !strings.Contains(err.Error(), "disk gone") {
+		t.Fatalf("Ping = %v, want reopen failure", err)
+	}
+	if err := storage.PutReport(report); err == nil {
+		t.Fatal("write succeeded on a closed storage file")
+	}
+
+	// 重试间隔之后读写时重新打开，数据仍在
+	storage.open = openBoltFile
+	storage.dbMu.Lock()
+	storage.retryAt = time.Time{}
+	storage.dbMu.Unlock()
+	if err := storage.Ping(); err != nil {
+		t.Fatalf("Ping after recovery: %v", err)
+	}
+	reports, err := storage.QueryReports("agent-a", time.Time{}, time.Now().Add(time.Minute), 0)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("reports after recovery = %d, %v; want 1", len(reports), err)
+	}
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis中的键，只使用有序集合、集合和哈希的范围操作，不使用会阻塞Redis的KEYS
+const (
+	redisAgentsKey    = "reports:agents" // 集合：有上报的Agent ID
+	redisIndexPrefix  = "reports:index:" // 有序集合：Agent的上报时间（UnixNano）索引，分数为上报时间的毫秒数
+	redisReportPrefix = "reports:data:"  // 字符串：上报JSON，后接"<Agent ID>:<UnixNano>"，按保留时间过期
+	redisStatePrefix  = "state:"         // 哈希：一种状态记录，字段为ID
+)
+
+// redisMGetBatch 每次MGET读取的上报数
+const redisMGetBatch = 500
+
+// redisRemoveEmptyAgent 索引为空时从Agent集合中删除，与写入并发时不会误删
+var redisRemoveEmptyAgent = redis.NewScript(`
+if redis.call('ZCARD', KEYS[1]) == 0 then
+	return redis.call('SREM', KEYS[2], ARGV[1])
+end
+return 0
+`)
+
+// RedisStorage Redis存储实现
+type RedisStorage struct {
+	client *redis.Client
+	config *config.StorageConfig
+	mu     sync.RWMutex
+	ctx    context.Context
+}
+
+// NewRedisStorage 创建Redis存储
+func NewRedisStorage(cfg *config.StorageConfig) (*RedisStorage, error) {
+	// 创建Redis客户端
+	rdb := redis.NewClient(&redis.Options{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+		Password:     cfg.Redis.Password,
+		DB:           cfg.Redis.DB,
+		PoolSize:     cfg.Redis.PoolSize,
+		DialTimeout:  cfg.Redis.Timeout,
+		ReadTimeout:  cfg.Redis.Timeout,
+		WriteTimeout: cfg.Redis.Timeout,
+	})
+
+	ctx := context.Background()
+
+	// 测试连接
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("连接Redis失败: %w", err)
+	}
+
+	cfgCopy := *cfg
+	return &RedisStorage{
+		client: rdb,
+		config: &cfgCopy,
+		ctx:    ctx,
+	}, nil
+}
+
+// PutReport 保存上报：写入上报JSON并加入Agent的时间索引，同时删除索引中已过期的部分
+func (rs *RedisStorage) PutReport(report common.ReportRequest) error {
+	if err := checkReport(&report); err != nil {
+		return err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("序列化上报失败: %w", err)
+	}
+
+	ttl := rs.ttl()
+
+	// 上报JSON在上报时间超过保留时间时过期，与索引的清理时间一致
+	var expiration time.Duration
+	if ttl > 0 {
+		expiration = ttl - time.Since(report.Timestamp)
+		if expiration <= 0 {
+			return nil
+		}
+	}
+
+	member := strconv.FormatInt(report.Timestamp.UnixNano(), 10)
+	indexKey := redisIndexPrefix + report.AgentID
+
+	_, err = rs.client.TxPipelined(rs.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(rs.ctx, redisReportKey(report.AgentID, member), data, expiration)
+		pipe.ZAdd(rs.ctx, indexKey, &redis.Z{Score: float64(report.Timestamp.UnixMilli()), Member: member})
+		pipe.SAdd(rs.ctx, redisAgentsKey, report.AgentID)
+		if ttl > 0 {
+			pipe.ZRemRangeByScore(rs.ctx, indexKey, "-inf", redisScoreBefore(time.Now().Add(-ttl)))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("保存上报失败: %w", err)
+	}
+	return nil
+}
+
+// QueryReports 按时间索引查询上报，数量不超过limit时再用MGET批量读取
+func (rs *RedisStorage) QueryReports(agentID string, from, to time.Time, limit int) ([]common.ReportRequest, error) {
+	from = laterTime(from, retentionCutoff(rs.ttl()))
+
+	agents := []string{agentID}
+	if agentID == "" {
+		var err error
+		if agents, err = rs.client.SMembers(rs.ctx, redisAgentsKey).Result(); err != nil {
+			return nil, fmt.Errorf("查询Agent列表失败: %w", err)
+		}
+	}
+
+	rangeBy := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !from.IsZero() {
+		rangeBy.Min = strconv.FormatInt(from.UnixMilli(), 10)
+	}
+	if !to.IsZero() {
+		rangeBy.Max = strconv.FormatInt(to.UnixMilli(), 10)
+	}
+
+	pending := make(map[string][]storedReport, len(agents))
+	total := 0
+	for _, agent := range agents {
+		members, err := rs.client.ZRangeByScore(rs.ctx, redisIndexPrefix+agent, rangeBy).Result()
+		if err != nil {
+			return nil, fmt.Errorf("查询上报索引失败: %w", err)
+		}
+
+		// 索引分数精确到毫秒，按成员中的纳秒时间再过滤一次
+		for _, member := range members {
+			nanos, err := strconv.ParseInt(member, 10, 64)
+			if err != nil {
+				continue
+			}
+			if t := time.Unix(0, nanos); inTimeRange(t, from, to) {
+				pending[agent] = append(pending[agent], storedReport{agentID: agent, time: t})
+				total++
+			}
+		}
+		if limit > 0 && total > limit {
+			return nil, ErrTooManyReports
+		}
+	}
+
+	var matched []storedReport
+	for _, agent := range agents {
+		reports, err := rs.loadReports(agent, pending[agent])
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, reports...)
+	}
+
+	return decodeReports(matched)
+}
+
+// loadReports 读取上报JSON，已过期的上报从索引中删除
+func (rs *RedisStorage) loadReports(agentID string, pending []storedReport) ([]storedReport, error) {
+	var loaded []storedReport
+	var missing []interface{}
+
+	for start := 0; start < len(pending); start += redisMGetBatch {
+		end := start + redisMGetBatch
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		keys := make([]string, len(batch))
+		for i, stored := range batch {
+			keys[i] = redisReportKey(agentID, strconv.FormatInt(stored.time.UnixNano(), 10))
+		}
+		values, err := rs.client.MGet(rs.ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("批量获取上报失败: %w", err)
+		}
+
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				missing = append(missing, strconv.FormatInt(batch[i].time.UnixNano(), 10))
+				continue
+			}
+			batch[i].data = []byte(data)
+			loaded = append(loaded, batch[i])
+		}
+	}
+
+	if len(missing) > 0 {
+		if err := rs.client.ZRem(rs.ctx, redisIndexPrefix+agentID, missing...).Err(); err != nil {
+			return nil, fmt.Errorf("清理上报索引失败: %w", err)
+		}
+	}
+	return loaded, nil
+}
+
+// ListAgents 列出有未过期上报的Agent，顺带删除索引已清空的Agent
+func (rs *RedisStorage) ListAgents() ([]string, error) {
+	members, err := rs.client.SMembers(rs.ctx, redisAgentsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("查询Agent列表失败: %w", err)
+	}
+
+	ttl := rs.ttl()
+	agents := make([]string, 0, len(members))
+	for _, agentID := range members {
+		indexKey := redisIndexPrefix + agentID
+		if ttl > 0 {
+			if err := rs.client.ZRemRangeByScore(rs.ctx, indexKey, "-inf", redisScoreBefore(time.Now().Add(-ttl))).Err(); err != nil {
+				return nil, fmt.Errorf("清理上报索引失败: %w", err)
+			}
+		}
+
+		count, err := rs.client.ZCard(rs.ctx, indexKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("查询上报索引失败: %w", err)
+		}
+		if count > 0 {
+			agents = append(agents, agentID)
+			continue
+		}
+		if err := redisRemoveEmptyAgent.Run(rs.ctx, rs.client, []string{indexKey, redisAgentsKey}, agentID).Err(); err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("清理Agent列表失败: %w", err)
+		}
+	}
+
+	sort.Strings(agents)
+	return agents, nil
+}
+
+// PutState 保存状态记录
+func (rs *RedisStorage) PutState(kind, id string, value interface{}) error {
+	if err := checkStateKey(kind, id); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %w", err)
+	}
+
+	return rs.client.HSet(rs.ctx, redisStatePrefix+kind, id, data).Err()
+}
+
+// GetState 读取状态记录
+func (rs *RedisStorage) GetState(kind, id string, value interface{}) error {
+	data, err := rs.client.HGet(rs.ctx, redisStatePrefix+kind, id).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		return fmt.Errorf("获取数据失败: %w", err)
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("反序列化数据失败: %w", err)
+	}
+	return nil
+}
+
+// ListState 列出状态记录
+func (rs *RedisStorage) ListState(kind string) ([]json.RawMessage, error) {
+	records, err := rs.client.HGetAll(rs.ctx, redisStatePrefix+kind).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取数据失败: %w", err)
+	}
+
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	results := make([]json.RawMessage, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, json.RawMessage(records[id]))
+	}
+	return results, nil
+}
+
+// DeleteState 删除状态记录
+func (rs *RedisStorage) DeleteState(kind, id string) error {
+	deleted, err := rs.client.HDel(rs.ctx, redisStatePrefix+kind, id).Result()
+	if err != nil {
+		return fmt.Errorf("删除数据失败: %w", err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateConfig 热加载保留时间，新的保留时间用于之后的写入、查询和索引清理
+func (rs *RedisStorage) UpdateConfig(cfg *config.StorageConfig) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.config.TTL = cfg.TTL
+}
+
+// Ping 检查Redis连接
+func (rs *RedisStorage) Ping() error {
+	return rs.client.Ping(rs.ctx).Err()
+}
+
+// Close 关闭Redis连接
+func (rs *RedisStorage) Close() error {
+	return rs.client.Close()
+}
+
+// ttl 当前的保留时间
+func (rs *RedisStorage) ttl() time.Duration {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return rs.config.TTL
+}
+
+// redisReportKey 上报JSON的键
+func redisReportKey(agentID, member string) string {
+	return redisReportPrefix + agentID + ":" + member
+}
+
+// redisScoreBefore 早于t的分数上限（不含）
+func redisScoreBefore(t time.Time) string {
+	return "(" + strconv.FormatInt(t.UnixMilli(), 10)
+}
@@ -0,0 +1,726 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/api/netmonv1"
+	"go-net-monitoring/pkg/auth"
+	"go-net-monitoring/pkg/codec"
+	"go-net-monitoring/pkg/tlsutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // 支持Agent使用gzip压缩
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxCommandHistory 每个Agent保留的命令记录数
+const maxCommandHistory = 50
+
+// 命令状态
+const (
+	CommandPending   = "pending"
+	CommandSucceeded = "succeeded"
+	CommandFailed    = "failed"
+	CommandQueued    = "queued"    // Agent未通过流连接，等待随下一次心跳响应下发
+	CommandDelivered = "delivered" // 已随REST心跳响应下发，Agent不回传执行结果
+)
+
+// ErrAgentNotConnected Agent未通过gRPC流连接
+var ErrAgentNotConnected = errors.New("agent not connected via stream")
+
+// StreamCommand 下发给Agent的命令及其执行结果
+type StreamCommand struct {
+	ID          string            `json:"id"`
+	AgentID     string            `json:"agent_id"`
+	Type        string            `json:"type"`
+	Args        map[string]string `json:"args,omitempty"`
+	Status      string            `json:"status"`
+	Message     string            `json:"message,omitempty"`
+	IssuedAt    time.Time         `json:"issued_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+}
+
+// StreamSessionInfo 流连接信息
+type StreamSessionInfo struct {
+	AgentID     string    `json:"agent_id"`
+	Hostname    string    `json:"hostname"`
+	Peer        string    `json:"peer"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeq     uint64    `json:"last_seq"`
+}
+
+// streamSession 一条Agent流连接
+type streamSession struct {
+	stream      netmonv1.AgentStream_ConnectServer
+	sendMu      sync.Mutex
+	peer        string
+	connectedAt time.Time
+	lastSeq     atomic.Uint64
+
+	mu       sync.Mutex
+	agentID  string
+	hostname string
+
+	authAgentID string    // 启用认证时API Key所属的Agent，连接期间不变
+	authToken   *APIToken // 使用ingest令牌认证时的令牌，按其Agent模式校验消息
+	certNames   []string  // 已验证的客户端证书中的名称（CN和SAN）
+}
+
+// send 发送消息（gRPC流不允许并发Send）
+func (ss *streamSession) send(msg *netmonv1.ServerMessage) error {
+	ss.sendMu.Lock()
+	defer ss.sendMu.Unlock()
+	return ss.stream.Send(msg)
+}
+
+// identity 获取Agent ID和主机名
+func (ss *streamSession) identity() (string, string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.agentID, ss.hostname
+}
+
+// streamService gRPC双向流服务：接收上报和心跳并逐条确认，向Agent下发命令
+type streamService struct {
+	netmonv1.UnimplementedAgentStreamServer
+
+	server *Server
+	logger *logrus.Logger
+
+	mu       sync.RWMutex
+	sessions map[string]*streamSession   // agent_id -> 当前连接
+	commands map[string][]*StreamCommand // agent_id -> 最近的命令
+	byID     map[string]*StreamCommand   // command_id -> 命令
+	queued   map[string][]*StreamCommand // agent_id -> 等待随心跳下发的命令
+	nextID   atomic.Uint64
+}
+
+// newStreamService 创建流服务
+func newStreamService(s *Server) *streamService {
+	return &streamService{
+		server:   s,
+		logger:   s.logger,
+		sessions: make(map[string]*streamSession),
+		commands: make(map[string][]*StreamCommand),
+		byID:     make(map[string]*StreamCommand),
+		queued:   make(map[string][]*StreamCommand),
+	}
+}
+
+// Connect 处理一条Agent流连接
+func (svc *streamService) Connect(stream netmonv1.AgentStream_ConnectServer) error {
+	ctx := stream.Context()
+	session := &streamSession{
+		stream:      stream,
+		connectedAt: time.Now(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		session.peer = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-agent-id"); len(ids) > 0 {
+			session.agentID = ids[0]
+		}
+		if hosts := md.Get("x-hostname"); len(hosts) > 0 {
+			session.hostname = hosts[0]
+		}
+	}
+
+	if err := svc.authenticate(ctx, session); err != nil {
+		return err
+	}
+
+	if session.agentID != "" {
+		svc.register(session)
+	}
+	defer svc.unregister(session)
+
+	svc.logger.WithFields(logrus.Fields{
+		"agent_id": session.agentID,
+		"peer":     session.peer,
+	}).Info("Agent建立gRPC流连接")
+
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if code := status.Code(err); code == codes.Canceled || code == codes.Unavailable {
+				return nil
+			}
+			svc.logger.WithError(err).WithField("agent_id", session.agentID).Warn("接收gRPC流消息失败")
+			return err
+		}
+
+		session.lastSeq.Store(msg.GetSeq())
+		ack := svc.handleMessage(session, msg)
+		if err := session.send(&netmonv1.ServerMessage{
+			Payload: &netmonv1.ServerMessage_Ack{Ack: ack},
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+// handleMessage 处理一条Agent消息并生成确认
+func (svc *streamService) handleMessage(session *streamSession, msg *netmonv1.AgentMessage) *netmonv1.Ack {
+	ack := &netmonv1.Ack{
+		Seq:       msg.GetSeq(),
+		Success:   true,
+		Timestamp: timestamppb.Now(),
+	}
+
+	switch payload := msg.GetPayload().(type) {
+	case *netmonv1.AgentMessage_Report:
+		svc.server.metrics.RecordStreamMessage("report")
+		request := codec.ReportRequestFromProto(payload.Report)
+		if request.AgentID == "" {
+			request.AgentID, _ = session.identity()
+		}
+		if !svc.authorized(session, request.AgentID, ack) {
+			break
+		}
+		svc.bind(session, request.AgentID, request.Hostname)
+		svc.server.ingestReport(&request)
+		ack.Message = "Metrics received successfully"
+
+	case *netmonv1.AgentMessage_Heartbeat:
+		svc.server.metrics.RecordStreamMessage("heartbeat")
+		agentInfo := codec.HeartbeatFromProto(payload.Heartbeat)
+		if agentInfo.ID == "" {
+			agentInfo.ID, _ = session.identity()
+		}
+		if !svc.authorized(session, agentInfo.ID, ack) {
+			break
+		}
+		if agentInfo.IP == "" {
+			agentInfo.IP, _, _ = net.SplitHostPort(session.peer)
+		}
+		svc.bind(session, agentInfo.ID, agentInfo.Hostname)
+		svc.server.recordHeartbeat(&agentInfo)
+
+		// 在流连接建立前排队的命令随确认下发，Agent执行后回传CommandResult
+		for _, cmd := range svc.TakeDirectives(agentInfo.ID, CommandPending) {
+			ack.Directives = append(ack.Directives, cmd.proto())
+		}
+
+	case *netmonv1.AgentMessage_CommandResult:
+		svc.server.metrics.RecordStreamMessage("command_result")
+		svc.completeCommand(session, payload.CommandResult)
+
+	default:
+		ack.Success = false
+		ack.Message = "empty message"
+	}
+
+	return ack
+}
+
+// authenticate 校验连接身份：已验证的客户端证书限定可用的Agent ID；启用认证时还需API Key（有客户端证书时可省略）
+func (svc *streamService) authenticate(ctx context.Context, session *streamSession) error {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			session.certNames = tlsutil.PeerIdentities(&info.State)
+		}
+	}
+	if len(session.certNames) > 0 {
+		if session.agentID == "" {
+			session.agentID = session.certNames[0]
+		} else if !containsString(session.certNames, session.agentID) {
+			svc.server.metrics.RecordAuthFailure(authFailCertMismatch)
+			return status.Error(codes.PermissionDenied, "client certificate does not match agent id")
+		}
+	}
+
+	if !svc.server.config.Auth.Enabled {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	apiKey := auth.BearerToken(firstMetadata(md, "authorization"))
+	if apiKey == "" {
+		if len(session.certNames) > 0 {
+			return nil
+		}
+		svc.server.metrics.RecordAuthFailure(authFailMissingToken)
+		return status.Error(codes.Unauthenticated, "missing api key")
+	}
+
+	// ingest角色的API令牌按创建时限定的Agent模式校验，未限定时可以上报任意Agent
+	if auth.IsToken(apiKey) {
+		token := svc.server.auth.lookupToken(apiKey)
+		switch {
+		case token == nil:
+			svc.server.metrics.RecordAuthFailure(authFailInvalidToken)
+			return status.Error(codes.Unauthenticated, "invalid token")
+		case token.Expired(time.Now()):
+			svc.server.metrics.RecordAuthFailure(authFailTokenExpired)
+			return status.Error(codes.Unauthenticated, "token expired")
+		case !token.HasRole(RoleIngest):
+			svc.server.metrics.RecordAuthFailure(authFailForbidden)
+			return status.Error(codes.PermissionDenied, "token lacks role \"ingest\"")
+		}
+		if session.agentID != "" && !svc.server.auth.checkTokenAgent(token, session.agentID) {
+			svc.server.metrics.RecordAuthFailure(authFailMismatch)
+			return status.Error(codes.PermissionDenied, "token is not allowed to report for this agent")
+		}
+		if err := svc.checkStreamSignature(md, auth.SigningKey(apiKey), tokenNonceScope(token.ID)); err != nil {
+			return err
+		}
+		session.authToken = token
+		return nil
+	}
+
+	record := svc.server.auth.lookup(apiKey)
+	if record == nil {
+		svc.server.metrics.RecordAuthFailure(authFailInvalidToken)
+		svc.logger.WithField("peer", session.peer).Warn("gRPC流连接认证失败")
+		return status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	if len(session.certNames) > 0 && !containsString(session.certNames, record.AgentID) {
+		svc.server.metrics.RecordAuthFailure(authFailCertMismatch)
+		return status.Error(codes.PermissionDenied, "client certificate does not match api key")
+	}
+	if session.agentID != "" && session.agentID != record.AgentID {
+		svc.server.metrics.RecordAuthFailure(authFailMismatch)
+		return status.Error(codes.PermissionDenied, "api key does not belong to this agent")
+	}
+
+	if err := svc.checkStreamSignature(md, record.SigningKey, record.AgentID); err != nil {
+		return err
+	}
+
+	session.authAgentID = record.AgentID
+	session.agentID = record.AgentID
+	return nil
+}
+
+// checkStreamSignature 校验建立连接时的签名，API Key和ingest令牌的要求相同
+// 流内消息不逐条签名，未配置require_signature时只校验带签名的连接
+func (svc *streamService) checkStreamSignature(md metadata.MD, signingKey, nonceScope string) error {
+	signature := firstMetadata(md, strings.ToLower(auth.HeaderSignature))
+	if !svc.server.config.Auth.RequireSignature && signature == "" {
+		return nil
+	}
+
+	timestamp := firstMetadata(md, strings.ToLower(auth.HeaderTimestamp))
+	nonce := firstMetadata(md, strings.ToLower(auth.HeaderNonce))
+	if timestamp == "" || nonce == "" || signature == "" {
+		svc.server.metrics.RecordAuthFailure(authFailBadSignature)
+		return status.Error(codes.Unauthenticated, "missing stream signature")
+	}
+	if reason, message := svc.server.auth.checkSignature(signingKey, nonceScope, auth.StreamSignMethod, netmonv1.AgentStream_Connect_FullMethodName, timestamp, nonce, nil, signature); reason != "" {
+		svc.server.metrics.RecordAuthFailure(reason)
+		return status.Error(codes.Unauthenticated, message)
+	}
+	return nil
+}
+
+// firstMetadata 返回元数据中指定键的第一个值
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// authorized 校验消息中的Agent ID与连接的客户端证书、API Key或ingest令牌一致，不一致时在确认中返回失败
+func (svc *streamService) authorized(session *streamSession, agentID string, ack *netmonv1.Ack) bool {
+	reason := ""
+	switch {
+	case len(session.certNames) > 0 && !containsString(session.certNames, agentID):
+		reason = authFailCertMismatch
+		ack.Message = "client certificate does not match agent id"
+	case session.authAgentID != "" && agentID != session.authAgentID:
+		reason = authFailMismatch
+		ack.Message = "api key does not belong to this agent"
+	case session.authToken != nil && !svc.server.auth.checkTokenAgent(session.authToken, agentID):
+		reason = authFailMismatch
+		ack.Message = "token is not allowed to report for this agent"
+	default:
+		return true
+	}
+
+	svc.server.metrics.RecordAuthFailure(reason)
+	fields := logrus.Fields{
+		"agent_id":      agentID,
+		"auth_agent_id": session.authAgentID,
+		"reason":        reason,
+	}
+	if session.authToken != nil {
+		fields["token_id"] = session.authToken.ID
+	}
+	svc.logger.WithFields(fields).Warn("gRPC消息的Agent ID与连接身份不匹配")
+	ack.Success = false
+	return false
+}
+
+// bind 首次收到带Agent ID的消息时登记连接
+func (svc *streamService) bind(session *streamSession, agentID, hostname string) {
+	if agentID == "" {
+		return
+	}
+
+	session.mu.Lock()
+	oldID := session.agentID
+	session.agentID = agentID
+	if hostname != "" {
+		session.hostname = hostname
+	}
+	session.mu.Unlock()
+
+	if oldID != agentID {
+		if oldID != "" {
+			svc.mu.Lock()
+			if svc.sessions[oldID] == session {
+				delete(svc.sessions, oldID)
+			}
+			svc.mu.Unlock()
+		}
+		svc.register(session)
+	}
+}
+
+// register 登记连接，同一Agent的新连接替换旧连接
+func (svc *streamService) register(session *streamSession) {
+	agentID, _ := session.identity()
+
+	svc.mu.Lock()
+	svc.sessions[agentID] = session
+	count := len(svc.sessions)
+	svc.mu.Unlock()
+
+	svc.server.metrics.SetStreamConnections(count)
+}
+
+// unregister 注销连接（已被新连接替换时不处理）
+func (svc *streamService) unregister(session *streamSession) {
+	agentID, _ := session.identity()
+
+	svc.mu.Lock()
+	if svc.sessions[agentID] == session {
+		delete(svc.sessions, agentID)
+	}
+	count := len(svc.sessions)
+	svc.mu.Unlock()
+
+	svc.server.metrics.SetStreamConnections(count)
+	svc.logger.WithFields(logrus.Fields{
+		"agent_id": agentID,
+		"peer":     session.peer,
+	}).Info("Agent gRPC流连接断开")
+}
+
+// SendCommand 向Agent下发命令，Agent未通过流连接时返回ErrAgentNotConnected
+func (svc *streamService) SendCommand(agentID, cmdType string, args map[string]string) (*StreamCommand, error) {
+	svc.mu.RLock()
+	session := svc.sessions[agentID]
+	svc.mu.RUnlock()
+	if session == nil {
+		return nil, ErrAgentNotConnected
+	}
+
+	// 先登记再发送，避免Agent的执行结果先于登记到达
+	svc.mu.Lock()
+	cmd := svc.newCommand(agentID, cmdType, args, CommandPending)
+	svc.mu.Unlock()
+
+	err := session.send(&netmonv1.ServerMessage{
+		Payload: &netmonv1.ServerMessage_Command{Command: cmd.proto()},
+	})
+	if err != nil {
+		svc.completeCommand(session, &netmonv1.CommandResult{
+			CommandId: cmd.ID,
+			Message:   err.Error(),
+		})
+		return nil, fmt.Errorf("下发命令失败: %w", err)
+	}
+
+	svc.logger.WithFields(logrus.Fields{
+		"agent_id":   agentID,
+		"command_id": cmd.ID,
+		"type":       cmdType,
+	}).Info("已下发命令")
+
+	svc.mu.RLock()
+	copied := *cmd
+	svc.mu.RUnlock()
+	return &copied, nil
+}
+
+// QueueDirective 登记命令，随Agent的下一次心跳响应下发（用于未通过流连接的Agent）
+func (svc *streamService) QueueDirective(agentID, cmdType string, args map[string]string) *StreamCommand {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	cmd := svc.newCommand(agentID, cmdType, args, CommandQueued)
+	svc.queued[agentID] = append(svc.queued[agentID], cmd)
+
+	svc.logger.WithFields(logrus.Fields{
+		"agent_id":   agentID,
+		"command_id": cmd.ID,
+		"type":       cmdType,
+	}).Info("命令已排队，等待随心跳下发")
+
+	copied := *cmd
+	return &copied
+}
+
+// TakeDirectives 取出等待随心跳下发的命令并更新状态
+// gRPC流的Agent会回传执行结果，状态为pending；REST心跳没有回传，状态为delivered
+func (svc *streamService) TakeDirectives(agentID, status string) []StreamCommand {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	queued := svc.queued[agentID]
+	if len(queued) == 0 {
+		return nil
+	}
+	delete(svc.queued, agentID)
+
+	result := make([]StreamCommand, 0, len(queued))
+	for _, cmd := range queued {
+		cmd.Status = status
+		result = append(result, *cmd)
+	}
+	return result
+}
+
+// newCommand 创建命令并登记到历史记录，调用方需持有svc.mu
+func (svc *streamService) newCommand(agentID, cmdType string, args map[string]string, status string) *StreamCommand {
+	cmd := &StreamCommand{
+		ID:       fmt.Sprintf("cmd-%d-%d", time.Now().Unix(), svc.nextID.Add(1)),
+		AgentID:  agentID,
+		Type:     cmdType,
+		Args:     args,
+		Status:   status,
+		IssuedAt: time.Now(),
+	}
+
+	history := append(svc.commands[agentID], cmd)
+	if len(history) > maxCommandHistory {
+		for _, old := range history[:len(history)-maxCommandHistory] {
+			delete(svc.byID, old.ID)
+		}
+		history = history[len(history)-maxCommandHistory:]
+	}
+	svc.commands[agentID] = history
+	svc.byID[cmd.ID] = cmd
+	return cmd
+}
+
+// proto 转换为protobuf命令
+func (cmd *StreamCommand) proto() *netmonv1.Command {
+	return &netmonv1.Command{
+		Id:       cmd.ID,
+		Type:     cmd.Type,
+		Args:     cmd.Args,
+		IssuedAt: timestamppb.New(cmd.IssuedAt),
+	}
+}
+
+// directive 转换为心跳响应中的指令
+func (cmd *StreamCommand) directive() common.Directive {
+	return common.Directive{ID: cmd.ID, Type: cmd.Type, Args: cmd.Args}
+}
+
+// completeCommand 记录命令执行结果，只接受下发给该连接所属Agent的命令的结果
+func (svc *streamService) completeCommand(session *streamSession, result *netmonv1.CommandResult) {
+	agentID, _ := session.identity()
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	cmd, ok := svc.byID[result.GetCommandId()]
+	if !ok {
+		return
+	}
+	if cmd.AgentID != agentID {
+		svc.logger.WithFields(logrus.Fields{
+			"agent_id":      agentID,
+			"command_id":    cmd.ID,
+			"command_agent": cmd.AgentID,
+			"peer":          session.peer,
+		}).Warn("忽略其他Agent的命令执行结果")
+		return
+	}
+
+	cmd.Status = CommandSucceeded
+	if !result.GetSuccess() {
+		cmd.Status = CommandFailed
+	}
+	cmd.Message = result.GetMessage()
+	now := time.Now()
+	cmd.CompletedAt = &now
+}
+
+// Commands 获取Agent最近的命令（从新到旧）
+func (svc *streamService) Commands(agentID string) []StreamCommand {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+
+	history := svc.commands[agentID]
+	result := make([]StreamCommand, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		result = append(result, *history[i])
+	}
+	return result
+}
+
+// Sessions 获取当前的流连接
+func (svc *streamService) Sessions() []StreamSessionInfo {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+
+	result := make([]StreamSessionInfo, 0, len(svc.sessions))
+	for _, session := range svc.sessions {
+		agentID, hostname := session.identity()
+		result = append(result, StreamSessionInfo{
+			AgentID:     agentID,
+			Hostname:    hostname,
+			Peer:        session.peer,
+			ConnectedAt: session.connectedAt,
+			LastSeq:     session.lastSeq.Load(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AgentID < result[j].AgentID
+	})
+	return result
+}
+
+// startGRPC 启动gRPC流服务
+func (s *Server) startGRPC() error {
+	addr := fmt.Sprintf("%s:%d", s.config.GRPC.Host, s.config.GRPC.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("gRPC监听失败: %w", err)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(maxReportBodyBytes),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    time.Minute,
+			Timeout: 20 * time.Second,
+		}),
+	}
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+
+	s.grpcServer = grpc.NewServer(opts...)
+	netmonv1.RegisterAgentStreamServer(s.grpcServer, s.stream)
+
+	go func() {
+		s.logger.WithField("addr", addr).Info("gRPC服务器启动")
+		if err := s.grpcServer.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+			s.logger.WithError(err).Error("gRPC服务器异常退出")
+		}
+	}()
+
+	return nil
+}
+
+// stopGRPC 关闭gRPC服务，超时后强制断开流连接
+func (s *Server) stopGRPC(timeout time.Duration) {
+	if s.grpcServer == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.grpcServer.Stop()
+	}
+}
+
+// commandRequest 下发命令的请求体
+type commandRequest struct {
+	Type string            `json:"type" binding:"required"`
+	Args map[string]string `json:"args"`
+}
+
+// handleSendCommand 向Agent下发命令：通过gRPC流连接的Agent立即下发，其余Agent随下一次心跳响应下发
+func (s *Server) handleSendCommand(c *gin.Context) {
+	var req commandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	agentID := c.Param("id")
+	cmd, err := s.stream.SendCommand(agentID, req.Type, req.Args)
+	if errors.Is(err, ErrAgentNotConnected) {
+		// 使用REST上报的Agent在下一次心跳时收到命令
+		s.agentsMu.RLock()
+		_, known := s.agents[agentID]
+		s.agentsMu.RUnlock()
+		if !known {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "agent not found",
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, s.stream.QueueDirective(agentID, req.Type, req.Args))
+		return
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("下发命令失败")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, cmd)
+}
+
+// handleGetCommands 获取Agent最近的命令及执行结果
+func (s *Server) handleGetCommands(c *gin.Context) {
+	commands := s.stream.Commands(c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{
+		"commands": commands,
+		"count":    len(commands),
+	})
+}
+
+// handleGetStreams 获取当前的gRPC流连接
+func (s *Server) handleGetStreams(c *gin.Context) {
+	sessions := s.stream.Sessions()
+	c.JSON(http.StatusOK, gin.H{
+		"streams": sessions,
+		"count":   len(sessions),
+	})
+}
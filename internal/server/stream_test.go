@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/api/netmonv1"
+	"go-net-monitoring/pkg/auth"
+	"go-net-monitoring/pkg/metrics"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+var (
+	testMetricsOnce sync.Once
+	testMetrics     *metrics.Metrics
+)
+
+// newTestMetrics 指标注册到全局Registry，整个测试进程只创建一次
+func newTestMetrics() *metrics.Metrics {
+	testMetricsOnce.Do(func() {
+		testMetrics = metrics.NewMetrics()
+	})
+	return testMetrics
+}
+
+// newTestAuthServer 创建启用认证、使用内存存储的Server
+func newTestAuthServer(t *testing.T, authCfg config.AuthConfig) *Server {
+	t.Helper()
+	storage, err := NewMemoryStorage(&config.StorageConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	logger := newTestLogger()
+	m := newTestMetrics()
+	authCfg.Enabled = true
+	if authCfg.SignatureWindow == 0 {
+		authCfg.SignatureWindow = 5 * time.Minute
+	}
+	authService, err := newAuthService(authCfg, storage, logger, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		config:  &config.ServerAppConfig{Auth: authCfg},
+		logger:  logger,
+		metrics: m,
+		storage: storage,
+		auth:    authService,
+	}
+}
+
+func TestCompleteCommandIgnoresOtherAgents(t *testing.T) {
+	svc := &streamService{
+		logger:   newTestLogger(),
+		commands: make(map[string][]*StreamCommand),
+		byID:     make(map[string]*StreamCommand),
+	}
+	cmd := svc.newCommand("agent-a", "reload", nil, CommandPending)
+
+	other := &streamSession{agentID: "agent-b"}
+	svc.completeCommand(other, &netmonv1.CommandResult{CommandId: cmd.ID, Success: true})
+	if cmd.Status != CommandPending || cmd.CompletedAt != nil {
+		t.Fatalf("command completed by another agent: %+v", cmd)
+	}
+
+	owner := &streamSession{agentID: "agent-a"}
+	svc.completeCommand(owner, &netmonv1.CommandResult{CommandId: cmd.ID, Message: "boom"})
+	if cmd.Status != CommandFailed || cmd.Message != "boom" || cmd.CompletedAt == nil {
+		t.Fatalf("command not completed by its agent: %+v", cmd)
+	}
+}
+
+func TestAuthenticateStreamSignature(t *testing.T) {
+	s := newTestAuthServer(t, config.AuthConfig{RequireSignature: true})
+	svc := &streamService{server: s, logger: s.logger}
+	apiKey, _, err := s.auth.issue("agent-a", "host-a", keySourceAdmin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect := func(signingKey, nonce string) error {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		pairs := []string{"authorization", "Bearer " + apiKey, "x-agent-id", "agent-a"}
+		if signingKey != "" {
+			signature := auth.Sign(signingKey, auth.StreamSignMethod, netmonv1.AgentStream_Connect_FullMethodName, timestamp, nonce, nil)
+			pairs = append(pairs,
+				strings.ToLower(auth.HeaderTimestamp), timestamp,
+				strings.ToLower(auth.HeaderNonce), nonce,
+				strings.ToLower(auth.HeaderSignature), signature)
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+		return svc.authenticate(ctx, &streamSession{})
+	}
+
+	tests := []struct {
+		name       string
+		signingKey string
+		nonce      string
+		code       codes.Code
+	}{
+		{"bare api key", "", "", codes.Unauthenticated},
+		{"key hash as signing key", auth.HashKey(apiKey), "n1", codes.Unauthenticated},
+		{"signed", auth.SigningKey(apiKey), "n2", codes.OK},
+		{"replayed nonce", auth.SigningKey(apiKey), "n2", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := status.Code(connect(tt.signingKey, tt.nonce)); code != tt.code {
+				t.Fatalf("got %v, want %v", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestAuthenticateStreamTokenSignature(t *testing.T) {
+	s := newTestAuthServer(t, config.AuthConfig{RequireSignature: true})
+	svc := &streamService{server: s, logger: s.logger}
+	secret, _, err := CreateAPIToken(s.storage, "fleet", []string{RoleIngest}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.auth.reloadNow()
+
+	connect := func(signed bool, nonce string) error {
+		pairs := []string{"authorization", "Bearer " + secret, "x-agent-id", "agent-a"}
+		if signed {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			signature := auth.Sign(auth.SigningKey(secret), auth.StreamSignMethod, netmonv1.AgentStream_Connect_FullMethodName, timestamp, nonce, nil)
+			pairs = append(pairs,
+				strings.ToLower(auth.HeaderTimestamp), timestamp,
+				strings.ToLower(auth.HeaderNonce), nonce,
+				strings.ToLower(auth.HeaderSignature), signature)
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+		return svc.authenticate(ctx, &streamSession{agentID: "agent-a"})
+	}
+
+	if code := status.Code(connect(false, "")); code != codes.Unauthenticated {
+		t.Fatalf("unsigned token stream: got %v, want Unauthenticated", code)
+	}
+	if err := connect(true, "n1"); err != nil {
+		t.Fatalf("signed token stream rejected: %v", err)
+	}
+	if code := status.Code(connect(true, "n1")); code != codes.Unauthenticated {
+		t.Fatalf("replayed token stream nonce: got %v, want Unauthenticated", code)
+	}
+}
+
+func TestAuthenticateStreamTokenAgents(t *testing.T) {
+	s := newTestAuthServer(t, config.AuthConfig{})
+	svc := &streamService{server: s, logger: s.logger}
+	secret, _, err := CreateAPIToken(s.storage, "web", []string{RoleIngest}, []string{"web-*"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.auth.reloadNow()
+
+	connect := func(agentID string) (*streamSession, error) {
+		md := metadata.Pairs("authorization", "Bearer "+secret, "x-agent-id", agentID)
+		session := &streamSession{agentID: agentID}
+		return session, svc.authenticate(metadata.NewIncomingContext(context.Background(), md), session)
+	}
+
+	if _, err := connect("db-1"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("token reported for agent outside its pattern: %v", err)
+	}
+	session, err := connect("web-1")
+	if err != nil {
+		t.Fatalf("token rejected for matching agent: %v", err)
+	}
+
+	ack := &netmonv1.Ack{Success: true}
+	if !svc.authorized(session, "web-2", ack) {
+		t.Fatalf("message for matching agent rejected: %s", ack.Message)
+	}
+	if svc.authorized(session, "db-1", ack) || ack.Success {
+		t.Fatal("message for agent outside the token pattern accepted")
+	}
+}
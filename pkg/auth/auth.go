@@ -0,0 +1,125 @@
+// Package auth 提供Agent与Server共用的API Key和请求签名算法
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 签名相关请求头
+const (
+	HeaderTimestamp = "X-Netmon-Timestamp"  // Unix秒
+	HeaderNonce     = "X-Netmon-Nonce"      // 随机串，签名有效期内不可重复
+	HeaderSignature = "X-Netmon-Signature"  // 十六进制HMAC-SHA256
+	HeaderAuthError = "X-Netmon-Auth-Error" // Server返回的认证失败原因
+)
+
+// StreamSignMethod gRPC流建立连接时签名使用的方法名，路径为流的完整方法名，请求体为空
+const StreamSignMethod = "GRPC"
+
+// ReasonInvalidToken API Key不存在或已吊销（Agent据此丢弃注册得到的Key）
+const ReasonInvalidToken = "invalid_token"
+
+// 凭据前缀，便于在日志和配置中识别
+const (
+	keyPrefix   = "nmk_" // Agent API Key
+	tokenPrefix = "nmt_" // 带角色的API令牌
+)
+
+// GenerateKey 生成新的Agent API Key
+func GenerateKey() (string, error) {
+	return generate(keyPrefix)
+}
+
+// GenerateToken 生成新的API令牌
+func GenerateToken() (string, error) {
+	return generate(tokenPrefix)
+}
+
+// IsToken 判断凭据是否为API令牌（而非Agent API Key）
+func IsToken(credential string) bool {
+	return strings.HasPrefix(credential, tokenPrefix)
+}
+
+// generate 生成带前缀的32字节随机凭据
+func generate(prefix string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成凭据失败: %w", err)
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
+
+// GenerateNonce 生成请求nonce
+func GenerateNonce() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// 随机源不可用时退化为时间戳，仍能满足单Agent内唯一
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// HashKey 计算API Key的SHA-256，Server用于按Key查找记录，不参与签名
+func HashKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// SigningKey 由API Key派生签名密钥：hex(HMAC-SHA256(api_key, "sign"))
+// 与HashKey相互独立，无法从查找用的哈希推导
+func SigningKey(apiKey string) string {
+	mac := hmac.New(sha256.New, []byte(apiKey))
+	mac.Write([]byte("sign"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// KeyID 返回API Key或令牌的可公开前缀，用于日志和管理接口
+func KeyID(apiKey string) string {
+	if len(apiKey) <= len(keyPrefix)+8 {
+		return apiKey
+	}
+	return apiKey[:len(keyPrefix)+8]
+}
+
+// Sign 计算请求签名，signingKey为SigningKey的结果
+// 签名内容：METHOD\nPATH\nTIMESTAMP\nNONCE\nhex(SHA-256(body))
+func Sign(signingKey, method, path, timestamp, nonce string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodySum[:]),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature 校验签名（常量时间比较）
+func VerifySignature(signingKey, method, path, timestamp, nonce string, body []byte, signature string) bool {
+	expected := Sign(signingKey, method, path, timestamp, nonce, body)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// TokenEqual 常量时间比较令牌
+func TokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// BearerToken 解析Authorization头中的Bearer令牌
+func BearerToken(header string) string {
+	const prefix = "bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
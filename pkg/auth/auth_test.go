@@ -0,0 +1,29 @@
+package auth
+
+import "testing"
+
+func TestSigningKeyIndependentOfHash(t *testing.T) {
+	apiKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey := SigningKey(apiKey)
+	if signingKey == HashKey(apiKey) || signingKey == HashKey(HashKey(apiKey)) {
+		t.Fatal("signing key must not be derivable from the lookup hash")
+	}
+	if signingKey != SigningKey(apiKey) {
+		t.Fatal("signing key is not deterministic")
+	}
+
+	body := []byte(`{"agent_id":"a"}`)
+	signature := Sign(signingKey, "post", "/api/v1/metrics", "1704110400", "n1", body)
+	if !VerifySignature(signingKey, "POST", "/api/v1/metrics", "1704110400", "n1", body, signature) {
+		t.Fatal("valid signature rejected")
+	}
+	if VerifySignature(HashKey(apiKey), "POST", "/api/v1/metrics", "1704110400", "n1", body, signature) {
+		t.Fatal("signature verified with the lookup hash")
+	}
+	if VerifySignature(signingKey, "POST", "/api/v1/metrics", "1704110400", "n1", []byte("{}"), signature) {
+		t.Fatal("signature verified for a different body")
+	}
+}
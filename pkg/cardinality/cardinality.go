@@ -0,0 +1,103 @@
+package cardinality
+
+import (
+	"sort"
+	"sync"
+
+	"go-net-monitoring/internal/config"
+)
+
+// Other 超出上限的标签值汇总后使用的标签值
+const Other = "other"
+
+// Limiter 限制一个指标的标签值数量
+// 标签值按出现时的流量从大到小依次占用名额，占用后一直保留，名额用完后新出现的标签值汇总到Other。
+// 已保留的集合不再变化，累计计数汇总后的Other序列保持单调递增，不会因为排名变化出现计数回退
+type Limiter struct {
+	limit int
+
+	mu       sync.Mutex
+	admitted map[string]struct{}
+}
+
+// NewLimiter 创建标签值上限为limit的限制器，limit<=0时返回nil（不限制）
+func NewLimiter(limit int) *Limiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &Limiter{
+		limit:    limit,
+		admitted: make(map[string]struct{}),
+	}
+}
+
+// Collapse 返回需要汇总到Other的标签值，weights为本次数据中各标签值的流量
+// 返回nil表示全部保留；Other本身不占用名额
+func (l *Limiter) Collapse(weights map[string]float64) map[string]bool {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var candidates []string
+	for value := range weights {
+		if value == Other {
+			continue
+		}
+		if _, ok := l.admitted[value]; !ok {
+			candidates = append(candidates, value)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		wi, wj := weights[candidates[i]], weights[candidates[j]]
+		if wi != wj {
+			return wi > wj
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	var collapsed map[string]bool
+	for _, value := range candidates {
+		if len(l.admitted) < l.limit {
+			l.admitted[value] = struct{}{}
+			continue
+		}
+		if collapsed == nil {
+			collapsed = make(map[string]bool)
+		}
+		collapsed[value] = true
+	}
+	return collapsed
+}
+
+// Set 按指标名称管理限制器
+type Set struct {
+	limiters map[string]*Limiter
+}
+
+// NewSet 按配置为每个受限指标创建限制器，未启用时返回nil（不限制）
+func NewSet(cfg config.CardinalityConfig, metrics ...string) *Set {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	s := &Set{limiters: make(map[string]*Limiter, len(metrics))}
+	for _, metric := range metrics {
+		s.limiters[metric] = NewLimiter(cfg.Limit(metric))
+	}
+	return s
+}
+
+// For 获取指标的限制器，未限制的指标返回nil
+func (s *Set) For(metric string) *Limiter {
+	if s == nil {
+		return nil
+	}
+	return s.limiters[metric]
+}
@@ -0,0 +1,231 @@
+// Package codec 上报数据的编码（JSON/Protobuf）与压缩（gzip/zstd）
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/api/netmonv1"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// 内容类型
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// 内容编码（压缩算法）
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+)
+
+// 序列化格式（配置项取值）
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+)
+
+// ErrUnsupportedContentType 不支持的内容类型
+var ErrUnsupportedContentType = errors.New("不支持的Content-Type")
+
+// ErrUnsupportedEncoding 不支持的压缩算法
+var ErrUnsupportedEncoding = errors.New("不支持的Content-Encoding")
+
+// ErrPayloadTooLarge 解压后的数据超出上限
+var ErrPayloadTooLarge = errors.New("解压后的数据超出上限")
+
+// ContentTypeForFormat 获取序列化格式对应的Content-Type
+func ContentTypeForFormat(format string) string {
+	if strings.EqualFold(format, FormatProtobuf) {
+		return ContentTypeProtobuf
+	}
+	return ContentTypeJSON
+}
+
+// NormalizeContentType 规范化Content-Type，空值视为JSON，不支持的类型返回错误
+func NormalizeContentType(contentType string) (string, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return ContentTypeJSON, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+
+	switch mediaType {
+	case ContentTypeJSON, "text/json":
+		return ContentTypeJSON, nil
+	case ContentTypeProtobuf, "application/protobuf", "application/vnd.google.protobuf":
+		return ContentTypeProtobuf, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedContentType, mediaType)
+	}
+}
+
+// NormalizeEncoding 规范化Content-Encoding，空值视为identity，不支持的算法返回错误
+func NormalizeEncoding(encoding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", EncodingIdentity, "none":
+		return EncodingIdentity, nil
+	case EncodingGzip, "x-gzip":
+		return EncodingGzip, nil
+	case EncodingZstd:
+		return EncodingZstd, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Compress 按指定算法压缩数据
+func Compress(data []byte, encoding string) ([]byte, error) {
+	encoding, err := NormalizeEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	switch encoding {
+	case EncodingGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip压缩失败: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("gzip压缩失败: %w", err)
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	default:
+		return data, nil
+	}
+}
+
+// Decompress 按指定算法解压数据，maxSize>0时限制解压后的大小
+func Decompress(data []byte, encoding string, maxSize int64) ([]byte, error) {
+	encoding, err := NormalizeEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip解压失败: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd解压失败: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		if maxSize > 0 && int64(len(data)) > maxSize {
+			return nil, ErrPayloadTooLarge
+		}
+		return data, nil
+	}
+
+	if maxSize > 0 {
+		reader = io.LimitReader(reader, maxSize+1)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s解压失败: %w", encoding, err)
+	}
+	if maxSize > 0 && int64(len(decoded)) > maxSize {
+		return nil, ErrPayloadTooLarge
+	}
+
+	return decoded, nil
+}
+
+// MarshalReportRequest 按Content-Type序列化上报请求
+func MarshalReportRequest(req *common.ReportRequest, contentType string) ([]byte, error) {
+	contentType, err := NormalizeContentType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType == ContentTypeProtobuf {
+		return proto.Marshal(ReportRequestToProto(req))
+	}
+	return json.Marshal(req)
+}
+
+// UnmarshalReportRequest 按Content-Type反序列化上报请求
+func UnmarshalReportRequest(data []byte, contentType string) (common.ReportRequest, error) {
+	var req common.ReportRequest
+
+	contentType, err := NormalizeContentType(contentType)
+	if err != nil {
+		return req, err
+	}
+
+	if contentType == ContentTypeProtobuf {
+		var pb netmonv1.ReportRequest
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return req, err
+		}
+		return ReportRequestFromProto(&pb), nil
+	}
+
+	err = json.Unmarshal(data, &req)
+	return req, err
+}
+
+// MarshalReportResponse 按Content-Type序列化上报响应
+func MarshalReportResponse(resp *common.ReportResponse, contentType string) ([]byte, error) {
+	contentType, err := NormalizeContentType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType == ContentTypeProtobuf {
+		return proto.Marshal(ReportResponseToProto(resp))
+	}
+	return json.Marshal(resp)
+}
+
+// UnmarshalReportResponse 按Content-Type反序列化上报响应
+func UnmarshalReportResponse(data []byte, contentType string) (common.ReportResponse, error) {
+	var resp common.ReportResponse
+
+	contentType, err := NormalizeContentType(contentType)
+	if err != nil {
+		return resp, err
+	}
+
+	if contentType == ContentTypeProtobuf {
+		var pb netmonv1.ReportResponse
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return resp, err
+		}
+		return ReportResponseFromProto(&pb), nil
+	}
+
+	err = json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// zstdEncoder 共享的zstd编码器（EncodeAll并发安全）
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
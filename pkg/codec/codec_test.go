@@ -0,0 +1,127 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+)
+
+func testRequest() common.ReportRequest {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+	return common.ReportRequest{
+		AgentID:   "agent-a",
+		Hostname:  "host-a",
+		Timestamp: ts,
+		Metrics: common.NetworkMetrics{
+			TotalConnections: 42,
+			TotalBytesSent:   1000,
+			DomainsAccessed:  map[string]uint64{"example.com": 7},
+			DomainTraffic:    map[string]*common.DomainTrafficStats{"example.com": {Domain: "example.com", BytesSent: 600, Connections: 7}},
+			PortStats:        map[int]uint64{443: 7},
+			ProtocolStats:    map[string]uint64{"tcp": 42},
+		},
+		Report: &common.MetricsReport{
+			AgentID:     "agent-a",
+			StartupTime: ts.Add(-time.Hour),
+			ReportTime:  ts,
+			ReportMode:  common.ReportModeIncremental,
+			DeltaStats:  map[string]common.DomainMetrics{"example.com": {Domain: "example.com", ConnectionCount: 3, PortStats: map[int]int64{443: 3}}},
+		},
+	}
+}
+
+func TestReportRequestRoundTrip(t *testing.T) {
+	want := testRequest()
+
+	for _, format := range []string{FormatJSON, FormatProtobuf} {
+		for _, encoding := range []string{EncodingIdentity, EncodingGzip, EncodingZstd} {
+			t.Run(format+"/"+encoding, func(t *testing.T) {
+				contentType := ContentTypeForFormat(format)
+				data, err := MarshalReportRequest(&want, contentType)
+				if err != nil {
+					t.Fatalf("marshal: %v", err)
+				}
+				compressed, err := Compress(data, encoding)
+				if err != nil {
+					t.Fatalf("compress: %v", err)
+				}
+				decoded, err := Decompress(compressed, encoding, 1<<20)
+				if err != nil {
+					t.Fatalf("decompress: %v", err)
+				}
+				if !bytes.Equal(decoded, data) {
+					t.Fatal("decompressed data differs from the original")
+				}
+
+				got, err := UnmarshalReportRequest(decoded, contentType)
+				if err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if got.AgentID != want.AgentID || got.Hostname != want.Hostname || !got.Timestamp.Equal(want.Timestamp) {
+					t.Fatalf("identity = %s/%s/%v", got.AgentID, got.Hostname, got.Timestamp)
+				}
+				m := got.Metrics
+				if m.TotalConnections != 42 || m.TotalBytesSent != 1000 || m.DomainsAccessed["example.com"] != 7 ||
+					m.DomainTraffic["example.com"] == nil || m.DomainTraffic["example.com"].BytesSent != 600 ||
+					m.PortStats[443] != 7 || m.ProtocolStats["tcp"] != 42 {
+					t.Fatalf("metrics = %+v", m)
+				}
+				r := got.Report
+				if r == nil || !r.StartupTime.Equal(want.Report.StartupTime) || r.ReportMode != common.ReportModeIncremental ||
+					r.DeltaStats["example.com"].ConnectionCount != 3 || r.DeltaStats["example.com"].PortStats[443] != 3 {
+					t.Fatalf("report = %+v", r)
+				}
+			})
+		}
+	}
+}
+
+func TestDecompressRejectsOversizedPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 4096)
+
+	for _, encoding := range []string{EncodingIdentity, EncodingGzip, EncodingZstd} {
+		compressed, err := Compress(payload, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Decompress(compressed, encoding, 1024); !errors.Is(err, ErrPayloadTooLarge) {
+			t.Errorf("%s: err = %v, want ErrPayloadTooLarge", encoding, err)
+		}
+		if decoded, err := Decompress(compressed, encoding, int64(len(payload))); err != nil || len(decoded) != len(payload) {
+			t.Errorf("%s at exact limit: %d bytes, %v", encoding, len(decoded), err)
+		}
+	}
+}
+
+func TestUnknownEncodingAndContentType(t *testing.T) {
+	if _, err := Decompress([]byte("x"), "br", 0); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Decompress(br) err = %v, want ErrUnsupportedEncoding", err)
+	}
+	if _, err := Compress([]byte("x"), "deflate"); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Compress(deflate) err = %v, want ErrUnsupportedEncoding", err)
+	}
+	if _, err := UnmarshalReportRequest([]byte("{}"), "text/plain"); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Errorf("UnmarshalReportRequest(text/plain) err = %v, want ErrUnsupportedContentType", err)
+	}
+	if _, err := Decompress([]byte("not gzip"), EncodingGzip, 0); err == nil {
+		t.Error("Decompress of corrupt gzip succeeded")
+	}
+
+	for input, want := range map[string]string{
+		"":                                ContentTypeJSON,
+		"application/json; charset=utf-8": ContentTypeJSON,
+		"application/protobuf":            ContentTypeProtobuf,
+	} {
+		if got, err := NormalizeContentType(input); err != nil || got != want {
+			t.Errorf("NormalizeContentType(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for input, want := range map[string]string{"": EncodingIdentity, "none": EncodingIdentity, "X-GZIP": EncodingGzip, "zstd": EncodingZstd} {
+		if got, err := NormalizeEncoding(input); err != nil || got != want {
+			t.Errorf("NormalizeEncoding(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+}
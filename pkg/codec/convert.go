@@ -0,0 +1,426 @@
+package codec
+
+import (
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/api/netmonv1"
+	"go-net-monitoring/pkg/network"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ReportRequestToProto 转换为protobuf上报请求
+func ReportRequestToProto(req *common.ReportRequest) *netmonv1.ReportRequest {
+	return &netmonv1.ReportRequest{
+		AgentId:   req.AgentID,
+		Hostname:  req.Hostname,
+		Timestamp: timestampToProto(req.Timestamp),
+		Metrics:   NetworkMetricsToProto(&req.Metrics),
+		Report:    MetricsReportToProto(req.Report),
+	}
+}
+
+// ReportRequestFromProto 从protobuf上报请求转换
+func ReportRequestFromProto(pb *netmonv1.ReportRequest) common.ReportRequest {
+	req := common.ReportRequest{
+		AgentID:   pb.GetAgentId(),
+		Hostname:  pb.GetHostname(),
+		Timestamp: timestampFromProto(pb.GetTimestamp()),
+		Report:    MetricsReportFromProto(pb.GetReport()),
+	}
+	if pb.GetMetrics() != nil {
+		req.Metrics = NetworkMetricsFromProto(pb.GetMetrics())
+	}
+	return req
+}
+
+// ReportResponseToProto 转换为protobuf上报响应
+func ReportResponseToProto(resp *common.ReportResponse) *netmonv1.ReportResponse {
+	return &netmonv1.ReportResponse{
+		Success:   resp.Success,
+		Message:   resp.Message,
+		Timestamp: timestampToProto(resp.Timestamp),
+	}
+}
+
+// ReportResponseFromProto 从protobuf上报响应转换
+func ReportResponseFromProto(pb *netmonv1.ReportResponse) common.ReportResponse {
+	return common.ReportResponse{
+		Success:   pb.GetSuccess(),
+		Message:   pb.GetMessage(),
+		Timestamp: timestampFromProto(pb.GetTimestamp()),
+	}
+}
+
+// NetworkMetricsToProto 转换网络指标
+func NetworkMetricsToProto(m *common.NetworkMetrics) *netmonv1.NetworkMetrics {
+	pb := &netmonv1.NetworkMetrics{
+		Timestamp:            timestampToProto(m.Timestamp),
+		HostId:               m.HostID,
+		Hostname:             m.Hostname,
+		Interface:            m.Interface,
+		TotalConnections:     m.TotalConnections,
+		TotalBytesSent:       m.TotalBytesSent,
+		TotalBytesReceived:   m.TotalBytesRecv,
+		TotalPacketsSent:     m.TotalPacketsSent,
+		TotalPacketsReceived: m.TotalPacketsRecv,
+		DomainsAccessed:      m.DomainsAccessed,
+		IpsAccessed:          m.IPsAccessed,
+		ProtocolStats:        m.ProtocolStats,
+	}
+
+	if len(m.PortStats) > 0 {
+		pb.PortStats = make(map[int32]uint64, len(m.PortStats))
+		for port, count := range m.PortStats {
+			pb.PortStats[int32(port)] = count
+		}
+	}
+
+	if len(m.DomainTraffic) > 0 {
+		pb.DomainTraffic = make(map[string]*netmonv1.DomainTrafficStats, len(m.DomainTraffic))
+		for domain, stats := range m.DomainTraffic {
+			if stats == nil {
+				continue
+			}
+			pb.DomainTraffic[domain] = &netmonv1.DomainTrafficStats{
+				Domain:          stats.Domain,
+				BytesSent:       stats.BytesSent,
+				BytesReceived:   stats.BytesReceived,
+				PacketsSent:     stats.PacketsSent,
+				PacketsReceived: stats.PacketsRecv,
+				Connections:     stats.Connections,
+				LastAccess:      timestampToProto(stats.LastAccess),
+			}
+		}
+	}
+
+	for _, process := range m.TopProcesses {
+		pb.TopProcesses = append(pb.TopProcesses, &netmonv1.ProcessStats{
+			ProcessName:   process.ProcessName,
+			Pid:           int32(process.PID),
+			Connections:   process.Connections,
+			BytesSent:     process.BytesSent,
+			BytesReceived: process.BytesReceived,
+		})
+	}
+
+	for _, event := range m.Events {
+		pb.Events = append(pb.Events, &netmonv1.NetworkEvent{
+			Timestamp:       timestampToProto(event.Timestamp),
+			Protocol:        event.Protocol,
+			Direction:       event.Direction,
+			SourceIp:        event.SourceIP,
+			SourcePort:      int32(event.SourcePort),
+			DestIp:          event.DestIP,
+			DestPort:        int32(event.DestPort),
+			Domain:          event.Domain,
+			Interface:       event.Interface,
+			BytesSent:       event.BytesSent,
+			BytesReceived:   event.BytesRecv,
+			PacketsSent:     event.PacketsSent,
+			PacketsReceived: event.PacketsRecv,
+			Duration:        durationpb.New(event.Duration),
+			Status:          event.Status,
+			ProcessName:     event.ProcessName,
+			ProcessPid:      int32(event.ProcessPID),
+		})
+	}
+
+	return pb
+}
+
+// NetworkMetricsFromProto 从protobuf网络指标转换
+func NetworkMetricsFromProto(pb *netmonv1.NetworkMetrics) common.NetworkMetrics {
+	m := common.NetworkMetrics{
+		Timestamp:        timestampFromProto(pb.GetTimestamp()),
+		HostID:           pb.GetHostId(),
+		Hostname:         pb.GetHostname(),
+		Interface:        pb.GetInterface(),
+		TotalConnections: pb.GetTotalConnections(),
+		TotalBytesSent:   pb.GetTotalBytesSent(),
+		TotalBytesRecv:   pb.GetTotalBytesReceived(),
+		TotalPacketsSent: pb.GetTotalPacketsSent(),
+		TotalPacketsRecv: pb.GetTotalPacketsReceived(),
+		DomainsAccessed:  pb.GetDomainsAccessed(),
+		IPsAccessed:      pb.GetIpsAccessed(),
+		ProtocolStats:    pb.GetProtocolStats(),
+		PortStats:        make(map[int]uint64, len(pb.GetPortStats())),
+		DomainTraffic:    make(map[string]*common.DomainTrafficStats, len(pb.GetDomainTraffic())),
+	}
+
+	for port, count := range pb.GetPortStats() {
+		m.PortStats[int(port)] = count
+	}
+
+	for domain, stats := range pb.GetDomainTraffic() {
+		m.DomainTraffic[domain] = &common.DomainTrafficStats{
+			Domain:        stats.GetDomain(),
+			BytesSent:     stats.GetBytesSent(),
+			BytesReceived: stats.GetBytesReceived(),
+			PacketsSent:   stats.GetPacketsSent(),
+			PacketsRecv:   stats.GetPacketsReceived(),
+			Connections:   stats.GetConnections(),
+			LastAccess:    timestampFromProto(stats.GetLastAccess()),
+		}
+	}
+
+	for _, process := range pb.GetTopProcesses() {
+		m.TopProcesses = append(m.TopProcesses, common.ProcessStats{
+			ProcessName:   process.GetProcessName(),
+			PID:           int(process.GetPid()),
+			Connections:   process.GetConnections(),
+			BytesSent:     process.GetBytesSent(),
+			BytesReceived: process.GetBytesReceived(),
+		})
+	}
+
+	for _, event := range pb.GetEvents() {
+		m.Events = append(m.Events, common.NetworkEvent{
+			Timestamp:   timestampFromProto(event.GetTimestamp()),
+			Protocol:    event.GetProtocol(),
+			Direction:   event.GetDirection(),
+			SourceIP:    event.GetSourceIp(),
+			SourcePort:  int(event.GetSourcePort()),
+			DestIP:      event.GetDestIp(),
+			DestPort:    int(event.GetDestPort()),
+			Domain:      event.GetDomain(),
+			Interface:   event.GetInterface(),
+			BytesSent:   event.GetBytesSent(),
+			BytesRecv:   event.GetBytesReceived(),
+			PacketsSent: event.GetPacketsSent(),
+			PacketsRecv: event.GetPacketsReceived(),
+			Duration:    event.GetDuration().AsDuration(),
+			Status:      event.GetStatus(),
+			ProcessName: event.GetProcessName(),
+			ProcessPID:  int(event.GetProcessPid()),
+		})
+	}
+
+	return m
+}
+
+// MetricsReportToProto 转换增强报告，nil返回nil
+func MetricsReportToProto(r *common.MetricsReport) *netmonv1.MetricsReport {
+	if r == nil {
+		return nil
+	}
+
+	return &netmonv1.MetricsReport{
+		AgentId:     r.AgentID,
+		StartupTime: timestampToProto(r.StartupTime),
+		ReportTime:  timestampToProto(r.ReportTime),
+		ReportMode:  r.ReportMode,
+		DeltaStats:  domainMetricsMapToProto(r.DeltaStats),
+		TotalStats:  domainMetricsMapToProto(r.TotalStats),
+		SystemInfo: &netmonv1.SystemMetrics{
+			Hostname:           r.SystemInfo.Hostname,
+			Interface:          r.SystemInfo.Interface,
+			TotalConnections:   r.SystemInfo.TotalConnections,
+			TotalBytesSent:     r.SystemInfo.TotalBytesSent,
+			TotalBytesReceived: r.SystemInfo.TotalBytesReceived,
+			ActiveDomains:      int32(r.SystemInfo.ActiveDomains),
+			ReportInterval:     r.SystemInfo.ReportInterval,
+			UptimeSeconds:      r.SystemInfo.UptimeSeconds,
+		},
+		Metadata: &netmonv1.ReportMetadata{
+			Version:            r.Metadata.Version,
+			ConfigHash:         r.Metadata.ConfigHash,
+			Tags:               r.Metadata.Tags,
+			PersistenceEnabled: r.Metadata.PersistenceEnabled,
+			RestartDetected:    r.Metadata.RestartDetected,
+		},
+	}
+}
+
+// MetricsReportFromProto 从protobuf增强报告转换，nil返回nil
+func MetricsReportFromProto(pb *netmonv1.MetricsReport) *common.MetricsReport {
+	if pb == nil {
+		return nil
+	}
+
+	system := pb.GetSystemInfo()
+	metadata := pb.GetMetadata()
+
+	return &common.MetricsReport{
+		AgentID:     pb.GetAgentId(),
+		StartupTime: timestampFromProto(pb.GetStartupTime()),
+		ReportTime:  timestampFromProto(pb.GetReportTime()),
+		ReportMode:  pb.GetReportMode(),
+		DeltaStats:  domainMetricsMapFromProto(pb.GetDeltaStats()),
+		TotalStats:  domainMetricsMapFromProto(pb.GetTotalStats()),
+		SystemInfo: common.SystemMetrics{
+			Hostname:           system.GetHostname(),
+			Interface:          system.GetInterface(),
+			TotalConnections:   system.GetTotalConnections(),
+			TotalBytesSent:     system.GetTotalBytesSent(),
+			TotalBytesReceived: system.GetTotalBytesReceived(),
+			ActiveDomains:      int(system.GetActiveDomains()),
+			ReportInterval:     system.GetReportInterval(),
+			UptimeSeconds:      system.GetUptimeSeconds(),
+		},
+		Metadata: common.ReportMetadata{
+			Version:            metadata.GetVersion(),
+			ConfigHash:         metadata.GetConfigHash(),
+			Tags:               metadata.GetTags(),
+			PersistenceEnabled: metadata.GetPersistenceEnabled(),
+			RestartDetected:    metadata.GetRestartDetected(),
+		},
+	}
+}
+
+// domainMetricsMapToProto 转换域名指标表
+func domainMetricsMapToProto(stats map[string]common.DomainMetrics) map[string]*netmonv1.DomainMetrics {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	result := make(map[string]*netmonv1.DomainMetrics, len(stats))
+	for domain, dm := range stats {
+		pb := &netmonv1.DomainMetrics{
+			Domain:          dm.Domain,
+			AccessCount:     dm.AccessCount,
+			BytesSent:       dm.BytesSent,
+			BytesReceived:   dm.BytesReceived,
+			ConnectionCount: dm.ConnectionCount,
+			LastAccessTime:  timestampToProto(dm.LastAccessTime),
+			ProtocolStats:   dm.ProtocolStats,
+		}
+		if len(dm.PortStats) > 0 {
+			pb.PortStats = make(map[int32]int64, len(dm.PortStats))
+			for port, count := range dm.PortStats {
+				pb.PortStats[int32(port)] = count
+			}
+		}
+		result[domain] = pb
+	}
+	return result
+}
+
+// domainMetricsMapFromProto 从protobuf域名指标表转换
+func domainMetricsMapFromProto(stats map[string]*netmonv1.DomainMetrics) map[string]common.DomainMetrics {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	result := make(map[string]common.DomainMetrics, len(stats))
+	for domain, pb := range stats {
+		dm := common.DomainMetrics{
+			Domain:          pb.GetDomain(),
+			AccessCount:     pb.GetAccessCount(),
+			BytesSent:       pb.GetBytesSent(),
+			BytesReceived:   pb.GetBytesReceived(),
+			ConnectionCount: pb.GetConnectionCount(),
+			LastAccessTime:  timestampFromProto(pb.GetLastAccessTime()),
+			ProtocolStats:   pb.GetProtocolStats(),
+		}
+		if len(pb.GetPortStats()) > 0 {
+			dm.PortStats = make(map[int]int64, len(pb.GetPortStats()))
+			for port, count := range pb.GetPortStats() {
+				dm.PortStats[int(port)] = count
+			}
+		}
+		result[domain] = dm
+	}
+	return result
+}
+
+// timestampToProto 零值时间转换为nil
+func timestampToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// timestampFromProto nil转换为零值时间
+func timestampFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// HeartbeatToProto 转换为protobuf心跳
+func HeartbeatToProto(info *common.AgentInfo) *netmonv1.Heartbeat {
+	pb := &netmonv1.Heartbeat{
+		AgentId:        info.ID,
+		Hostname:       info.Hostname,
+		Version:        info.Version,
+		StartTime:      timestampToProto(info.StartTime),
+		Status:         info.Status,
+		Mode:           info.Mode,
+		KernelVersion:  info.KernelVersion,
+		Os:             info.OS,
+		Arch:           info.Arch,
+		Interface:      info.Interface,
+		ReportInterval: info.ReportInterval,
+		StartupTime:    timestampToProto(info.StartupTime),
+	}
+	if info.Host != nil {
+		pb.Host = &netmonv1.HostInfo{
+			HostIp:        info.Host.HostIP,
+			Gateway:       info.Host.Gateway,
+			IsContainer:   info.Host.IsContainer,
+			IsVm:          info.Host.IsVM,
+			ContainerType: info.Host.ContainerType,
+			VmType:        info.Host.VMType,
+			DetectedAt:    timestampToProto(info.Host.DetectedAt),
+		}
+	}
+	for _, iface := range info.Interfaces {
+		pb.Interfaces = append(pb.Interfaces, &netmonv1.InterfaceInfo{
+			Name:         iface.Name,
+			HardwareAddr: iface.HardwareAddr,
+			IpAddresses:  iface.IPAddresses,
+			IsUp:         iface.IsUp,
+			IsLoopback:   iface.IsLoopback,
+			IsVirtual:    iface.IsVirtual,
+			Mtu:          int32(iface.MTU),
+		})
+	}
+	return pb
+}
+
+// HeartbeatFromProto 从protobuf心跳转换
+func HeartbeatFromProto(pb *netmonv1.Heartbeat) common.AgentInfo {
+	info := common.AgentInfo{
+		ID:             pb.GetAgentId(),
+		Hostname:       pb.GetHostname(),
+		Version:        pb.GetVersion(),
+		StartTime:      timestampFromProto(pb.GetStartTime()),
+		Status:         pb.GetStatus(),
+		Mode:           pb.GetMode(),
+		KernelVersion:  pb.GetKernelVersion(),
+		OS:             pb.GetOs(),
+		Arch:           pb.GetArch(),
+		Interface:      pb.GetInterface(),
+		ReportInterval: pb.GetReportInterval(),
+		StartupTime:    timestampFromProto(pb.GetStartupTime()),
+	}
+	if host := pb.GetHost(); host != nil {
+		info.Host = &network.HostInfo{
+			HostIP:        host.GetHostIp(),
+			Gateway:       host.GetGateway(),
+			IsContainer:   host.GetIsContainer(),
+			IsVM:          host.GetIsVm(),
+			ContainerType: host.GetContainerType(),
+			VMType:        host.GetVmType(),
+			DetectedAt:    timestampFromProto(host.GetDetectedAt()),
+		}
+	}
+	for _, iface := range pb.GetInterfaces() {
+		info.Interfaces = append(info.Interfaces, network.InterfaceInfo{
+			Name:         iface.GetName(),
+			DisplayName:  iface.GetName(),
+			HardwareAddr: iface.GetHardwareAddr(),
+			IPAddresses:  iface.GetIpAddresses(),
+			IsUp:         iface.GetIsUp(),
+			IsLoopback:   iface.GetIsLoopback(),
+			IsVirtual:    iface.GetIsVirtual(),
+			MTU:          int(iface.GetMtu()),
+		})
+	}
+	return info
+}
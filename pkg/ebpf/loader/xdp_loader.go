@@ -28,6 +28,7 @@ type XDPLoader struct {
 	iface    string
 	statsMap *ebpf.Map
 	logger   *logrus.Logger
+	ticker   *time.Ticker
 }
 
 // NewXDPLoader 创建新的XDP加载器
@@ -125,6 +126,7 @@ func (x *XDPLoader) GetStats() (*PacketStats, error) {
 // StartStatsCollection 开始统计信息收集
 func (x *XDPLoader) StartStatsCollection(interval time.Duration, callback func(*PacketStats)) {
 	ticker := time.NewTicker(interval)
+	x.ticker = ticker
 	go func() {
 		defer ticker.Stop()
 		for range ticker.C {
@@ -138,6 +140,13 @@ func (x *XDPLoader) StartStatsCollection(interval time.Duration, callback func(*
 	}()
 }
 
+// SetStatsInterval 调整统计信息收集间隔
+func (x *XDPLoader) SetStatsInterval(interval time.Duration) {
+	if x.ticker != nil && interval > 0 {
+		x.ticker.Reset(interval)
+	}
+}
+
 // Close 清理资源
 func (x *XDPLoader) Close() error {
 	if x.link != nil {
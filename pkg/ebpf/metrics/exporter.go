@@ -1,13 +1,24 @@
 package metrics
 
 import (
+	"net/http"
+	"os"
+
+	"go-net-monitoring/pkg/ebpf/loader"
+	"go-net-monitoring/pkg/reporter"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
 // EBPFMetricsExporter eBPF指标导出器
 type EBPFMetricsExporter struct {
-	logger *logrus.Logger
+	logger   *logrus.Logger
+	registry *prometheus.Registry
+	hostname string
+	iface    string
 
 	// eBPF特定指标
 	ebpfPacketsTotal  *prometheus.CounterVec
@@ -15,9 +26,361 @@ type EBPFMetricsExporter struct {
 	ebpfProtocolStats *prometheus.CounterVec
 	ebpfProgramInfo   *prometheus.GaugeVec
 
-	// 兼容现有指标
-	networkDomainsTotal     *prometheus.CounterVec
-	networkBytesTotal       *prometheus.CounterVec
+	// 兼容现有指标（与Server端指标名称和标签一致）
+	networkBytesSentTotal   *prometheus.CounterVec
+	networkBytesRecvTotal   *prometheus.CounterVec
 	networkConnectionsTotal *prometheus.CounterVec
 	networkInterfaceInfo    *prometheus.GaugeVec
 }
+
+// NewEBPFMetricsExporter 创建eBPF指标导出器，使用独立的Registry
+func NewEBPFMetricsExporter(iface string, logger *logrus.Logger) *EBPFMetricsExporter {
+	hostname, _ := os.Hostname()
+	if iface == "" {
+		iface = "unknown"
+	}
+
+	e := &EBPFMetricsExporter{
+		logger:   logger,
+		registry: prometheus.NewRegistry(),
+		hostname: hostname,
+		iface:    iface,
+
+		ebpfPacketsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ebpf_packets_total",
+				Help: "Total packets observed by the XDP program",
+			},
+			[]string{"host", "interface"},
+		),
+
+		ebpfBytesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ebpf_bytes_total",
+				Help: "Total bytes observed by the XDP program",
+			},
+			[]string{"host", "interface"},
+		),
+
+		ebpfProtocolStats: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ebpf_protocol_packets_total",
+				Help: "Packets observed by the XDP program per protocol",
+			},
+			[]string{"protocol", "host", "interface"},
+		),
+
+		ebpfProgramInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ebpf_program_info",
+				Help: "Information about the loaded eBPF program, value is 1",
+			},
+			[]string{"mode", "program_path", "host", "interface"},
+		),
+
+		networkBytesSentTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "network_bytes_sent_total",
+				Help: "Total bytes sent over network",
+			},
+			[]string{"protocol", "destination", "host", "interface"},
+		),
+
+		networkBytesRecvTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "network_bytes_received_total",
+				Help: "Total bytes received over network",
+			},
+			[]string{"protocol", "source", "host", "interface"},
+		),
+
+		networkConnectionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "network_connections_total",
+				Help: "Total number of network connections",
+			},
+			[]string{"protocol", "direction", "host", "interface"},
+		),
+
+		networkInterfaceInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "network_interface_info",
+				Help: "Network interface information with IP address, MAC address and host IP address",
+			},
+			[]string{"interface", "ip_address", "mac_address", "host", "host_ip_address"},
+		),
+	}
+
+	e.registry.MustRegister(
+		e.ebpfPacketsTotal,
+		e.ebpfBytesTotal,
+		e.ebpfProtocolStats,
+		e.ebpfProgramInfo,
+		e.networkBytesSentTotal,
+		e.networkBytesRecvTotal,
+		e.networkConnectionsTotal,
+		e.networkInterfaceInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return e
+}
+
+// Handler 返回/metrics处理器
+func (e *EBPFMetricsExporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{
+		ErrorLog: e.logger,
+	})
+}
+
+// Registry 返回导出器使用的Registry，用于注册额外的采集器
+func (e *EBPFMetricsExporter) Registry() *prometheus.Registry {
+	return e.registry
+}
+
+// SetProgramInfo 记录当前采集模式和eBPF程序路径
+func (e *EBPFMetricsExporter) SetProgramInfo(mode, programPath string) {
+	e.ebpfProgramInfo.Reset()
+	e.ebpfProgramInfo.WithLabelValues(mode, programPath, e.hostname, e.iface).Set(1)
+}
+
+// UpdatePacketStats 累加XDP统计增量
+func (e *EBPFMetricsExporter) UpdatePacketStats(delta *loader.PacketStats) {
+	e.ebpfPacketsTotal.WithLabelValues(e.hostname, e.iface).Add(float64(delta.TotalPackets))
+	e.ebpfBytesTotal.WithLabelValues(e.hostname, e.iface).Add(float64(delta.TotalBytes))
+
+	e.ebpfProtocolStats.WithLabelValues("tcp", e.hostname, e.iface).Add(float64(delta.TCPPackets))
+	e.ebpfProtocolStats.WithLabelValues("udp", e.hostname, e.iface).Add(float64(delta.UDPPackets))
+	e.ebpfProtocolStats.WithLabelValues("other", e.hostname, e.iface).Add(float64(delta.OtherPackets))
+
+	// 与Agent上报逻辑一致：XDP只统计入口流量，按发送和接收各占一半估算
+	e.networkConnectionsTotal.WithLabelValues("total", "all", e.hostname, e.iface).Add(float64(delta.TotalPackets))
+	e.networkBytesSentTotal.WithLabelValues("total", "all", e.hostname, e.iface).Add(float64(delta.TotalBytes / 2))
+	e.networkBytesRecvTotal.WithLabelValues("total", "all", e.hostname, e.iface).Add(float64(delta.TotalBytes / 2))
+}
+
+// UpdateInterfaceInfo 更新网卡信息指标
+func (e *EBPFMetricsExporter) UpdateInterfaceInfo(interfaceName, ipAddress, macAddress, hostname, hostIPAddress string) {
+	e.networkInterfaceInfo.WithLabelValues(interfaceName, ipAddress, macAddress, hostname, hostIPAddress).Set(1)
+}
+
+// ClearInterfaceInfo 清除网卡信息指标
+func (e *EBPFMetricsExporter) ClearInterfaceInfo() {
+	e.networkInterfaceInfo.Reset()
+}
+
+// RegisterReporterStats 注册上报器统计采集器，抓取时读取最新的ReporterStats
+func (e *EBPFMetricsExporter) RegisterReporterStats(statsFunc func() reporter.ReporterStats) {
+	e.registry.MustRegister(newReporterCollector(statsFunc))
+}
+
+// reporterCollector 上报器统计采集器
+type reporterCollector struct {
+	statsFunc func() reporter.ReporterStats
+
+	reportsTotal    *prometheus.Desc
+	retriesTotal    *prometheus.Desc
+	queueSize       *prometheus.Desc
+	batchSize       *prometheus.Desc
+	lastReportTime  *prometheus.Desc
+	spoolDepth      *prometheus.Desc
+	spoolBytes      *prometheus.Desc
+	spooledTotal    *prometheus.Desc
+	replayedTotal   *prometheus.Desc
+	spoolDropped    *prometheus.Desc
+	pendingRetries  *prometheus.Desc
+	breakerState    *prometheus.Desc
+	failures        *prometheus.Desc
+	streamConnected *prometheus.Desc
+
+	sinkHealthy   *prometheus.Desc
+	sinkQueueSize *prometheus.Desc
+	sinkRecords   *prometheus.Desc
+	sinkRetries   *prometheus.Desc
+
+	collapsedLabels *prometheus.Desc
+}
+
+// newReporterCollector 创建上报器统计采集器
+func newReporterCollector(statsFunc func() reporter.ReporterStats) *reporterCollector {
+	return &reporterCollector{
+		statsFunc: statsFunc,
+		reportsTotal: prometheus.NewDesc(
+			"agent_reporter_reports_total",
+			"Total number of report batches sent to the server",
+			[]string{"status"}, nil,
+		),
+		retriesTotal: prometheus.NewDesc(
+			"agent_reporter_retries_total",
+			"Total number of report retries",
+			nil, nil,
+		),
+		queueSize: prometheus.NewDesc(
+			"agent_reporter_queue_size",
+			"Current number of metrics waiting in the report queue",
+			nil, nil,
+		),
+		batchSize: prometheus.NewDesc(
+			"agent_reporter_batch_size",
+			"Number of metrics in the last sent batch",
+			nil, nil,
+		),
+		lastReportTime: prometheus.NewDesc(
+			"agent_reporter_last_report_timestamp_seconds",
+			"Unix timestamp of the last report attempt",
+			nil, nil,
+		),
+		spoolDepth: prometheus.NewDesc(
+			"agent_reporter_spool_depth",
+			"Number of reports waiting in the disk spool",
+			nil, nil,
+		),
+		spoolBytes: prometheus.NewDesc(
+			"agent_reporter_spool_bytes",
+			"Disk space used by the spool in bytes",
+			nil, nil,
+		),
+		spooledTotal: prometheus.NewDesc(
+			"agent_reporter_spooled_reports_total",
+			"Total number of reports written to the disk spool",
+			nil, nil,
+		),
+		replayedTotal: prometheus.NewDesc(
+			"agent_reporter_replayed_reports_total",
+			"Total number of spooled reports replayed to the server",
+			nil, nil,
+		),
+		spoolDropped: prometheus.NewDesc(
+			"agent_reporter_spool_dropped_total",
+			"Total number of spooled reports dropped by size or age limits",
+			nil, nil,
+		),
+		pendingRetries: prometheus.NewDesc(
+			"agent_reporter_pending_retries",
+			"Number of batches waiting for a retry in memory",
+			nil, nil,
+		),
+		breakerState: prometheus.NewDesc(
+			"agent_reporter_circuit_breaker_state",
+			"Current circuit breaker state, value is 1 for the active state",
+			[]string{"state"}, nil,
+		),
+		failures: prometheus.NewDesc(
+			"agent_reporter_consecutive_failures",
+			"Number of consecutive failed sends",
+			nil, nil,
+		),
+		streamConnected: prometheus.NewDesc(
+			"agent_reporter_stream_connected",
+			"Whether the gRPC report stream is currently established (1) or not (0)",
+			nil, nil,
+		),
+		sinkHealthy: prometheus.NewDesc(
+			"agent_reporter_sink_healthy",
+			"Whether the last write to the sink succeeded (1) or not (0)",
+			[]string{"sink", "type"}, nil,
+		),
+		sinkQueueSize: prometheus.NewDesc(
+			"agent_reporter_sink_queue_size",
+			"Current number of records waiting in the sink queue",
+			[]string{"sink", "type"}, nil,
+		),
+		sinkRecords: prometheus.NewDesc(
+			"agent_reporter_sink_records_total",
+			"Total number of records handled by the sink",
+			[]string{"sink", "type", "status"}, nil,
+		),
+		sinkRetries: prometheus.NewDesc(
+			"agent_reporter_sink_retries_total",
+			"Total number of write retries of the sink",
+			[]string{"sink", "type"}, nil,
+		),
+		collapsedLabels: prometheus.NewDesc(
+			"agent_cardinality_collapsed_label_values",
+			"Number of label values collapsed into the other bucket by the cardinality limit in the last report",
+			[]string{"metric"}, nil,
+		),
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (c *reporterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reportsTotal
+	ch <- c.retriesTotal
+	ch <- c.queueSize
+	ch <- c.batchSize
+	ch <- c.lastReportTime
+	ch <- c.spoolDepth
+	ch <- c.spoolBytes
+	ch <- c.spooledTotal
+	ch <- c.replayedTotal
+	ch <- c.spoolDropped
+	ch <- c.pendingRetries
+	ch <- c.breakerState
+	ch <- c.failures
+	ch <- c.streamConnected
+	ch <- c.sinkHealthy
+	ch <- c.sinkQueueSize
+	ch <- c.sinkRecords
+	ch <- c.sinkRetries
+	ch <- c.collapsedLabels
+}
+
+// Collect 实现prometheus.Collector
+func (c *reporterCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.statsFunc()
+
+	ch <- prometheus.MustNewConstMetric(c.reportsTotal, prometheus.CounterValue, float64(stats.SuccessReports), "success")
+	ch <- prometheus.MustNewConstMetric(c.reportsTotal, prometheus.CounterValue, float64(stats.FailedReports), "failed")
+	ch <- prometheus.MustNewConstMetric(c.retriesTotal, prometheus.CounterValue, float64(stats.RetryCount))
+	ch <- prometheus.MustNewConstMetric(c.queueSize, prometheus.GaugeValue, float64(stats.QueueSize))
+	ch <- prometheus.MustNewConstMetric(c.batchSize, prometheus.GaugeValue, float64(stats.BatchSize))
+
+	var lastReport float64
+	if !stats.LastReportTime.IsZero() {
+		lastReport = float64(stats.LastReportTime.Unix())
+	}
+	ch <- prometheus.MustNewConstMetric(c.lastReportTime, prometheus.GaugeValue, lastReport)
+
+	ch <- prometheus.MustNewConstMetric(c.spoolDepth, prometheus.GaugeValue, float64(stats.SpoolDepth))
+	ch <- prometheus.MustNewConstMetric(c.spoolBytes, prometheus.GaugeValue, float64(stats.SpoolBytes))
+	ch <- prometheus.MustNewConstMetric(c.spooledTotal, prometheus.CounterValue, float64(stats.SpooledReports))
+	ch <- prometheus.MustNewConstMetric(c.replayedTotal, prometheus.CounterValue, float64(stats.ReplayedReports))
+	ch <- prometheus.MustNewConstMetric(c.spoolDropped, prometheus.CounterValue, float64(stats.SpoolDropped))
+
+	ch <- prometheus.MustNewConstMetric(c.pendingRetries, prometheus.GaugeValue, float64(stats.PendingRetries))
+	ch <- prometheus.MustNewConstMetric(c.failures, prometheus.GaugeValue, float64(stats.ConsecutiveFailures))
+	for _, state := range []reporter.BreakerState{reporter.BreakerClosed, reporter.BreakerOpen, reporter.BreakerHalfOpen} {
+		var value float64
+		if stats.BreakerState == state {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.breakerState, prometheus.GaugeValue, value, string(state))
+	}
+
+	if stats.Transport == "grpc" {
+		var connected float64
+		if stats.StreamConnected {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.streamConnected, prometheus.GaugeValue, connected)
+	}
+
+	for _, sink := range stats.Sinks {
+		var healthy float64
+		if sink.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.sinkHealthy, prometheus.GaugeValue, healthy, sink.Name, sink.Type)
+		ch <- prometheus.MustNewConstMetric(c.sinkQueueSize, prometheus.GaugeValue, float64(sink.QueueSize), sink.Name, sink.Type)
+		ch <- prometheus.MustNewConstMetric(c.sinkRecords, prometheus.CounterValue, float64(sink.SentRecords), sink.Name, sink.Type, "sent")
+		ch <- prometheus.MustNewConstMetric(c.sinkRecords, prometheus.CounterValue, float64(sink.FailedRecords), sink.Name, sink.Type, "failed")
+		ch <- prometheus.MustNewConstMetric(c.sinkRecords, prometheus.CounterValue, float64(sink.DroppedRecords), sink.Name, sink.Type, "dropped")
+		ch <- prometheus.MustNewConstMetric(c.sinkRetries, prometheus.CounterValue, float64(sink.Retries), sink.Name, sink.Type)
+	}
+
+	for metric, count := range stats.CollapsedLabelValues {
+		ch <- prometheus.MustNewConstMetric(c.collapsedLabels, prometheus.GaugeValue, float64(count), metric)
+	}
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"go-net-monitoring/internal/common"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -9,24 +11,8 @@ import (
 
 // Metrics Prometheus指标集合
 type Metrics struct {
-	// 网络连接指标
-	NetworkConnectionsTotal *prometheus.CounterVec
-	NetworkBytesSentTotal   *prometheus.CounterVec
-	NetworkBytesRecvTotal   *prometheus.CounterVec
-	NetworkPacketsSentTotal *prometheus.CounterVec
-	NetworkPacketsRecvTotal *prometheus.CounterVec
-
-	// 域名和IP访问指标
-	NetworkDomainsAccessedTotal *prometheus.CounterVec
-	NetworkIPsAccessedTotal     *prometheus.CounterVec
-
-	// 按域名的流量指标
-	NetworkDomainBytesSentTotal     *prometheus.CounterVec
-	NetworkDomainBytesReceivedTotal *prometheus.CounterVec
-	NetworkDomainConnectionsTotal   *prometheus.CounterVec
-
-	// 协议统计指标
-	NetworkProtocolStats *prometheus.CounterVec
+	// Agent上报的网络计数器（连接、流量、包、域名、IP、协议），按Agent保存状态
+	Network *NetworkCollector
 
 	// 连接状态指标
 	NetworkActiveConnections  *prometheus.GaugeVec
@@ -46,102 +32,31 @@ type Metrics struct {
 
 	// 网卡信息指标 (新增)
 	NetworkInterfaceInfo *prometheus.GaugeVec
-}
-
-// NewMetrics 创建新的指标集合
-func NewMetrics() *Metrics {
-	return &Metrics{
-		// 网络连接指标 (添加interface标签)
-		NetworkConnectionsTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_connections_total",
-				Help: "Total number of network connections",
-			},
-			[]string{"protocol", "direction", "host", "interface"},
-		),
-
-		NetworkBytesSentTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_bytes_sent_total",
-				Help: "Total bytes sent over network",
-			},
-			[]string{"protocol", "destination", "host", "interface"},
-		),
-
-		NetworkBytesRecvTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_bytes_received_total",
-				Help: "Total bytes received over network",
-			},
-			[]string{"protocol", "source", "host", "interface"},
-		),
 
-		NetworkPacketsSentTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_packets_sent_total",
-				Help: "Total packets sent over network",
-			},
-			[]string{"protocol", "destination", "host", "interface"},
-		),
-
-		NetworkPacketsRecvTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_packets_received_total",
-				Help: "Total packets received over network",
-			},
-			[]string{"protocol", "source", "host", "interface"},
-		),
+	// 上报数据大小（按序列化格式和压缩算法）
+	ReportPayloadBytes *prometheus.HistogramVec
 
-		// 域名和IP访问指标 (添加interface标签)
-		NetworkDomainsAccessedTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_domains_accessed_total",
-				Help: "Total number of domains accessed",
-			},
-			[]string{"domain", "host", "interface"},
-		),
+	// gRPC流式上报
+	StreamConnections   prometheus.Gauge
+	StreamMessagesTotal *prometheus.CounterVec
 
-		NetworkIPsAccessedTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_ips_accessed_total",
-				Help: "Total number of IP addresses accessed",
-			},
-			[]string{"ip", "host", "interface"},
-		),
+	// OTLP导出
+	OTLPExportRecordsTotal *prometheus.CounterVec
 
-		// 按域名的流量指标 (添加interface标签)
-		NetworkDomainBytesSentTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_domain_bytes_sent_total",
-				Help: "Total bytes sent to each domain",
-			},
-			[]string{"domain", "host", "interface"},
-		),
+	// 认证
+	AuthFailuresTotal *prometheus.CounterVec
 
-		NetworkDomainBytesReceivedTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_domain_bytes_received_total",
-				Help: "Total bytes received from each domain",
-			},
-			[]string{"domain", "host", "interface"},
-		),
+	// v2批量上报
+	ReportItemsTotal *prometheus.CounterVec
+}
 
-		NetworkDomainConnectionsTotal: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_domain_connections_total",
-				Help: "Total connections to each domain",
-			},
-			[]string{"domain", "host", "interface"},
-		),
+// NewMetrics 创建新的指标集合
+func NewMetrics() *Metrics {
+	network := NewNetworkCollector()
+	prometheus.MustRegister(network)
 
-		// 协议统计指标 (添加interface标签)
-		NetworkProtocolStats: promauto.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "network_protocol_stats_total",
-				Help: "Network protocol statistics",
-			},
-			[]string{"protocol", "host", "interface"},
-		),
+	return &Metrics{
+		Network: network,
 
 		// 连接状态指标
 		NetworkActiveConnections: promauto.NewGaugeVec(
@@ -231,48 +146,82 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"interface", "ip_address", "mac_address", "host", "host_ip_address"},
 		),
-	}
-}
 
-// UpdateNetworkMetrics 更新网络指标 (支持interface参数)
-func (m *Metrics) UpdateNetworkMetrics(metrics common.NetworkMetrics) {
-	hostname := metrics.Hostname
-	// 默认使用 "unknown" 作为interface，保持向后兼容
-	interfaceName := "unknown"
-	if metrics.Interface != "" {
-		interfaceName = metrics.Interface
-	}
+		ReportPayloadBytes: promauto.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "server_report_payload_bytes",
+				Help:    "Size of received report payloads in bytes, on the wire and after decompression",
+				Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+			},
+			[]string{"content_type", "content_encoding", "stage"},
+		),
 
-	// 更新网络指标 - 使用正确的标签数量 (添加interface标签)
-	m.NetworkConnectionsTotal.WithLabelValues("total", "all", hostname, interfaceName).Add(float64(metrics.TotalConnections))
-	m.NetworkBytesSentTotal.WithLabelValues("total", "all", hostname, interfaceName).Add(float64(metrics.TotalBytesSent))
-	m.NetworkBytesRecvTotal.WithLabelValues("total", "all", hostname, interfaceName).Add(float64(metrics.TotalBytesRecv))
-	m.NetworkPacketsSentTotal.WithLabelValues("total", "all", hostname, interfaceName).Add(float64(metrics.TotalPacketsSent))
-	m.NetworkPacketsRecvTotal.WithLabelValues("total", "all", hostname, interfaceName).Add(float64(metrics.TotalPacketsRecv))
+		StreamConnections: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "server_stream_connections",
+				Help: "Number of agents connected via gRPC stream",
+			},
+		),
 
-	// 更新域名访问统计 (添加interface标签)
-	for domain, count := range metrics.DomainsAccessed {
-		m.NetworkDomainsAccessedTotal.WithLabelValues(domain, hostname, interfaceName).Add(float64(count))
-	}
+		StreamMessagesTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "server_stream_messages_total",
+				Help: "Total number of messages received on gRPC streams",
+			},
+			[]string{"type"},
+		),
 
-	// 更新域名流量统计 (添加interface标签)
-	for domain, stats := range metrics.DomainTraffic {
-		if stats != nil {
-			m.NetworkDomainBytesSentTotal.WithLabelValues(domain, hostname, interfaceName).Add(float64(stats.BytesSent))
-			m.NetworkDomainBytesReceivedTotal.WithLabelValues(domain, hostname, interfaceName).Add(float64(stats.BytesReceived))
-			m.NetworkDomainConnectionsTotal.WithLabelValues(domain, hostname, interfaceName).Add(float64(stats.Connections))
-		}
-	}
+		OTLPExportRecordsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "server_otlp_export_records_total",
+				Help: "Total number of reports forwarded to the OTLP collector",
+			},
+			[]string{"status"},
+		),
 
-	// 更新IP访问统计 (添加interface标签)
-	for ip, count := range metrics.IPsAccessed {
-		m.NetworkIPsAccessedTotal.WithLabelValues(ip, hostname, interfaceName).Add(float64(count))
+		AuthFailuresTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "server_auth_failures_total",
+				Help: "Total number of rejected requests by authentication failure reason",
+			},
+			[]string{"reason"},
+		),
+
+		ReportItemsTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "server_report_items_total",
+				Help: "Total number of reports received on /api/v2/reports by result",
+			},
+			[]string{"result"},
+		),
 	}
+}
+
+// UpdateNetworkMetrics 更新Agent上报的网络计数器，metrics为Agent自startupTime启动以来的累计值
+func (m *Metrics) UpdateNetworkMetrics(agentID string, startupTime time.Time, metrics common.NetworkMetrics) {
+	m.Network.ObserveNetworkMetrics(agentID, startupTime, metrics)
+}
+
+// UpdateReportMetrics 按报告的上报模式更新网络计数器
+func (m *Metrics) UpdateReportMetrics(report common.MetricsReport) {
+	m.Network.ObserveReport(report)
+}
 
-	// 更新协议统计 (添加interface标签)
-	for protocol, count := range metrics.ProtocolStats {
-		m.NetworkProtocolStats.WithLabelValues(protocol, hostname, interfaceName).Add(float64(count))
+// RemoveAgentMetrics 删除Agent的指标序列；hostname非空时同时删除带该host标签的序列，
+// 调用方需确认没有其他Agent使用相同的主机名
+func (m *Metrics) RemoveAgentMetrics(agentID, hostname string) {
+	m.Network.RemoveAgent(agentID)
+	if hostname == "" {
+		return
 	}
+
+	labels := prometheus.Labels{"host": hostname}
+	m.NetworkActiveConnections.DeletePartialMatch(labels)
+	m.NetworkConnectionDuration.DeletePartialMatch(labels)
+	m.AgentReportTotal.DeletePartialMatch(labels)
+	m.AgentReportErrors.DeletePartialMatch(labels)
+	m.PacketProcessingDuration.DeletePartialMatch(labels)
+	m.NetworkInterfaceInfo.DeletePartialMatch(labels)
 }
 
 // UpdateInterfaceInfo 更新网卡信息指标 (新增方法)
@@ -286,70 +235,6 @@ func (m *Metrics) ClearInterfaceInfo() {
 	m.NetworkInterfaceInfo.Reset()
 }
 
-// UpdateNetworkEvent 更新网络事件指标 (支持interface参数)
-func (m *Metrics) UpdateNetworkEvent(event common.NetworkEvent) {
-	hostname := event.ProcessName // 或者从其他地方获取hostname
-	interfaceName := "unknown"
-	if event.Interface != "" {
-		interfaceName = event.Interface
-	}
-
-	// 更新连接计数 (添加interface标签)
-	m.NetworkConnectionsTotal.WithLabelValues(
-		event.Protocol,
-		event.Direction,
-		hostname,
-		interfaceName,
-	).Inc()
-
-	// 更新字节统计 (添加interface标签)
-	if event.BytesSent > 0 {
-		m.NetworkBytesSentTotal.WithLabelValues(
-			event.Protocol,
-			event.DestIP,
-			hostname,
-			interfaceName,
-		).Add(float64(event.BytesSent))
-	}
-
-	if event.BytesRecv > 0 {
-		m.NetworkBytesRecvTotal.WithLabelValues(
-			event.Protocol,
-			event.SourceIP,
-			hostname,
-			interfaceName,
-		).Add(float64(event.BytesRecv))
-	}
-
-	// 更新包统计 (添加interface标签)
-	if event.PacketsSent > 0 {
-		m.NetworkPacketsSentTotal.WithLabelValues(
-			event.Protocol,
-			event.DestIP,
-			hostname,
-			interfaceName,
-		).Add(float64(event.PacketsSent))
-	}
-
-	if event.PacketsRecv > 0 {
-		m.NetworkPacketsRecvTotal.WithLabelValues(
-			event.Protocol,
-			event.SourceIP,
-			hostname,
-			interfaceName,
-		).Add(float64(event.PacketsRecv))
-	}
-
-	// 更新连接持续时间 (添加interface标签)
-	if event.Duration > 0 {
-		m.NetworkConnectionDuration.WithLabelValues(
-			event.Protocol,
-			hostname,
-			interfaceName,
-		).Observe(event.Duration.Seconds())
-	}
-}
-
 // UpdateAgentStats 更新Agent统计
 func (m *Metrics) UpdateAgentStats(hostname string, uptime float64, lastReportTime float64) {
 	m.AgentUptime.Set(uptime)
@@ -366,6 +251,37 @@ func (m *Metrics) UpdateReportError(hostname, errorType string) {
 	m.AgentReportErrors.WithLabelValues(errorType, hostname).Inc()
 }
 
+// RecordReportPayload 记录上报数据压缩前后的大小
+func (m *Metrics) RecordReportPayload(contentType, contentEncoding string, wireBytes, decodedBytes int) {
+	m.ReportPayloadBytes.WithLabelValues(contentType, contentEncoding, "wire").Observe(float64(wireBytes))
+	m.ReportPayloadBytes.WithLabelValues(contentType, contentEncoding, "decoded").Observe(float64(decodedBytes))
+}
+
+// SetStreamConnections 更新gRPC流连接数
+func (m *Metrics) SetStreamConnections(count int) {
+	m.StreamConnections.Set(float64(count))
+}
+
+// RecordStreamMessage 记录收到的gRPC流消息
+func (m *Metrics) RecordStreamMessage(msgType string) {
+	m.StreamMessagesTotal.WithLabelValues(msgType).Inc()
+}
+
+// RecordOTLPExport 记录OTLP导出的上报条数（status为sent、failed或dropped）
+func (m *Metrics) RecordOTLPExport(status string, records int) {
+	m.OTLPExportRecordsTotal.WithLabelValues(status).Add(float64(records))
+}
+
+// RecordAuthFailure 记录认证失败的请求
+func (m *Metrics) RecordAuthFailure(reason string) {
+	m.AuthFailuresTotal.WithLabelValues(reason).Inc()
+}
+
+// RecordReportItem 记录v2批量上报中单个报告的处理结果（accepted、rejected）
+func (m *Metrics) RecordReportItem(result string) {
+	m.ReportItemsTotal.WithLabelValues(result).Inc()
+}
+
 // UpdatePerformanceMetrics 更新性能指标
 func (m *Metrics) UpdatePerformanceMetrics(hostname string, processingDuration float64, queueSize, cacheSize, trackerSize int) {
 	m.PacketProcessingDuration.WithLabelValues("total", hostname).Observe(processingDuration)
@@ -0,0 +1,465 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/cardinality"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// networkSeries Agent上报数据生成的网络计数器
+type networkSeries int
+
+const (
+	seriesConnections networkSeries = iota
+	seriesBytesSent
+	seriesBytesRecv
+	seriesPacketsSent
+	seriesPacketsRecv
+	seriesDomainsAccessed
+	seriesIPsAccessed
+	seriesDomainBytesSent
+	seriesDomainBytesRecv
+	seriesDomainConnections
+	seriesProtocolStats
+	seriesCount
+)
+
+// networkSeriesNames 计数器的指标名称
+var networkSeriesNames = [seriesCount]string{
+	seriesConnections:       "network_connections_total",
+	seriesBytesSent:         "network_bytes_sent_total",
+	seriesBytesRecv:         "network_bytes_received_total",
+	seriesPacketsSent:       "network_packets_sent_total",
+	seriesPacketsRecv:       "network_packets_received_total",
+	seriesDomainsAccessed:   "network_domains_accessed_total",
+	seriesIPsAccessed:       "network_ips_accessed_total",
+	seriesDomainBytesSent:   "network_domain_bytes_sent_total",
+	seriesDomainBytesRecv:   "network_domain_bytes_received_total",
+	seriesDomainConnections: "network_domain_connections_total",
+	seriesProtocolStats:     "network_protocol_stats_total",
+}
+
+// seriesKey 计数器名称和标签值（最多4个标签）
+type seriesKey struct {
+	series networkSeries
+	labels [4]string
+}
+
+// agentCounters 单个Agent的计数器状态
+type agentCounters struct {
+	startupTime time.Time
+	values      map[seriesKey]float64
+	// 之前各次启动的最终计数，重启后继续计入总和
+	retired map[seriesKey]float64
+
+	// 本次启动以来的上报次数，用于淘汰长期缺席的标签值
+	reports uint64
+	// 受限序列中各标签值的归属，标签值首次出现时确定；
+	// 连续memberIdleReports次上报缺席或Agent重启后淘汰，再次出现时重新申请名额
+	members map[networkSeries]map[string]*labelMember
+	// 汇总到other的累计值按原标签保存，other为这些值之和；
+	// 标签值在之后的上报中缺席时保留上次的值，other不会回退
+	hidden map[seriesKey]float64
+	// 已淘汰的汇总标签值最后的累计值，按other序列合并保存
+	folded map[seriesKey]float64
+}
+
+// labelMember 受限标签值的归属
+type labelMember struct {
+	kept     bool   // true为独立序列，false为汇总到other
+	lastSeen uint64 // 最后一次出现时的上报序号
+}
+
+// defaultMemberIdleReports 标签值连续缺席多少次上报后淘汰（上报间隔10s时约1小时）
+const defaultMemberIdleReports = 360
+
+// NetworkCollector 按Agent保存网络计数器，抓取时输出各Agent的计数之和
+// 累计上报直接使用Agent启动以来的计数，增量上报在已有计数上累加；
+// Agent重启（启动时间变化）时本次启动的计数从零开始，之前的计数继续计入总和；Agent被删除时其计数转入retired，
+// 多个Agent汇总的序列不会因为其中一个Agent重启或过期而回退（Prometheus会把回退当作计数器重置）
+type NetworkCollector struct {
+	descs         [seriesCount]*prometheus.Desc
+	collapsedDesc *prometheus.Desc
+
+	mu      sync.RWMutex
+	agents  map[string]*agentCounters
+	retired map[seriesKey]float64 // 已删除Agent在仍有其他Agent贡献的序列上的最终计数
+	limits  *cardinality.Set
+
+	memberIdleReports uint64
+}
+
+// NewNetworkCollector 创建网络计数器收集器，指标名称和标签与之前的CounterVec保持一致
+func NewNetworkCollector() *NetworkCollector {
+	c := &NetworkCollector{
+		agents:            make(map[string]*agentCounters),
+		retired:           make(map[seriesKey]float64),
+		memberIdleReports: defaultMemberIdleReports,
+	}
+
+	c.descs[seriesConnections] = prometheus.NewDesc(networkSeriesNames[seriesConnections],
+		"Total number of network connections", []string{"protocol", "direction", "host", "interface"}, nil)
+	c.descs[seriesBytesSent] = prometheus.NewDesc(networkSeriesNames[seriesBytesSent],
+		"Total bytes sent over network", []string{"protocol", "destination", "host", "interface"}, nil)
+	c.descs[seriesBytesRecv] = prometheus.NewDesc(networkSeriesNames[seriesBytesRecv],
+		"Total bytes received over network", []string{"protocol", "source", "host", "interface"}, nil)
+	c.descs[seriesPacketsSent] = prometheus.NewDesc(networkSeriesNames[seriesPacketsSent],
+		"Total packets sent over network", []string{"protocol", "destination", "host", "interface"}, nil)
+	c.descs[seriesPacketsRecv] = prometheus.NewDesc(networkSeriesNames[seriesPacketsRecv],
+		"Total packets received over network", []string{"protocol", "source", "host", "interface"}, nil)
+	c.descs[seriesDomainsAccessed] = prometheus.NewDesc(networkSeriesNames[seriesDomainsAccessed],
+		"Total number of domains accessed", []string{"domain", "host", "interface"}, nil)
+	c.descs[seriesIPsAccessed] = prometheus.NewDesc(networkSeriesNames[seriesIPsAccessed],
+		"Total number of IP addresses accessed", []string{"ip", "host", "interface"}, nil)
+	c.descs[seriesDomainBytesSent] = prometheus.NewDesc(networkSeriesNames[seriesDomainBytesSent],
+		"Total bytes sent to each domain", []string{"domain", "host", "interface"}, nil)
+	c.descs[seriesDomainBytesRecv] = prometheus.NewDesc(networkSeriesNames[seriesDomainBytesRecv],
+		"Total bytes received from each domain", []string{"domain", "host", "interface"}, nil)
+	c.descs[seriesDomainConnections] = prometheus.NewDesc(networkSeriesNames[seriesDomainConnections],
+		"Total connections to each domain", []string{"domain", "host", "interface"}, nil)
+	c.descs[seriesProtocolStats] = prometheus.NewDesc(networkSeriesNames[seriesProtocolStats],
+		"Network protocol statistics", []string{"protocol", "host", "interface"}, nil)
+	c.collapsedDesc = prometheus.NewDesc("server_cardinality_collapsed_label_values",
+		"Number of label values collapsed into the other bucket by the cardinality limit", []string{"metric"}, nil)
+
+	return c
+}
+
+// SetCardinality 设置标签基数限制，应在收到数据之前调用
+func (c *NetworkCollector) SetCardinality(cfg config.CardinalityConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.limits = cardinality.NewSet(cfg, networkSeriesNames[seriesDomainsAccessed:]...)
+}
+
+// Describe 实现prometheus.Collector
+func (c *NetworkCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+	ch <- c.collapsedDesc
+}
+
+// Collect 实现prometheus.Collector，相同标签的序列为各Agent计数之和
+func (c *NetworkCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	totals := make(map[seriesKey]float64, len(c.retired))
+	for key, value := range c.retired {
+		totals[key] = value
+	}
+	var collapsed [seriesCount]int
+	for _, agent := range c.agents {
+		for key, value := range agent.values {
+			totals[key] += value
+		}
+		for key, value := range agent.retired {
+			totals[key] += value
+		}
+		for series, members := range agent.members {
+			for _, member := range members {
+				if !member.kept {
+					collapsed[series]++
+				}
+			}
+		}
+	}
+	limits := c.limits
+	c.mu.RUnlock()
+
+	for key, value := range totals {
+		n := labelCount(key.series)
+		ch <- prometheus.MustNewConstMetric(c.descs[key.series], prometheus.CounterValue, value, key.labels[:n]...)
+	}
+	for series, name := range networkSeriesNames {
+		if limits.For(name) != nil {
+			ch <- prometheus.MustNewConstMetric(c.collapsedDesc, prometheus.GaugeValue, float64(collapsed[series]), name)
+		}
+	}
+}
+
+// labelCount 序列的标签数量
+func labelCount(series networkSeries) int {
+	if series <= seriesPacketsRecv {
+		return 4
+	}
+	return 3
+}
+
+// observe 更新Agent的计数：cumulative为启动以来的累计值，delta为自上次上报以来的增量
+// startupTime为零时无法识别重启，累计值变小的序列直接表现为计数器重置
+func (c *NetworkCollector) observe(agentID string, startupTime time.Time, cumulative, delta map[seriesKey]float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	agent, exists := c.agents[agentID]
+	if !exists {
+		agent = &agentCounters{
+			values:  make(map[seriesKey]float64),
+			retired: make(map[seriesKey]float64),
+			members: make(map[networkSeries]map[string]*labelMember),
+			hidden:  make(map[seriesKey]float64),
+			folded:  make(map[seriesKey]float64),
+		}
+		c.agents[agentID] = agent
+	}
+
+	if !startupTime.IsZero() {
+		if !agent.startupTime.IsZero() && !startupTime.Equal(agent.startupTime) {
+			// Agent重启，本次启动的计数从零开始，之前的计数保留在retired中
+			for key, value := range agent.values {
+				agent.retired[key] += value
+			}
+			agent.values = make(map[seriesKey]float64)
+			agent.hidden = make(map[seriesKey]float64)
+			agent.folded = make(map[seriesKey]float64)
+			agent.members = make(map[networkSeries]map[string]*labelMember)
+			agent.reports = 0
+		}
+		agent.startupTime = startupTime
+	}
+
+	agent.reports++
+	c.classify(agent, cumulative)
+	c.classify(agent, delta)
+	agent.touch(cumulative)
+	agent.touch(delta)
+
+	others := make(map[seriesKey]bool)
+	for key, value := range cumulative {
+		if c.collapsed(agent, key) {
+			agent.hidden[key] = value
+			others[otherKey(key)] = true
+			continue
+		}
+		agent.values[key] = value
+	}
+	for key := range others {
+		agent.values[key] = agent.folded[key]
+	}
+	for key, value := range agent.hidden {
+		if other := otherKey(key); others[other] {
+			agent.values[other] += value
+		}
+	}
+
+	for key, value := range delta {
+		if value <= 0 {
+			continue
+		}
+		if c.collapsed(agent, key) {
+			key = otherKey(key)
+		}
+		agent.values[key] += value
+	}
+
+	agent.expireMembers(c.memberIdleReports)
+}
+
+// touch 记录本次上报中出现的受限标签值
+func (agent *agentCounters) touch(values map[seriesKey]float64) {
+	for key := range values {
+		if member := agent.members[key.series][key.labels[0]]; member != nil {
+			member.lastSeen = agent.reports
+		}
+	}
+}
+
+// expireMembers 淘汰连续idle次上报缺席的标签值，已输出的计数保持不变：
+// 独立序列的计数转入retired，汇总标签值的累计值合并到folded，other不会回退
+func (agent *agentCounters) expireMembers(idle uint64) {
+	if idle == 0 || agent.reports <= idle {
+		return
+	}
+
+	expired := make(map[networkSeries]map[string]bool)
+	for series, members := range agent.members {
+		for label, member := range members {
+			if agent.reports-member.lastSeen >= idle {
+				if expired[series] == nil {
+					expired[series] = make(map[string]bool)
+				}
+				expired[series][label] = true
+				delete(members, label)
+			}
+		}
+		if len(members) == 0 {
+			delete(agent.members, series)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	for key, value := range agent.values {
+		if expired[key.series][key.labels[0]] {
+			agent.retired[key] += value
+			delete(agent.values, key)
+		}
+	}
+	for key, value := range agent.hidden {
+		if expired[key.series][key.labels[0]] {
+			agent.folded[otherKey(key)] += value
+			delete(agent.hidden, key)
+		}
+	}
+}
+
+// classify 为Agent首次出现（或淘汰后再次出现）的受限标签值（域名、IP、协议）确定归属
+// 按本次流量从大到小向各Agent共享的限制器申请名额，申请不到的在淘汰之前一直汇总到other；
+// 同一序列中来自不同主机、网卡的相同标签值只占用一个名额，按这些值的总和排名
+func (c *NetworkCollector) classify(agent *agentCounters, values map[seriesKey]float64) {
+	if c.limits == nil || len(values) == 0 {
+		return
+	}
+
+	weights := make(map[networkSeries]map[string]float64)
+	for key, value := range values {
+		label := key.labels[0]
+		if label == cardinality.Other || c.limits.For(networkSeriesNames[key.series]) == nil {
+			continue
+		}
+		if _, known := agent.members[key.series][label]; known {
+			continue
+		}
+		if weights[key.series] == nil {
+			weights[key.series] = make(map[string]float64)
+		}
+		weights[key.series][label] += value
+	}
+
+	for series, seriesWeights := range weights {
+		collapsed := c.limits.For(networkSeriesNames[series]).Collapse(seriesWeights)
+		if agent.members[series] == nil {
+			agent.members[series] = make(map[string]*labelMember)
+		}
+		for label := range seriesWeights {
+			agent.members[series][label] = &labelMember{kept: !collapsed[label], lastSeen: agent.reports}
+		}
+	}
+}
+
+// collapsed 序列是否计入other：受限序列中被汇总的标签值，以及Agent自己上报的other
+func (c *NetworkCollector) collapsed(agent *agentCounters, key seriesKey) bool {
+	if c.limits.For(networkSeriesNames[key.series]) == nil {
+		return false
+	}
+	label := key.labels[0]
+	if label == cardinality.Other {
+		return true
+	}
+	member := agent.members[key.series][label]
+	return member == nil || !member.kept
+}
+
+// otherKey 序列对应的other序列（主机和网卡标签不变）
+func otherKey(key seriesKey) seriesKey {
+	key.labels[0] = cardinality.Other
+	return key
+}
+
+// ObserveNetworkMetrics 记录Agent上报的NetworkMetrics（Agent启动以来的累计值）
+func (c *NetworkCollector) ObserveNetworkMetrics(agentID string, startupTime time.Time, metrics common.NetworkMetrics) {
+	host, iface := metrics.Hostname, metrics.Interface
+	if iface == "" {
+		iface = "unknown"
+	}
+
+	values := map[seriesKey]float64{
+		{seriesConnections, [4]string{"total", "all", host, iface}}: float64(metrics.TotalConnections),
+		{seriesBytesSent, [4]string{"total", "all", host, iface}}:   float64(metrics.TotalBytesSent),
+		{seriesBytesRecv, [4]string{"total", "all", host, iface}}:   float64(metrics.TotalBytesRecv),
+		{seriesPacketsSent, [4]string{"total", "all", host, iface}}: float64(metrics.TotalPacketsSent),
+		{seriesPacketsRecv, [4]string{"total", "all", host, iface}}: float64(metrics.TotalPacketsRecv),
+	}
+	for domain, count := range metrics.DomainsAccessed {
+		values[seriesKey{seriesDomainsAccessed, [4]string{domain, host, iface}}] = float64(count)
+	}
+	for domain, stats := range metrics.DomainTraffic {
+		if stats == nil {
+			continue
+		}
+		values[seriesKey{seriesDomainBytesSent, [4]string{domain, host, iface}}] = float64(stats.BytesSent)
+		values[seriesKey{seriesDomainBytesRecv, [4]string{domain, host, iface}}] = float64(stats.BytesReceived)
+		values[seriesKey{seriesDomainConnections, [4]string{domain, host, iface}}] = float64(stats.Connections)
+	}
+	for ip, count := range metrics.IPsAccessed {
+		values[seriesKey{seriesIPsAccessed, [4]string{ip, host, iface}}] = float64(count)
+	}
+	for protocol, count := range metrics.ProtocolStats {
+		values[seriesKey{seriesProtocolStats, [4]string{protocol, host, iface}}] = float64(count)
+	}
+
+	c.observe(agentID, startupTime, values, nil)
+}
+
+// ObserveReport 记录MetricsReport：系统总计为累计值，域名统计按report_mode作为增量或累计值
+func (c *NetworkCollector) ObserveReport(report common.MetricsReport) {
+	host, iface := report.SystemInfo.Hostname, report.SystemInfo.Interface
+	if iface == "" {
+		iface = "unknown"
+	}
+
+	cumulative := map[seriesKey]float64{
+		{seriesConnections, [4]string{"total", "all", host, iface}}: float64(report.SystemInfo.TotalConnections),
+		{seriesBytesSent, [4]string{"total", "all", host, iface}}:   float64(report.SystemInfo.TotalBytesSent),
+		{seriesBytesRecv, [4]string{"total", "all", host, iface}}:   float64(report.SystemInfo.TotalBytesReceived),
+	}
+
+	domains := cumulative
+	stats := report.TotalStats
+	var delta map[seriesKey]float64
+	if report.ReportMode == common.ReportModeIncremental {
+		delta = make(map[seriesKey]float64)
+		domains = delta
+		stats = report.DeltaStats
+	}
+	for domain, m := range stats {
+		domains[seriesKey{seriesDomainsAccessed, [4]string{domain, host, iface}}] = float64(m.AccessCount)
+		domains[seriesKey{seriesDomainBytesSent, [4]string{domain, host, iface}}] = float64(m.BytesSent)
+		domains[seriesKey{seriesDomainBytesRecv, [4]string{domain, host, iface}}] = float64(m.BytesReceived)
+		domains[seriesKey{seriesDomainConnections, [4]string{domain, host, iface}}] = float64(m.ConnectionCount)
+	}
+
+	c.observe(report.AgentID, report.StartupTime, cumulative, delta)
+}
+
+// RemoveAgent 删除Agent的全部计数，该Agent单独贡献的序列从下一次抓取起消失；
+// 与其他Agent汇总的序列保留它的最终计数，总和不回退
+func (c *NetworkCollector) RemoveAgent(agentID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	agent, exists := c.agents[agentID]
+	if !exists {
+		return false
+	}
+	delete(c.agents, agentID)
+
+	for _, values := range []map[seriesKey]float64{agent.values, agent.retired} {
+		for key, value := range values {
+			c.retired[key] += value
+		}
+	}
+	// 没有其他Agent贡献的序列随该Agent一起消失
+	live := make(map[seriesKey]bool)
+	for _, other := range c.agents {
+		for key := range other.values {
+			live[key] = true
+		}
+		for key := range other.retired {
+			live[key] = true
+		}
+	}
+	for key := range c.retired {
+		if !live[key] {
+			delete(c.retired, key)
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/cardinality"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNetworkCollectorStickyTopK(t *testing.T) {
+	c := NewNetworkCollector()
+	c.SetCardinality(config.CardinalityConfig{Enabled: true, DefaultLimit: 1})
+
+	startup := time.Now().Add(-time.Hour)
+	observe := func(accessed map[string]uint64) {
+		c.ObserveNetworkMetrics("agent-a", startup, common.NetworkMetrics{
+			Hostname:        "host-a",
+			Interface:       "eth0",
+			DomainsAccessed: accessed,
+		})
+	}
+	value := func(domain string) (float64, bool) {
+		key := seriesKey{seriesDomainsAccessed, [4]string{domain, "host-a", "eth0"}}
+		v, ok := c.agents["agent-a"].values[key]
+		return v, ok
+	}
+
+	steps := []struct {
+		accessed map[string]uint64
+		kept     float64
+		other    float64
+	}{
+		{map[string]uint64{"a.com": 10, "b.com": 5}, 10, 5},
+		// b.com缺席、c.com流量超过a.com：a.com保持独立序列，other保留b.com的值
+		{map[string]uint64{"a.com": 20, "c.com": 100}, 20, 105},
+		{map[string]uint64{"a.com": 21, "b.com": 6, "c.com": 101}, 21, 107},
+	}
+	for i, step := range steps {
+		observe(step.accessed)
+		if got, _ := value("a.com"); got != step.kept {
+			t.Fatalf("step %d: a.com = %v, want %v", i, got, step.kept)
+		}
+		if got, _ := value(cardinality.Other); got != step.other {
+			t.Fatalf("step %d: other = %v, want %v", i, got, step.other)
+		}
+		for _, domain := range []string{"b.com", "c.com"} {
+			if _, ok := value(domain); ok {
+				t.Fatalf("step %d: collapsed domain %s has its own series", i, domain)
+			}
+		}
+	}
+}
+
+// collectCounters 抓取一次，返回 "指标名{标签值,...}" -> 值
+func collectCounters(c *NetworkCollector) map[string]float64 {
+	ch := make(chan prometheus.Metric, 256)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	result := make(map[string]float64)
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil || m.Counter == nil {
+			continue
+		}
+		labels := make([]string, 0, len(m.Label))
+		for _, label := range m.Label {
+			labels = append(labels, label.GetName()+"="+label.GetValue())
+		}
+		for series, desc := range c.descs {
+			if desc == metric.Desc() {
+				result[networkSeriesNames[series]+"{"+strings.Join(labels, ",")+"}"] = m.Counter.GetValue()
+			}
+		}
+	}
+	return result
+}
+
+func TestNetworkCollectorSumSurvivesRestartAndRemoval(t *testing.T) {
+	c := NewNetworkCollector()
+	const bytesSent = "network_bytes_sent_total{destination=all,host=shared,interface=eth0,protocol=total}"
+	const onlyB = "network_domains_accessed_total{domain=b.com,host=shared,interface=eth0}"
+
+	firstRun := time.Now().Add(-time.Hour)
+	observe := func(agentID string, startup time.Time, sent uint64, domains map[string]uint64) {
+		c.ObserveNetworkMetrics(agentID, startup, common.NetworkMetrics{
+			Hostname:        "shared",
+			Interface:       "eth0",
+			TotalBytesSent:  sent,
+			DomainsAccessed: domains,
+		})
+	}
+
+	// 同一主机上的两个Agent汇总到同一序列
+	observe("agent-a", firstRun, 100, nil)
+	observe("agent-b", firstRun, 50, map[string]uint64{"b.com": 3})
+	if got := collectCounters(c)[bytesSent]; got != 150 {
+		t.Fatalf("sum = %v, want 150", got)
+	}
+
+	// agent-a重启后计数从零开始，总和保留重启前的计数
+	observe("agent-a", firstRun.Add(30*time.Minute), 10, nil)
+	if got := collectCounters(c)[bytesSent]; got != 160 {
+		t.Fatalf("sum after restart = %v, want 160", got)
+	}
+
+	// agent-b过期被删除：共享序列保留它的最终计数，只有它贡献的序列消失
+	if !c.RemoveAgent("agent-b") {
+		t.Fatal("agent-b not removed")
+	}
+	counters := collectCounters(c)
+	if got := counters[bytesSent]; got != 160 {
+		t.Fatalf("sum after removal = %v, want 160", got)
+	}
+	if _, ok := counters[onlyB]; ok {
+		t.Fatal("series contributed only by the removed agent still exported")
+	}
+
+	observe("agent-a", firstRun.Add(30*time.Minute), 15, nil)
+	if got := collectCounters(c)[bytesSent]; got != 165 {
+		t.Fatalf("sum after further reports = %v, want 165", got)
+	}
+
+	// 最后一个Agent删除后序列全部消失
+	c.RemoveAgent("agent-a")
+	if counters := collectCounters(c); len(counters) != 0 || len(c.retired) != 0 {
+		t.Fatalf("series left after all agents removed: %v", counters)
+	}
+}
+
+func TestNetworkCollectorMembershipTurnover(t *testing.T) {
+	c := NewNetworkCollector()
+	c.SetCardinality(config.CardinalityConfig{Enabled: true, DefaultLimit: 1})
+	c.memberIdleReports = 2
+
+	firstRun := time.Now().Add(-time.Hour)
+	observe := func(startup time.Time, accessed map[string]uint64) map[string]float64 {
+		c.ObserveNetworkMetrics("agent-a", startup, common.NetworkMetrics{
+			Hostname:        "host-a",
+			Interface:       "eth0",
+			DomainsAccessed: accessed,
+		})
+		return collectCounters(c)
+	}
+	series := func(domain string) string {
+		return "network_domains_accessed_total{domain=" + domain + ",host=host-a,interface=eth0}"
+	}
+	members := func() []string {
+		var labels []string
+		for label := range c.agents["agent-a"].members[seriesDomainsAccessed] {
+			labels = append(labels, label)
+		}
+		return labels
+	}
+
+	steps := []struct {
+		accessed map[string]uint64
+		kept     float64 // a.com的导出值
+		other    float64
+		members  int
+	}{
+		{map[string]uint64{"a.com": 10, "b.com": 5}, 10, 5, 2},
+		{map[string]uint64{"c.com": 1}, 10, 6, 3},
+		// a.com和b.com连续两次缺席被淘汰：a.com的计数转入retired，b.com的值并入other，导出值都不回退
+		{map[string]uint64{"c.com": 2}, 10, 7, 1},
+		{map[string]uint64{"c.com": 3}, 10, 8, 1},
+		// a.com再次出现，按新的计数叠加在淘汰前的计数上
+		{map[string]uint64{"a.com": 4}, 14, 8, 2},
+	}
+	for i, step := range steps {
+		counters := observe(firstRun, step.accessed)
+		if got := counters[series("a.com")]; got != step.kept {
+			t.Fatalf("step %d: a.com = %v, want %v", i, got, step.kept)
+		}
+		if got := counters[series(cardinality.Other)]; got != step.other {
+			t.Fatalf("step %d: other = %v, want %v", i, got, step.other)
+		}
+		if got := members(); len(got) != step.members {
+			t.Fatalf("step %d: members = %v, want %d entries", i, got, step.members)
+		}
+	}
+
+	// Agent重启后归属重新确定，之前的标签值不再占用成员记录
+	counters := observe(firstRun.Add(30*time.Minute), map[string]uint64{"d.com": 1})
+	if got := members(); len(got) != 1 || got[0] != "d.com" {
+		t.Fatalf("members after restart = %v, want [d.com]", got)
+	}
+	if counters[series("a.com")] != 14 || counters[series(cardinality.Other)] != 9 {
+		t.Fatalf("counters went backwards after restart: a.com=%v other=%v", counters[series("a.com")], counters[series(cardinality.Other)])
+	}
+}
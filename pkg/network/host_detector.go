@@ -18,13 +18,13 @@ type HostDetector struct {
 
 // HostInfo 主机信息
 type HostInfo struct {
-	HostIP        string    `json:"host_ip"`         // 主机IP地址
-	Gateway       string    `json:"gateway"`         // 网关地址
-	IsContainer   bool      `json:"is_container"`    // 是否在容器中
-	IsVM          bool      `json:"is_vm"`           // 是否在虚拟机中
-	ContainerType string    `json:"container_type"`  // 容器类型 (docker, podman, etc.)
-	VMType        string    `json:"vm_type"`         // 虚拟机类型 (kvm, vmware, etc.)
-	DetectedAt    time.Time `json:"detected_at"`     // 检测时间
+	HostIP        string    `json:"host_ip"`        // 主机IP地址
+	Gateway       string    `json:"gateway"`        // 网关地址
+	IsContainer   bool      `json:"is_container"`   // 是否在容器中
+	IsVM          bool      `json:"is_vm"`          // 是否在虚拟机中
+	ContainerType string    `json:"container_type"` // 容器类型 (docker, podman, etc.)
+	VMType        string    `json:"vm_type"`        // 虚拟机类型 (kvm, vmware, etc.)
+	DetectedAt    time.Time `json:"detected_at"`    // 检测时间
 }
 
 // NewHostDetector 创建主机检测器
@@ -0,0 +1,282 @@
+package otlp
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go-net-monitoring/internal/common"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// scopeName 导出数据的InstrumentationScope名称
+const scopeName = "go-net-monitoring"
+
+// Record 一次上报的数据
+type Record struct {
+	AgentID   string
+	Hostname  string
+	StartTime time.Time // 计数的起始时间（Agent启动时间），零值表示未知
+	Metrics   *common.NetworkMetrics
+}
+
+// Batch 转换后的OTLP数据
+type Batch struct {
+	Metrics []*metricspb.ResourceMetrics
+	Logs    []*logspb.ResourceLogs
+}
+
+// Converter 将上报数据转换为OTLP数据
+// 网络计数转换为单调递增的累计Sum，NetworkEvent转换为日志；资源属性包含主机、网卡和Agent ID
+type Converter struct {
+	ServiceName string            // service.name，Attributes中配置时以配置为准
+	Version     string            // InstrumentationScope版本
+	Attributes  map[string]string // 附加的资源属性，不覆盖host.name等来自数据的属性
+}
+
+// resourceGroup 同一资源（Agent + 网卡）的数据
+type resourceGroup struct {
+	resource *resourcepb.Resource
+	metrics  []*metricspb.Metric
+	byName   map[string]*metricspb.Metric
+	logs     []*logspb.LogRecord
+}
+
+// Convert 转换一批上报数据，相同资源的数据合并到一起
+func (c *Converter) Convert(records []Record) Batch {
+	groups := make(map[string]*resourceGroup)
+	var order []*resourceGroup
+
+	for i := range records {
+		record := &records[i]
+		if record.Metrics == nil {
+			continue
+		}
+
+		host := record.Metrics.Hostname
+		if host == "" {
+			host = record.Hostname
+		}
+		iface := record.Metrics.Interface
+		if iface == "" {
+			iface = "unknown"
+		}
+
+		key := record.AgentID + "\x00" + host + "\x00" + iface
+		group, ok := groups[key]
+		if !ok {
+			group = &resourceGroup{
+				resource: c.resource(record.AgentID, host, iface),
+				byName:   make(map[string]*metricspb.Metric),
+			}
+			groups[key] = group
+			order = append(order, group)
+		}
+
+		group.addMetrics(record)
+		for j := range record.Metrics.Events {
+			group.logs = append(group.logs, eventToLog(&record.Metrics.Events[j]))
+		}
+	}
+
+	scope := &commonpb.InstrumentationScope{Name: scopeName, Version: c.Version}
+	var batch Batch
+	for _, group := range order {
+		if len(group.metrics) > 0 {
+			batch.Metrics = append(batch.Metrics, &metricspb.ResourceMetrics{
+				Resource:     group.resource,
+				ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: scope, Metrics: group.metrics}},
+			})
+		}
+		if len(group.logs) > 0 {
+			batch.Logs = append(batch.Logs, &logspb.ResourceLogs{
+				Resource:  group.resource,
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: scope, LogRecords: group.logs}},
+			})
+		}
+	}
+	return batch
+}
+
+// resource 构建资源属性
+func (c *Converter) resource(agentID, host, iface string) *resourcepb.Resource {
+	attrs := make(map[string]string, len(c.Attributes)+5)
+	if c.ServiceName != "" {
+		attrs["service.name"] = c.ServiceName
+	}
+	for k, v := range c.Attributes {
+		attrs[k] = v
+	}
+	attrs["host.name"] = host
+	attrs["network.interface.name"] = iface
+	if agentID != "" {
+		attrs["netmon.agent.id"] = agentID
+		attrs["service.instance.id"] = agentID
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	resource := &resourcepb.Resource{Attributes: make([]*commonpb.KeyValue, 0, len(keys))}
+	for _, k := range keys {
+		resource.Attributes = append(resource.Attributes, stringAttr(k, attrs[k]))
+	}
+	return resource
+}
+
+// addMetrics 添加一次上报的计数
+func (g *resourceGroup) addMetrics(record *Record) {
+	m := record.Metrics
+	timestamp := m.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	now := uint64(timestamp.UnixNano())
+	var start uint64
+	if !record.StartTime.IsZero() && record.StartTime.Before(timestamp) {
+		start = uint64(record.StartTime.UnixNano())
+	}
+
+	add := func(name, unit, desc string, value uint64, attrs ...*commonpb.KeyValue) {
+		metric, ok := g.byName[name]
+		if !ok {
+			metric = &metricspb.Metric{
+				Name:        name,
+				Unit:        unit,
+				Description: desc,
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+				}},
+			}
+			g.byName[name] = metric
+			g.metrics = append(g.metrics, metric)
+		}
+		sum := metric.GetSum()
+		sum.DataPoints = append(sum.DataPoints, &metricspb.NumberDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			Value:             &metricspb.NumberDataPoint_AsInt{AsInt: int64(value)},
+		})
+	}
+
+	const (
+		ioDesc      = "Bytes transferred over the network"
+		packetsDesc = "Packets transferred over the network"
+	)
+	add("netmon.network.io", "By", ioDesc, m.TotalBytesSent, stringAttr("network.io.direction", "transmit"))
+	add("netmon.network.io", "By", ioDesc, m.TotalBytesRecv, stringAttr("network.io.direction", "receive"))
+	add("netmon.network.packets", "{packet}", packetsDesc, m.TotalPacketsSent, stringAttr("network.io.direction", "transmit"))
+	add("netmon.network.packets", "{packet}", packetsDesc, m.TotalPacketsRecv, stringAttr("network.io.direction", "receive"))
+	add("netmon.network.connections", "{connection}", "Network connections observed", m.TotalConnections)
+
+	for _, domain := range sortedKeys(m.DomainsAccessed) {
+		add("netmon.domain.accesses", "{access}", "Accesses to each domain", m.DomainsAccessed[domain],
+			stringAttr("netmon.domain", domain))
+	}
+	for _, domain := range sortedKeys(m.DomainTraffic) {
+		stats := m.DomainTraffic[domain]
+		if stats == nil {
+			continue
+		}
+		add("netmon.domain.io", "By", "Bytes transferred with each domain", stats.BytesSent,
+			stringAttr("netmon.domain", domain), stringAttr("network.io.direction", "transmit"))
+		add("netmon.domain.io", "By", "Bytes transferred with each domain", stats.BytesReceived,
+			stringAttr("netmon.domain", domain), stringAttr("network.io.direction", "receive"))
+		add("netmon.domain.connections", "{connection}", "Connections to each domain", stats.Connections,
+			stringAttr("netmon.domain", domain))
+	}
+	for _, ip := range sortedKeys(m.IPsAccessed) {
+		add("netmon.ip.accesses", "{access}", "Accesses to each IP address", m.IPsAccessed[ip],
+			stringAttr("network.peer.address", ip))
+	}
+	for _, protocol := range sortedKeys(m.ProtocolStats) {
+		add("netmon.protocol.packets", "{packet}", "Packets per transport protocol", m.ProtocolStats[protocol],
+			stringAttr("network.transport", protocol))
+	}
+	for _, port := range sortedKeys(m.PortStats) {
+		add("netmon.port.connections", "{connection}", "Connections per port", m.PortStats[port],
+			intAttr("network.peer.port", int64(port)))
+	}
+}
+
+// eventToLog 将网络事件转换为日志
+func eventToLog(event *common.NetworkEvent) *logspb.LogRecord {
+	body := fmt.Sprintf("%s %s %s:%d -> %s:%d", event.Protocol, event.Direction,
+		event.SourceIP, event.SourcePort, event.DestIP, event.DestPort)
+	if event.Domain != "" {
+		body += " (" + event.Domain + ")"
+	}
+
+	attrs := []*commonpb.KeyValue{
+		stringAttr("network.transport", event.Protocol),
+		stringAttr("netmon.direction", event.Direction),
+		stringAttr("source.address", event.SourceIP),
+		intAttr("source.port", int64(event.SourcePort)),
+		stringAttr("destination.address", event.DestIP),
+		intAttr("destination.port", int64(event.DestPort)),
+		intAttr("netmon.bytes_sent", int64(event.BytesSent)),
+		intAttr("netmon.bytes_received", int64(event.BytesRecv)),
+		intAttr("netmon.packets_sent", int64(event.PacketsSent)),
+		intAttr("netmon.packets_received", int64(event.PacketsRecv)),
+		intAttr("netmon.duration_ms", event.Duration.Milliseconds()),
+	}
+	if event.Domain != "" {
+		attrs = append(attrs, stringAttr("netmon.domain", event.Domain))
+	}
+	if event.Interface != "" {
+		attrs = append(attrs, stringAttr("network.interface.name", event.Interface))
+	}
+	if event.Status != "" {
+		attrs = append(attrs, stringAttr("netmon.status", event.Status))
+	}
+	if event.ProcessName != "" {
+		attrs = append(attrs, stringAttr("process.executable.name", event.ProcessName))
+	}
+	if event.ProcessPID != 0 {
+		attrs = append(attrs, intAttr("process.pid", int64(event.ProcessPID)))
+	}
+
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return &logspb.LogRecord{
+		TimeUnixNano:         uint64(timestamp.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+		SeverityText:         "INFO",
+		EventName:            "netmon.network.event",
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}},
+		Attributes:           attrs,
+	}
+}
+
+// stringAttr 字符串属性
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// intAttr 整数属性
+func intAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}}
+}
+
+// sortedKeys 按顺序返回map的键，使同一批数据的输出稳定
+func sortedKeys[K string | int, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
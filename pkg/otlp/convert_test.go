@@ -0,0 +1,176 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// attrValue 查找字符串属性的值
+func attrValue(attrs []*commonpb.KeyValue, key string) (string, bool) {
+	for _, kv := range attrs {
+		if kv.GetKey() == key {
+			return kv.GetValue().GetStringValue(), true
+		}
+	}
+	return "", false
+}
+
+func findMetric(rm *metricspb.ResourceMetrics, name string) *metricspb.Metric {
+	for _, sm := range rm.GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			if m.GetName() == name {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+func resourceAttr(resource *resourcepb.Resource, key string) string {
+	value, _ := attrValue(resource.GetAttributes(), key)
+	return value
+}
+
+func testRecords() []Record {
+	start := time.Unix(1700000000, 0)
+	return []Record{
+		{
+			AgentID:   "agent-1",
+			Hostname:  "host-1",
+			StartTime: start,
+			Metrics: &common.NetworkMetrics{
+				Timestamp:        start.Add(time.Minute),
+				Interface:        "eth0",
+				TotalConnections: 10,
+				TotalBytesSent:   100,
+				TotalBytesRecv:   200,
+				DomainsAccessed:  map[string]uint64{"a.com": 3, "b.com": 1},
+				PortStats:        map[int]uint64{443: 7},
+				Events: []common.NetworkEvent{{
+					Timestamp: start.Add(30 * time.Second),
+					Protocol:  "tcp",
+					Direction: "outbound",
+					SourceIP:  "10.0.0.2",
+					DestIP:    "1.1.1.1",
+					DestPort:  443,
+					Domain:    "a.com",
+				}},
+			},
+		},
+		{
+			AgentID:   "agent-1",
+			Hostname:  "host-1",
+			StartTime: start,
+			Metrics: &common.NetworkMetrics{
+				Timestamp:        start.Add(2 * time.Minute),
+				Interface:        "eth0",
+				TotalConnections: 15,
+			},
+		},
+		{
+			AgentID:   "agent-1",
+			Hostname:  "host-1",
+			StartTime: start,
+			Metrics: &common.NetworkMetrics{
+				Timestamp: start.Add(2 * time.Minute),
+				Interface: "eth1",
+			},
+		},
+		{AgentID: "agent-1"}, // 没有指标的记录被跳过
+	}
+}
+
+func TestConvertGroupsByResource(t *testing.T) {
+	c := &Converter{
+		ServiceName: "netmon-agent",
+		Version:     "1.0.0",
+		Attributes:  map[string]string{"deployment.environment": "prod", "host.name": "overridden"},
+	}
+	batch := c.Convert(testRecords())
+
+	if len(batch.Metrics) != 2 {
+		t.Fatalf("got %d resources, want 2 (eth0 and eth1)", len(batch.Metrics))
+	}
+	resource := batch.Metrics[0].GetResource()
+	for key, want := range map[string]string{
+		"service.name":           "netmon-agent",
+		"service.instance.id":    "agent-1",
+		"netmon.agent.id":        "agent-1",
+		"host.name":              "host-1",
+		"network.interface.name": "eth0",
+		"deployment.environment": "prod",
+	} {
+		if got := resourceAttr(resource, key); got != want {
+			t.Errorf("resource attribute %s = %q, want %q", key, got, want)
+		}
+	}
+
+	conns := findMetric(batch.Metrics[0], "netmon.network.connections")
+	if conns == nil {
+		t.Fatal("netmon.network.connections not found")
+	}
+	sum := conns.GetSum()
+	if !sum.GetIsMonotonic() || sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("connections is not a monotonic cumulative sum: %+v", sum)
+	}
+	points := sum.GetDataPoints()
+	if len(points) != 2 || points[0].GetAsInt() != 10 || points[1].GetAsInt() != 15 {
+		t.Fatalf("connection data points = %v, want 10 then 15", points)
+	}
+	start := uint64(time.Unix(1700000000, 0).UnixNano())
+	if points[0].GetStartTimeUnixNano() != start || points[1].GetTimeUnixNano() <= points[0].GetTimeUnixNano() {
+		t.Errorf("unexpected data point times: %v", points)
+	}
+
+	io := findMetric(batch.Metrics[0], "netmon.network.io")
+	if n := len(io.GetSum().GetDataPoints()); n != 4 {
+		t.Errorf("netmon.network.io has %d data points, want 4 (transmit and receive per record)", n)
+	}
+	if direction, _ := attrValue(io.GetSum().GetDataPoints()[0].GetAttributes(), "network.io.direction"); direction != "transmit" {
+		t.Errorf("first io data point direction = %q, want transmit", direction)
+	}
+
+	accesses := findMetric(batch.Metrics[0], "netmon.domain.accesses").GetSum().GetDataPoints()
+	if len(accesses) != 2 {
+		t.Fatalf("got %d domain access points, want 2", len(accesses))
+	}
+	if domain, _ := attrValue(accesses[0].GetAttributes(), "netmon.domain"); domain != "a.com" {
+		t.Errorf("domains are not sorted: first is %q", domain)
+	}
+
+	port := findMetric(batch.Metrics[0], "netmon.port.connections").GetSum().GetDataPoints()[0]
+	if got := port.GetAttributes()[0].GetValue().GetIntValue(); got != 443 {
+		t.Errorf("network.peer.port = %d, want 443", got)
+	}
+}
+
+func TestConvertEventsToLogs(t *testing.T) {
+	batch := (&Converter{}).Convert(testRecords())
+
+	if len(batch.Logs) != 1 {
+		t.Fatalf("got %d log resources, want 1", len(batch.Logs))
+	}
+	records := batch.Logs[0].GetScopeLogs()[0].GetLogRecords()
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want 1", len(records))
+	}
+	record := records[0]
+	if got, want := record.GetBody().GetStringValue(), "tcp outbound 10.0.0.2:0 -> 1.1.1.1:443 (a.com)"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if record.GetEventName() != "netmon.network.event" {
+		t.Errorf("event name = %q", record.GetEventName())
+	}
+	if domain, ok := attrValue(record.GetAttributes(), "netmon.domain"); !ok || domain != "a.com" {
+		t.Errorf("netmon.domain = %q, %v", domain, ok)
+	}
+	if got := record.GetTimeUnixNano(); got != uint64(time.Unix(1700000030, 0).UnixNano()) {
+		t.Errorf("log time = %d, want the event timestamp", got)
+	}
+}
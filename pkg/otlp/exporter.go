@@ -0,0 +1,271 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/sirupsen/logrus"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Options 导出器配置
+type Options struct {
+	Protocol    string            // http 或 grpc
+	Endpoint    string            // http为基础URL，grpc为 host:port
+	Insecure    bool              // grpc不使用TLS
+	Compression string            // none 或 gzip
+	Headers     map[string]string // 附加的请求头（gRPC为metadata）
+	UserAgent   string
+}
+
+// PermanentError 不可重试的导出错误（如数据被Collector拒绝）
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// IsPermanent 是否为不可重试的错误
+func IsPermanent(err error) bool {
+	var perr *PermanentError
+	return errors.As(err, &perr)
+}
+
+// Exporter OTLP导出器，支持OTLP/HTTP（protobuf）和OTLP/gRPC
+type Exporter struct {
+	opts   Options
+	logger *logrus.Logger
+
+	client *http.Client
+
+	conn     *grpc.ClientConn
+	metrics  colmetricspb.MetricsServiceClient
+	logs     collogspb.LogsServiceClient
+	callOpts []grpc.CallOption
+}
+
+// NewExporter 创建导出器（gRPC不会立即建立连接）
+func NewExporter(opts Options, logger *logrus.Logger) (*Exporter, error) {
+	e := &Exporter{opts: opts, logger: logger}
+
+	if opts.Protocol != config.OTLPProtocolGRPC {
+		e.opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+		e.client = &http.Client{}
+		return e, nil
+	}
+
+	creds := credentials.NewTLS(&tls.Config{})
+	if opts.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if opts.UserAgent != "" {
+		dialOpts = append(dialOpts, grpc.WithUserAgent(opts.UserAgent))
+	}
+
+	conn, err := grpc.NewClient(opts.Endpoint, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("创建OTLP gRPC客户端失败: %w", err)
+	}
+	e.conn = conn
+	e.metrics = colmetricspb.NewMetricsServiceClient(conn)
+	e.logs = collogspb.NewLogsServiceClient(conn)
+	if opts.Compression == codec.EncodingGzip {
+		e.callOpts = append(e.callOpts, grpc.UseCompressor(gzip.Name))
+	}
+	return e, nil
+}
+
+// Export 导出指标和日志，Collector部分拒绝时只记录警告
+func (e *Exporter) Export(ctx context.Context, batch Batch) error {
+	if len(batch.Metrics) > 0 {
+		if err := e.exportMetrics(ctx, &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: batch.Metrics}); err != nil {
+			return fmt.Errorf("导出OTLP指标失败: %w", err)
+		}
+	}
+	if len(batch.Logs) > 0 {
+		if err := e.exportLogs(ctx, &collogspb.ExportLogsServiceRequest{ResourceLogs: batch.Logs}); err != nil {
+			return fmt.Errorf("导出OTLP日志失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// exportMetrics 导出指标
+func (e *Exporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	var err error
+	if e.conn != nil {
+		resp, err = e.metrics.Export(e.outgoing(ctx), req, e.callOpts...)
+		err = grpcError(err)
+	} else {
+		err = e.post(ctx, "/v1/metrics", req, resp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if partial := resp.GetPartialSuccess(); partial.GetRejectedDataPoints() > 0 || partial.GetErrorMessage() != "" {
+		e.logger.WithFields(logrus.Fields{
+			"rejected": partial.GetRejectedDataPoints(),
+			"message":  partial.GetErrorMessage(),
+		}).Warn("OTLP Collector拒绝了部分指标数据点")
+	}
+	return nil
+}
+
+// exportLogs 导出日志
+func (e *Exporter) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	resp := &collogspb.ExportLogsServiceResponse{}
+	var err error
+	if e.conn != nil {
+		resp, err = e.logs.Export(e.outgoing(ctx), req, e.callOpts...)
+		err = grpcError(err)
+	} else {
+		err = e.post(ctx, "/v1/logs", req, resp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if partial := resp.GetPartialSuccess(); partial.GetRejectedLogRecords() > 0 || partial.GetErrorMessage() != "" {
+		e.logger.WithFields(logrus.Fields{
+			"rejected": partial.GetRejectedLogRecords(),
+			"message":  partial.GetErrorMessage(),
+		}).Warn("OTLP Collector拒绝了部分日志")
+	}
+	return nil
+}
+
+// outgoing 附加gRPC metadata
+func (e *Exporter) outgoing(ctx context.Context) context.Context {
+	if len(e.opts.Headers) == 0 {
+		return ctx
+	}
+	md := metadata.New(nil)
+	for k, v := range e.opts.Headers {
+		md.Set(k, v)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// post 发送OTLP/HTTP请求；429、502、503、504可重试，其他错误状态码不重试
+func (e *Exporter) post(ctx context.Context, path string, req, resp proto.Message) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return &PermanentError{fmt.Errorf("序列化请求失败: %w", err)}
+	}
+	if e.opts.Compression == codec.EncodingGzip {
+		if data, err = codec.Compress(data, codec.EncodingGzip); err != nil {
+			return &PermanentError{err}
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.Endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return &PermanentError{fmt.Errorf("创建请求失败: %w", err)}
+	}
+	httpReq.Header.Set("Content-Type", codec.ContentTypeProtobuf)
+	if e.opts.Compression == codec.EncodingGzip {
+		httpReq.Header.Set("Content-Encoding", codec.EncodingGzip)
+	}
+	if e.opts.UserAgent != "" {
+		httpReq.Header.Set("User-Agent", e.opts.UserAgent)
+	}
+	for k, v := range e.opts.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if httpResp.StatusCode == http.StatusOK {
+		if len(body) > 0 && strings.HasPrefix(httpResp.Header.Get("Content-Type"), codec.ContentTypeProtobuf) {
+			if err := proto.Unmarshal(body, resp); err != nil {
+				e.logger.WithError(err).Debug("解析OTLP响应失败")
+			}
+		}
+		return nil
+	}
+
+	// 错误响应体为google.rpc.Status
+	message := strings.TrimSpace(string(body))
+	var st statuspb.Status
+	if proto.Unmarshal(body, &st) == nil && st.GetMessage() != "" {
+		message = st.GetMessage()
+	}
+	if len(message) > 256 {
+		message = message[:256]
+	}
+
+	err = fmt.Errorf("状态码 %d: %s", httpResp.StatusCode, message)
+	switch httpResp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	default:
+		return &PermanentError{err}
+	}
+}
+
+// grpcError 按OTLP规范区分可重试的gRPC错误
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+		return err
+	default:
+		return &PermanentError{err}
+	}
+}
+
+// Close 关闭连接
+func (e *Exporter) Close() error {
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// defaultTimeout 未配置超时时使用
+const defaultTimeout = 10 * time.Second
+
+// WithTimeout 为一次导出设置超时
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
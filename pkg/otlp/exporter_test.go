@@ -0,0 +1,119 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/sirupsen/logrus"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestExporter(t *testing.T, url, compression string) *Exporter {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	exporter, err := NewExporter(Options{
+		Protocol:    "http",
+		Endpoint:    url + "/",
+		Compression: compression,
+		Headers:     map[string]string{"X-Tenant": "t1"},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewExporter: %v", err)
+	}
+	t.Cleanup(func() { exporter.Close() })
+	return exporter
+}
+
+func TestExporterHTTP(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]proto.Message)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Tenant") != "t1" || r.Header.Get("Content-Type") != codec.ContentTypeProtobuf {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") == codec.EncodingGzip {
+			var err error
+			if body, err = codec.Decompress(body, codec.EncodingGzip, 1<<20); err != nil {
+				t.Errorf("decompress: %v", err)
+			}
+		}
+
+		var msg proto.Message
+		switch r.URL.Path {
+		case "/v1/metrics":
+			msg = &colmetricspb.ExportMetricsServiceRequest{}
+		case "/v1/logs":
+			msg = &collogspb.ExportLogsServiceRequest{}
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			return
+		}
+		if err := proto.Unmarshal(body, msg); err != nil {
+			t.Errorf("unmarshal %s: %v", r.URL.Path, err)
+		}
+		mu.Lock()
+		requests[r.URL.Path] = msg
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	exporter := newTestExporter(t, server.URL, codec.EncodingGzip)
+	if err := exporter.Export(context.Background(), (&Converter{}).Convert(testRecords())); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	metrics, ok := requests["/v1/metrics"].(*colmetricspb.ExportMetricsServiceRequest)
+	if !ok || len(metrics.GetResourceMetrics()) != 2 {
+		t.Fatalf("metrics request = %v", requests["/v1/metrics"])
+	}
+	logs, ok := requests["/v1/logs"].(*collogspb.ExportLogsServiceRequest)
+	if !ok || len(logs.GetResourceLogs()) != 1 {
+		t.Fatalf("logs request = %v", requests["/v1/logs"])
+	}
+}
+
+func TestExporterHTTPErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+		{http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "collector says no", tt.status)
+		}))
+		exporter := newTestExporter(t, server.URL, "")
+
+		err := exporter.Export(context.Background(), (&Converter{}).Convert(testRecords()))
+		server.Close()
+
+		if err == nil {
+			t.Errorf("status %d: Export returned nil error", tt.status)
+			continue
+		}
+		if IsPermanent(err) != tt.permanent {
+			t.Errorf("status %d: permanent = %v, want %v", tt.status, IsPermanent(err), tt.permanent)
+		}
+		if !strings.Contains(err.Error(), "collector says no") {
+			t.Errorf("status %d: error %q does not include the response message", tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/auth"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiKeyFileName 状态目录中保存注册得到的API Key的文件名
+const apiKeyFileName = "api_key"
+
+// 注册失败后的重试间隔
+const (
+	enrollRetryDelay    = 30 * time.Second
+	enrollConflictDelay = 5 * time.Minute // Server已有该Agent的Key，需要管理员吊销
+)
+
+// agentCredentials Agent向Server认证使用的API Key：配置的Key优先，否则使用注册得到的Key
+type agentCredentials struct {
+	cfg      config.AgentAuthConfig
+	keyPath  string // 注册得到的Key的保存路径，为空时只保存在内存
+	logger   *logrus.Logger
+	enrollFn func(token string) (string, error)
+
+	mu         sync.Mutex
+	apiKey     string
+	enrolled   bool // 当前Key来自注册，被Server拒绝时丢弃并重新注册
+	nextEnroll time.Time
+}
+
+// newAgentCredentials 加载配置的API Key或之前注册得到的API Key
+func newAgentCredentials(cfg config.AgentAuthConfig, stateDir string, logger *logrus.Logger) *agentCredentials {
+	c := &agentCredentials{cfg: cfg, logger: logger}
+	if stateDir != "" {
+		c.keyPath = filepath.Join(stateDir, apiKeyFileName)
+	}
+
+	if cfg.APIKey != "" {
+		c.apiKey = strings.TrimSpace(os.ExpandEnv(cfg.APIKey))
+		return c
+	}
+
+	if cfg.EnrollmentToken != "" && c.keyPath != "" {
+		if data, err := os.ReadFile(c.keyPath); err == nil {
+			if key := strings.TrimSpace(string(data)); key != "" {
+				c.apiKey = key
+				c.enrolled = true
+				logger.WithField("key_id", auth.KeyID(key)).Info("已加载注册得到的API Key")
+			}
+		}
+	}
+	return c
+}
+
+// enabled 是否需要向Server认证
+func (c *agentCredentials) enabled() bool {
+	return c.cfg.APIKey != "" || c.cfg.EnrollmentToken != ""
+}
+
+// get 返回当前的API Key，没有时尝试注册；未配置认证时返回空串
+func (c *agentCredentials) get() (string, error) {
+	if !c.enabled() {
+		return "", nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.apiKey != "" {
+		return c.apiKey, nil
+	}
+	if c.enrollFn == nil {
+		return "", fmt.Errorf("没有可用的API Key")
+	}
+	if time.Now().Before(c.nextEnroll) {
+		return "", fmt.Errorf("注册失败，等待重试 (下次: %s)", c.nextEnroll.Format(time.RFC3339))
+	}
+
+	key, err := c.enrollFn(os.ExpandEnv(c.cfg.EnrollmentToken))
+	if err != nil {
+		delay := enrollRetryDelay
+		if errors.Is(err, errAlreadyEnrolled) {
+			delay = enrollConflictDelay
+		}
+		c.nextEnroll = time.Now().Add(delay)
+		return "", fmt.Errorf("向Server注册失败: %w", err)
+	}
+
+	c.apiKey = key
+	c.enrolled = true
+	c.save(key)
+	c.logger.WithField("key_id", auth.KeyID(key)).Info("已向Server注册并获得API Key")
+	return key, nil
+}
+
+// save 保存注册得到的Key（仅属主可读）
+func (c *agentCredentials) save(key string) {
+	if c.keyPath == "" {
+		c.logger.Warn("未配置state_dir，注册得到的API Key只保存在内存中，重启后需要重新注册")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.keyPath), 0700); err != nil {
+		c.logger.WithError(err).Warn("创建状态目录失败，API Key未保存")
+		return
+	}
+	tmp := c.keyPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(key+"\n"), 0600); err != nil {
+		c.logger.WithError(err).Warn("保存API Key失败")
+		return
+	}
+	if err := os.Rename(tmp, c.keyPath); err != nil {
+		os.Remove(tmp)
+		c.logger.WithError(err).Warn("保存API Key失败")
+	}
+}
+
+// rejected Server拒绝了当前Key：注册得到的Key被丢弃，下次发送时重新注册
+func (c *agentCredentials) rejected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.apiKey == "" {
+		return
+	}
+	if !c.enrolled {
+		c.logger.WithField("key_id", auth.KeyID(c.apiKey)).Error("Server拒绝了配置的API Key，请检查reporter.auth.api_key")
+		return
+	}
+
+	c.logger.WithField("key_id", auth.KeyID(c.apiKey)).Warn("Server拒绝了注册得到的API Key，将重新注册")
+	c.apiKey = ""
+	c.enrolled = false
+	if c.keyPath != "" {
+		os.Remove(c.keyPath)
+	}
+}
+
+// errAlreadyEnrolled Server上已有该Agent的API Key
+var errAlreadyEnrolled = errors.New("Server上已存在该Agent的API Key，需要管理员吊销后才能重新注册")
+
+// enrollURL 由server_url推导注册地址（与上报接口同级的/enroll）
+func enrollURL(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return strings.TrimSuffix(serverURL, "/") + "/enroll"
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	path = strings.TrimSuffix(path, "/metrics")
+	u.Path = path + "/enroll"
+	u.RawPath = ""
+	u.RawQuery = ""
+	return u.String()
+}
+
+// enroll 使用注册令牌向Server申请API Key
+func (r *Reporter) enroll(token string) (string, error) {
+	data, err := json.Marshal(map[string]string{
+		"agent_id": r.GetAgentID(),
+		"hostname": r.hostname,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPost, enrollURL(r.getConfig().ServerURL), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("创建注册请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.getClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("发送注册请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return "", errAlreadyEnrolled
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		APIKey string `json:"api_key"`
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err == nil {
+		err = json.Unmarshal(body, &response)
+	}
+	if err != nil {
+		return "", fmt.Errorf("解析注册响应失败: %w", err)
+	}
+	if response.APIKey == "" {
+		return "", fmt.Errorf("注册响应中没有api_key")
+	}
+	return response.APIKey, nil
+}
+
+// authorize 为REST请求添加API Key，启用签名时同时添加时间戳、nonce和签名
+func (r *Reporter) authorize(req *http.Request, body []byte) error {
+	apiKey, err := r.credentials.get()
+	if err != nil || apiKey == "" {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if r.credentials.cfg.Sign {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := auth.GenerateNonce()
+		req.Header.Set(auth.HeaderTimestamp, timestamp)
+		req.Header.Set(auth.HeaderNonce, nonce)
+		req.Header.Set(auth.HeaderSignature, auth.Sign(auth.SigningKey(apiKey), req.Method, req.URL.Path, timestamp, nonce, body))
+	}
+	return nil
+}
+
+// checkAuthResponse Server认为Key无效（不存在或已吊销）时丢弃注册得到的Key
+// 签名或时间戳错误不影响Key本身
+func (r *Reporter) checkAuthResponse(resp *http.Response) {
+	if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get(auth.HeaderAuthError) == auth.ReasonInvalidToken {
+		r.credentials.rejected()
+	}
+}
@@ -0,0 +1,159 @@
+package reporter
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常发送
+	BreakerOpen     BreakerState = "open"      // 暂停发送，等待探测
+	BreakerHalfOpen BreakerState = "half-open" // 正在用心跳探测Server
+)
+
+// backoffDelay 计算第attempt次重试的退避时间：base*2^(attempt-1)，不超过max，并加入±20%的抖动
+func backoffDelay(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	if max < base {
+		max = base
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// 抖动避免大量Agent在Server恢复时同时重试
+	spread := int64(delay) / 5
+	if spread > 0 {
+		delay += time.Duration(rand.Int63n(2*spread+1) - spread)
+	}
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// circuitBreaker 上报熔断器
+// 连续失败达到阈值后打开，停止发送数据；之后按指数退避用心跳探测Server，探测成功后关闭
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int // 连续失败次数
+	probes    int // 连续探测失败次数
+	threshold int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	openedAt  time.Time
+	nextProbe time.Time
+}
+
+// breakerSnapshot 熔断器状态快照
+type breakerSnapshot struct {
+	State     BreakerState
+	Failures  int
+	OpenedAt  time.Time
+	NextProbe time.Time
+}
+
+// newCircuitBreaker 创建熔断器，threshold<=0时不打开
+func newCircuitBreaker(threshold int, baseDelay, maxDelay time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		state:     BreakerClosed,
+		threshold: threshold,
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+// Configure 更新熔断参数（配置热加载）
+func (b *circuitBreaker) Configure(threshold int, baseDelay, maxDelay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.threshold = threshold
+	b.baseDelay = baseDelay
+	b.maxDelay = maxDelay
+}
+
+// Allow 是否允许发送数据
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerClosed
+}
+
+// RecordSuccess 记录发送成功，返回熔断器是否由此恢复
+func (b *circuitBreaker) RecordSuccess() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recovered := b.state != BreakerClosed
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probes = 0
+	b.openedAt = time.Time{}
+	b.nextProbe = time.Time{}
+	return recovered
+}
+
+// RecordFailure 记录发送失败，返回熔断器是否由此打开
+func (b *circuitBreaker) RecordFailure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	switch b.state {
+	case BreakerClosed:
+		if b.threshold > 0 && b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+			b.nextProbe = b.openedAt.Add(backoffDelay(b.baseDelay, b.maxDelay, 1))
+			return true
+		}
+	case BreakerHalfOpen:
+		// 探测失败，延长下次探测时间
+		b.probes++
+		b.state = BreakerOpen
+		b.nextProbe = time.Now().Add(backoffDelay(b.baseDelay, b.maxDelay, b.probes+1))
+	}
+
+	return false
+}
+
+// TryProbe 到达探测时间时切换为半开状态，返回是否应当发起探测
+func (b *circuitBreaker) TryProbe() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerOpen || time.Now().Before(b.nextProbe) {
+		return false
+	}
+
+	b.state = BreakerHalfOpen
+	return true
+}
+
+// Snapshot 获取状态快照
+func (b *circuitBreaker) Snapshot() breakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return breakerSnapshot{
+		State:     b.state,
+		Failures:  b.failures,
+		OpenedAt:  b.openedAt,
+		NextProbe: b.nextProbe,
+	}
+}
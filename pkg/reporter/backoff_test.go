@@ -0,0 +1,146 @@
+package reporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		max     time.Duration
+		attempt int
+		want    time.Duration // 抖动前的退避时间
+	}{
+		{"first attempt", time.Second, time.Minute, 1, time.Second},
+		{"doubles per attempt", time.Second, time.Minute, 4, 8 * time.Second},
+		{"capped at max", time.Second, 10 * time.Second, 10, 10 * time.Second},
+		{"large attempt does not overflow", time.Second, time.Minute, 1000, time.Minute},
+		{"zero base defaults to one second", 0, time.Minute, 1, time.Second},
+		{"max below base uses base", 5 * time.Second, time.Second, 3, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			max := tt.max
+			if max < tt.want {
+				max = tt.want
+			}
+			low, high := tt.want-tt.want/5, tt.want+tt.want/5
+			if high > max {
+				high = max
+			}
+
+			for i := 0; i < 200; i++ {
+				got := backoffDelay(tt.base, tt.max, tt.attempt)
+				if got < low || got > high {
+					t.Fatalf("backoffDelay(%v, %v, %d) = %v, want within [%v, %v]",
+						tt.base, tt.max, tt.attempt, got, low, high)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	b := newCircuitBreaker(3, time.Second, time.Minute)
+
+	for i := 1; i < 3; i++ {
+		if b.RecordFailure() {
+			t.Fatalf("breaker opened after %d failures, threshold is 3", i)
+		}
+		if !b.Allow() {
+			t.Fatalf("Allow() = false after %d failures", i)
+		}
+	}
+	if !b.RecordFailure() {
+		t.Fatal("breaker did not open at the threshold")
+	}
+	if b.Allow() {
+		t.Fatal("Allow() = true while open")
+	}
+
+	snap := b.Snapshot()
+	if snap.State != BreakerOpen || snap.OpenedAt.IsZero() {
+		t.Fatalf("snapshot = %+v, want open with OpenedAt set", snap)
+	}
+	if !snap.NextProbe.After(snap.OpenedAt) {
+		t.Fatalf("NextProbe %v is not after OpenedAt %v", snap.NextProbe, snap.OpenedAt)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker(2, time.Second, time.Minute)
+
+	b.RecordFailure()
+	if b.RecordSuccess() {
+		t.Fatal("RecordSuccess reported recovery while closed")
+	}
+	if b.RecordFailure() {
+		t.Fatal("failures were not reset by a success")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Second, time.Minute)
+
+	for i := 0; i < 100; i++ {
+		if b.RecordFailure() {
+			t.Fatal("breaker with threshold 0 opened")
+		}
+	}
+	if !b.Allow() {
+		t.Fatal("Allow() = false with threshold 0")
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	b := newCircuitBreaker(1, time.Second, time.Minute)
+	b.RecordFailure()
+
+	if b.TryProbe() {
+		t.Fatal("TryProbe() = true before the probe time")
+	}
+
+	// 到达探测时间后半开，探测失败时重新打开并延长下次探测时间
+	b.mu.Lock()
+	b.nextProbe = time.Now().Add(-time.Millisecond)
+	b.mu.Unlock()
+	if !b.TryProbe() {
+		t.Fatal("TryProbe() = false after the probe time")
+	}
+	if b.TryProbe() {
+		t.Fatal("TryProbe() = true while a probe is in flight")
+	}
+	if b.Allow() {
+		t.Fatal("Allow() = true while half-open")
+	}
+
+	before := time.Now()
+	if b.RecordFailure() {
+		t.Fatal("failed probe reported as a new opening")
+	}
+	snap := b.Snapshot()
+	if snap.State != BreakerOpen {
+		t.Fatalf("state after failed probe = %s, want open", snap.State)
+	}
+	// 第二次探测的退避为base*2（减去抖动后至少1.6秒）
+	if min := before.Add(1600 * time.Millisecond); snap.NextProbe.Before(min) {
+		t.Fatalf("NextProbe %v is earlier than %v", snap.NextProbe, min)
+	}
+
+	// 探测成功后关闭
+	b.mu.Lock()
+	b.nextProbe = time.Now().Add(-time.Millisecond)
+	b.mu.Unlock()
+	if !b.TryProbe() {
+		t.Fatal("TryProbe() = false after the extended probe time")
+	}
+	if !b.RecordSuccess() {
+		t.Fatal("RecordSuccess did not report recovery")
+	}
+	if !b.Allow() || b.Snapshot().State != BreakerClosed {
+		t.Fatal("breaker is not closed after a successful probe")
+	}
+}
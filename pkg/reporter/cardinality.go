@@ -0,0 +1,195 @@
+package reporter
+
+import (
+	"strconv"
+	"sync"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/cardinality"
+)
+
+// 按域名流量统计生成的指标，Agent端共用一个名额集合（取三者中最小的上限）
+var domainTrafficMetrics = []string{
+	"network_domain_bytes_sent_total",
+	"network_domain_bytes_received_total",
+	"network_domain_connections_total",
+}
+
+// cardinalityLimiter 上报前限制域名、IP、协议和端口的标签值数量，超出的部分汇总到other
+// 对中心Server和所有输出目标生效
+type cardinalityLimiter struct {
+	domains   *cardinality.Limiter
+	traffic   *cardinality.Limiter
+	ips       *cardinality.Limiter
+	protocols *cardinality.Limiter
+	ports     *cardinality.Limiter
+
+	mu        sync.Mutex
+	collapsed map[string]int // 指标名称 -> 最近一次上报中被汇总的标签值数量
+}
+
+// newCardinalityLimiter 按配置创建限制器，未启用时返回nil
+func newCardinalityLimiter(cfg config.CardinalityConfig) *cardinalityLimiter {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	trafficLimit := 0
+	for _, metric := range domainTrafficMetrics {
+		if limit := cfg.Limit(metric); limit > 0 && (trafficLimit == 0 || limit < trafficLimit) {
+			trafficLimit = limit
+		}
+	}
+
+	return &cardinalityLimiter{
+		domains:   cardinality.NewLimiter(cfg.Limit("network_domains_accessed_total")),
+		traffic:   cardinality.NewLimiter(trafficLimit),
+		ips:       cardinality.NewLimiter(cfg.Limit("network_ips_accessed_total")),
+		protocols: cardinality.NewLimiter(cfg.Limit("network_protocol_stats_total")),
+		ports:     cardinality.NewLimiter(cfg.Limit("network_port_connections_total")),
+		collapsed: make(map[string]int),
+	}
+}
+
+// apply 返回限制后的指标，不修改传入数据中的映射
+// 域名按收发字节数排名（没有流量统计时按访问次数），IP、协议和端口按计数排名
+func (l *cardinalityLimiter) apply(metrics common.NetworkMetrics) common.NetworkMetrics {
+	if l == nil {
+		return metrics
+	}
+
+	domainWeights := make(map[string]float64, len(metrics.DomainsAccessed))
+	for domain, count := range metrics.DomainsAccessed {
+		domainWeights[domain] = float64(count)
+	}
+	for domain, stats := range metrics.DomainTraffic {
+		if stats != nil {
+			domainWeights[domain] = float64(stats.BytesSent + stats.BytesReceived)
+		}
+	}
+
+	collapsed := make(map[string]int)
+
+	if drop := l.domains.Collapse(domainWeights); len(drop) > 0 {
+		metrics.DomainsAccessed = collapseCounts(metrics.DomainsAccessed, drop)
+		collapsed["network_domains_accessed_total"] = len(drop)
+	}
+	if drop := l.traffic.Collapse(domainWeights); len(drop) > 0 {
+		metrics.DomainTraffic = collapseTraffic(metrics.DomainTraffic, drop)
+		for _, metric := range domainTrafficMetrics {
+			collapsed[metric] = len(drop)
+		}
+	}
+	if drop := l.ips.Collapse(countWeights(metrics.IPsAccessed)); len(drop) > 0 {
+		metrics.IPsAccessed = collapseCounts(metrics.IPsAccessed, drop)
+		collapsed["network_ips_accessed_total"] = len(drop)
+	}
+	if drop := l.protocols.Collapse(countWeights(metrics.ProtocolStats)); len(drop) > 0 {
+		metrics.ProtocolStats = collapseCounts(metrics.ProtocolStats, drop)
+		collapsed["network_protocol_stats_total"] = len(drop)
+	}
+	if l.ports != nil && len(metrics.PortStats) > 0 {
+		weights := make(map[string]float64, len(metrics.PortStats))
+		for port, count := range metrics.PortStats {
+			weights[strconv.Itoa(port)] = float64(count)
+		}
+		if drop := l.ports.Collapse(weights); len(drop) > 0 {
+			metrics.PortStats = collapsePorts(metrics.PortStats, drop)
+			collapsed["network_port_connections_total"] = len(drop)
+		}
+	}
+
+	l.mu.Lock()
+	l.collapsed = collapsed
+	l.mu.Unlock()
+
+	return metrics
+}
+
+// stats 最近一次上报中各指标被汇总的标签值数量
+func (l *cardinalityLimiter) stats() map[string]int {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make(map[string]int, len(l.collapsed))
+	for metric, count := range l.collapsed {
+		result[metric] = count
+	}
+	return result
+}
+
+// countWeights 以计数作为排名权重
+func countWeights(counts map[string]uint64) map[string]float64 {
+	weights := make(map[string]float64, len(counts))
+	for value, count := range counts {
+		weights[value] = float64(count)
+	}
+	return weights
+}
+
+// collapseCounts 复制计数映射，drop中的标签值汇总到other
+func collapseCounts(counts map[string]uint64, drop map[string]bool) map[string]uint64 {
+	result := make(map[string]uint64, len(counts)-len(drop)+1)
+	for value, count := range counts {
+		if drop[value] {
+			value = cardinality.Other
+		}
+		result[value] += count
+	}
+	return result
+}
+
+// collapsePorts 复制端口计数映射，drop中的端口汇总到端口0（不会出现在实际连接中，表示other）
+func collapsePorts(counts map[int]uint64, drop map[string]bool) map[int]uint64 {
+	result := make(map[int]uint64, len(counts)-len(drop)+1)
+	for port, count := range counts {
+		if drop[strconv.Itoa(port)] {
+			port = 0
+		}
+		result[port] += count
+	}
+	return result
+}
+
+// portLabel 端口的标签值，端口0为基数限制汇总的other
+func portLabel(port int) string {
+	if port == 0 {
+		return cardinality.Other
+	}
+	return strconv.Itoa(port)
+}
+
+// collapseTraffic 复制域名流量映射，drop中的域名汇总到other
+func collapseTraffic(traffic map[string]*common.DomainTrafficStats, drop map[string]bool) map[string]*common.DomainTrafficStats {
+	result := make(map[string]*common.DomainTrafficStats, len(traffic)-len(drop)+1)
+	for domain, stats := range traffic {
+		if stats == nil {
+			continue
+		}
+		if !drop[domain] && domain != cardinality.Other {
+			result[domain] = stats
+			continue
+		}
+
+		// 汇总到新建的other，不修改Agent数据
+		other := result[cardinality.Other]
+		if other == nil {
+			other = &common.DomainTrafficStats{Domain: cardinality.Other}
+			result[cardinality.Other] = other
+		}
+		other.BytesSent += stats.BytesSent
+		other.BytesReceived += stats.BytesReceived
+		other.PacketsSent += stats.PacketsSent
+		other.PacketsRecv += stats.PacketsRecv
+		other.Connections += stats.Connections
+		if stats.LastAccess.After(other.LastAccess) {
+			other.LastAccess = stats.LastAccess
+		}
+	}
+	return result
+}
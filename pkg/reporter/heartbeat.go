@@ -0,0 +1,179 @@
+package reporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/api/netmonv1"
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/sirupsen/logrus"
+)
+
+// heartbeatInterval 心跳间隔
+const heartbeatInterval = time.Minute
+
+// HeartbeatInfoFunc 提供心跳携带的Agent运行信息（版本、启动时间、采集模式、内核版本、主机和网卡信息等）
+// ID、主机名、状态和发送时间由上报器填写
+type HeartbeatInfoFunc func() common.AgentInfo
+
+// SetHeartbeatInfo 设置心跳信息的来源（应在Start之前调用）
+func (r *Reporter) SetHeartbeatInfo(fn HeartbeatInfoFunc) {
+	r.mu.Lock()
+	r.heartbeatInfo = fn
+	r.mu.Unlock()
+}
+
+// TriggerHeartbeat 立即发送一次心跳（如采集模式确定或配置变更后），不等待发送完成
+func (r *Reporter) TriggerHeartbeat() {
+	select {
+	case r.heartbeatChan <- struct{}{}:
+	default:
+	}
+}
+
+// buildHeartbeat 构建心跳内容
+func (r *Reporter) buildHeartbeat() common.AgentInfo {
+	r.mu.Lock()
+	fn := r.heartbeatInfo
+	info := r.info
+	r.mu.Unlock()
+
+	var hb common.AgentInfo
+	if fn != nil {
+		hb = fn()
+	}
+	hb.ID = r.GetAgentID()
+	hb.Hostname = r.hostname
+	hb.LastSeen = time.Now()
+	hb.Status = "online"
+	if hb.Version == "" {
+		hb.Version = info.Version
+	}
+	if hb.StartTime.IsZero() {
+		hb.StartTime = r.startTime
+	}
+	if hb.StartupTime.IsZero() {
+		hb.StartupTime = info.StartupTime
+	}
+	if hb.ReportInterval == "" && info.ReportInterval > 0 {
+		hb.ReportInterval = info.ReportInterval.String()
+	}
+	return hb
+}
+
+// heartbeatURL 由server_url推导心跳地址
+// server_url是上报接口（如 http://server:8080/api/v1/metrics），心跳接口与之同级（/api/v1/heartbeat）
+func heartbeatURL(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return strings.TrimSuffix(serverURL, "/") + "/heartbeat"
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	path = strings.TrimSuffix(path, "/metrics")
+	u.Path = path + "/heartbeat"
+	u.RawPath = ""
+	u.RawQuery = ""
+	return u.String()
+}
+
+// sendHeartbeat 发送心跳并执行响应中的指令，网络错误、认证失败或Server返回5xx时返回错误
+func (r *Reporter) sendHeartbeat() error {
+	if r.stream != nil {
+		return r.sendStreamHeartbeat()
+	}
+
+	data, err := json.Marshal(r.buildHeartbeat())
+	if err != nil {
+		return fmt.Errorf("序列化心跳数据失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, "POST", heartbeatURL(r.getConfig().ServerURL), bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("创建心跳请求失败: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Agent-ID", r.GetAgentID())
+	if err := r.authorize(req, data); err != nil {
+		return fmt.Errorf("认证失败: %w", err)
+	}
+
+	resp, err := r.getClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("发送心跳失败: %w", err)
+	}
+	defer resp.Body.Close()
+	r.checkAuthResponse(resp)
+
+	// 认证失败时上报同样会失败，不能作为熔断恢复的依据
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		r.logger.WithField("status", resp.StatusCode).Debug("心跳返回非200状态码")
+		return nil
+	}
+
+	var response common.HeartbeatResponse
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err == nil {
+		err = json.Unmarshal(body, &response)
+	}
+	if err != nil {
+		// 不影响心跳本身的结果
+		r.logger.WithError(err).Warn("解析心跳响应失败")
+		return nil
+	}
+
+	r.logger.WithField("directives", len(response.Directives)).Debug("心跳发送成功")
+	for _, directive := range response.Directives {
+		r.applyDirective(&netmonv1.Command{
+			Id:   directive.ID,
+			Type: directive.Type,
+			Args: directive.Args,
+		})
+	}
+	return nil
+}
+
+// applyDirective 执行REST心跳响应中的指令，结果只记录日志
+func (r *Reporter) applyDirective(cmd *netmonv1.Command) {
+	logger := r.logger.WithFields(logrus.Fields{
+		"directive_id": cmd.GetId(),
+		"type":         cmd.GetType(),
+	})
+	logger.Info("收到Server指令")
+
+	if result := r.executeCommand(cmd); result.GetSuccess() {
+		logger.Info("Server指令执行成功")
+	}
+}
+
+// sendStreamHeartbeat 通过gRPC流发送心跳，确认中的指令按命令处理并回传结果
+func (r *Reporter) sendStreamHeartbeat() error {
+	hb := r.buildHeartbeat()
+	msg := &netmonv1.AgentMessage{
+		Payload: &netmonv1.AgentMessage_Heartbeat{Heartbeat: codec.HeartbeatToProto(&hb)},
+	}
+
+	ack, err := r.stream.Send(r.ctx, msg, r.getConfig().Timeout)
+	if err != nil {
+		return fmt.Errorf("发送心跳失败: %w", err)
+	}
+
+	r.logger.WithField("directives", len(ack.GetDirectives())).Debug("心跳发送成功")
+	for _, cmd := range ack.GetDirectives() {
+		go r.stream.handleCommand(cmd)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package reporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+func TestHeartbeatURL(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		want      string
+	}{
+		{"http://server:8080/api/v1/metrics", "http://server:8080/api/v1/heartbeat"},
+		{"http://server:8080/api/v1/metrics/", "http://server:8080/api/v1/heartbeat"},
+		{"https://server/ingest?token=x", "https://server/ingest/heartbeat"},
+	}
+	for _, tt := range tests {
+		if got := heartbeatURL(tt.serverURL); got != tt.want {
+			t.Errorf("heartbeatURL(%q) = %q, want %q", tt.serverURL, got, tt.want)
+		}
+	}
+}
+
+func TestSendHeartbeatAppliesDirectives(t *testing.T) {
+	var received common.AgentInfo
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/heartbeat" || req.Header.Get("X-Agent-ID") != "agent-test" {
+			t.Errorf("unexpected heartbeat request: %s %s", req.URL.Path, req.Header.Get("X-Agent-ID"))
+		}
+		json.NewDecoder(req.Body).Decode(&received)
+		json.NewEncoder(w).Encode(common.HeartbeatResponse{
+			Success:   true,
+			Timestamp: time.Now(),
+			Directives: []common.Directive{
+				{ID: "cmd-1", Type: common.DirectiveSetReportInterval, Args: map[string]string{"interval": "30s"}},
+				{ID: "cmd-2", Type: common.DirectiveReplaySpool},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	r, err := NewReporter(&config.ReporterConfig{
+		ServerURL:  srv.URL + "/api/v1/metrics",
+		Timeout:    time.Second,
+		RetryDelay: time.Second,
+		BatchSize:  1,
+		AgentID:    "agent-test",
+		StateDir:   t.TempDir(),
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewReporter: %v", err)
+	}
+	r.SetHeartbeatInfo(func() common.AgentInfo { return common.AgentInfo{Mode: "ebpf"} })
+
+	var handled []string
+	r.SetCommandHandler(func(cmdType string, args map[string]string) error {
+		handled = append(handled, cmdType+"="+args["interval"])
+		return nil
+	})
+
+	if err := r.sendHeartbeat(); err != nil {
+		t.Fatalf("sendHeartbeat: %v", err)
+	}
+	if received.ID != "agent-test" || received.Mode != "ebpf" || received.Status != "online" {
+		t.Fatalf("heartbeat body = %+v", received)
+	}
+	if len(handled) != 1 || handled[0] != "set_report_interval=30s" {
+		t.Fatalf("handled directives = %v, want set_report_interval=30s", handled)
+	}
+	// replay_spool由上报器自己处理，唤醒批处理协程重发缓存
+	select {
+	case <-r.resumeChan:
+	default:
+		t.Fatal("replay_spool directive did not trigger a resume")
+	}
+}
+
+func TestSendHeartbeatServerError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"server error", http.StatusInternalServerError, true},
+		{"unauthorized", http.StatusUnauthorized, true},
+		{"not found", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			r, err := NewReporter(&config.ReporterConfig{
+				ServerURL: srv.URL + "/api/v1/metrics",
+				Timeout:   time.Second,
+				BatchSize: 1,
+				AgentID:   "agent-test",
+				StateDir:  t.TempDir(),
+			}, newTestLogger())
+			if err != nil {
+				t.Fatalf("NewReporter: %v", err)
+			}
+			if err := r.sendHeartbeat(); (err != nil) != tt.wantErr {
+				t.Fatalf("sendHeartbeat error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package reporter
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Agent ID来源
+const (
+	AgentIDSourceConfig    = "config"
+	AgentIDSourceMachineID = "machine-id"
+	AgentIDSourceDMI       = "dmi-product-uuid"
+	AgentIDSourceStateFile = "state-file"
+	AgentIDSourceHostname  = "hostname"
+)
+
+// agentIDFileName 状态目录中持久化随机ID的文件名
+const agentIDFileName = "agent-id"
+
+// 机器标识文件路径（变量便于在不同发行版上覆盖）
+var (
+	machineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+	dmiUUIDPath    = "/sys/class/dmi/id/product_uuid"
+)
+
+// ResolveAgentID 按优先级解析稳定的Agent ID：
+// 配置的agent_id > /etc/machine-id > DMI产品UUID > 状态目录中持久化的随机UUID > 主机名
+func ResolveAgentID(configured, stateDir string) (string, string, error) {
+	// 1. 配置文件指定（支持环境变量）
+	if id := expandAgentID(configured); id != "" {
+		return id, AgentIDSourceConfig, nil
+	}
+
+	// 2. systemd machine-id
+	for _, path := range machineIDPaths {
+		if id := readMachineID(path); id != "" {
+			return hashMachineID(id), AgentIDSourceMachineID, nil
+		}
+	}
+
+	// 3. DMI产品UUID（通常需要root权限）
+	if id := readDMIUUID(dmiUUIDPath); id != "" {
+		return hashMachineID(id), AgentIDSourceDMI, nil
+	}
+
+	// 4. 状态目录中的随机UUID
+	if stateDir != "" {
+		id, err := loadOrCreateAgentID(stateDir)
+		if err == nil {
+			return id, AgentIDSourceStateFile, nil
+		}
+
+		hostname, _ := os.Hostname()
+		return hostname, AgentIDSourceHostname, err
+	}
+
+	// 5. 主机名兜底
+	hostname, _ := os.Hostname()
+	return hostname, AgentIDSourceHostname, nil
+}
+
+// expandAgentID 展开配置中的环境变量，${HOSTNAME}未设置时使用系统主机名
+func expandAgentID(configured string) string {
+	id := os.Expand(configured, func(key string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		if key == "HOSTNAME" {
+			hostname, _ := os.Hostname()
+			return hostname
+		}
+		return ""
+	})
+	return strings.TrimSpace(id)
+}
+
+// readMachineID 读取machine-id，忽略空值和未初始化的值
+func readMachineID(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	id := strings.TrimSpace(string(data))
+	if len(id) != 32 || id == "uninitialized" {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+// readDMIUUID 读取DMI产品UUID，忽略厂商占位值
+func readDMIUUID(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	id := strings.ToLower(strings.TrimSpace(string(data)))
+	if id == "" || id == "not settable" || id == "not present" {
+		return ""
+	}
+	// 全0或全F是未烧录UUID的占位值
+	if strings.Trim(id, "0-") == "" || strings.Trim(id, "f-") == "" {
+		return ""
+	}
+	return id
+}
+
+// hashMachineID 对机器标识做单向哈希，避免在网络上暴露原始machine-id
+func hashMachineID(id string) string {
+	sum := sha256.Sum256([]byte("go-net-monitoring:" + id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// loadOrCreateAgentID 从状态目录读取Agent ID，不存在时生成随机UUID并保存
+func loadOrCreateAgentID(stateDir string) (string, error) {
+	path := filepath.Join(stateDir, agentIDFileName)
+
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", fmt.Errorf("生成Agent ID失败: %w", err)
+	}
+
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return "", fmt.Errorf("创建状态目录失败: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("保存Agent ID失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("保存Agent ID失败: %w", err)
+	}
+
+	return id, nil
+}
+
+// newUUID 生成随机UUID (v4)
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,109 @@
+package reporter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withIdentityFiles 把机器标识路径指向临时文件，空内容表示文件不存在
+func withIdentityFiles(t *testing.T, machineID, dmiUUID string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if content != "" {
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return path
+	}
+
+	oldMachine, oldDMI := machineIDPaths, dmiUUIDPath
+	machineIDPaths = []string{write("machine-id", machineID)}
+	dmiUUIDPath = write("product_uuid", dmiUUID)
+	t.Cleanup(func() { machineIDPaths, dmiUUIDPath = oldMachine, oldDMI })
+}
+
+func TestResolveAgentIDOrder(t *testing.T) {
+	const machineID = "0123456789abcdef0123456789abcdef\n"
+	const dmiUUID = "4C4C4544-0042-3510-8052-B4C04F4E4D32\n"
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name       string
+		configured string
+		machineID  string
+		dmiUUID    string
+		stateDir   bool
+		wantSource string
+		wantID     string
+	}{
+		{"config wins", "edge-01", machineID, dmiUUID, true, AgentIDSourceConfig, "edge-01"},
+		{"machine-id before dmi", "", machineID, dmiUUID, true, AgentIDSourceMachineID, hashMachineID("0123456789abcdef0123456789abcdef")},
+		{"uninitialized machine-id falls back to dmi", "", "uninitialized\n", dmiUUID, true, AgentIDSourceDMI, hashMachineID("4c4c4544-0042-3510-8052-b4c04f4e4d32")},
+		{"placeholder dmi falls back to state file", "", "", "FFFFFFFF-FFFF-FFFF-FFFF-FFFFFFFFFFFF", true, AgentIDSourceStateFile, ""},
+		{"hostname without state dir", "", "", "", false, AgentIDSourceHostname, hostname},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withIdentityFiles(t, tt.machineID, tt.dmiUUID)
+			stateDir := ""
+			if tt.stateDir {
+				stateDir = t.TempDir()
+			}
+
+			id, source, err := ResolveAgentID(tt.configured, stateDir)
+			if err != nil {
+				t.Fatalf("ResolveAgentID: %v", err)
+			}
+			if source != tt.wantSource {
+				t.Fatalf("source = %s, want %s", source, tt.wantSource)
+			}
+			if tt.wantID != "" && id != tt.wantID {
+				t.Fatalf("id = %s, want %s", id, tt.wantID)
+			}
+			if id == "" {
+				t.Fatal("id is empty")
+			}
+		})
+	}
+}
+
+func TestResolveAgentIDStable(t *testing.T) {
+	withIdentityFiles(t, "", "")
+	stateDir := t.TempDir()
+
+	first, source, err := ResolveAgentID("", stateDir)
+	if err != nil || source != AgentIDSourceStateFile {
+		t.Fatalf("first resolve = %s (%s), %v", first, source, err)
+	}
+	second, _, err := ResolveAgentID("", stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatalf("state file ID changed between runs: %s != %s", first, second)
+	}
+
+	// 机器标识的哈希不依赖状态目录
+	withIdentityFiles(t, "0123456789abcdef0123456789abcdef", "")
+	a, _, _ := ResolveAgentID("", t.TempDir())
+	b, _, _ := ResolveAgentID("", t.TempDir())
+	if a != b {
+		t.Fatalf("machine-id derived ID differs: %s != %s", a, b)
+	}
+}
+
+func TestExpandAgentID(t *testing.T) {
+	t.Setenv("NETMON_TEST_SITE", "dc1")
+	if got := expandAgentID(" ${NETMON_TEST_SITE}-edge "); got != "dc1-edge" {
+		t.Fatalf("expandAgentID = %q, want dc1-edge", got)
+	}
+	if got := expandAgentID("${NETMON_TEST_UNSET}"); got != "" {
+		t.Fatalf("unset variable expanded to %q, want empty", got)
+	}
+}
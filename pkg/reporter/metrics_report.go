@@ -0,0 +1,294 @@
+package reporter
+
+import (
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/cardinality"
+)
+
+// ReportInfo 构建MetricsReport所需的Agent信息
+type ReportInfo struct {
+	Version            string        // Agent版本
+	StartupTime        time.Time     // 累计计数起始时间
+	ReportInterval     time.Duration // 上报间隔
+	ConfigHash         string        // 配置摘要
+	PersistenceEnabled bool          // 是否启用持久化
+	RestartDetected    bool          // 是否从持久化状态恢复（仅首个报告携带）
+}
+
+// SetReportInfo 设置报告元数据（应在Start之前调用）
+func (r *Reporter) SetReportInfo(info ReportInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info.StartupTime.IsZero() {
+		info.StartupTime = r.startTime
+	}
+	r.info = info
+}
+
+// UpdateReportInfo 更新配置热加载后变化的报告元数据
+func (r *Reporter) UpdateReportInfo(reportInterval time.Duration, configHash string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.info.ReportInterval = reportInterval
+	r.info.ConfigHash = configHash
+}
+
+// SetBaseline 以从持久化状态恢复的累计计数作为增量基准（应在Start之前调用）
+// 恢复的计数在上次运行中已经上报过，启动时间不变时Server会在原有累计值上继续累加
+func (r *Reporter) SetBaseline(startupTime time.Time, metrics common.NetworkMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastTotals = reportTotals(metrics)
+	r.lastStartup = startupTime
+}
+
+// buildMetricsReport 根据上报模式构建MetricsReport
+// entry非nil时是重放的缓存条目，使用写入缓存时的报告时间、启动时间和上报模式
+func (r *Reporter) buildMetricsReport(metrics common.NetworkMetrics, entry *SpoolEntry) *common.MetricsReport {
+	r.mu.Lock()
+	info := r.info
+	agentID := r.agentID
+	cfg := r.config
+	r.mu.Unlock()
+
+	mode := cfg.Mode
+	reportTime := time.Now()
+	if entry != nil {
+		reportTime = entry.SpooledAt
+		if !entry.StartupTime.IsZero() {
+			info.StartupTime = entry.StartupTime
+		}
+		if entry.ReportMode != "" {
+			mode = entry.ReportMode
+		}
+	}
+	if mode == "" {
+		mode = common.ReportModeIncremental
+	}
+
+	totals := reportTotals(metrics)
+
+	report := &common.MetricsReport{
+		AgentID:     agentID,
+		StartupTime: info.StartupTime,
+		ReportTime:  reportTime,
+		ReportMode:  mode,
+		SystemInfo: common.SystemMetrics{
+			Hostname:           r.hostname,
+			Interface:          metrics.Interface,
+			TotalConnections:   int64(metrics.TotalConnections),
+			TotalBytesSent:     int64(metrics.TotalBytesSent),
+			TotalBytesReceived: int64(metrics.TotalBytesRecv),
+			ActiveDomains:      len(common.DomainMetricsFromNetworkMetrics(metrics)),
+			ReportInterval:     info.ReportInterval.String(),
+			UptimeSeconds:      int64(time.Since(r.startTime).Seconds()),
+		},
+		Metadata: common.ReportMetadata{
+			Version:            info.Version,
+			ConfigHash:         info.ConfigHash,
+			Tags:               cfg.Tags,
+			PersistenceEnabled: info.PersistenceEnabled,
+			RestartDetected:    info.RestartDetected,
+		},
+	}
+
+	if mode != common.ReportModeCumulative {
+		previous, ok := r.deltaBaseline(info.StartupTime)
+		// 重放的数据没有同一运行的基准，或早于当前基准（恢复的计数已包含它）时，
+		// 无法得到相对Server已收到的数据的增量，改为发送累计值
+		if entry != nil && (!ok || anyCounterReset(totals, previous)) {
+			mode = common.ReportModeCumulative
+			report.ReportMode = mode
+		} else {
+			report.DeltaStats = calculateDeltaStats(totals, previous)
+			if cfg.IncludeTotals {
+				report.TotalStats = totals
+			}
+		}
+	}
+	if mode == common.ReportModeCumulative {
+		report.TotalStats = totals
+	}
+
+	return report
+}
+
+// deltaBaseline 返回startupTime所属运行的增量基准，基准属于其他运行时返回false
+// 新的运行从零开始计数，没有基准时整体作为增量
+func (r *Reporter) deltaBaseline(startupTime time.Time) (map[string]common.DomainMetrics, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.lastStartup.Equal(startupTime) {
+		return nil, false
+	}
+	return r.lastTotals, true
+}
+
+// reportTotals 按访问目标汇总报告中的累计计数，TotalStats和DeltaStats都由它计算
+// 没有域名的IP以IP作为目标；未归属到任何目标的流量（如eBPF只统计了总量、协议和端口）
+// 以及Agent级的协议和端口分布汇总到other，只上报IP、端口的Agent也能得到增量
+func reportTotals(metrics common.NetworkMetrics) map[string]common.DomainMetrics {
+	totals := common.DomainMetricsFromNetworkMetrics(metrics)
+
+	for ip, count := range metrics.IPsAccessed {
+		if _, exists := totals[ip]; exists {
+			continue
+		}
+		totals[ip] = common.DomainMetrics{
+			Domain:          ip,
+			AccessCount:     int64(count),
+			ConnectionCount: int64(count),
+		}
+	}
+
+	var attributed common.DomainMetrics
+	for _, m := range totals {
+		attributed.ConnectionCount += m.ConnectionCount
+		attributed.BytesSent += m.BytesSent
+		attributed.BytesReceived += m.BytesReceived
+	}
+
+	rest := common.DomainMetrics{
+		Domain:          cardinality.Other,
+		ConnectionCount: nonNegative(int64(metrics.TotalConnections) - attributed.ConnectionCount),
+		BytesSent:       nonNegative(int64(metrics.TotalBytesSent) - attributed.BytesSent),
+		BytesReceived:   nonNegative(int64(metrics.TotalBytesRecv) - attributed.BytesReceived),
+	}
+	if len(metrics.ProtocolStats) > 0 {
+		rest.ProtocolStats = make(map[string]int64, len(metrics.ProtocolStats))
+		for protocol, count := range metrics.ProtocolStats {
+			rest.ProtocolStats[protocol] = int64(count)
+		}
+	}
+	if len(metrics.PortStats) > 0 {
+		rest.PortStats = make(map[int]int64, len(metrics.PortStats))
+		for port, count := range metrics.PortStats {
+			rest.PortStats[port] = int64(count)
+		}
+	}
+	if rest.ConnectionCount == 0 && rest.BytesSent == 0 && rest.BytesReceived == 0 &&
+		len(rest.ProtocolStats) == 0 && len(rest.PortStats) == 0 {
+		return totals
+	}
+
+	if existing, exists := totals[cardinality.Other]; exists {
+		rest = common.MergeMetrics(existing, rest)
+	}
+	totals[cardinality.Other] = rest
+	return totals
+}
+
+// nonNegative 计数差为负（各项统计不同步）时按0处理
+func nonNegative(v int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// calculateDeltaStats 计算各目标相对上次成功上报（last）的增量
+func calculateDeltaStats(totals, last map[string]common.DomainMetrics) map[string]common.DomainMetrics {
+	delta := make(map[string]common.DomainMetrics)
+	for domain, current := range totals {
+		previous, exists := last[domain]
+		if !exists || counterReset(current, previous) {
+			// 首次出现或计数器被重置，整体视为增量
+			delta[domain] = current
+			continue
+		}
+
+		d := common.CalculateDelta(current, previous, 0)
+		protocols := protocolDelta(current.ProtocolStats, previous.ProtocolStats)
+		ports := portDelta(current.PortStats, previous.PortStats)
+		if d.AccessDelta == 0 && d.BytesSentDelta == 0 && d.BytesReceivedDelta == 0 && d.ConnectionDelta == 0 &&
+			len(protocols) == 0 && len(ports) == 0 {
+			continue
+		}
+
+		delta[domain] = common.DomainMetrics{
+			Domain:          domain,
+			AccessCount:     d.AccessDelta,
+			BytesSent:       d.BytesSentDelta,
+			BytesReceived:   d.BytesReceivedDelta,
+			ConnectionCount: d.ConnectionDelta,
+			LastAccessTime:  current.LastAccessTime,
+			ProtocolStats:   protocols,
+			PortStats:       ports,
+		}
+	}
+
+	return delta
+}
+
+// anyCounterReset 判断是否有目标的累计计数比基准小
+func anyCounterReset(totals, last map[string]common.DomainMetrics) bool {
+	for domain, previous := range last {
+		if counterReset(totals[domain], previous) {
+			return true
+		}
+	}
+	return false
+}
+
+// counterReset 判断目标的任一累计计数是否比上次小
+func counterReset(current, previous common.DomainMetrics) bool {
+	if current.AccessCount < previous.AccessCount || current.ConnectionCount < previous.ConnectionCount ||
+		current.BytesSent < previous.BytesSent || current.BytesReceived < previous.BytesReceived {
+		return true
+	}
+	for protocol, count := range previous.ProtocolStats {
+		if current.ProtocolStats[protocol] < count {
+			return true
+		}
+	}
+	for port, count := range previous.PortStats {
+		if current.PortStats[port] < count {
+			return true
+		}
+	}
+	return false
+}
+
+// protocolDelta 计算协议分布的增量，只保留有变化的协议
+func protocolDelta(current, previous map[string]int64) map[string]int64 {
+	var delta map[string]int64
+	for protocol, count := range current {
+		if d := count - previous[protocol]; d > 0 {
+			if delta == nil {
+				delta = make(map[string]int64)
+			}
+			delta[protocol] = d
+		}
+	}
+	return delta
+}
+
+// portDelta 计算端口分布的增量，只保留有变化的端口
+func portDelta(current, previous map[int]int64) map[int]int64 {
+	var delta map[int]int64
+	for port, count := range current {
+		if d := count - previous[port]; d > 0 {
+			if delta == nil {
+				delta = make(map[int]int64)
+			}
+			delta[port] = d
+		}
+	}
+	return delta
+}
+
+// commitReport 报告发送成功后更新增量基准和一次性元数据，startupTime为报告所属运行的启动时间
+func (r *Reporter) commitReport(startupTime time.Time, totals common.NetworkMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastTotals = reportTotals(totals)
+	r.lastStartup = startupTime
+	r.info.RestartDetected = false
+}
@@ -0,0 +1,135 @@
+package reporter
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/cardinality"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestMergeMetricsKeepsLatestCumulativeValues(t *testing.T) {
+	r := &Reporter{logger: newTestLogger()}
+
+	merged := r.mergeMetrics([]common.NetworkMetrics{
+		{
+			TotalConnections: 10,
+			DomainsAccessed:  map[string]uint64{"a.com": 3, "b.com": 1},
+			ProtocolStats:    map[string]uint64{"tcp": 10},
+			Events:           []common.NetworkEvent{{Domain: "a.com"}},
+		},
+		{
+			TotalConnections: 25,
+			DomainsAccessed:  map[string]uint64{"a.com": 7},
+			ProtocolStats:    map[string]uint64{"tcp": 20, "udp": 5},
+			Events:           []common.NetworkEvent{{Domain: "b.com"}},
+		},
+	})
+
+	if merged.TotalConnections != 25 {
+		t.Errorf("TotalConnections = %d, want 25", merged.TotalConnections)
+	}
+	if merged.DomainsAccessed["a.com"] != 7 || merged.DomainsAccessed["b.com"] != 1 {
+		t.Errorf("DomainsAccessed = %v, want a.com=7 b.com=1", merged.DomainsAccessed)
+	}
+	if merged.ProtocolStats["tcp"] != 20 || merged.ProtocolStats["udp"] != 5 {
+		t.Errorf("ProtocolStats = %v, want tcp=20 udp=5", merged.ProtocolStats)
+	}
+	if len(merged.Events) != 2 {
+		t.Errorf("len(Events) = %d, want 2", len(merged.Events))
+	}
+}
+
+func TestReportTotalsAttributesUnnamedTrafficToOther(t *testing.T) {
+	totals := reportTotals(common.NetworkMetrics{
+		TotalConnections: 100,
+		TotalBytesSent:   1000,
+		DomainsAccessed:  map[string]uint64{"a.com": 10},
+		DomainTraffic: map[string]*common.DomainTrafficStats{
+			"a.com": {BytesSent: 400, Connections: 10},
+		},
+		IPsAccessed:   map[string]uint64{"10.0.0.1": 30},
+		ProtocolStats: map[string]uint64{"tcp": 100},
+		PortStats:     map[int]uint64{443: 60},
+	})
+
+	if got := totals["10.0.0.1"]; got.ConnectionCount != 30 {
+		t.Errorf("IP entry = %+v, want 30 connections", got)
+	}
+	other := totals[cardinality.Other]
+	if other.ConnectionCount != 60 || other.BytesSent != 600 {
+		t.Errorf("other = %+v, want 60 connections and 600 bytes sent", other)
+	}
+	if other.ProtocolStats["tcp"] != 100 || other.PortStats[443] != 60 {
+		t.Errorf("other protocol/port stats = %v %v", other.ProtocolStats, other.PortStats)
+	}
+}
+
+func TestCalculateDeltaStatsForPortOnlyTraffic(t *testing.T) {
+	first := common.NetworkMetrics{
+		TotalConnections: 50,
+		ProtocolStats:    map[string]uint64{"tcp": 50},
+		PortStats:        map[int]uint64{443: 50},
+	}
+	delta := calculateDeltaStats(reportTotals(first), nil)
+	if delta[cardinality.Other].ConnectionCount != 50 {
+		t.Fatalf("first delta = %+v, want the whole total", delta)
+	}
+
+	second := common.NetworkMetrics{
+		TotalConnections: 80,
+		ProtocolStats:    map[string]uint64{"tcp": 70, "udp": 10},
+		PortStats:        map[int]uint64{443: 60, 53: 10},
+	}
+	got := calculateDeltaStats(reportTotals(second), reportTotals(first))[cardinality.Other]
+	if got.ConnectionCount != 30 {
+		t.Errorf("ConnectionCount delta = %d, want 30", got.ConnectionCount)
+	}
+	if got.ProtocolStats["tcp"] != 20 || got.ProtocolStats["udp"] != 10 {
+		t.Errorf("ProtocolStats delta = %v, want tcp=20 udp=10", got.ProtocolStats)
+	}
+	if got.PortStats[443] != 10 || got.PortStats[53] != 10 {
+		t.Errorf("PortStats delta = %v, want 443=10 53=10", got.PortStats)
+	}
+
+	// 计数器变小视为Agent重启，整体作为增量
+	restarted := calculateDeltaStats(reportTotals(common.NetworkMetrics{TotalConnections: 5}), reportTotals(second))
+	if restarted[cardinality.Other].ConnectionCount != 5 {
+		t.Errorf("delta after restart = %+v, want 5", restarted[cardinality.Other])
+	}
+}
+
+func TestRestoredBaselineSendsZeroFirstDelta(t *testing.T) {
+	r := &Reporter{logger: newTestLogger(), config: &config.ReporterConfig{Mode: common.ReportModeIncremental}}
+
+	// 从持久化状态恢复的累计计数在上次运行中已经上报过
+	restored := common.NetworkMetrics{
+		TotalConnections: 500,
+		TotalBytesSent:   4000,
+		ProtocolStats:    map[string]uint64{"tcp": 400, "udp": 100},
+	}
+	startup := time.Now().Add(-time.Hour)
+	r.SetReportInfo(ReportInfo{StartupTime: startup})
+	r.SetBaseline(startup, restored)
+
+	if report := r.buildMetricsReport(restored, nil); len(report.DeltaStats) != 0 {
+		t.Fatalf("first delta after restore = %+v, want empty", report.DeltaStats)
+	}
+
+	restored.TotalConnections += 20
+	restored.ProtocolStats["tcp"] += 20
+	got := r.buildMetricsReport(restored, nil).DeltaStats[cardinality.Other]
+	if got.ConnectionCount != 20 || got.ProtocolStats["tcp"] != 20 || got.BytesSent != 0 {
+		t.Errorf("delta after new traffic = %+v, want 20 tcp connections", got)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"sync"
@@ -13,6 +13,8 @@ import (
 
 	"go-net-monitoring/internal/common"
 	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/codec"
+	"go-net-monitoring/pkg/tlsutil"
 
 	"github.com/sirupsen/logrus"
 )
@@ -31,6 +33,45 @@ type Reporter struct {
 	agentID  string
 	hostname string
 	stats    *ReporterStats
+	spool    *Spool
+
+	// 队列已满时的溢出数据（受mu保护），由批处理协程按顺序写入磁盘缓存；
+	// 溢出期间新数据都追加到这里，保证只有批处理协程读取队列
+	overflow     []common.NetworkMetrics
+	overflowChan chan struct{}
+
+	// 重试调度（仅由批处理协程访问）
+	outbox  []*outboxItem
+	retryAt *time.Timer
+	retryC  <-chan time.Time
+
+	// 熔断器，探测成功后通过resumeChan通知批处理协程
+	breaker    *circuitBreaker
+	resumeChan chan struct{}
+
+	// gRPC流传输（transport为grpc时使用）
+	stream         *streamClient
+	commandHandler CommandHandler
+
+	// 心跳：heartbeatInfo提供Agent运行信息，heartbeatChan触发立即发送
+	heartbeatInfo HeartbeatInfoFunc
+	heartbeatChan chan struct{}
+
+	// 向Server认证的API Key（reporter.auth）
+	credentials *agentCredentials
+
+	// 输出目标：serverEnabled表示是否上报到中心Server，其余目标各自独立批处理和重试
+	serverEnabled bool
+	sinks         []*sinkWorker
+
+	// 标签基数限制（reporter.cardinality）
+	cardinality *cardinalityLimiter
+
+	// MetricsReport构建状态
+	startTime   time.Time
+	info        ReportInfo
+	lastTotals  map[string]common.DomainMetrics
+	lastStartup time.Time // lastTotals所属运行的累计计数起始时间
 }
 
 // ReporterStats 上报统计
@@ -44,8 +85,37 @@ type ReporterStats struct {
 	LastError      string
 	QueueSize      int
 	BatchSize      int
+
+	lastSuccessTime time.Time
+
+	// 磁盘缓存
+	SpoolDepth      int
+	SpoolBytes      int64
+	SpooledReports  uint64
+	ReplayedReports uint64
+	SpoolDropped    uint64
+
+	// 重试与熔断
+	PendingRetries      int
+	BreakerState        BreakerState
+	ConsecutiveFailures int
+	BreakerOpenedAt     time.Time
+	NextProbeTime       time.Time
+
+	// 传输方式
+	Transport       string
+	StreamConnected bool
+
+	// 最近一次上报中各指标被汇总到other的标签值数量
+	CollapsedLabelValues map[string]int
+
+	// 各输出目标的健康统计（中心Server在前）
+	Sinks []SinkStats
 }
 
+// spoolReplayInterval 磁盘缓存重放检查间隔
+const spoolReplayInterval = 30 * time.Second
+
 // NewReporter 创建新的上报器
 func NewReporter(cfg *config.ReporterConfig, logger *logrus.Logger) (*Reporter, error) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -55,31 +125,36 @@ func NewReporter(cfg *config.ReporterConfig, logger *logrus.Logger) (*Reporter,
 		Timeout: cfg.Timeout,
 	}
 
-	// 配置TLS
+	// 配置TLS：客户端证书和CA文件轮换后自动重新加载
+	var tlsConfig *tls.Config
 	if cfg.EnableTLS {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false, // 生产环境应该验证证书
+		reloader, err := tlsutil.NewReloader(cfg.TLSCertPath, cfg.TLSKeyPath, cfg.TLSCAPath, logger)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("加载TLS配置失败: %w", err)
 		}
+		tlsConfig = reloader.ClientConfig(cfg.TLSServerName)
 
-		if cfg.TLSCertPath != "" && cfg.TLSKeyPath != "" {
-			cert, err := tls.LoadX509KeyPair(cfg.TLSCertPath, cfg.TLSKeyPath)
-			if err != nil {
-				cancel()
-				return nil, fmt.Errorf("加载TLS证书失败: %w", err)
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-		}
-
-		client.Transport = &http.Transport{
-			TLSClientConfig: tlsConfig,
-		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
 	}
 
 	hostname, _ := os.Hostname()
-	agentID := generateAgentID(hostname)
+	agentID, source, err := ResolveAgentID(cfg.AgentID, cfg.StateDir)
+	if err != nil {
+		logger.WithError(err).Warn("持久化Agent ID失败，使用主机名作为Agent ID")
+	}
+	logger.WithFields(logrus.Fields{
+		"agent_id": agentID,
+		"source":   source,
+	}).Info("Agent ID已确定")
+
+	// 复制配置，热加载时整体替换而不修改调用方的配置
+	cfgCopy := *cfg
 
 	reporter := &Reporter{
-		config:   cfg,
+		config:   &cfgCopy,
 		logger:   logger,
 		client:   client,
 		queue:    make(chan common.NetworkMetrics, cfg.BatchSize*2),
@@ -89,6 +164,77 @@ func NewReporter(cfg *config.ReporterConfig, logger *logrus.Logger) (*Reporter,
 		agentID:  agentID,
 		hostname: hostname,
 		stats:    &ReporterStats{},
+
+		startTime:  time.Now(),
+		lastTotals: make(map[string]common.DomainMetrics),
+
+		breaker:    newCircuitBreaker(cfg.BreakerThreshold, cfg.RetryDelay, cfg.MaxRetryDelay),
+		resumeChan: make(chan struct{}, 1),
+
+		overflowChan: make(chan struct{}, 1),
+
+		heartbeatChan: make(chan struct{}, 1),
+
+		cardinality: newCardinalityLimiter(cfg.Cardinality),
+	}
+	reporter.info.StartupTime = reporter.startTime
+
+	reporter.credentials = newAgentCredentials(cfg.Auth, cfg.StateDir, logger)
+	reporter.credentials.enrollFn = reporter.enroll
+
+	// 未配置输出目标时只上报到中心Server
+	reporter.serverEnabled = len(cfg.Sinks) == 0 || cfg.HasSink(config.SinkHTTP)
+
+	// 其他输出目标
+	for _, sinkCfg := range cfg.Sinks {
+		if sinkCfg.Type == config.SinkHTTP {
+			continue
+		}
+		sink, err := newSink(sinkCfg, reporter.startTime, logger)
+		if err != nil {
+			reporter.closeSinks()
+			cancel()
+			return nil, fmt.Errorf("创建输出目标 %s 失败: %w", sinkCfg.Name, err)
+		}
+		reporter.sinks = append(reporter.sinks, newSinkWorker(sinkCfg, sink, logger))
+		logger.WithFields(logrus.Fields{
+			"sink": sinkCfg.Name,
+			"type": sinkCfg.Type,
+		}).Info("已启用输出目标")
+	}
+
+	// gRPC流传输
+	if cfg.Transport == "grpc" && reporter.serverEnabled {
+		stream, err := newStreamClient(cfg.GRPCAddress, tlsConfig, cfg.Compression, logger)
+		if err != nil {
+			reporter.closeSinks()
+			cancel()
+			return nil, err
+		}
+		stream.identity = func() (string, string) {
+			return reporter.GetAgentID(), reporter.hostname
+		}
+		stream.onCommand = reporter.executeCommand
+		stream.credentials = reporter.credentials.get
+		stream.sign = cfg.Auth.Sign
+		stream.onUnauthenticated = reporter.credentials.rejected
+		reporter.stream = stream
+		logger.WithField("address", cfg.GRPCAddress).Info("使用gRPC流上报数据")
+	}
+
+	// 打开磁盘缓存
+	if cfg.Spool.Enabled && reporter.serverEnabled {
+		spool, err := OpenSpool(SpoolOptions{
+			Dir:          cfg.Spool.Dir,
+			MaxBytes:     cfg.Spool.MaxBytes,
+			MaxAge:       cfg.Spool.MaxAge,
+			SegmentBytes: cfg.Spool.SegmentBytes,
+		}, logger)
+		if err != nil {
+			logger.WithError(err).Warn("打开磁盘缓存失败，发送失败的数据将被丢弃")
+		} else {
+			reporter.spool = spool
+		}
 	}
 
 	return reporter, nil
@@ -98,6 +244,25 @@ func NewReporter(cfg *config.ReporterConfig, logger *logrus.Logger) (*Reporter,
 func (r *Reporter) Start() error {
 	r.logger.Info("启动数据上报器")
 
+	// 启动各输出目标的协程
+	for _, worker := range r.sinks {
+		r.wg.Add(1)
+		go func(w *sinkWorker) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					r.logger.Errorf("输出目标 %s 协程panic: %v", w.cfg.Name, rec)
+				}
+				r.wg.Done()
+			}()
+			w.run(r.ctx)
+		}(worker)
+	}
+
+	if !r.serverEnabled {
+		r.logger.Info("未配置http输出目标，不上报到中心Server")
+		return nil
+	}
+
 	// 启动批处理协程
 	r.logger.Debug("启动批处理协程...")
 	r.wg.Add(1)
@@ -152,11 +317,50 @@ func (r *Reporter) Stop() error {
 		r.logger.Warn("等待上报器goroutine结束超时")
 	}
 
+	if r.spool != nil {
+		if err := r.spool.Close(); err != nil {
+			r.logger.WithError(err).Error("关闭磁盘缓存失败")
+		}
+	}
+
+	if r.stream != nil {
+		if err := r.stream.Close(); err != nil {
+			r.logger.WithError(err).Debug("关闭gRPC连接失败")
+		}
+	}
+
 	return nil
 }
 
 // Report 上报网络指标
 func (r *Reporter) Report(metrics common.NetworkMetrics) error {
+	metrics = r.cardinality.apply(metrics)
+
+	if len(r.sinks) > 0 {
+		record := common.ReportRequest{
+			AgentID:   r.GetAgentID(),
+			Hostname:  r.hostname,
+			Timestamp: time.Now(),
+			Metrics:   metrics,
+		}
+		for _, worker := range r.sinks {
+			worker.Enqueue(record)
+		}
+	}
+
+	if !r.serverEnabled {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.overflow != nil {
+		// 溢出数据还未写入缓存，新数据排在其后
+		r.overflow = append(r.overflow, metrics)
+		return nil
+	}
+
 	select {
 	case r.queue <- metrics:
 		r.updateQueueSize(len(r.queue))
@@ -164,34 +368,82 @@ func (r *Reporter) Report(metrics common.NetworkMetrics) error {
 	case <-r.ctx.Done():
 		return fmt.Errorf("上报器已停止")
 	default:
+		if r.spool != nil {
+			r.logger.Warn("上报队列已满，写入磁盘缓存")
+			r.overflow = []common.NetworkMetrics{metrics}
+			select {
+			case r.overflowChan <- struct{}{}:
+			default:
+			}
+			return nil
+		}
 		r.logger.Warn("上报队列已满，丢弃数据")
 		return fmt.Errorf("上报队列已满")
 	}
 }
 
+// spoolOverflow 队列溢出时按顺序将待重试数据、批数据、队列中的数据和溢出数据写入磁盘缓存
+// 只在批处理协程中调用：溢出期间Report不再写入队列，取出溢出数据前队列中的数据都早于溢出数据
+func (r *Reporter) spoolOverflow() {
+	r.spoolOutbox()
+
+	r.mu.Lock()
+	batch := r.batch
+	r.batch = nil
+	r.mu.Unlock()
+	if len(batch) > 0 {
+		r.spoolMetrics(r.mergeMetrics(batch))
+	}
+
+	for {
+		select {
+		case queued, ok := <-r.queue:
+			if ok {
+				r.spoolMetrics(queued)
+				continue
+			}
+		default:
+		}
+		break
+	}
+
+	r.mu.Lock()
+	overflow := r.overflow
+	r.overflow = nil
+	r.mu.Unlock()
+
+	for _, metrics := range overflow {
+		r.spoolMetrics(metrics)
+	}
+	r.updateQueueSize(len(r.queue))
+}
+
 // batchProcessor 批处理协程
 func (r *Reporter) batchProcessor() {
-	defer r.wg.Done()
-
 	ticker := time.NewTicker(5 * time.Second) // 减少检查间隔
 	defer ticker.Stop()
 
+	replayTicker := time.NewTicker(spoolReplayInterval)
+	defer replayTicker.Stop()
+
+	// 重放上次运行遗留的缓存数据
+	if r.spool != nil && r.spool.Len() > 0 {
+		r.replaySpool()
+	}
+
+	defer r.stopRetryTimer()
+
 	for {
 		select {
 		case <-r.ctx.Done():
 			// 处理剩余的批数据
-			if len(r.batch) > 0 {
-				r.logger.Debug("处理剩余的批数据")
-				r.sendBatch()
-			}
+			r.flushOnStop()
 			return
 
 		case metrics, ok := <-r.queue:
 			if !ok {
 				// 队列已关闭，处理剩余数据后退出
-				if len(r.batch) > 0 {
-					r.sendBatch()
-				}
+				r.flushOnStop()
 				return
 			}
 
@@ -213,30 +465,119 @@ func (r *Reporter) batchProcessor() {
 			if shouldSend {
 				r.sendBatch()
 			}
+
+		case <-r.overflowChan:
+			r.spoolOverflow()
+
+		case <-r.retryC:
+			// 到达重试时间
+			r.retryC = nil
+			r.flushOutbox()
+
+		case <-r.resumeChan:
+			// 熔断器恢复，先发送内存中的待重试数据，再重放磁盘缓存
+			r.flushOutbox()
+			if r.spool != nil && r.spool.Len() > 0 {
+				r.replaySpool()
+			}
+
+		case <-replayTicker.C:
+			if r.spool != nil && r.spool.Len() > 0 {
+				r.replaySpool()
+			}
 		}
 	}
 }
 
-// reportProcessor 上报处理协程
-func (r *Reporter) reportProcessor() {
-	defer r.wg.Done()
+// flushOnStop 停止时处理剩余数据：启用磁盘缓存时直接写入缓存，下次启动后重放
+func (r *Reporter) flushOnStop() {
+	if r.spool == nil {
+		pending := len(r.batch) + len(r.outbox)
+		if pending > 0 {
+			r.logger.WithField("count", pending).Warn("未启用磁盘缓存，丢弃未发送的数据")
+		}
+		return
+	}
+
+	// 待重试的数据早于批数据，先写入缓存
+	r.spoolOutbox()
+
+	for {
+		select {
+		case metrics, ok := <-r.queue:
+			if ok {
+				r.batch = append(r.batch, metrics)
+				continue
+			}
+		default:
+		}
+		break
+	}
+
+	r.mu.Lock()
+	batch := r.batch
+	r.batch = nil
+	r.mu.Unlock()
+
+	if len(batch) > 0 {
+		r.logger.WithField("count", len(batch)).Info("停止时将未发送的数据写入磁盘缓存")
+		r.spoolMetrics(r.mergeMetrics(batch))
+	}
 
-	// 这里可以添加额外的上报逻辑
-	// 比如健康检查、状态上报等
+	r.mu.Lock()
+	overflow := r.overflow
+	r.overflow = nil
+	r.mu.Unlock()
+	for _, metrics := range overflow {
+		r.spoolMetrics(metrics)
+	}
+}
 
-	ticker := time.NewTicker(1 * time.Minute)
+// reportProcessor 上报处理协程：定时发送心跳，熔断期间用心跳探测Server
+func (r *Reporter) reportProcessor() {
+	ticker := time.NewTicker(heartbeatInterval)
 	defer ticker.Stop()
 
+	probeTicker := time.NewTicker(time.Second)
+	defer probeTicker.Stop()
+
 	for {
 		select {
 		case <-r.ctx.Done():
 			return
 		case <-ticker.C:
-			r.sendHeartbeat()
+			if err := r.sendHeartbeat(); err != nil {
+				r.logger.WithError(err).Debug("发送心跳失败")
+			}
+		case <-r.heartbeatChan:
+			if err := r.sendHeartbeat(); err != nil {
+				r.logger.WithError(err).Debug("发送心跳失败")
+			}
+		case <-probeTicker.C:
+			if r.breaker.TryProbe() {
+				r.probe()
+			}
 		}
 	}
 }
 
+// probe 熔断器半开时发送心跳探测Server是否恢复
+func (r *Reporter) probe() {
+	if err := r.sendHeartbeat(); err != nil {
+		r.breaker.RecordFailure()
+		r.logger.WithError(err).WithField("next_probe", r.breaker.Snapshot().NextProbe).Debug("Server探测失败")
+		return
+	}
+
+	r.breaker.RecordSuccess()
+	r.logger.Info("Server探测成功，熔断器关闭，恢复上报")
+
+	select {
+	case r.resumeChan <- struct{}{}:
+	default:
+	}
+}
+
 // sendBatch 发送批数据
 func (r *Reporter) sendBatch() {
 	r.mu.Lock()
@@ -256,28 +597,96 @@ func (r *Reporter) sendBatch() {
 	// 合并所有指标数据
 	mergedMetrics := r.mergeMetrics(batch)
 
-	// 创建上报请求
-	request := common.ReportRequest{
-		AgentID:   r.agentID,
+	// 缓存中还有未重放的数据时，新数据追加到缓存末尾以保持上报顺序
+	if r.spool != nil && r.spool.Len() > 0 {
+		r.spoolMetrics(mergedMetrics)
+		if r.breaker.Allow() {
+			r.replaySpool()
+		}
+		return
+	}
+
+	// 加入发送队列，发送失败时按退避时间重试
+	r.enqueueOutbox(mergedMetrics)
+	r.flushOutbox()
+}
+
+// buildRequest 创建上报请求，entry非nil时按缓存条目所属的运行构建（重放磁盘缓存时使用）
+func (r *Reporter) buildRequest(metrics common.NetworkMetrics, entry *SpoolEntry) common.ReportRequest {
+	report := r.buildMetricsReport(metrics, entry)
+
+	return common.ReportRequest{
+		AgentID:   report.AgentID,
 		Hostname:  r.hostname,
-		Timestamp: time.Now(),
-		Metrics:   mergedMetrics,
+		Timestamp: report.ReportTime,
+		Metrics:   metrics,
+		Report:    report,
 	}
+}
 
-	// 发送请求
-	if err := r.sendRequest(request); err != nil {
-		r.logger.WithError(err).Error("发送批数据失败")
-		r.updateStats(false, err.Error())
+// spoolMetrics 将数据写入磁盘缓存，未启用缓存时丢弃
+func (r *Reporter) spoolMetrics(metrics common.NetworkMetrics) {
+	if r.spool == nil {
+		r.logger.Warn("未启用磁盘缓存，丢弃发送失败的数据")
+		return
+	}
 
-		// 重试逻辑
-		r.retryRequest(request)
-	} else {
-		r.logger.Debug("成功发送批数据")
+	r.mu.Lock()
+	entry := SpoolEntry{StartupTime: r.info.StartupTime, ReportMode: r.config.Mode, Metrics: metrics}
+	r.mu.Unlock()
+
+	if err := r.spool.Append(entry); err != nil {
+		r.logger.WithError(err).Error("写入磁盘缓存失败，丢弃数据")
+		return
+	}
+
+	r.stats.mu.Lock()
+	r.stats.SpooledReports++
+	r.stats.mu.Unlock()
+
+	r.logger.WithField("spool_depth", r.spool.Len()).Debug("数据已写入磁盘缓存")
+}
+
+// replaySpool 按顺序重放磁盘缓存，遇到发送失败时停止，等待下次重放
+func (r *Reporter) replaySpool() {
+	if !r.breaker.Allow() {
+		return
+	}
+
+	replayed, err := r.spool.Replay(func(entry SpoolEntry) error {
+		request := r.buildRequest(entry.Metrics, &entry)
+		if err := r.sendRequest(request); err != nil {
+			if r.breaker.RecordFailure() {
+				r.logger.WithError(err).Warn("连续发送失败，熔断器打开，暂停上报")
+			}
+			return err
+		}
+
+		r.breaker.RecordSuccess()
 		r.updateStats(true, "")
+		r.commitReport(request.Report.StartupTime, entry.Metrics)
+		return nil
+	})
+
+	if replayed > 0 {
+		r.stats.mu.Lock()
+		r.stats.ReplayedReports += uint64(replayed)
+		r.stats.mu.Unlock()
+
+		r.logger.WithFields(logrus.Fields{
+			"replayed":  replayed,
+			"remaining": r.spool.Len(),
+		}).Info("已重放磁盘缓存数据")
+	}
+
+	if err != nil {
+		r.logger.WithError(err).WithField("spool_depth", r.spool.Len()).Debug("重放磁盘缓存失败，稍后重试")
 	}
 }
 
 // mergeMetrics 合并多个指标数据
+// Agent的快照中计数器都是启动以来的累计值，合并时每个计数取最新快照中的值（只在较早快照中出现的标签取其最后一次的值），
+// 只有事件这样的增量数据按顺序拼接
 func (r *Reporter) mergeMetrics(batch []common.NetworkMetrics) common.NetworkMetrics {
 	if len(batch) == 0 {
 		return common.NetworkMetrics{}
@@ -287,70 +696,58 @@ func (r *Reporter) mergeMetrics(batch []common.NetworkMetrics) common.NetworkMet
 		return batch[0]
 	}
 
-	// 合并所有指标
+	latest := batch[len(batch)-1]
 	merged := common.NetworkMetrics{
-		Timestamp:       time.Now(),
-		HostID:          r.agentID,
-		Hostname:        r.hostname,
-		DomainsAccessed: make(map[string]uint64),
-		IPsAccessed:     make(map[string]uint64),
-		ProtocolStats:   make(map[string]uint64),
-		PortStats:       make(map[int]uint64),
-		DomainTraffic:   make(map[string]*common.DomainTrafficStats),
+		Timestamp:        latest.Timestamp,
+		HostID:           latest.HostID,
+		Hostname:         latest.Hostname,
+		Interface:        latest.Interface,
+		TotalConnections: latest.TotalConnections,
+		TotalBytesSent:   latest.TotalBytesSent,
+		TotalBytesRecv:   latest.TotalBytesRecv,
+		TotalPacketsSent: latest.TotalPacketsSent,
+		TotalPacketsRecv: latest.TotalPacketsRecv,
+		DomainsAccessed:  make(map[string]uint64),
+		IPsAccessed:      make(map[string]uint64),
+		ProtocolStats:    make(map[string]uint64),
+		PortStats:        make(map[int]uint64),
+		DomainTraffic:    make(map[string]*common.DomainTrafficStats),
+		TopProcesses:     latest.TopProcesses,
+	}
+	if merged.Timestamp.IsZero() {
+		merged.Timestamp = time.Now()
+	}
+	if merged.HostID == "" {
+		merged.HostID = r.GetAgentID()
+	}
+	if merged.Hostname == "" {
+		merged.Hostname = r.hostname
 	}
 
+	// 按时间顺序覆盖，每个标签保留最后一次出现时的累计值
 	for _, metrics := range batch {
-		// 合并基础统计
-		merged.TotalConnections += metrics.TotalConnections
-		merged.TotalBytesSent += metrics.TotalBytesSent
-		merged.TotalBytesRecv += metrics.TotalBytesRecv
-		merged.TotalPacketsSent += metrics.TotalPacketsSent
-		merged.TotalPacketsRecv += metrics.TotalPacketsRecv
-
-		// 合并域名统计
 		for domain, count := range metrics.DomainsAccessed {
-			merged.DomainsAccessed[domain] += count
+			merged.DomainsAccessed[domain] = count
 		}
-
-		// 合并IP统计
 		for ip, count := range metrics.IPsAccessed {
-			merged.IPsAccessed[ip] += count
+			merged.IPsAccessed[ip] = count
 		}
-
-		// 合并协议统计
 		for protocol, count := range metrics.ProtocolStats {
-			merged.ProtocolStats[protocol] += count
+			merged.ProtocolStats[protocol] = count
 		}
-
-		// 合并端口统计
 		for port, count := range metrics.PortStats {
-			merged.PortStats[port] += count
+			merged.PortStats[port] = count
 		}
-
-		// 合并域名流量统计
 		for domain, stats := range metrics.DomainTraffic {
 			if stats == nil {
 				continue
 			}
-
-			if merged.DomainTraffic[domain] == nil {
-				merged.DomainTraffic[domain] = &common.DomainTrafficStats{
-					Domain: domain,
-				}
-			}
-
-			mergedStats := merged.DomainTraffic[domain]
-			mergedStats.BytesSent += stats.BytesSent
-			mergedStats.BytesReceived += stats.BytesReceived
-			mergedStats.PacketsSent += stats.PacketsSent
-			mergedStats.PacketsRecv += stats.PacketsRecv
-			mergedStats.Connections += stats.Connections
-
-			// 使用最新的访问时间
-			if stats.LastAccess.After(mergedStats.LastAccess) {
-				mergedStats.LastAccess = stats.LastAccess
-			}
+			copied := *stats
+			merged.DomainTraffic[domain] = &copied
 		}
+
+		// 事件是每个上报周期内新产生的，按顺序拼接
+		merged.Events = append(merged.Events, metrics.Events...)
 	}
 
 	r.logger.Debugf("合并后的指标: 域名=%d, IP=%d, 协议=%d, 域名流量=%d",
@@ -361,34 +758,62 @@ func (r *Reporter) mergeMetrics(batch []common.NetworkMetrics) common.NetworkMet
 
 // sendRequest 发送HTTP请求
 func (r *Reporter) sendRequest(request common.ReportRequest) error {
-	data, err := json.Marshal(request)
+	if r.stream != nil {
+		return r.sendStreamReport(request)
+	}
+
+	cfg, client := r.getConfig(), r.getClient()
+	contentType := codec.ContentTypeForFormat(cfg.Encoding)
+
+	data, err := codec.MarshalReportRequest(&request, contentType)
 	if err != nil {
 		return fmt.Errorf("序列化请求数据失败: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(r.ctx, "POST", r.config.ServerURL, bytes.NewBuffer(data))
+	encoding, err := codec.NormalizeEncoding(cfg.Compression)
+	if err != nil {
+		return err
+	}
+	data, err = codec.Compress(data, encoding)
+	if err != nil {
+		return fmt.Errorf("压缩请求数据失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, "POST", cfg.ServerURL, bytes.NewBuffer(data))
 	if err != nil {
 		return fmt.Errorf("创建HTTP请求失败: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	if encoding != codec.EncodingIdentity {
+		req.Header.Set("Content-Encoding", encoding)
+	}
 	req.Header.Set("User-Agent", fmt.Sprintf("network-monitor-agent/%s", "1.0.0"))
-	req.Header.Set("X-Agent-ID", r.agentID)
+	req.Header.Set("X-Agent-ID", request.AgentID)
 	req.Header.Set("X-Hostname", r.hostname)
+	if err := r.authorize(req, data); err != nil {
+		return fmt.Errorf("认证失败: %w", err)
+	}
 
-	resp, err := r.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("发送HTTP请求失败: %w", err)
 	}
 	defer resp.Body.Close()
+	r.checkAuthResponse(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("服务器返回错误状态码: %d", resp.StatusCode)
 	}
 
-	// 解析响应
-	var response common.ReportResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	// 解析响应（旧版Server只返回JSON）
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	response, err := codec.UnmarshalReportResponse(body, resp.Header.Get("Content-Type"))
+	if err != nil {
 		return fmt.Errorf("解析响应失败: %w", err)
 	}
 
@@ -399,69 +824,6 @@ func (r *Reporter) sendRequest(request common.ReportRequest) error {
 	return nil
 }
 
-// retryRequest 重试请求
-func (r *Reporter) retryRequest(request common.ReportRequest) {
-	for i := 0; i < r.config.RetryCount; i++ {
-		r.logger.Infof("重试发送请求，第 %d 次", i+1)
-
-		time.Sleep(r.config.RetryDelay)
-
-		if err := r.sendRequest(request); err != nil {
-			r.logger.WithError(err).Warnf("第 %d 次重试失败", i+1)
-			r.stats.mu.Lock()
-			r.stats.RetryCount++
-			r.stats.mu.Unlock()
-			continue
-		}
-
-		r.logger.Info("重试成功")
-		r.updateStats(true, "")
-		return
-	}
-
-	r.logger.Error("重试次数用尽，放弃发送")
-	r.updateStats(false, "重试次数用尽")
-}
-
-// sendHeartbeat 发送心跳
-func (r *Reporter) sendHeartbeat() {
-	agentInfo := common.AgentInfo{
-		ID:        r.agentID,
-		Hostname:  r.hostname,
-		Version:   "1.0.0",
-		StartTime: time.Now(), // 应该记录实际启动时间
-		LastSeen:  time.Now(),
-		Status:    "online",
-	}
-
-	data, err := json.Marshal(agentInfo)
-	if err != nil {
-		r.logger.WithError(err).Error("序列化心跳数据失败")
-		return
-	}
-
-	heartbeatURL := r.config.ServerURL + "/heartbeat"
-	req, err := http.NewRequestWithContext(r.ctx, "POST", heartbeatURL, bytes.NewBuffer(data))
-	if err != nil {
-		r.logger.WithError(err).Error("创建心跳请求失败")
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Agent-ID", r.agentID)
-
-	resp, err := r.client.Do(req)
-	if err != nil {
-		r.logger.WithError(err).Debug("发送心跳失败")
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		r.logger.Debug("心跳发送成功")
-	}
-}
-
 // updateStats 更新统计信息
 func (r *Reporter) updateStats(success bool, errorMsg string) {
 	r.stats.mu.Lock()
@@ -473,6 +835,7 @@ func (r *Reporter) updateStats(success bool, errorMsg string) {
 	if success {
 		r.stats.SuccessReports++
 		r.stats.LastError = ""
+		r.stats.lastSuccessTime = r.stats.LastReportTime
 	} else {
 		r.stats.FailedReports++
 		r.stats.LastError = errorMsg
@@ -495,22 +858,133 @@ func (r *Reporter) updateBatchSize(size int) {
 
 // GetStats 获取统计信息
 func (r *Reporter) GetStats() ReporterStats {
+	var spoolStats SpoolStats
+	if r.spool != nil {
+		spoolStats = r.spool.Stats()
+	}
+	breaker := r.breaker.Snapshot()
+	transport := r.getConfig().Transport
+	streamConnected := r.stream != nil && r.stream.Connected()
+
+	sinks := make([]SinkStats, 0, len(r.sinks)+1)
+	for _, worker := range r.sinks {
+		sinks = append(sinks, worker.Stats())
+	}
+
 	r.stats.mu.RLock()
 	defer r.stats.mu.RUnlock()
 
+	if r.serverEnabled {
+		server := SinkStats{
+			Name:                config.SinkHTTP,
+			Type:                transport,
+			Healthy:             breaker.State == BreakerClosed && breaker.Failures == 0,
+			QueueSize:           r.stats.QueueSize,
+			SentRecords:         r.stats.SuccessReports,
+			FailedRecords:       r.stats.FailedReports,
+			DroppedRecords:      spoolStats.Dropped,
+			Retries:             r.stats.RetryCount,
+			ConsecutiveFailures: breaker.Failures,
+			LastSuccess:         r.stats.lastSuccessTime,
+			LastError:           r.stats.LastError,
+		}
+		sinks = append([]SinkStats{server}, sinks...)
+	}
+
 	return ReporterStats{
-		TotalReports:   r.stats.TotalReports,
-		SuccessReports: r.stats.SuccessReports,
-		FailedReports:  r.stats.FailedReports,
-		RetryCount:     r.stats.RetryCount,
-		LastReportTime: r.stats.LastReportTime,
-		LastError:      r.stats.LastError,
-		QueueSize:      r.stats.QueueSize,
-		BatchSize:      r.stats.BatchSize,
+		TotalReports:    r.stats.TotalReports,
+		SuccessReports:  r.stats.SuccessReports,
+		FailedReports:   r.stats.FailedReports,
+		RetryCount:      r.stats.RetryCount,
+		LastReportTime:  r.stats.LastReportTime,
+		LastError:       r.stats.LastError,
+		QueueSize:       r.stats.QueueSize,
+		BatchSize:       r.stats.BatchSize,
+		SpoolDepth:      spoolStats.Depth,
+		SpoolBytes:      spoolStats.Bytes,
+		SpooledReports:  r.stats.SpooledReports,
+		ReplayedReports: r.stats.ReplayedReports,
+		SpoolDropped:    spoolStats.Dropped,
+
+		PendingRetries:      r.stats.PendingRetries,
+		BreakerState:        breaker.State,
+		ConsecutiveFailures: breaker.Failures,
+		BreakerOpenedAt:     breaker.OpenedAt,
+		NextProbeTime:       breaker.NextProbe,
+
+		Transport:       transport,
+		StreamConnected: streamConnected,
+
+		CollapsedLabelValues: r.cardinality.stats(),
+
+		Sinks: sinks,
+	}
+}
+
+// closeSinks 关闭已创建的输出目标（创建Reporter失败时使用）
+func (r *Reporter) closeSinks() {
+	for _, worker := range r.sinks {
+		worker.sink.Close()
+	}
+}
+
+// getConfig 获取当前生效的配置
+func (r *Reporter) getConfig() *config.ReporterConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.config
+}
+
+// getClient 获取当前HTTP客户端
+func (r *Reporter) getClient() *http.Client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.client
+}
+
+// UpdateConfig 热加载上报配置
+// TLS、BatchSize、AgentID和StateDir在创建时确定，变更需要重启
+func (r *Reporter) UpdateConfig(cfg *config.ReporterConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	updated := *r.config
+	updated.ServerURL = cfg.ServerURL
+	updated.Timeout = cfg.Timeout
+	updated.RetryCount = cfg.RetryCount
+	updated.RetryDelay = cfg.RetryDelay
+	updated.Mode = cfg.Mode
+	updated.IncludeTotals = cfg.IncludeTotals
+	updated.Tags = cfg.Tags
+	updated.MaxRetryDelay = cfg.MaxRetryDelay
+	updated.BreakerThreshold = cfg.BreakerThreshold
+	updated.Encoding = cfg.Encoding
+	updated.Compression = cfg.Compression
+	r.config = &updated
+	r.breaker.Configure(cfg.BreakerThreshold, cfg.RetryDelay, cfg.MaxRetryDelay)
+
+	if r.client.Timeout != cfg.Timeout {
+		r.client = &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: r.client.Transport,
+		}
 	}
 }
 
-// generateAgentID 生成Agent ID
-func generateAgentID(hostname string) string {
-	return fmt.Sprintf("%s-%d", hostname, time.Now().Unix())
+// GetAgentID 获取Agent ID
+func (r *Reporter) GetAgentID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.agentID
+}
+
+// SetAgentID 设置Agent ID（用于恢复持久化的Agent标识，应在Start之前调用）
+func (r *Reporter) SetAgentID(agentID string) {
+	if agentID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	r.agentID = agentID
+	r.mu.Unlock()
 }
@@ -0,0 +1,70 @@
+package reporter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+func newTestReporter(t *testing.T) *Reporter {
+	t.Helper()
+
+	dir := t.TempDir()
+	r, err := NewReporter(&config.ReporterConfig{
+		ServerURL:  "http://127.0.0.1:1/api/v1/metrics",
+		Timeout:    time.Second,
+		RetryDelay: time.Second,
+		BatchSize:  1,
+		AgentID:    "agent-test",
+		StateDir:   dir,
+		Spool: config.SpoolConfig{
+			Enabled:      true,
+			Dir:          filepath.Join(dir, "spool"),
+			SegmentBytes: 1 << 20,
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewReporter: %v", err)
+	}
+	t.Cleanup(func() { r.spool.Close() })
+	return r
+}
+
+func TestReportOverflowSpoolsInOrder(t *testing.T) {
+	r := newTestReporter(t)
+
+	// 批处理协程未启动，队列（容量为BatchSize*2）写满后的数据进入溢出列表
+	for seq := uint64(1); seq <= 5; seq++ {
+		if err := r.Report(common.NetworkMetrics{TotalConnections: seq}); err != nil {
+			t.Fatalf("Report(%d): %v", seq, err)
+		}
+	}
+	if len(r.queue) != 2 {
+		t.Fatalf("queue length = %d, want 2", len(r.queue))
+	}
+	select {
+	case <-r.overflowChan:
+	default:
+		t.Fatal("overflow was not signalled to the batch goroutine")
+	}
+
+	r.spoolOverflow()
+
+	if len(r.queue) != 0 || r.overflow != nil {
+		t.Fatalf("queue=%d overflow=%v after spooling, want both empty", len(r.queue), r.overflow)
+	}
+	if got, want := replayAll(t, r.spool), []uint64{1, 2, 3, 4, 5}; !equalSeq(got, want) {
+		t.Fatalf("spooled %v, want %v", got, want)
+	}
+
+	// 溢出处理完成后恢复写入队列
+	if err := r.Report(common.NetworkMetrics{TotalConnections: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.queue) != 1 {
+		t.Fatalf("queue length = %d after overflow was handled, want 1", len(r.queue))
+	}
+}
@@ -0,0 +1,154 @@
+package reporter
+
+import (
+	"time"
+
+	"go-net-monitoring/internal/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxOutboxItems 内存中等待重试的批数据上限，超出时写入磁盘缓存或丢弃最旧的数据
+const maxOutboxItems = 10
+
+// outboxItem 等待发送或重试的批数据
+type outboxItem struct {
+	metrics     common.NetworkMetrics
+	attempts    int       // 已失败的次数
+	nextAttempt time.Time // 下次发送时间
+}
+
+// enqueueOutbox 将批数据加入发送队列
+func (r *Reporter) enqueueOutbox(metrics common.NetworkMetrics) {
+	if len(r.outbox) >= maxOutboxItems {
+		if r.spool != nil {
+			// 保持顺序：已有的待重试数据和新数据都转入磁盘缓存
+			r.spoolOutbox()
+			r.spoolMetrics(metrics)
+			return
+		}
+
+		r.logger.Warn("待重试数据过多，丢弃最旧的批数据")
+		r.outbox = r.outbox[1:]
+		r.updateStats(false, "待重试数据过多")
+	}
+
+	r.outbox = append(r.outbox, &outboxItem{metrics: metrics})
+	r.updatePendingRetries()
+}
+
+// flushOutbox 按顺序发送到期的批数据，失败时按指数退避安排重试，不阻塞批处理协程
+func (r *Reporter) flushOutbox() {
+	defer r.scheduleRetry()
+
+	for len(r.outbox) > 0 {
+		if !r.breaker.Allow() {
+			// 熔断期间暂停发送，有磁盘缓存时转入缓存，等待探测成功后重放
+			r.spoolOutbox()
+			return
+		}
+
+		item := r.outbox[0]
+		if time.Now().Before(item.nextAttempt) {
+			return
+		}
+
+		request := r.buildRequest(item.metrics, nil)
+		err := r.sendRequest(request)
+		if err == nil {
+			if item.attempts > 0 {
+				r.logger.WithField("attempts", item.attempts).Info("重试成功")
+			} else {
+				r.logger.Debug("成功发送批数据")
+			}
+
+			r.breaker.RecordSuccess()
+			r.updateStats(true, "")
+			r.commitReport(request.Report.StartupTime, item.metrics)
+			r.outbox = r.outbox[1:]
+			r.updatePendingRetries()
+			continue
+		}
+
+		if r.breaker.RecordFailure() {
+			r.logger.WithError(err).Warn("连续发送失败，熔断器打开，暂停上报")
+		}
+
+		if item.attempts == 0 {
+			r.logger.WithError(err).Error("发送批数据失败")
+			r.updateStats(false, err.Error())
+		} else {
+			r.logger.WithError(err).Warnf("第 %d 次重试失败", item.attempts)
+			r.stats.mu.Lock()
+			r.stats.RetryCount++
+			r.stats.mu.Unlock()
+		}
+
+		item.attempts++
+		cfg := r.getConfig()
+		if item.attempts > cfg.RetryCount {
+			r.logger.Error("重试次数用尽，放弃发送")
+			r.updateStats(false, "重试次数用尽")
+			r.outbox = r.outbox[1:]
+			r.spoolMetrics(item.metrics)
+			// 后续数据也转入缓存，保证重放顺序
+			r.spoolOutbox()
+			r.updatePendingRetries()
+			continue
+		}
+
+		delay := backoffDelay(cfg.RetryDelay, cfg.MaxRetryDelay, item.attempts)
+		item.nextAttempt = time.Now().Add(delay)
+		r.logger.WithFields(logrus.Fields{
+			"attempt": item.attempts,
+			"delay":   delay,
+		}).Info("安排重试发送")
+		return
+	}
+}
+
+// spoolOutbox 将内存中待重试的数据按顺序写入磁盘缓存（未启用缓存时保留在内存中）
+func (r *Reporter) spoolOutbox() {
+	if r.spool == nil || len(r.outbox) == 0 {
+		return
+	}
+
+	for _, item := range r.outbox {
+		r.spoolMetrics(item.metrics)
+	}
+	r.outbox = nil
+	r.updatePendingRetries()
+}
+
+// scheduleRetry 根据队首数据的重试时间设置定时器
+func (r *Reporter) scheduleRetry() {
+	r.stopRetryTimer()
+
+	// 熔断期间由探测成功触发恢复
+	if len(r.outbox) == 0 || !r.breaker.Allow() {
+		return
+	}
+
+	delay := time.Until(r.outbox[0].nextAttempt)
+	if delay < 0 {
+		delay = 0
+	}
+	r.retryAt = time.NewTimer(delay)
+	r.retryC = r.retryAt.C
+}
+
+// stopRetryTimer 停止重试定时器
+func (r *Reporter) stopRetryTimer() {
+	if r.retryAt != nil {
+		r.retryAt.Stop()
+		r.retryAt = nil
+	}
+	r.retryC = nil
+}
+
+// updatePendingRetries 更新待重试数量
+func (r *Reporter) updatePendingRetries() {
+	r.stats.mu.Lock()
+	r.stats.PendingRetries = len(r.outbox)
+	r.stats.mu.Unlock()
+}
@@ -0,0 +1,243 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink 上报数据的输出目标
+type Sink interface {
+	// Write 写出一批数据，返回错误时按退避重试整批数据
+	Write(ctx context.Context, batch []common.ReportRequest) error
+	// Close 释放资源
+	Close() error
+}
+
+// permanentError 不可重试的写出错误（如请求被对端拒绝），该批数据直接丢弃
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// isPermanent 是否为不可重试的错误
+func isPermanent(err error) bool {
+	var perr *permanentError
+	return errors.As(err, &perr)
+}
+
+// SinkStats 输出目标的健康统计
+type SinkStats struct {
+	Name                string    `json:"name"`
+	Type                string    `json:"type"`
+	Healthy             bool      `json:"healthy"`
+	QueueSize           int       `json:"queue_size"`
+	SentRecords         uint64    `json:"sent_records"`
+	FailedRecords       uint64    `json:"failed_records"`
+	DroppedRecords      uint64    `json:"dropped_records"`
+	Retries             uint64    `json:"retries"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// newSink 根据配置创建输出目标（http由Reporter自身处理，不经过此函数）
+func newSink(cfg config.SinkConfig, startTime time.Time, logger *logrus.Logger) (Sink, error) {
+	switch cfg.Type {
+	case config.SinkFile:
+		return newFileSink(cfg.Path, cfg.MaxBytes, cfg.MaxBackups)
+	case config.SinkStdout:
+		return newStdoutSink(), nil
+	case config.SinkUnix:
+		return newUnixSink(cfg.Network, cfg.Path), nil
+	case config.SinkRemoteWrite:
+		return newRemoteWriteSink(cfg), nil
+	case config.SinkOTLP:
+		return newOTLPSink(cfg, startTime, logger)
+	case config.SinkInflux:
+		return newInfluxSink(cfg), nil
+	case config.SinkStatsD:
+		return newStatsDSink(cfg), nil
+	default:
+		return nil, fmt.Errorf("不支持的输出目标类型: %s", cfg.Type)
+	}
+}
+
+// sinkWorker 为一个输出目标提供独立的队列、批处理和重试，慢的输出目标只会丢弃自己的数据
+type sinkWorker struct {
+	cfg    config.SinkConfig
+	sink   Sink
+	queue  chan common.ReportRequest
+	logger *logrus.Entry
+
+	mu    sync.Mutex
+	stats SinkStats
+}
+
+// newSinkWorker 创建输出目标的工作协程
+func newSinkWorker(cfg config.SinkConfig, sink Sink, logger *logrus.Logger) *sinkWorker {
+	return &sinkWorker{
+		cfg:    cfg,
+		sink:   sink,
+		queue:  make(chan common.ReportRequest, cfg.QueueSize),
+		logger: logger.WithFields(logrus.Fields{"sink": cfg.Name, "type": cfg.Type}),
+		stats: SinkStats{
+			Name:    cfg.Name,
+			Type:    cfg.Type,
+			Healthy: true,
+		},
+	}
+}
+
+// Enqueue 加入队列，不阻塞；队列已满时丢弃并计数
+func (w *sinkWorker) Enqueue(record common.ReportRequest) {
+	select {
+	case w.queue <- record:
+	default:
+		w.mu.Lock()
+		w.stats.DroppedRecords++
+		w.mu.Unlock()
+		w.logger.Warn("输出目标队列已满，丢弃数据")
+	}
+}
+
+// run 批处理协程，ctx取消后尽力写出剩余数据
+func (w *sinkWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]common.ReportRequest, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			w.flushOnStop(batch)
+			return
+
+		case record := <-w.queue:
+			batch = append(batch, record)
+			if len(batch) >= w.cfg.BatchSize {
+				w.flush(ctx, batch)
+				batch = make([]common.ReportRequest, 0, w.cfg.BatchSize)
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(ctx, batch)
+				batch = make([]common.ReportRequest, 0, w.cfg.BatchSize)
+			}
+		}
+	}
+}
+
+// flush 写出一批数据，失败时按指数退避重试，重试次数用尽后丢弃
+func (w *sinkWorker) flush(ctx context.Context, batch []common.ReportRequest) {
+	for attempt := 0; ; attempt++ {
+		writeCtx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+		err := w.sink.Write(writeCtx, batch)
+		cancel()
+
+		if err == nil {
+			w.recordSuccess(len(batch))
+			return
+		}
+
+		w.recordFailure(len(batch), err)
+		if attempt >= w.cfg.RetryCount || ctx.Err() != nil || isPermanent(err) {
+			w.logger.WithError(err).WithField("records", len(batch)).Error("写出失败，放弃该批数据")
+			w.mu.Lock()
+			w.stats.DroppedRecords += uint64(len(batch))
+			w.mu.Unlock()
+			return
+		}
+
+		delay := backoffDelay(w.cfg.RetryDelay, w.cfg.MaxRetryDelay, attempt+1)
+		w.logger.WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"delay":   delay,
+		}).Warn("写出失败，安排重试")
+
+		w.mu.Lock()
+		w.stats.Retries++
+		w.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// flushOnStop 停止时写出队列和批中剩余的数据（只尝试一次）
+func (w *sinkWorker) flushOnStop(batch []common.ReportRequest) {
+	for {
+		select {
+		case record := <-w.queue:
+			batch = append(batch, record)
+			continue
+		default:
+		}
+		break
+	}
+
+	if len(batch) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+		if err := w.sink.Write(ctx, batch); err != nil {
+			w.recordFailure(len(batch), err)
+			w.logger.WithError(err).Warn("停止时写出剩余数据失败")
+		} else {
+			w.recordSuccess(len(batch))
+		}
+		cancel()
+	}
+
+	if err := w.sink.Close(); err != nil {
+		w.logger.WithError(err).Warn("关闭输出目标失败")
+	}
+}
+
+// recordSuccess 记录写出成功
+func (w *sinkWorker) recordSuccess(records int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.stats.Healthy {
+		w.logger.Info("输出目标恢复")
+	}
+	w.stats.SentRecords += uint64(records)
+	w.stats.ConsecutiveFailures = 0
+	w.stats.Healthy = true
+	w.stats.LastError = ""
+	w.stats.LastSuccess = time.Now()
+}
+
+// recordFailure 记录写出失败
+func (w *sinkWorker) recordFailure(records int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stats.FailedRecords += uint64(records)
+	w.stats.ConsecutiveFailures++
+	w.stats.Healthy = false
+	w.stats.LastError = err.Error()
+}
+
+// Stats 获取统计快照
+func (w *sinkWorker) Stats() SinkStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats := w.stats
+	stats.QueueSize = len(w.queue)
+	return stats
+}
@@ -0,0 +1,215 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+// influxSink 以InfluxDB行协议写出，支持HTTP写入接口（v1 /write 和 v2 /api/v2/write）和UDP
+// 每次上报生成以下measurement（prefix默认为netmon）：
+// prefix_network、prefix_domain、prefix_ip、prefix_protocol、prefix_port
+type influxSink struct {
+	prefix  string
+	tags    map[string]string
+	limiter *tagLimiter
+
+	url     string
+	headers map[string]string
+	client  *http.Client
+	udp     *udpWriter
+}
+
+// newInfluxSink 创建InfluxDB输出目标
+func newInfluxSink(cfg config.SinkConfig) *influxSink {
+	s := &influxSink{
+		prefix:  cfg.Prefix,
+		tags:    cfg.Tags,
+		limiter: newTagLimiter(cfg.MaxTagValues),
+	}
+	if cfg.Protocol == "udp" {
+		s.udp = &udpWriter{address: cfg.Endpoint}
+	} else {
+		s.url = cfg.URL
+		s.headers = cfg.Headers
+		s.client = &http.Client{}
+	}
+	return s
+}
+
+// Write 实现Sink
+func (s *influxSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	var lines [][]byte
+	for i := range batch {
+		lines = append(lines, s.render(&batch[i])...)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if s.udp != nil {
+		return s.udp.write(ctx, lines)
+	}
+	return s.post(ctx, bytes.Join(lines, nil))
+}
+
+// post 通过HTTP写入接口写出；5xx和429可重试，其他4xx不重试
+func (s *influxSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("创建请求失败: %w", err)}
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送Influx写入请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("Influx返回状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// render 将一次上报渲染为行协议
+func (s *influxSink) render(record *common.ReportRequest) [][]byte {
+	m := &record.Metrics
+	timestamp := m.Timestamp
+	if timestamp.IsZero() {
+		timestamp = record.Timestamp
+	}
+	ts := strconv.FormatInt(timestamp.UnixNano(), 10)
+
+	host := m.Hostname
+	if host == "" {
+		host = record.Hostname
+	}
+	iface := m.Interface
+	if iface == "" {
+		iface = "unknown"
+	}
+	base := map[string]string{"agent_id": record.AgentID, "host": host, "interface": iface}
+	for k, v := range s.tags {
+		if _, ok := base[k]; !ok {
+			base[k] = v
+		}
+	}
+
+	var lines [][]byte
+	line := func(measurement string, tags map[string]string, fields []influxField) {
+		lines = append(lines, influxLine(s.prefix+"_"+measurement, base, tags, fields, ts))
+	}
+
+	line("network", nil, []influxField{
+		{"bytes_sent", m.TotalBytesSent},
+		{"bytes_received", m.TotalBytesRecv},
+		{"packets_sent", m.TotalPacketsSent},
+		{"packets_received", m.TotalPacketsRecv},
+		{"connections", m.TotalConnections},
+	})
+
+	stats := aggregateLineStats(m, s.limiter)
+	for _, domain := range sortedKeys(stats.Domains) {
+		c := stats.Domains[domain]
+		line("domain", map[string]string{"domain": domain}, []influxField{
+			{"accesses", c.Accesses},
+			{"bytes_sent", c.BytesSent},
+			{"bytes_received", c.BytesReceived},
+			{"connections", c.Connections},
+		})
+	}
+	for _, ip := range sortedKeys(stats.IPs) {
+		line("ip", map[string]string{"ip": ip}, []influxField{{"accesses", stats.IPs[ip]}})
+	}
+	for _, protocol := range sortedKeys(stats.Protocols) {
+		line("protocol", map[string]string{"protocol": protocol}, []influxField{{"packets", stats.Protocols[protocol]}})
+	}
+	for _, port := range sortedKeys(stats.Ports) {
+		line("port", map[string]string{"port": port}, []influxField{{"connections", stats.Ports[port]}})
+	}
+	return lines
+}
+
+// Close 实现Sink
+func (s *influxSink) Close() error {
+	if s.udp != nil {
+		return s.udp.close()
+	}
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// influxField 整数字段
+type influxField struct {
+	key   string
+	value uint64
+}
+
+// influxLine 渲染一行：measurement,tag=v,... field=1i,... timestamp
+// 字段使用整数类型（i后缀，InfluxDB 1.x默认不支持无符号整数），标签按名称排序
+func influxLine(measurement string, base, extra map[string]string, fields []influxField, ts string) []byte {
+	tags := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		tags[k] = v
+	}
+	for k, v := range extra {
+		tags[k] = v
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		if tags[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	b.WriteString(measurementEscaper.Replace(measurement))
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tags[k]))
+	}
+	for i, f := range fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(f.key))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatInt(int64(f.value), 10))
+		b.WriteByte('i')
+	}
+	b.WriteByte(' ')
+	b.WriteString(ts)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// 行协议转义规则
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", "")
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "")
+)
@@ -0,0 +1,187 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/cardinality"
+)
+
+// otherTagValue 超出标签值上限的数据合并到该值
+const otherTagValue = cardinality.Other
+
+// maxDatagramSize UDP数据报大小上限，避免在常见MTU下分片
+const maxDatagramSize = 1432
+
+// tagLimiter 限制每个维度的标签值数量：先出现的值被保留，之后的新值合并为other
+// 保留的集合不随数据变化，序列和增量计算保持稳定
+type tagLimiter struct {
+	max  int
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+// newTagLimiter 创建标签值限制器
+func newTagLimiter(max int) *tagLimiter {
+	return &tagLimiter{max: max, seen: make(map[string]map[string]struct{})}
+}
+
+// limit 返回实际使用的标签值
+func (l *tagLimiter) limit(dimension, value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	values, ok := l.seen[dimension]
+	if !ok {
+		values = make(map[string]struct{})
+		l.seen[dimension] = values
+	}
+	if _, ok := values[value]; ok {
+		return value
+	}
+	if len(values) >= l.max {
+		return otherTagValue
+	}
+	values[value] = struct{}{}
+	return value
+}
+
+// domainCounters 按域名汇总的计数
+type domainCounters struct {
+	Accesses      uint64
+	BytesSent     uint64
+	BytesReceived uint64
+	Connections   uint64
+}
+
+// lineStats 一次上报按维度汇总的计数，标签值已经过上限处理
+type lineStats struct {
+	Domains   map[string]*domainCounters
+	IPs       map[string]uint64
+	Protocols map[string]uint64
+	Ports     map[string]uint64
+}
+
+// aggregateLineStats 按维度汇总，超出上限的标签值合并为other
+func aggregateLineStats(m *common.NetworkMetrics, limiter *tagLimiter) *lineStats {
+	stats := &lineStats{
+		Domains:   make(map[string]*domainCounters),
+		IPs:       make(map[string]uint64),
+		Protocols: make(map[string]uint64),
+		Ports:     make(map[string]uint64),
+	}
+
+	domain := func(name string) *domainCounters {
+		name = limiter.limit("domain", name)
+		counters, ok := stats.Domains[name]
+		if !ok {
+			counters = &domainCounters{}
+			stats.Domains[name] = counters
+		}
+		return counters
+	}
+
+	for _, name := range sortedKeys(m.DomainsAccessed) {
+		domain(name).Accesses += m.DomainsAccessed[name]
+	}
+	for _, name := range sortedKeys(m.DomainTraffic) {
+		traffic := m.DomainTraffic[name]
+		if traffic == nil {
+			continue
+		}
+		counters := domain(name)
+		counters.BytesSent += traffic.BytesSent
+		counters.BytesReceived += traffic.BytesReceived
+		counters.Connections += traffic.Connections
+	}
+	for _, ip := range sortedKeys(m.IPsAccessed) {
+		stats.IPs[limiter.limit("ip", ip)] += m.IPsAccessed[ip]
+	}
+	for _, protocol := range sortedKeys(m.ProtocolStats) {
+		stats.Protocols[limiter.limit("protocol", protocol)] += m.ProtocolStats[protocol]
+	}
+	for _, port := range sortedKeys(m.PortStats) {
+		stats.Ports[limiter.limit("port", portLabel(port))] += m.PortStats[port]
+	}
+	return stats
+}
+
+// sortedKeys 按顺序返回map的键，保证先出现的标签值在不同次上报间一致
+func sortedKeys[K string | int, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// udpWriter 将多行数据按数据报大小上限分组发送
+type udpWriter struct {
+	address string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// write 发送数据行（每行以换行结尾），单行超过上限时单独发送
+func (w *udpWriter) write(ctx context.Context, lines [][]byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "udp", w.address)
+		if err != nil {
+			return fmt.Errorf("连接UDP地址失败: %w", err)
+		}
+		w.conn = conn
+	}
+
+	packet := make([]byte, 0, maxDatagramSize)
+	flush := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := w.conn.Write(packet)
+		packet = packet[:0]
+		return err
+	}
+
+	for _, line := range lines {
+		if len(packet)+len(line) > maxDatagramSize {
+			if err := flush(); err != nil {
+				return w.reset(err)
+			}
+		}
+		packet = append(packet, line...)
+	}
+	if err := flush(); err != nil {
+		return w.reset(err)
+	}
+	return nil
+}
+
+// reset 发送失败时关闭连接，下次发送时重新连接
+func (w *udpWriter) reset(err error) error {
+	w.conn.Close()
+	w.conn = nil
+	return fmt.Errorf("发送UDP数据失败: %w", err)
+}
+
+// close 关闭连接
+func (w *udpWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
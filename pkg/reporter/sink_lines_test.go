@@ -0,0 +1,137 @@
+package reporter
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+func lineRecord(connections uint64, domains map[string]uint64) *common.ReportRequest {
+	return &common.ReportRequest{
+		AgentID:   "agent-1",
+		Hostname:  "host-1",
+		Timestamp: time.Unix(1700000000, 0),
+		Metrics: common.NetworkMetrics{
+			Interface:        "eth0",
+			TotalConnections: connections,
+			DomainsAccessed:  domains,
+		},
+	}
+}
+
+func joinLines(lines [][]byte) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.Write(line)
+	}
+	return b.String()
+}
+
+func TestInfluxLineEscaping(t *testing.T) {
+	got := string(influxLine("net mon,x", map[string]string{"host": "a b", "empty": ""},
+		map[string]string{"domain": "x=y,z"}, []influxField{{"bytes sent", 5}, {"count", 1}}, "123"))
+	want := `net\ mon\,x,domain=x\=y\,z,host=a\ b bytes\ sent=5i,count=1i 123` + "\n"
+	if got != want {
+		t.Fatalf("influxLine = %q, want %q", got, want)
+	}
+}
+
+func TestInfluxRender(t *testing.T) {
+	s := newInfluxSink(config.SinkConfig{
+		Prefix:       "netmon",
+		Tags:         map[string]string{"env": "prod", "host": "ignored"},
+		MaxTagValues: 1,
+	})
+
+	out := joinLines(s.render(lineRecord(10, map[string]uint64{"a.com": 2, "b.com": 3})))
+	for _, want := range []string{
+		"netmon_network,agent_id=agent-1,env=prod,host=host-1,interface=eth0 bytes_sent=0i,bytes_received=0i,packets_sent=0i,packets_received=0i,connections=10i 1700000000000000000\n",
+		"netmon_domain,agent_id=agent-1,domain=a.com,env=prod,host=host-1,interface=eth0 accesses=2i,",
+		"netmon_domain,agent_id=agent-1,domain=other,env=prod,host=host-1,interface=eth0 accesses=3i,",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("render output missing %q:\n%s", want, out)
+		}
+	}
+
+	// 已占用名额的标签值保持不变，新值继续汇总到other
+	out = joinLines(s.render(lineRecord(12, map[string]uint64{"c.com": 1, "a.com": 4})))
+	if !strings.Contains(out, "domain=a.com,") || !strings.Contains(out, "domain=other,") || strings.Contains(out, "c.com") {
+		t.Errorf("tag limit is not sticky:\n%s", out)
+	}
+}
+
+func TestStatsDDeltas(t *testing.T) {
+	s := newStatsDSink(config.SinkConfig{Prefix: "netmon", MaxTagValues: 10})
+	s.pending = make(map[string]uint64)
+
+	// 第一次上报只作为基线
+	if lines := s.render(lineRecord(10, nil), false); len(lines) != 0 {
+		t.Fatalf("baseline produced lines: %q", joinLines(lines))
+	}
+	for k, v := range s.pending {
+		s.last[k] = v
+	}
+
+	s.pending = make(map[string]uint64)
+	out := joinLines(s.render(lineRecord(15, map[string]uint64{"a.com": 2}), true))
+	if out != "netmon.network.connections:5|c\nnetmon.domain.accesses:2|c\n" {
+		t.Errorf("delta output = %q", out)
+	}
+	for k, v := range s.pending {
+		s.last[k] = v
+	}
+
+	// 计数变小视为重置，发送当前值
+	s.pending = make(map[string]uint64)
+	out = joinLines(s.render(lineRecord(3, map[string]uint64{"a.com": 2}), true))
+	if out != "netmon.network.connections:3|c\n" {
+		t.Errorf("reset output = %q", out)
+	}
+}
+
+func TestStatsDTagFormats(t *testing.T) {
+	tags := []statsdTag{{"domain", "a,b"}, {"host", "h:1"}}
+	tests := map[string]string{
+		"":          "netmon.x_y:7|c\n",
+		"dogstatsd": "netmon.x_y:7|c|#domain:a_b,host:h:1\n",
+		"telegraf":  "netmon.x_y,domain=a_b,host=h_1:7|c\n",
+	}
+	for format, want := range tests {
+		s := &statsdSink{tagFormat: format}
+		if got := string(s.line("netmon.x y", 7, tags)); got != want {
+			t.Errorf("tag_format %q: line = %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestStatsDWriteOverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp not available: %v", err)
+	}
+	defer conn.Close()
+
+	s := newStatsDSink(config.SinkConfig{Prefix: "netmon", Endpoint: conn.LocalAddr().String(), MaxTagValues: 10})
+	defer s.Close()
+
+	batch := []common.ReportRequest{*lineRecord(10, nil), *lineRecord(25, nil)}
+	if err := s.Write(context.Background(), batch); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxDatagramSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if got := string(buf[:n]); got != "netmon.network.connections:15|c\n" {
+		t.Errorf("datagram = %q", got)
+	}
+}
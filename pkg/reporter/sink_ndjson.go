@@ -0,0 +1,242 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go-net-monitoring/internal/common"
+)
+
+// encodeNDJSON 将一批数据编码为NDJSON（每行一个ReportRequest）
+func encodeNDJSON(batch []common.ReportRequest) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range batch {
+		if err := encoder.Encode(&batch[i]); err != nil {
+			return nil, fmt.Errorf("序列化数据失败: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// stdoutSink 输出到标准输出
+type stdoutSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// newStdoutSink 创建标准输出目标
+func newStdoutSink() *stdoutSink {
+	return &stdoutSink{writer: os.Stdout}
+}
+
+// Write 实现Sink
+func (s *stdoutSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	data, err := encodeNDJSON(batch)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.writer.Write(data)
+	return err
+}
+
+// Close 实现Sink
+func (s *stdoutSink) Close() error {
+	return nil
+}
+
+// fileSink 追加写入NDJSON文件，超过大小上限时轮转为 path.1 ... path.N
+type fileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// newFileSink 创建文件输出目标
+func newFileSink(path string, maxBytes int64, maxBackups int) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建输出目录失败: %w", err)
+	}
+
+	s := &fileSink{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open 打开（或创建）当前文件
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开输出文件失败: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取输出文件信息失败: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write 实现Sink，每批数据写完后同步到磁盘
+func (s *fileSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	data, err := encodeNDJSON(batch)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && s.size+int64(len(data)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入输出文件失败: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("同步输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// rotate 轮转文件：path.N-1 -> path.N，...，path -> path.1，超出数量的最旧文件被删除
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("关闭输出文件失败: %w", err)
+	}
+	s.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return fmt.Errorf("轮转输出文件失败: %w", err)
+	}
+
+	return s.open()
+}
+
+// Close 实现Sink
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// unixSink 写入Unix域套接字；unix为流式连接（每行一个JSON），unixgram每条数据一个数据报
+type unixSink struct {
+	network string
+	path    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// newUnixSink 创建Unix域套接字输出目标（首次写出时连接）
+func newUnixSink(network, path string) *unixSink {
+	return &unixSink{network: network, path: path}
+}
+
+// Write 实现Sink，写出失败时关闭连接，重试时重新连接
+func (s *unixSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, s.network, s.path)
+		if err != nil {
+			return fmt.Errorf("连接Unix套接字失败: %w", err)
+		}
+		s.conn = conn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	if err := s.write(batch); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("写入Unix套接字失败: %w", err)
+	}
+	return nil
+}
+
+// write 按网络类型写出数据
+func (s *unixSink) write(batch []common.ReportRequest) error {
+	if s.network != "unixgram" {
+		data, err := encodeNDJSON(batch)
+		if err != nil {
+			return err
+		}
+		_, err = s.conn.Write(data)
+		return err
+	}
+
+	for i := range batch {
+		data, err := json.Marshal(&batch[i])
+		if err != nil {
+			return fmt.Errorf("序列化数据失败: %w", err)
+		}
+		if _, err := s.conn.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 实现Sink
+func (s *unixSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
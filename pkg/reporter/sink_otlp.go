@@ -0,0 +1,71 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/otlp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// otlpSink 以OTLP协议写出到OpenTelemetry Collector
+type otlpSink struct {
+	exporter  *otlp.Exporter
+	converter *otlp.Converter
+	startTime time.Time
+}
+
+// newOTLPSink 创建OTLP输出目标，计数的起始时间为Agent启动时间
+func newOTLPSink(cfg config.SinkConfig, startTime time.Time, logger *logrus.Logger) (*otlpSink, error) {
+	exporter, err := otlp.NewExporter(otlp.Options{
+		Protocol:    cfg.Protocol,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		Compression: cfg.Compression,
+		Headers:     cfg.Headers,
+		UserAgent:   fmt.Sprintf("network-monitor-agent/%s", "1.0.0"),
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpSink{
+		exporter: exporter,
+		converter: &otlp.Converter{
+			ServiceName: "netmon-agent",
+			Version:     "1.0.0",
+			Attributes:  cfg.ResourceAttributes,
+		},
+		startTime: startTime,
+	}, nil
+}
+
+// Write 实现Sink
+func (s *otlpSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	records := make([]otlp.Record, len(batch))
+	for i := range batch {
+		records[i] = otlp.Record{
+			AgentID:   batch[i].AgentID,
+			Hostname:  batch[i].Hostname,
+			StartTime: s.startTime,
+			Metrics:   &batch[i].Metrics,
+		}
+	}
+
+	if err := s.exporter.Export(ctx, s.converter.Convert(records)); err != nil {
+		if otlp.IsPermanent(err) {
+			return &permanentError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// Close 实现Sink
+func (s *otlpSink) Close() error {
+	return s.exporter.Close()
+}
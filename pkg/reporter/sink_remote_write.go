@@ -0,0 +1,187 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/api/prompb"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// remoteWriteSink 以Prometheus remote_write协议写出数据
+// Agent上报的计数都是启动以来的累计值，直接作为counter样本写出，序列名称和标签与Server导出的指标一致
+type remoteWriteSink struct {
+	url            string
+	externalLabels map[string]string
+	headers        map[string]string
+	client         *http.Client
+}
+
+// newRemoteWriteSink 创建remote_write输出目标
+func newRemoteWriteSink(cfg config.SinkConfig) *remoteWriteSink {
+	return &remoteWriteSink{
+		url:            cfg.URL,
+		externalLabels: cfg.ExternalLabels,
+		headers:        cfg.Headers,
+		client:         &http.Client{},
+	}
+}
+
+// Write 实现Sink；5xx和429可重试，其他4xx视为数据被拒绝，不再重试
+func (s *remoteWriteSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: buildTimeSeries(batch, s.externalLabels)})
+	if err != nil {
+		return fmt.Errorf("序列化remote_write请求失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return &permanentError{fmt.Errorf("创建请求失败: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", fmt.Sprintf("network-monitor-agent/%s", "1.0.0"))
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送remote_write请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote_write返回状态码 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// Close 实现Sink
+func (s *remoteWriteSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// seriesBuilder 按标签集合并一批数据中的样本
+type seriesBuilder struct {
+	externalLabels map[string]string
+	index          map[string]*prompb.TimeSeries
+	series         []*prompb.TimeSeries
+}
+
+// add 添加一个样本，labels为成对的标签名和值（不含__name__）
+func (b *seriesBuilder) add(name string, value uint64, timestamp int64, labels ...string) {
+	pairs := make([]*prompb.Label, 0, len(labels)/2+len(b.externalLabels)+1)
+	pairs = append(pairs, &prompb.Label{Name: "__name__", Value: name})
+	seen := make(map[string]bool, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, &prompb.Label{Name: labels[i], Value: labels[i+1]})
+		seen[labels[i]] = true
+	}
+	for labelName, labelValue := range b.externalLabels {
+		if !seen[labelName] {
+			pairs = append(pairs, &prompb.Label{Name: labelName, Value: labelValue})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+
+	var key strings.Builder
+	for _, label := range pairs {
+		key.WriteString(label.Name)
+		key.WriteByte(0)
+		key.WriteString(label.Value)
+		key.WriteByte(0)
+	}
+
+	ts, ok := b.index[key.String()]
+	if !ok {
+		ts = &prompb.TimeSeries{Labels: pairs}
+		b.index[key.String()] = ts
+		b.series = append(b.series, ts)
+	}
+
+	// 同一序列的样本时间必须递增，同一毫秒内的重复样本只保留第一个
+	if n := len(ts.Samples); n > 0 && ts.Samples[n-1].Timestamp >= timestamp {
+		return
+	}
+	ts.Samples = append(ts.Samples, &prompb.Sample{Value: float64(value), Timestamp: timestamp})
+}
+
+// buildTimeSeries 将一批上报数据转换为remote_write时间序列
+func buildTimeSeries(batch []common.ReportRequest, externalLabels map[string]string) []*prompb.TimeSeries {
+	b := &seriesBuilder{
+		externalLabels: externalLabels,
+		index:          make(map[string]*prompb.TimeSeries),
+	}
+
+	for i := range batch {
+		record := &batch[i]
+		m := &record.Metrics
+
+		timestamp := m.Timestamp
+		if timestamp.IsZero() {
+			timestamp = record.Timestamp
+		}
+		ms := timestamp.UnixMilli()
+
+		host := m.Hostname
+		if host == "" {
+			host = record.Hostname
+		}
+		iface := m.Interface
+		if iface == "" {
+			iface = "unknown"
+		}
+		base := []string{"agent_id", record.AgentID, "host", host, "interface", iface}
+		with := func(labels ...string) []string {
+			return append(append(make([]string, 0, len(base)+len(labels)), base...), labels...)
+		}
+
+		b.add("network_connections_total", m.TotalConnections, ms, with("protocol", "total", "direction", "all")...)
+		b.add("network_bytes_sent_total", m.TotalBytesSent, ms, with("protocol", "total", "destination", "all")...)
+		b.add("network_bytes_received_total", m.TotalBytesRecv, ms, with("protocol", "total", "source", "all")...)
+		b.add("network_packets_sent_total", m.TotalPacketsSent, ms, with("protocol", "total", "destination", "all")...)
+		b.add("network_packets_received_total", m.TotalPacketsRecv, ms, with("protocol", "total", "source", "all")...)
+
+		for domain, count := range m.DomainsAccessed {
+			b.add("network_domains_accessed_total", count, ms, with("domain", domain)...)
+		}
+		for domain, stats := range m.DomainTraffic {
+			if stats == nil {
+				continue
+			}
+			b.add("network_domain_bytes_sent_total", stats.BytesSent, ms, with("domain", domain)...)
+			b.add("network_domain_bytes_received_total", stats.BytesReceived, ms, with("domain", domain)...)
+			b.add("network_domain_connections_total", stats.Connections, ms, with("domain", domain)...)
+		}
+		for ip, count := range m.IPsAccessed {
+			b.add("network_ips_accessed_total", count, ms, with("ip", ip)...)
+		}
+		for protocol, count := range m.ProtocolStats {
+			b.add("network_protocol_stats_total", count, ms, with("protocol", protocol)...)
+		}
+		for port, count := range m.PortStats {
+			b.add("network_port_connections_total", count, ms, with("port", portLabel(port))...)
+		}
+	}
+
+	return b.series
+}
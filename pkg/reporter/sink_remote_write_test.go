@@ -0,0 +1,195 @@
+package reporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/api/prompb"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// seriesLabels 将时间序列的标签转换为map
+func seriesLabels(ts *prompb.TimeSeries) map[string]string {
+	labels := make(map[string]string, len(ts.Labels))
+	for _, label := range ts.Labels {
+		labels[label.Name] = label.Value
+	}
+	return labels
+}
+
+// findSeries 按名称和标签查找时间序列
+func findSeries(series []*prompb.TimeSeries, name string, match map[string]string) *prompb.TimeSeries {
+	for _, ts := range series {
+		labels := seriesLabels(ts)
+		if labels["__name__"] != name {
+			continue
+		}
+		matched := true
+		for k, v := range match {
+			if labels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return ts
+		}
+	}
+	return nil
+}
+
+func remoteWriteBatch() []common.ReportRequest {
+	start := time.UnixMilli(1700000000000)
+	return []common.ReportRequest{
+		{
+			AgentID:   "agent-1",
+			Hostname:  "host-1",
+			Timestamp: start,
+			Metrics: common.NetworkMetrics{
+				Interface:        "eth0",
+				TotalConnections: 10,
+				DomainsAccessed:  map[string]uint64{"example.com": 3},
+				DomainTraffic: map[string]*common.DomainTrafficStats{
+					"example.com": {BytesSent: 100, BytesReceived: 200, Connections: 2},
+				},
+				PortStats: map[int]uint64{443: 5, 0: 1},
+			},
+		},
+		{
+			AgentID:   "agent-1",
+			Hostname:  "host-1",
+			Timestamp: start.Add(10 * time.Second),
+			Metrics: common.NetworkMetrics{
+				Interface:        "eth0",
+				TotalConnections: 15,
+				DomainsAccessed:  map[string]uint64{"example.com": 4},
+			},
+		},
+		{
+			// 同一毫秒的重复样本只保留第一个
+			AgentID:   "agent-1",
+			Hostname:  "host-1",
+			Timestamp: start.Add(10 * time.Second),
+			Metrics: common.NetworkMetrics{
+				Interface:        "eth0",
+				TotalConnections: 99,
+			},
+		},
+	}
+}
+
+func TestBuildTimeSeries(t *testing.T) {
+	series := buildTimeSeries(remoteWriteBatch(), map[string]string{"cluster": "prod", "host": "ignored"})
+
+	conns := findSeries(series, "network_connections_total", map[string]string{"agent_id": "agent-1"})
+	if conns == nil {
+		t.Fatal("network_connections_total series not found")
+	}
+	labels := seriesLabels(conns)
+	if labels["cluster"] != "prod" {
+		t.Errorf("external label cluster = %q, want prod", labels["cluster"])
+	}
+	if labels["host"] != "host-1" {
+		t.Errorf("host = %q, external labels must not override series labels", labels["host"])
+	}
+	if labels["interface"] != "eth0" || labels["protocol"] != "total" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	for i := 1; i < len(conns.Labels); i++ {
+		if conns.Labels[i-1].Name >= conns.Labels[i].Name {
+			t.Fatalf("labels are not sorted by name: %v", conns.Labels)
+		}
+	}
+
+	if len(conns.Samples) != 2 {
+		t.Fatalf("got %d samples, want 2 (duplicate timestamp dropped)", len(conns.Samples))
+	}
+	if conns.Samples[0].Value != 10 || conns.Samples[1].Value != 15 {
+		t.Errorf("sample values = %v, %v; want 10, 15", conns.Samples[0].Value, conns.Samples[1].Value)
+	}
+	if conns.Samples[1].Timestamp-conns.Samples[0].Timestamp != 10000 {
+		t.Errorf("sample timestamps = %d, %d", conns.Samples[0].Timestamp, conns.Samples[1].Timestamp)
+	}
+
+	domain := findSeries(series, "network_domain_bytes_received_total", map[string]string{"domain": "example.com"})
+	if domain == nil || len(domain.Samples) != 1 || domain.Samples[0].Value != 200 {
+		t.Errorf("domain bytes received series = %v", domain)
+	}
+	if findSeries(series, "network_port_connections_total", map[string]string{"port": "443"}) == nil {
+		t.Error("port 443 series not found")
+	}
+	if findSeries(series, "network_port_connections_total", map[string]string{"port": "other"}) == nil {
+		t.Error("port 0 is not exported as other")
+	}
+}
+
+func TestRemoteWriteSinkWrite(t *testing.T) {
+	var received prompb.WriteRequest
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy decode: %v", err)
+		}
+		if err := proto.Unmarshal(data, &received); err != nil {
+			t.Errorf("unmarshal WriteRequest: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newRemoteWriteSink(config.SinkConfig{URL: server.URL, Headers: map[string]string{"X-Scope-OrgID": "tenant"}})
+	defer sink.Close()
+
+	if err := sink.Write(context.Background(), remoteWriteBatch()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if headers.Get("Content-Encoding") != "snappy" || headers.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+	if headers.Get("X-Scope-OrgID") != "tenant" {
+		t.Errorf("custom header not sent")
+	}
+	if findSeries(received.Timeseries, "network_domains_accessed_total", map[string]string{"domain": "example.com"}) == nil {
+		t.Error("received request is missing the domain series")
+	}
+}
+
+func TestRemoteWriteSinkErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "rejected", tt.status)
+		}))
+
+		sink := newRemoteWriteSink(config.SinkConfig{URL: server.URL})
+		err := sink.Write(context.Background(), remoteWriteBatch())
+		server.Close()
+
+		if err == nil {
+			t.Errorf("status %d: Write returned nil error", tt.status)
+			continue
+		}
+		if isPermanent(err) != tt.permanent {
+			t.Errorf("status %d: permanent = %v, want %v (%v)", tt.status, isPermanent(err), tt.permanent, err)
+		}
+	}
+}
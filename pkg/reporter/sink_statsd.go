@@ -0,0 +1,196 @@
+package reporter
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+// statsdSink 以StatsD计数器（|c）写出，通过UDP发送
+// Agent上报的是累计值，这里按序列记录上次的值并发送增量：启动后第一次上报只作为基线，
+// 之后新出现的序列从0开始计算，值变小时视为计数器重置
+type statsdSink struct {
+	prefix    string
+	tags      map[string]string
+	tagFormat string
+	limiter   *tagLimiter
+	udp       *udpWriter
+
+	// 只由sinkWorker协程访问；pending在发送成功后合并到last，重试时重新计算增量
+	primed  bool
+	last    map[string]uint64
+	pending map[string]uint64
+}
+
+// newStatsDSink 创建StatsD输出目标
+func newStatsDSink(cfg config.SinkConfig) *statsdSink {
+	return &statsdSink{
+		prefix:    cfg.Prefix,
+		tags:      cfg.Tags,
+		tagFormat: cfg.TagFormat,
+		limiter:   newTagLimiter(cfg.MaxTagValues),
+		udp:       &udpWriter{address: cfg.Endpoint},
+		last:      make(map[string]uint64),
+	}
+}
+
+// statsdTag 标签
+type statsdTag struct {
+	key, value string
+}
+
+// Write 实现Sink
+func (s *statsdSink) Write(ctx context.Context, batch []common.ReportRequest) error {
+	s.pending = make(map[string]uint64)
+
+	var lines [][]byte
+	for i := range batch {
+		lines = append(lines, s.render(&batch[i], s.primed || i > 0)...)
+	}
+	if len(lines) > 0 {
+		if err := s.udp.write(ctx, lines); err != nil {
+			return err
+		}
+	}
+
+	for key, value := range s.pending {
+		s.last[key] = value
+	}
+	s.primed = true
+	return nil
+}
+
+// render 将一次上报渲染为StatsD计数器增量
+// primed为false时（启动后的第一次上报）只记录基线
+func (s *statsdSink) render(record *common.ReportRequest, primed bool) [][]byte {
+	m := &record.Metrics
+	host := m.Hostname
+	if host == "" {
+		host = record.Hostname
+	}
+	iface := m.Interface
+	if iface == "" {
+		iface = "unknown"
+	}
+
+	base := []statsdTag{{"agent_id", record.AgentID}, {"host", host}, {"interface", iface}}
+	for _, k := range sortedKeys(s.tags) {
+		if k != "agent_id" && k != "host" && k != "interface" {
+			base = append(base, statsdTag{k, s.tags[k]})
+		}
+	}
+
+	var lines [][]byte
+	counter := func(name string, value uint64, extra ...statsdTag) {
+		tags := append(append(make([]statsdTag, 0, len(base)+len(extra)), base...), extra...)
+		sort.Slice(tags, func(i, j int) bool { return tags[i].key < tags[j].key })
+
+		if delta, ok := s.delta(name, tags, value, primed); ok {
+			lines = append(lines, s.line(s.prefix+"."+name, delta, tags))
+		}
+	}
+
+	counter("network.bytes_sent", m.TotalBytesSent)
+	counter("network.bytes_received", m.TotalBytesRecv)
+	counter("network.packets_sent", m.TotalPacketsSent)
+	counter("network.packets_received", m.TotalPacketsRecv)
+	counter("network.connections", m.TotalConnections)
+
+	stats := aggregateLineStats(m, s.limiter)
+	for _, domain := range sortedKeys(stats.Domains) {
+		c := stats.Domains[domain]
+		tag := statsdTag{"domain", domain}
+		counter("domain.accesses", c.Accesses, tag)
+		counter("domain.bytes_sent", c.BytesSent, tag)
+		counter("domain.bytes_received", c.BytesReceived, tag)
+		counter("domain.connections", c.Connections, tag)
+	}
+	for _, ip := range sortedKeys(stats.IPs) {
+		counter("ip.accesses", stats.IPs[ip], statsdTag{"ip", ip})
+	}
+	for _, protocol := range sortedKeys(stats.Protocols) {
+		counter("protocol.packets", stats.Protocols[protocol], statsdTag{"protocol", protocol})
+	}
+	for _, port := range sortedKeys(stats.Ports) {
+		counter("port.connections", stats.Ports[port], statsdTag{"port", port})
+	}
+	return lines
+}
+
+// delta 计算增量，返回false表示不需要发送
+func (s *statsdSink) delta(name string, tags []statsdTag, value uint64, primed bool) (uint64, bool) {
+	var key strings.Builder
+	key.WriteString(name)
+	for _, tag := range tags {
+		key.WriteByte(0)
+		key.WriteString(tag.key)
+		key.WriteByte(0)
+		key.WriteString(tag.value)
+	}
+
+	last, seen := s.pending[key.String()]
+	if !seen {
+		last, seen = s.last[key.String()]
+	}
+	s.pending[key.String()] = value
+
+	switch {
+	case !seen && !primed:
+		return 0, false
+	case value < last:
+		return value, value > 0
+	default:
+		return value - last, value > last
+	}
+}
+
+// line 按tag_format渲染一行
+func (s *statsdSink) line(name string, value uint64, tags []statsdTag) []byte {
+	name = statsdNameEscaper.Replace(name)
+	v := strconv.FormatUint(value, 10)
+
+	var b strings.Builder
+	switch s.tagFormat {
+	case "telegraf":
+		// name,k=v,k2=v2:1|c
+		b.WriteString(name)
+		for _, tag := range tags {
+			b.WriteByte(',')
+			b.WriteString(telegrafTagEscaper.Replace(tag.key))
+			b.WriteByte('=')
+			b.WriteString(telegrafTagEscaper.Replace(tag.value))
+		}
+		b.WriteString(":" + v + "|c")
+	case "dogstatsd":
+		// name:1|c|#k:v,k2:v2
+		b.WriteString(name + ":" + v + "|c|#")
+		for i, tag := range tags {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(dogstatsdTagEscaper.Replace(tag.key))
+			b.WriteByte(':')
+			b.WriteString(dogstatsdTagEscaper.Replace(tag.value))
+		}
+	default:
+		b.WriteString(name + ":" + v + "|c")
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// Close 实现Sink
+func (s *statsdSink) Close() error {
+	return s.udp.close()
+}
+
+// StatsD各部分中不允许出现的字符替换为下划线
+var (
+	statsdNameEscaper   = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", " ", "_", "\n", "_")
+	dogstatsdTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+	telegrafTagEscaper  = strings.NewReplacer(",", "_", "=", "_", ":", "_", "|", "_", " ", "_", "\n", "_")
+)
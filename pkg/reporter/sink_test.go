@@ -0,0 +1,156 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+)
+
+// fakeSink 记录写出的批次，前failures次写出返回err
+type fakeSink struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	batches  [][]common.ReportRequest
+	closed   bool
+	written  chan struct{}
+}
+
+func newFakeSink(failures int, err error) *fakeSink {
+	return &fakeSink{failures: failures, err: err, written: make(chan struct{}, 100)}
+}
+
+func (f *fakeSink) Write(_ context.Context, batch []common.ReportRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	f.batches = append(f.batches, append([]common.ReportRequest(nil), batch...))
+	f.written <- struct{}{}
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeSink) records() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, batch := range f.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func testSinkConfig(name string) config.SinkConfig {
+	return config.SinkConfig{
+		Type:          config.SinkStdout,
+		Name:          name,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		QueueSize:     10,
+		Timeout:       time.Second,
+		RetryCount:    3,
+		RetryDelay:    200 * time.Millisecond,
+		MaxRetryDelay: time.Second,
+	}
+}
+
+func waitWritten(t *testing.T, sink *fakeSink, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-sink.written:
+	case <-time.After(timeout):
+		t.Fatal("sink did not receive a batch in time")
+	}
+}
+
+func TestSinkFanOutRetriesIndependently(t *testing.T) {
+	healthy := newFakeSink(0, nil)
+	flaky := newFakeSink(1, errors.New("connection refused"))
+
+	r := &Reporter{logger: newTestLogger(), agentID: "agent-a"}
+	r.sinks = []*sinkWorker{
+		newSinkWorker(testSinkConfig("healthy"), healthy, r.logger),
+		newSinkWorker(testSinkConfig("flaky"), flaky, r.logger),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, worker := range r.sinks {
+		wg.Add(1)
+		go func(w *sinkWorker) {
+			defer wg.Done()
+			w.run(ctx)
+		}(worker)
+	}
+
+	// 未启用http输出目标时只写出到各输出目标
+	for i := uint64(1); i <= 2; i++ {
+		if err := r.Report(common.NetworkMetrics{TotalConnections: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 另一个输出目标在退避等待时，健康的输出目标不受影响
+	waitWritten(t, healthy, 100*time.Millisecond)
+	if flaky.records() != 0 {
+		t.Fatal("flaky sink wrote before its retry delay")
+	}
+	waitWritten(t, flaky, 2*time.Second)
+
+	cancel()
+	wg.Wait()
+
+	if healthy.records() != 2 || flaky.records() != 2 {
+		t.Fatalf("records healthy=%d flaky=%d, want 2 each", healthy.records(), flaky.records())
+	}
+	stats := r.sinks[1].Stats()
+	if stats.Retries != 1 || stats.FailedRecords != 2 || stats.SentRecords != 2 || !stats.Healthy {
+		t.Fatalf("flaky stats = %+v, want one retry and recovered", stats)
+	}
+	if healthyStats := r.sinks[0].Stats(); healthyStats.Retries != 0 || healthyStats.SentRecords != 2 {
+		t.Fatalf("healthy stats = %+v", healthyStats)
+	}
+	if !healthy.closed || !flaky.closed {
+		t.Fatal("sinks were not closed on stop")
+	}
+}
+
+func TestSinkWorkerDropsOnPermanentErrorAndFullQueue(t *testing.T) {
+	sink := newFakeSink(1, &permanentError{err: errors.New("400 bad request")})
+	cfg := testSinkConfig("rejecting")
+	cfg.QueueSize = 1
+	worker := newSinkWorker(cfg, sink, newTestLogger())
+
+	// 不可重试的错误直接丢弃该批数据
+	worker.flush(context.Background(), []common.ReportRequest{{AgentID: "a"}, {AgentID: "b"}})
+	if stats := worker.Stats(); stats.Retries != 0 || stats.DroppedRecords != 2 || stats.Healthy {
+		t.Fatalf("stats after permanent error = %+v", stats)
+	}
+
+	// 队列满时只丢弃该输出目标的新数据
+	worker.Enqueue(common.ReportRequest{AgentID: "c"})
+	worker.Enqueue(common.ReportRequest{AgentID: "d"})
+	if stats := worker.Stats(); stats.QueueSize != 1 || stats.DroppedRecords != 3 {
+		t.Fatalf("stats after full queue = %+v", stats)
+	}
+
+	// 停止时写出队列中剩余的数据
+	worker.flushOnStop(nil)
+	if sink.records() != 1 || !sink.closed {
+		t.Fatalf("flushOnStop wrote %d records, closed=%v", sink.records(), sink.closed)
+	}
+}
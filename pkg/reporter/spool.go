@@ -0,0 +1,450 @@
+package reporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// spoolSegmentExt 段文件扩展名
+const spoolSegmentExt = ".spool"
+
+// SpoolOptions 磁盘缓存参数
+type SpoolOptions struct {
+	Dir          string        // 缓存目录
+	MaxBytes     int64         // 总大小上限
+	MaxAge       time.Duration // 最长保留时间
+	SegmentBytes int64         // 单个段文件大小
+}
+
+// SpoolStats 磁盘缓存统计
+type SpoolStats struct {
+	Depth    int    // 待重放的条目数
+	Bytes    int64  // 占用的磁盘空间
+	Segments int    // 段文件数
+	Dropped  uint64 // 因大小或时间上限丢弃的条目数
+}
+
+// SpoolEntry 缓存条目，每行一个JSON
+// 保存写入时所属运行的累计计数起始时间和上报模式，Agent重启后重放时仍按原来的运行构建报告
+type SpoolEntry struct {
+	SpooledAt   time.Time             `json:"spooled_at"`
+	StartupTime time.Time             `json:"startup_time,omitempty"`
+	ReportMode  string                `json:"report_mode,omitempty"`
+	Metrics     common.NetworkMetrics `json:"metrics"`
+}
+
+// spoolSegment 段文件元数据
+type spoolSegment struct {
+	seq     uint64
+	path    string
+	size    int64
+	entries int
+	modTime time.Time
+}
+
+// Spool 上报数据的磁盘缓存（按段追加写入的顺序队列）
+// 发送失败或队列溢出的数据写入缓存，Server恢复后按写入顺序重放
+type Spool struct {
+	opts   SpoolOptions
+	logger *logrus.Logger
+
+	mu        sync.Mutex
+	segments  []*spoolSegment // 按序号从旧到新排列
+	active    *os.File        // 当前追加写入的段（最后一个段）
+	replaying *spoolSegment   // 正在重放的段，不参与上限淘汰
+	nextSeq   uint64
+	depth     int
+	bytes     int64
+	dropped   uint64
+}
+
+// OpenSpool 打开磁盘缓存，加载目录中已有的段文件
+func OpenSpool(opts SpoolOptions, logger *logrus.Logger) (*Spool, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+
+	s := &Spool{
+		opts:    opts,
+		logger:  logger,
+		nextSeq: 1,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.enforceLimitsLocked()
+	s.mu.Unlock()
+
+	if s.depth > 0 {
+		logger.WithFields(logrus.Fields{
+			"dir":      opts.Dir,
+			"depth":    s.depth,
+			"segments": len(s.segments),
+		}).Info("发现未重放的缓存数据")
+	}
+
+	return s, nil
+}
+
+// load 扫描缓存目录
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("读取缓存目录失败: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(s.opts.Dir, name)
+		entries, err := countLines(path)
+		if err != nil {
+			s.logger.WithError(err).WithField("file", path).Warn("读取缓存段失败，跳过")
+			continue
+		}
+
+		s.segments = append(s.segments, &spoolSegment{
+			seq:     seq,
+			path:    path,
+			size:    info.Size(),
+			entries: entries,
+			modTime: info.ModTime(),
+		})
+		s.depth += entries
+		s.bytes += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+
+	return nil
+}
+
+// Append 追加一条数据，SpooledAt为零值时使用当前时间
+func (s *Spool) Append(entry SpoolEntry) error {
+	if entry.SpooledAt.IsZero() {
+		entry.SpooledAt = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化缓存数据失败: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 当前段写满时切换到新段
+	if s.active != nil {
+		last := s.segments[len(s.segments)-1]
+		if last.size > 0 && last.size+int64(len(data)) > s.opts.SegmentBytes {
+			s.closeActiveLocked()
+		}
+	}
+
+	if s.active == nil {
+		if err := s.openSegmentLocked(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.active.Write(data); err != nil {
+		return fmt.Errorf("写入缓存失败: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("同步缓存文件失败: %w", err)
+	}
+
+	last := s.segments[len(s.segments)-1]
+	last.size += int64(len(data))
+	last.entries++
+	last.modTime = time.Now()
+	s.depth++
+	s.bytes += int64(len(data))
+
+	s.enforceLimitsLocked()
+	return nil
+}
+
+// Replay 按写入顺序重放缓存数据，send返回错误时停止并保留未发送的数据
+func (s *Spool) Replay(send func(entry SpoolEntry) error) (int, error) {
+	replayed := 0
+
+	for {
+		s.mu.Lock()
+		s.enforceLimitsLocked()
+		if len(s.segments) == 0 {
+			s.mu.Unlock()
+			return replayed, nil
+		}
+
+		seg := s.segments[0]
+		// 重放当前写入的段前先关闭它，之后的数据写入新段
+		if s.active != nil && seg == s.segments[len(s.segments)-1] {
+			s.closeActiveLocked()
+		}
+		s.replaying = seg
+		s.mu.Unlock()
+
+		entries, err := s.readSegment(seg.path)
+		if err != nil {
+			s.logger.WithError(err).WithField("file", seg.path).Error("读取缓存段失败，丢弃该段")
+			s.mu.Lock()
+			s.dropped += uint64(seg.entries)
+			s.removeSegmentLocked(seg)
+			s.mu.Unlock()
+			continue
+		}
+
+		for i, entry := range entries {
+			if s.opts.MaxAge > 0 && time.Since(entry.SpooledAt) > s.opts.MaxAge {
+				s.mu.Lock()
+				s.dropped++
+				s.mu.Unlock()
+				continue
+			}
+
+			if err := send(entry); err != nil {
+				s.mu.Lock()
+				if rewriteErr := s.rewriteSegmentLocked(seg, entries[i:]); rewriteErr != nil {
+					s.logger.WithError(rewriteErr).Error("更新缓存段失败，已发送的数据可能被重复发送")
+				}
+				s.replaying = nil
+				s.mu.Unlock()
+				return replayed, err
+			}
+			replayed++
+		}
+
+		s.mu.Lock()
+		s.removeSegmentLocked(seg)
+		s.mu.Unlock()
+	}
+}
+
+// Len 获取待重放的条目数
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Stats 获取缓存统计
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SpoolStats{
+		Depth:    s.depth,
+		Bytes:    s.bytes,
+		Segments: len(s.segments),
+		Dropped:  s.dropped,
+	}
+}
+
+// Close 关闭缓存
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeActiveLocked()
+	return nil
+}
+
+// openSegmentLocked 创建新的段文件
+func (s *Spool) openSegmentLocked() error {
+	seq := s.nextSeq
+	path := filepath.Join(s.opts.Dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("创建缓存段失败: %w", err)
+	}
+
+	s.nextSeq++
+	s.active = file
+	s.segments = append(s.segments, &spoolSegment{
+		seq:     seq,
+		path:    path,
+		modTime: time.Now(),
+	})
+	return nil
+}
+
+// closeActiveLocked 关闭当前写入的段
+func (s *Spool) closeActiveLocked() {
+	if s.active == nil {
+		return
+	}
+	if err := s.active.Close(); err != nil {
+		s.logger.WithError(err).Warn("关闭缓存段失败")
+	}
+	s.active = nil
+}
+
+// removeSegmentLocked 删除段文件
+func (s *Spool) removeSegmentLocked(seg *spoolSegment) {
+	if s.replaying == seg {
+		s.replaying = nil
+	}
+
+	for i, candidate := range s.segments {
+		if candidate != seg {
+			continue
+		}
+
+		if s.active != nil && i == len(s.segments)-1 {
+			s.closeActiveLocked()
+		}
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			s.logger.WithError(err).WithField("file", seg.path).Warn("删除缓存段失败")
+		}
+
+		s.depth -= seg.entries
+		s.bytes -= seg.size
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		return
+	}
+}
+
+// rewriteSegmentLocked 用剩余的条目原子替换段文件
+func (s *Spool) rewriteSegmentLocked(seg *spoolSegment, remaining []SpoolEntry) error {
+	tmp := seg.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	var size int64
+	for _, entry := range remaining {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		data = append(data, '\n')
+		writer.Write(data)
+		size += int64(len(data))
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, seg.path); err != nil {
+		return err
+	}
+
+	s.depth += len(remaining) - seg.entries
+	s.bytes += size - seg.size
+	seg.entries = len(remaining)
+	seg.size = size
+	return nil
+}
+
+// enforceLimitsLocked 丢弃超过保留时间或超出大小上限的最旧段
+func (s *Spool) enforceLimitsLocked() {
+	for len(s.segments) > 0 {
+		oldest := s.segments[0]
+		if oldest == s.replaying {
+			return
+		}
+
+		expired := s.opts.MaxAge > 0 && time.Since(oldest.modTime) > s.opts.MaxAge
+		oversized := s.opts.MaxBytes > 0 && s.bytes > s.opts.MaxBytes
+		if !expired && !oversized {
+			return
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"file":    oldest.path,
+			"entries": oldest.entries,
+			"expired": expired,
+		}).Warn("缓存超出上限，丢弃最旧的数据")
+
+		s.dropped += uint64(oldest.entries)
+		s.removeSegmentLocked(oldest)
+	}
+}
+
+// readSegment 读取段文件中的所有条目，跳过损坏的行（如崩溃时写了一半的行）
+func (s *Spool) readSegment(path string) ([]SpoolEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []SpoolEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		var entry SpoolEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			s.logger.WithError(err).WithField("file", path).Warn("跳过损坏的缓存条目")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// countLines 统计段文件中的条目数
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			count++
+		}
+	}
+
+	return count, scanner.Err()
+}
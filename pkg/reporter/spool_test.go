@@ -0,0 +1,232 @@
+package reporter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/internal/config"
+	"go-net-monitoring/pkg/cardinality"
+)
+
+func openTestSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+
+	spool, err := OpenSpool(SpoolOptions{Dir: dir, SegmentBytes: 1 << 20}, newTestLogger())
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	t.Cleanup(func() { spool.Close() })
+	return spool
+}
+
+func appendSeq(t *testing.T, spool *Spool, seqs ...uint64) {
+	t.Helper()
+
+	for _, seq := range seqs {
+		if err := spool.Append(SpoolEntry{Metrics: common.NetworkMetrics{TotalConnections: seq}}); err != nil {
+			t.Fatalf("Append(%d): %v", seq, err)
+		}
+	}
+}
+
+func replayAll(t *testing.T, spool *Spool) []uint64 {
+	t.Helper()
+
+	var got []uint64
+	if _, err := spool.Replay(func(entry SpoolEntry) error {
+		got = append(got, entry.Metrics.TotalConnections)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return got
+}
+
+func equalSeq(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpoolReplaySkipsPartiallyWrittenEntry(t *testing.T) {
+	dir := t.TempDir()
+
+	spool := openTestSpool(t, dir)
+	appendSeq(t, spool, 1, 2, 3)
+	spool.Close()
+
+	// 模拟写入最后一行时崩溃：段文件末尾是没有换行的半行JSON
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("expected one segment, got %v (%v)", segments, err)
+	}
+	file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"spooled_at":"2026-01-01T00:00:00Z","metrics":{"total_conn`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	spool = openTestSpool(t, dir)
+	appendSeq(t, spool, 4)
+
+	if got, want := replayAll(t, spool), []uint64{1, 2, 3, 4}; !equalSeq(got, want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+	if spool.Len() != 0 {
+		t.Fatalf("Len() = %d after replay, want 0", spool.Len())
+	}
+	if stats := spool.Stats(); stats.Segments != 0 || stats.Bytes != 0 {
+		t.Fatalf("stats after replay = %+v, want empty", stats)
+	}
+}
+
+func TestSpoolReplayResumesAfterSendFailure(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir())
+	appendSeq(t, spool, 1, 2, 3, 4, 5)
+
+	var sent []uint64
+	replayed, err := spool.Replay(func(entry SpoolEntry) error {
+		if entry.Metrics.TotalConnections == 3 {
+			return errors.New("server unavailable")
+		}
+		sent = append(sent, entry.Metrics.TotalConnections)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Replay returned nil error after send failure")
+	}
+	if replayed != 2 || !equalSeq(sent, []uint64{1, 2}) {
+		t.Fatalf("replayed %d %v before failure, want 2 [1 2]", replayed, sent)
+	}
+	if spool.Len() != 3 {
+		t.Fatalf("Len() = %d after partial replay, want 3", spool.Len())
+	}
+
+	// 新数据写入新段，排在未发送的数据之后
+	appendSeq(t, spool, 6)
+	if got, want := replayAll(t, spool), []uint64{3, 4, 5, 6}; !equalSeq(got, want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+}
+
+func TestSpoolReopenKeepsPendingEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	spool := openTestSpool(t, dir)
+	appendSeq(t, spool, 1, 2)
+	spool.Close()
+
+	spool = openTestSpool(t, dir)
+	if spool.Len() != 2 {
+		t.Fatalf("Len() = %d after reopen, want 2", spool.Len())
+	}
+	appendSeq(t, spool, 3)
+	if got, want := replayAll(t, spool), []uint64{1, 2, 3}; !equalSeq(got, want) {
+		t.Fatalf("replayed %v, want %v", got, want)
+	}
+}
+
+// newSpoolReporter 创建使用dir下磁盘缓存的Reporter，模拟一次Agent运行
+func newSpoolReporter(t *testing.T, dir, serverURL string, startup time.Time) *Reporter {
+	t.Helper()
+
+	r, err := NewReporter(&config.ReporterConfig{
+		ServerURL:  serverURL,
+		Timeout:    time.Second,
+		RetryDelay: time.Second,
+		BatchSize:  1,
+		AgentID:    "agent-test",
+		StateDir:   dir,
+		Spool: config.SpoolConfig{
+			Enabled:      true,
+			Dir:          filepath.Join(dir, "spool"),
+			SegmentBytes: 1 << 20,
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("NewReporter: %v", err)
+	}
+	r.SetReportInfo(ReportInfo{StartupTime: startup})
+	t.Cleanup(func() { r.spool.Close() })
+	return r
+}
+
+func TestSpoolReplayAcrossRestartKeepsOriginalRun(t *testing.T) {
+	var received []common.ReportRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var request common.ReportRequest
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		received = append(received, request)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	firstStartup := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	secondStartup := firstStartup.Add(time.Hour)
+
+	// 第一次运行：Server不可用，两次上报写入磁盘缓存
+	first := newSpoolReporter(t, dir, "http://127.0.0.1:1/api/v1/metrics", firstStartup)
+	first.spoolMetrics(common.NetworkMetrics{TotalConnections: 10})
+	first.spoolMetrics(common.NetworkMetrics{TotalConnections: 25})
+	first.spool.Close()
+
+	// 第二次运行（未启用持久化，计数从零开始）：先按顺序重放上一次运行的数据
+	second := newSpoolReporter(t, dir, server.URL, secondStartup)
+	second.replaySpool()
+	if len(received) != 2 {
+		t.Fatalf("replayed %d reports, want 2", len(received))
+	}
+
+	// 新进程没有上一次运行的增量基准，第一条按累计值发送
+	if got := received[0].Report; !got.StartupTime.Equal(firstStartup) || got.ReportMode != common.ReportModeCumulative ||
+		got.TotalStats[cardinality.Other].ConnectionCount != 10 || len(got.DeltaStats) != 0 {
+		t.Fatalf("first replayed report = %+v, want cumulative total 10 from the first run", got)
+	}
+	if got := received[1].Report; !got.StartupTime.Equal(firstStartup) || got.ReportMode != common.ReportModeIncremental ||
+		got.DeltaStats[cardinality.Other].ConnectionCount != 15 {
+		t.Fatalf("second replayed report = %+v, want delta 15 from the first run", got)
+	}
+
+	// 重放完成后，本次运行的数据使用本次的启动时间，整体作为增量
+	live := second.buildMetricsReport(common.NetworkMetrics{TotalConnections: 4}, nil)
+	if !live.StartupTime.Equal(secondStartup) || live.DeltaStats[cardinality.Other].ConnectionCount != 4 {
+		t.Fatalf("live report = %+v, want delta 4 from the second run", live)
+	}
+}
+
+func TestSpoolReplayBelowRestoredBaselineSendsTotals(t *testing.T) {
+	startup := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newSpoolReporter(t, t.TempDir(), "http://127.0.0.1:1/api/v1/metrics", startup)
+
+	// 启用持久化时启动时间不变，恢复的计数（30）已包含缓存中尚未发送的数据
+	r.SetBaseline(startup, common.NetworkMetrics{TotalConnections: 30})
+	entry := SpoolEntry{SpooledAt: startup.Add(time.Minute), StartupTime: startup, Metrics: common.NetworkMetrics{TotalConnections: 10}}
+
+	report := r.buildMetricsReport(entry.Metrics, &entry)
+	if report.ReportMode != common.ReportModeCumulative || report.TotalStats[cardinality.Other].ConnectionCount != 10 {
+		t.Fatalf("report = %+v, want cumulative total 10", report)
+	}
+	if !report.ReportTime.Equal(entry.SpooledAt) {
+		t.Fatalf("ReportTime = %v, want spooled time %v", report.ReportTime, entry.SpooledAt)
+	}
+}
@@ -0,0 +1,331 @@
+package reporter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/common"
+	"go-net-monitoring/pkg/api/netmonv1"
+	"go-net-monitoring/pkg/auth"
+	"go-net-monitoring/pkg/codec"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// CommandHandler 处理Server通过gRPC流下发的命令
+type CommandHandler func(cmdType string, args map[string]string) error
+
+// errStreamClosed 等待确认时流已断开
+var errStreamClosed = errors.New("gRPC流已断开")
+
+// streamClient gRPC双向流客户端
+// 首次发送时建立流，流断开后在下一次发送时重连；每条消息分配递增序号并等待Server的确认
+type streamClient struct {
+	conn      *grpc.ClientConn
+	client    netmonv1.AgentStreamClient
+	callOpts  []grpc.CallOption
+	identity  func() (agentID, hostname string)
+	onCommand func(cmd *netmonv1.Command) *netmonv1.CommandResult
+	logger    *logrus.Logger
+
+	// 认证：credentials提供连接时携带的API Key，sign时同时对建立连接签名，Server拒绝时调用onUnauthenticated
+	credentials       func() (string, error)
+	sign              bool
+	onUnauthenticated func()
+
+	mu      sync.Mutex
+	stream  netmonv1.AgentStream_ConnectClient
+	cancel  context.CancelFunc
+	seq     uint64
+	pending map[uint64]chan *netmonv1.Ack
+
+	sendMu sync.Mutex // gRPC流不允许并发Send
+}
+
+// newStreamClient 创建gRPC流客户端（不会立即建立连接）
+func newStreamClient(addr string, tlsConfig *tls.Config, compression string, logger *logrus.Logger) (*streamClient, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("创建gRPC客户端失败: %w", err)
+	}
+
+	var callOpts []grpc.CallOption
+	switch compression {
+	case codec.EncodingGzip:
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	case codec.EncodingZstd:
+		logger.Warn("gRPC传输不支持zstd压缩，改用gzip")
+		callOpts = append(callOpts, grpc.UseCompressor(gzip.Name))
+	}
+
+	return &streamClient{
+		conn:     conn,
+		client:   netmonv1.NewAgentStreamClient(conn),
+		callOpts: callOpts,
+		logger:   logger,
+		pending:  make(map[uint64]chan *netmonv1.Ack),
+	}, nil
+}
+
+// Send 发送消息并等待确认
+func (c *streamClient) Send(ctx context.Context, msg *netmonv1.AgentMessage, timeout time.Duration) (*netmonv1.Ack, error) {
+	stream, err := c.ensureStream()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.seq++
+	msg.Seq = c.seq
+	ackChan := make(chan *netmonv1.Ack, 1)
+	c.pending[msg.Seq] = ackChan
+	c.mu.Unlock()
+
+	c.sendMu.Lock()
+	err = stream.Send(msg)
+	c.sendMu.Unlock()
+	if err != nil {
+		c.resetStream(stream, err)
+		return nil, fmt.Errorf("发送gRPC流消息失败: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case ack, ok := <-ackChan:
+		if !ok {
+			return nil, errStreamClosed
+		}
+		if !ack.GetSuccess() {
+			return ack, fmt.Errorf("服务器返回错误: %s", ack.GetMessage())
+		}
+		return ack, nil
+	case <-timer.C:
+		c.dropPending(msg.Seq)
+		return nil, fmt.Errorf("等待确认超时 (seq=%d)", msg.Seq)
+	case <-ctx.Done():
+		c.dropPending(msg.Seq)
+		return nil, ctx.Err()
+	}
+}
+
+// ensureStream 获取当前的流，不存在时建立新流
+func (c *streamClient) ensureStream() (netmonv1.AgentStream_ConnectClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stream != nil {
+		return c.stream, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if c.identity != nil {
+		agentID, hostname := c.identity()
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-id", agentID, "x-hostname", hostname)
+	}
+	if c.credentials != nil {
+		apiKey, err := c.credentials()
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("认证失败: %w", err)
+		}
+		if apiKey != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+apiKey)
+			if c.sign {
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				nonce := auth.GenerateNonce()
+				signature := auth.Sign(auth.SigningKey(apiKey), auth.StreamSignMethod, netmonv1.AgentStream_Connect_FullMethodName, timestamp, nonce, nil)
+				ctx = metadata.AppendToOutgoingContext(ctx,
+					strings.ToLower(auth.HeaderTimestamp), timestamp,
+					strings.ToLower(auth.HeaderNonce), nonce,
+					strings.ToLower(auth.HeaderSignature), signature)
+			}
+		}
+	}
+
+	stream, err := c.client.Connect(ctx, c.callOpts...)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("建立gRPC流失败: %w", err)
+	}
+
+	c.stream = stream
+	c.cancel = cancel
+	go c.recvLoop(stream)
+
+	c.logger.Debug("gRPC流已建立")
+	return stream, nil
+}
+
+// recvLoop 接收Server的确认和命令，流断开后退出
+func (c *streamClient) recvLoop(stream netmonv1.AgentStream_ConnectClient) {
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) == codes.Unauthenticated && c.onUnauthenticated != nil {
+				c.onUnauthenticated()
+			}
+			c.resetStream(stream, err)
+			return
+		}
+
+		switch payload := msg.GetPayload().(type) {
+		case *netmonv1.ServerMessage_Ack:
+			c.mu.Lock()
+			ackChan, ok := c.pending[payload.Ack.GetSeq()]
+			delete(c.pending, payload.Ack.GetSeq())
+			c.mu.Unlock()
+			if ok {
+				ackChan <- payload.Ack
+			}
+
+		case *netmonv1.ServerMessage_Command:
+			go c.handleCommand(payload.Command)
+		}
+	}
+}
+
+// handleCommand 执行命令并回传结果
+func (c *streamClient) handleCommand(cmd *netmonv1.Command) {
+	c.logger.WithFields(logrus.Fields{
+		"command_id": cmd.GetId(),
+		"type":       cmd.GetType(),
+	}).Info("收到Server命令")
+
+	result := &netmonv1.CommandResult{CommandId: cmd.GetId(), Success: true}
+	if c.onCommand != nil {
+		result = c.onCommand(cmd)
+	}
+
+	msg := &netmonv1.AgentMessage{
+		Payload: &netmonv1.AgentMessage_CommandResult{CommandResult: result},
+	}
+	if _, err := c.Send(context.Background(), msg, 10*time.Second); err != nil {
+		c.logger.WithError(err).WithField("command_id", cmd.GetId()).Warn("回传命令结果失败")
+	}
+}
+
+// resetStream 流出错时关闭它，并通知所有等待确认的发送方
+func (c *streamClient) resetStream(stream netmonv1.AgentStream_ConnectClient, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stream != stream {
+		return
+	}
+
+	c.logger.WithError(err).Debug("gRPC流已断开，下次发送时重连")
+	c.cancel()
+	c.stream = nil
+	c.cancel = nil
+	for seq, ackChan := range c.pending {
+		close(ackChan)
+		delete(c.pending, seq)
+	}
+}
+
+// dropPending 放弃等待确认
+func (c *streamClient) dropPending(seq uint64) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+// Connected 流是否已建立
+func (c *streamClient) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stream != nil
+}
+
+// Close 关闭流和连接
+func (c *streamClient) Close() error {
+	c.mu.Lock()
+	if c.stream != nil {
+		c.sendMu.Lock()
+		c.stream.CloseSend()
+		c.sendMu.Unlock()
+		c.cancel()
+		c.stream = nil
+	}
+	c.mu.Unlock()
+
+	return c.conn.Close()
+}
+
+// sendStreamReport 通过gRPC流发送上报数据
+func (r *Reporter) sendStreamReport(request common.ReportRequest) error {
+	msg := &netmonv1.AgentMessage{
+		Payload: &netmonv1.AgentMessage_Report{Report: codec.ReportRequestToProto(&request)},
+	}
+
+	_, err := r.stream.Send(r.ctx, msg, r.getConfig().Timeout)
+	return err
+}
+
+// SetCommandHandler 设置Server下发命令的处理函数（仅gRPC传输）
+// replay_spool 由上报器自身处理，其余命令交给handler
+func (r *Reporter) SetCommandHandler(handler CommandHandler) {
+	r.mu.Lock()
+	r.commandHandler = handler
+	r.mu.Unlock()
+}
+
+// executeCommand 执行Server下发的命令
+func (r *Reporter) executeCommand(cmd *netmonv1.Command) *netmonv1.CommandResult {
+	result := &netmonv1.CommandResult{CommandId: cmd.GetId(), Success: true}
+
+	var err error
+	switch cmd.GetType() {
+	case "replay_spool":
+		// 与熔断恢复相同：发送待重试数据并重放磁盘缓存
+		select {
+		case r.resumeChan <- struct{}{}:
+		default:
+		}
+	default:
+		r.mu.Lock()
+		handler := r.commandHandler
+		r.mu.Unlock()
+
+		if handler == nil {
+			err = fmt.Errorf("不支持的命令: %s", cmd.GetType())
+		} else {
+			err = handler(cmd.GetType(), cmd.GetArgs())
+		}
+	}
+
+	if err != nil {
+		result.Success = false
+		result.Message = err.Error()
+		r.logger.WithError(err).WithField("type", cmd.GetType()).Warn("执行Server命令失败")
+	}
+	return result
+}
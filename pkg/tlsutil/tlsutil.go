@@ -0,0 +1,259 @@
+// Package tlsutil 提供Agent与Server共用的TLS配置：证书和CA文件轮换后自动重新加载，并从客户端证书中解析Agent身份
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-net-monitoring/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reloadCheckInterval 检查证书文件是否变更的最小间隔（在TLS握手时检查）
+const reloadCheckInterval = 10 * time.Second
+
+// Reloader 持有证书、私钥和CA，文件修改时间变化后在下一次握手时重新加载
+// 重新加载失败时继续使用之前的证书并记录日志
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	logger   *logrus.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  [3]time.Time // cert、key、ca
+	lastCheck time.Time
+}
+
+// NewReloader 加载证书和CA，certFile/keyFile或caFile可以为空
+func NewReloader(certFile, keyFile, caFile string, logger *logrus.Logger) (*Reloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("证书和私钥必须同时配置")
+	}
+
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		logger:   logger,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load 读取全部文件
+func (r *Reloader) load() error {
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("加载TLS证书失败: %w", err)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		data, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("读取CA文件失败: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("CA文件中没有有效的PEM证书: %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.modTimes = r.statAll()
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// statAll 获取文件修改时间（文件不存在时为零值）
+func (r *Reloader) statAll() [3]time.Time {
+	var times [3]time.Time
+	for i, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// maybeReload 距上次检查超过reloadCheckInterval且文件有变化时重新加载
+func (r *Reloader) maybeReload() {
+	r.mu.Lock()
+	if time.Since(r.lastCheck) < reloadCheckInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	changed := r.statAll() != r.modTimes
+	r.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	// 证书和私钥可能不是同时写入，加载失败时保留旧证书，下次检查时重试
+	if err := r.load(); err != nil {
+		r.logger.WithError(err).Warn("重新加载TLS证书失败，继续使用当前证书")
+		r.mu.Lock()
+		r.modTimes = [3]time.Time{}
+		r.mu.Unlock()
+		return
+	}
+
+	fields := logrus.Fields{"cert": r.certFile, "ca": r.caFile}
+	if leaf := r.leaf(); leaf != nil {
+		fields["not_after"] = leaf.NotAfter
+	}
+	r.logger.WithFields(fields).Info("TLS证书已重新加载")
+}
+
+// leaf 当前证书的叶子证书
+func (r *Reloader) leaf() *x509.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.cert == nil {
+		return nil
+	}
+	if r.cert.Leaf != nil {
+		return r.cert.Leaf
+	}
+	leaf, err := x509.ParseCertificate(r.cert.Certificate[0])
+	if err != nil {
+		return nil
+	}
+	return leaf
+}
+
+// current 获取当前证书和CA
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.maybeReload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+// ServerConfig 创建Server端TLS配置，每次握手使用最新的证书和客户端CA
+func (r *Reloader) ServerConfig(clientAuth string) (*tls.Config, error) {
+	authType, err := parseClientAuth(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if r.certFile == "" {
+		return nil, errors.New("Server启用TLS时必须配置证书和私钥")
+	}
+	if authType != tls.NoClientCert && r.caFile == "" {
+		return nil, errors.New("校验客户端证书时必须配置CA文件")
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, pool := r.current()
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.Certificates = []tls.Certificate{*cert}
+		cfg.ClientAuth = authType
+		cfg.ClientCAs = pool
+		return cfg, nil
+	}
+	return base, nil
+}
+
+// ClientConfig 创建客户端TLS配置：使用最新的客户端证书，按最新的CA（未配置时使用系统CA）校验Server证书
+// serverName为空时使用连接地址中的主机名
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+	}
+
+	if r.caFile != "" {
+		// 标准校验只能使用固定的RootCAs，为支持CA轮换改为在VerifyConnection中按当前CA校验
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyServer(state, pool)
+		}
+	}
+	return cfg
+}
+
+// verifyServer 按CA和ServerName校验Server证书链
+func verifyServer(state tls.ConnectionState, pool *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("Server没有提供证书")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       state.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// parseClientAuth 转换客户端证书校验方式
+func parseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(mode) {
+	case "", config.ClientAuthNone:
+		return tls.NoClientCert, nil
+	case config.ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case config.ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("client_auth 必须是 none、optional 或 require: %s", mode)
+	}
+}
+
+// PeerIdentities 返回已验证的客户端证书中可作为Agent ID的名称：CN、DNS SAN和URI SAN
+// 第一个为证书映射的Agent ID（CN，为空时为第一个SAN）；没有已验证的证书时返回nil
+func PeerIdentities(state *tls.ConnectionState) []string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := state.VerifiedChains[0][0]
+	var names []string
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
@@ -0,0 +1,257 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// testCA 测试用CA，签发的证书写入临时目录
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "netmon-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+// writeCA 写入CA证书文件
+func (ca *testCA) writeCA(t *testing.T, path string) {
+	t.Helper()
+	writePEM(t, path, "CERTIFICATE", ca.der)
+}
+
+// issue 签发证书并写入certFile和keyFile
+func (ca *testCA) issue(t *testing.T, certFile, keyFile string, tmpl *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touch 把文件修改时间推后，模拟证书轮换
+func touch(t *testing.T, offset time.Duration, paths ...string) {
+	t.Helper()
+	when := time.Now().Add(offset)
+	for _, path := range paths {
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// expireCheck 让下一次握手立即检查文件变更
+func (r *Reloader) expireCheck() {
+	r.mu.Lock()
+	r.lastCheck = time.Time{}
+	r.mu.Unlock()
+}
+
+func TestReloaderReloadsOnModTimeChange(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	ca := newTestCA(t)
+	ca.issue(t, certFile, keyFile, &x509.Certificate{Subject: pkix.Name{CommonName: "server-v1"}})
+
+	r, err := NewReloader(certFile, keyFile, "", newTestLogger())
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	if leaf := r.leaf(); leaf == nil || leaf.Subject.CommonName != "server-v1" {
+		t.Fatalf("initial leaf = %v, want server-v1", leaf)
+	}
+
+	// 检查间隔内不重新加载
+	ca.issue(t, certFile, keyFile, &x509.Certificate{Subject: pkix.Name{CommonName: "server-v2"}})
+	touch(t, time.Minute, certFile, keyFile)
+	r.current()
+	if cn := r.leaf().Subject.CommonName; cn != "server-v1" {
+		t.Fatalf("reloaded within check interval: %s", cn)
+	}
+
+	r.expireCheck()
+	r.current()
+	if cn := r.leaf().Subject.CommonName; cn != "server-v2" {
+		t.Fatalf("leaf after rotation = %s, want server-v2", cn)
+	}
+
+	// 只写了一半的证书加载失败时保留当前证书，修复后下次检查重新加载
+	if err := os.WriteFile(keyFile, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, 2*time.Minute, keyFile)
+	r.expireCheck()
+	r.current()
+	if cn := r.leaf().Subject.CommonName; cn != "server-v2" {
+		t.Fatalf("broken rotation replaced certificate: %s", cn)
+	}
+
+	ca.issue(t, certFile, keyFile, &x509.Certificate{Subject: pkix.Name{CommonName: "server-v3"}})
+	r.expireCheck()
+	r.current()
+	if cn := r.leaf().Subject.CommonName; cn != "server-v3" {
+		t.Fatalf("leaf after fixed rotation = %s, want server-v3", cn)
+	}
+}
+
+func TestNewReloaderRequiresKeyPair(t *testing.T) {
+	if _, err := NewReloader("server.crt", "", "", newTestLogger()); err == nil {
+		t.Fatal("certificate without key should be rejected")
+	}
+	if _, err := NewReloader("", "", filepath.Join(t.TempDir(), "missing.crt"), newTestLogger()); err == nil {
+		t.Fatal("missing CA file should be rejected")
+	}
+}
+
+func TestPeerIdentities(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://netmon/agent/edge-01")
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "edge-01"},
+		DNSNames: []string{"edge-01.example.com"},
+		URIs:     []*url.URL{spiffe},
+	}
+	sanOnly := &x509.Certificate{DNSNames: []string{"edge-02"}}
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		want  []string
+	}{
+		{"no tls", nil, nil},
+		{"unverified peer", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, nil},
+		{"cn first then sans", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+			[]string{"edge-01", "edge-01.example.com", "spiffe://netmon/agent/edge-01"}},
+		{"san when cn is empty", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{sanOnly}}}, []string{"edge-02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PeerIdentities(tt.state); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("PeerIdentities = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutualTLSHandshakeMapsClientIdentity(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	ca := newTestCA(t)
+	ca.writeCA(t, path("ca.crt"))
+	ca.issue(t, path("server.crt"), path("server.key"), &x509.Certificate{
+		Subject: pkix.Name{CommonName: "netmon-server"}, DNSNames: []string{"netmon-server"},
+	})
+	ca.issue(t, path("agent.crt"), path("agent.key"), &x509.Certificate{Subject: pkix.Name{CommonName: "agent-a"}})
+
+	serverReloader, err := NewReloader(path("server.crt"), path("server.key"), path("ca.crt"), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg, err := serverReloader.ServerConfig("require")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientReloader, err := NewReloader(path("agent.crt"), path("agent.key"), path("ca.crt"), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	identities := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			identities <- nil
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			identities <- nil
+			return
+		}
+		state := tlsConn.ConnectionState()
+		identities <- PeerIdentities(&state)
+	}()
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", ln.Addr().String(), clientReloader.ClientConfig("netmon-server"))
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	defer conn.Close()
+
+	if got := <-identities; !reflect.DeepEqual(got, []string{"agent-a"}) {
+		t.Fatalf("server saw identities %v, want [agent-a]", got)
+	}
+}